@@ -12,7 +12,7 @@ import (
 const (
 	traceOptionDesc      = "The tracing is enabled when this `function` is called and then disabled when returned."
 	tracelevelOptionDesc = "Functions are traced if the stack depth is within this `tracelevel`. The stack depth here is based on the point the tracing is enabled."
-	parselevelOptionDesc = "The trace log includes the function's args. The `parselevel` option determines how detailed these values should be."
+	parselevelOptionDesc = "The trace log includes the function's args. The `parselevel` option determines how detailed these values should be. If 0, the args are not read at all."
 	verboseOptionDesc    = "Show the debug-level message"
 )
 
@@ -2,11 +2,22 @@ package debugapi
 
 import (
 	"fmt"
+	"syscall"
+	"time"
 )
 
+// terminateTimeout is the max time to wait for the process to exit after the kill signal other than SIGKILL is sent.
+// The process is killed by SIGKILL if it doesn't exit in time, for example, because the signal is handled and ignored.
+const terminateTimeout = 5 * time.Second
+
 // client is the client interface to control the tracee process.
 // It's still unstable and so do not export it.
 type client interface {
+	// SetEnv and SetWorkingDir set the environment variables and working directory of the process launched next.
+	SetEnv(env []string)
+	SetWorkingDir(dir string)
+	// SetKillSignal sets the signal sent to the launched process when it's killed on detach.
+	SetKillSignal(sig syscall.Signal)
 	// LaunchProcess launches the new prcoess.
 	LaunchProcess(name string, arg ...string) error
 	// AttachProcess attaches to the existing process.
@@ -17,11 +28,13 @@ type client interface {
 	ReadRegisters(threadID int) (Registers, error)
 	WriteRegisters(threadID int, regs Registers) error
 	ReadTLS(threadID int, offset int32) (uint64, error)
+	// SetPC sets the program counter of the thread. The other registers are not changed.
+	SetPC(threadID int, addr uint64) error
 	ContinueAndWait() (Event, error)
 	StepAndWait(threadID int) (Event, error)
 }
 
-// EventType represents the type of the event.
+// EventType represents the type of the event. See the Event's Data field for the data associated with each type.
 type EventType int
 
 const (
@@ -33,13 +46,45 @@ const (
 	EventTypeExited
 	// EventTypeTerminated event happens when the process is terminated by a signal.
 	EventTypeTerminated
+	// EventTypeExec event happens when the process executes a new program (e.g. syscall.Exec).
+	// The process is still alive, but the addresses and breakpoints of the old program are no longer valid.
+	EventTypeExec
 )
 
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventTypeTrapped:
+		return "trapped"
+	case EventTypeCoreDump:
+		return "core dump"
+	case EventTypeExited:
+		return "exited"
+	case EventTypeTerminated:
+		return "terminated"
+	case EventTypeExec:
+		return "exec"
+	default:
+		return fmt.Sprintf("unknown event type (%d)", int(t))
+	}
+}
+
 // IsExitEvent returns true if the event indicates the process exits for some reason.
 func IsExitEvent(event EventType) bool {
 	return event == EventTypeCoreDump || event == EventTypeExited || event == EventTypeTerminated
 }
 
+// IsTerminatedEvent returns true if the event indicates the process is terminated by a signal.
+// Unlike IsExitEvent, it returns false if the process exits normally.
+func IsTerminatedEvent(event EventType) bool {
+	return event == EventTypeTerminated
+}
+
+// IsTrappedEvent returns true if the event indicates the process is trapped and so still alive.
+func IsTrappedEvent(event EventType) bool {
+	return event == EventTypeTrapped
+}
+
 // Event describes the event happens to the target process.
 type Event struct {
 	Type EventType
@@ -51,6 +96,7 @@ type Event struct {
 	//    EventTypeCoreDump    NA          NA
 	//    EventTypeExited      int         Exit status
 	//    EventTypeTerminated  int         Signal number
+	//    EventTypeExec        []int       A list of trapped thread id
 	Data interface{}
 }
 
@@ -59,6 +105,26 @@ type Registers struct {
 	Rip uint64
 	Rsp uint64
 	Rcx uint64
+	// The registers below are used to pass the integer arguments and results in the Go internal ABI (ABIInternal),
+	// in the order of rax, rbx, rcx, rdi, rsi, r8, r9, r10 and r11.
+	Rax uint64
+	Rbx uint64
+	Rdi uint64
+	Rsi uint64
+	R8  uint64
+	R9  uint64
+	R10 uint64
+	R11 uint64
+	// The rest of the general-purpose registers. rdx is the closure context pointer and r14 is the current g in ABIInternal.
+	Rdx uint64
+	Rbp uint64
+	R12 uint64
+	R13 uint64
+	R14 uint64
+	R15 uint64
+	// Xmm is the lower 64 bits of xmm0-xmm14, which the Go internal ABI uses to pass the floating-point arguments and results.
+	// They are only read. WriteRegisters doesn't change the xmm registers.
+	Xmm [15]uint64
 }
 
 // UnspecifiedThreadError indicates the stopped threads include unspecified ones.
@@ -3,6 +3,7 @@ package debugapi
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -24,6 +25,13 @@ const (
 	excBadAccess  = syscall.Signal(0x91) // EXC_BAD_ACCESS
 )
 
+// maxReadMemorySize is the max size of the memory read by one 'm' command. The response has 2 hex digits per byte and
+// '$', '#' and 2 digits checksum, so the size is chosen not to exceed the max packet size.
+const maxReadMemorySize = (maxPacketSize - 4) / 2
+
+// maxResends is the max number of times the packet is sent again when the nak is received.
+const maxResends = 3
+
 // Client is the debug api client which depends on lldb's debugserver.
 // See the gdb's doc for the reference: https://sourceware.org/gdb/onlinedocs/gdb/Remote-Protocol.html
 // Some commands use the lldb extension: https://github.com/llvm-mirror/lldb/blob/master/docs/lldb-gdb-remote.txt
@@ -34,12 +42,51 @@ type Client struct {
 	noAckMode            bool
 	registerMetadataList []registerMetadata
 	buffer               []byte
+	// unreadData is the data received after the last packet, such as the next packet, which is read first next time.
+	unreadData []byte
+	// lastPacket is the packet sent last time. It's sent again if the nak ('-') is received.
+	lastPacket []byte
 	// outputWriter is the writer to which the output of the debugee process will be written.
 	outputWriter io.Writer
+	// env and workingDir are passed to the process launched next. See SetEnv and SetWorkingDir.
+	env        []string
+	workingDir string
+	// killSignal is the signal sent to the launched process on detach. SIGKILL if 0.
+	killSignal syscall.Signal
 
 	readTLSFuncAddr  uint64
 	currentTLSOffset uint32
 	pendingSignal    int
+	processInfo      ProcessInfo
+	// supportsVContStop is true if the debugserver supports the vCont's stop action, 't'.
+	supportsVContStop bool
+	// The lldb extensions below are detected in the initialization, because the other gdb-remote stubs,
+	// such as gdbserver, qemu and rr, may not support them.
+	//
+	// supportsThreadSuffix is true if the stub accepts the thread suffix (QThreadSuffixSupported).
+	// Otherwise, the thread is selected by the 'Hg' command. See threadSuffix.
+	supportsThreadSuffix bool
+	// listsThreadsInStopReply is true if the stop reply lists all the threads (QListThreadsInStopReply).
+	// Otherwise, only the thread the stop reply reports is considered.
+	listsThreadsInStopReply bool
+	// selectedThreadID is the thread the last 'Hg' command selected. 0 if not selected.
+	selectedThreadID int
+	// pPacketUnsupported is true if the debugserver returned the empty or error response to the 'P' command.
+	// Then the single register is written by the 'G' command.
+	pPacketUnsupported bool
+}
+
+// ProcessInfo is the information of the debugee process the debugserver reports.
+type ProcessInfo struct {
+	PID, ParentPID             int
+	RealUID, RealGID           int
+	EffectiveUID, EffectiveGID int
+	// CPUType and CPUSubtype are the values defined in mach/machine.h. For example, CPUType is 0x1000007 if x86_64.
+	CPUType, CPUSubtype int
+	// OSType is the name of the os, such as "macosx".
+	OSType  string
+	Endian  string
+	PtrSize int
 }
 
 // NewClient returns the new debug api client which depends on OS API.
@@ -47,6 +94,23 @@ func NewClient() *Client {
 	return &Client{buffer: make([]byte, maxPacketSize), outputWriter: os.Stdout}
 }
 
+// SetEnv sets the environment variables, in the form of "key=value", which are added to the process launched next.
+// The process inherits the tracer's environment variables anyway.
+func (c *Client) SetEnv(env []string) {
+	c.env = env
+}
+
+// SetWorkingDir sets the working directory of the process launched next. The tracer's one is used if empty.
+func (c *Client) SetWorkingDir(dir string) {
+	c.workingDir = dir
+}
+
+// SetKillSignal sets the signal sent to the launched process when it's killed on detach. SIGKILL is sent if 0,
+// which is the default. Other signals, such as SIGTERM, give the process the chance to run its signal handlers.
+func (c *Client) SetKillSignal(sig syscall.Signal) {
+	c.killSignal = sig
+}
+
 // LaunchProcess lets the debugserver launch the new prcoess.
 func (c *Client) LaunchProcess(name string, arg ...string) error {
 	listener, err := net.Listen("tcp", "localhost:")
@@ -59,8 +123,14 @@ func (c *Client) LaunchProcess(name string, arg ...string) error {
 		return err
 	}
 
-	debugServerArgs := []string{"-F", "-R", listener.Addr().String(), "--", name}
-	debugServerArgs = append(debugServerArgs, arg...)
+	// The debugserver launches the process at startup unless the environment or working directory is specified.
+	// Otherwise, they are sent before the process is launched by the 'A' packet.
+	launchByPacket := len(c.env) > 0 || c.workingDir != ""
+	debugServerArgs := []string{"-F", "-R", listener.Addr().String()}
+	if !launchByPacket {
+		debugServerArgs = append(debugServerArgs, "--", name)
+		debugServerArgs = append(debugServerArgs, arg...)
+	}
 	cmd := exec.Command(path, debugServerArgs...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // Otherwise, the signal sent to all the group members.
 	if err := cmd.Start(); err != nil {
@@ -74,9 +144,103 @@ func (c *Client) LaunchProcess(name string, arg ...string) error {
 	c.pid = cmd.Process.Pid
 	c.killOnDetach = true
 
+	if launchByPacket {
+		if err := c.launchInferior(append([]string{name}, arg...)); err != nil {
+			return err
+		}
+	}
+
 	return c.initialize()
 }
 
+// launchInferior sends the environment and working directory and then lets the debugserver launch the process.
+// `args` includes the program name as the first element.
+func (c *Client) launchInferior(args []string) error {
+	for _, kv := range append(os.Environ(), c.env...) {
+		if err := c.qEnvironmentHexEncoded(kv); err != nil {
+			return err
+		}
+	}
+
+	if c.workingDir != "" {
+		if err := c.qSetWorkingDir(c.workingDir); err != nil {
+			return err
+		}
+	}
+
+	if err := c.send(buildAPacket(args)); err != nil {
+		return err
+	}
+	if err := c.receiveAndCheck(); err != nil {
+		return err
+	}
+
+	return c.qLaunchSuccess()
+}
+
+func (c *Client) qEnvironmentHexEncoded(kv string) error {
+	command := "QEnvironmentHexEncoded:" + hex.EncodeToString([]byte(kv))
+	if err := c.send(command); err != nil {
+		return err
+	}
+
+	return c.receiveAndCheck()
+}
+
+func (c *Client) qSetWorkingDir(dir string) error {
+	command := "QSetWorkingDir:" + hex.EncodeToString([]byte(dir))
+	if err := c.send(command); err != nil {
+		return err
+	}
+
+	return c.receiveAndCheck()
+}
+
+// SetPassSignals lets the debugserver pass the signals, such as SIGTERM, to the debugee without stopping it,
+// so that the debugee can handle them by itself. The empty list stops passing the signals set before.
+// The older debugserver may not support the query and return the empty response. Then the debug message is logged
+// and nil is returned, because the tracing works anyway. The error response, such as E01, is returned as the error.
+// It must be called after the process is launched or attached, and takes effect from the next continue.
+func (c *Client) SetPassSignals(signals []int) error {
+	hexSignals := make([]string, 0, len(signals))
+	for _, sig := range signals {
+		hexSignals = append(hexSignals, fmt.Sprintf("%02x", sig))
+	}
+	command := "QPassSignals:" + strings.Join(hexSignals, ";")
+	if err := c.send(command); err != nil {
+		return err
+	}
+
+	data, err := c.receive()
+	if err != nil {
+		return err
+	} else if data == "" {
+		log.Debugf("the debugserver doesn't support QPassSignals")
+	} else if data != "OK" {
+		return fmt.Errorf("failed to set the pass signals: %s", data)
+	}
+	return nil
+}
+
+func (c *Client) qLaunchSuccess() error {
+	const command = "qLaunchSuccess"
+	if err := c.send(command); err != nil {
+		return err
+	}
+
+	return c.receiveAndCheck()
+}
+
+// buildAPacket builds the 'A' packet, which is the list of `arglen,argnum,arg` and arg is hex encoded.
+func buildAPacket(args []string) string {
+	var fields []string
+	for i, arg := range args {
+		hexArg := hex.EncodeToString([]byte(arg))
+		fields = append(fields, fmt.Sprintf("%d,%d,%s", len(hexArg), i, hexArg))
+	}
+	return "A" + strings.Join(fields, ",")
+}
+
 func (c *Client) waitConnectOrExit(listener net.Listener, cmd *exec.Cmd) (net.Conn, error) {
 	waitCh := make(chan error)
 	go func(ch chan error) {
@@ -112,25 +276,122 @@ func (c *Client) initialize() error {
 		return err
 	}
 
-	if err := c.qThreadSuffixSupported(); err != nil {
+	if err := c.qVContSupported(); err != nil {
 		return err
 	}
 
 	var err error
+	c.supportsThreadSuffix, err = c.qThreadSuffixSupported()
+	if err != nil {
+		return err
+	}
+
 	c.registerMetadataList, err = c.collectRegisterMetadata()
+	if err == errNotSupported {
+		log.Debugf("qRegisterInfo is not supported. Use the default register layout")
+		c.registerMetadataList, err = defaultRegisterMetadataList, nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if err := c.qListThreadsInStopReply(); err != nil {
+	c.listsThreadsInStopReply, err = c.qListThreadsInStopReply()
+	if err != nil {
+		return err
+	}
+
+	c.processInfo, err = c.qProcessInfo()
+	if err == errNotSupported {
+		log.Debugf("qProcessInfo is not supported. The process info is unknown")
+		err = nil
+	}
+	if err != nil {
 		return err
 	}
 
 	readTLSFunction := c.buildReadTLSFunction(0) // need the function length here. So the offset doesn't matter.
 	c.readTLSFuncAddr, err = c.allocateMemory(len(readTLSFunction))
+	if err == errNotSupported {
+		log.Debugf("_M is not supported. The TLS can't be read")
+		err = nil
+	}
 	return err
 }
 
+// errNotSupported indicates the stub doesn't support the command, i.e. it returns the empty response.
+var errNotSupported = errors.New("the command is not supported")
+
+// ProcessInfo returns the information of the process, which is queried when the process is launched or attached.
+func (c *Client) ProcessInfo() ProcessInfo {
+	return c.processInfo
+}
+
+func (c *Client) qProcessInfo() (ProcessInfo, error) {
+	const command = "qProcessInfo"
+	if err := c.send(command); err != nil {
+		return ProcessInfo{}, err
+	}
+
+	data, err := c.receive()
+	if err != nil {
+		return ProcessInfo{}, err
+	} else if data == "" {
+		return ProcessInfo{}, errNotSupported
+	} else if strings.HasPrefix(data, "E") {
+		return ProcessInfo{}, fmt.Errorf("error response: %s", data)
+	}
+
+	return parseProcessInfo(data)
+}
+
+// parseProcessInfo parses the response of the qProcessInfo, such as `pid:1a2b;parent-pid:1;ostype:macosx;`.
+// The numbers are in hex.
+func parseProcessInfo(data string) (ProcessInfo, error) {
+	var info ProcessInfo
+	for _, chunk := range strings.Split(data, ";") {
+		keyValue := strings.SplitN(chunk, ":", 2)
+		if len(keyValue) < 2 {
+			continue
+		}
+
+		key, value := keyValue[0], keyValue[1]
+		var num *int
+		switch key {
+		case "pid":
+			num = &info.PID
+		case "parent-pid":
+			num = &info.ParentPID
+		case "real-uid":
+			num = &info.RealUID
+		case "real-gid":
+			num = &info.RealGID
+		case "effective-uid":
+			num = &info.EffectiveUID
+		case "effective-gid":
+			num = &info.EffectiveGID
+		case "cputype":
+			num = &info.CPUType
+		case "cpusubtype":
+			num = &info.CPUSubtype
+		case "ptrsize":
+			num = &info.PtrSize
+		case "ostype":
+			info.OSType = value
+		case "endian":
+			info.Endian = value
+		}
+
+		if num != nil {
+			val, err := strconv.ParseUint(value, 16, 64)
+			if err != nil {
+				return ProcessInfo{}, fmt.Errorf("failed to parse %s: %v", key, err)
+			}
+			*num = int(val)
+		}
+	}
+	return info, nil
+}
+
 func (c *Client) setNoAckMode() error {
 	const command = "QStartNoAckMode"
 	if err := c.send(command); err != nil {
@@ -157,12 +418,73 @@ func (c *Client) qSupported() error {
 	return err
 }
 
-func (c *Client) qThreadSuffixSupported() error {
-	const command = "QThreadSuffixSupported"
+// qVContSupported queries the actions the vCont packet supports. The reply is like `vCont;c;C;s;S;t`,
+// or empty if the vCont packet is not supported.
+func (c *Client) qVContSupported() error {
+	const command = "vCont?"
 	if err := c.send(command); err != nil {
 		return err
 	}
-	return c.receiveAndCheck()
+
+	data, err := c.receive()
+	if err != nil {
+		return err
+	}
+
+	for _, action := range strings.Split(data, ";")[1:] {
+		if action == "t" {
+			c.supportsVContStop = true
+		}
+	}
+	return nil
+}
+
+// threadSuffix returns the suffix to specify the thread the command operates on. The suffix is available
+// if the stub accepts QThreadSuffixSupported in the initialization. Otherwise, the thread is selected by
+// the 'Hg' command here and the suffix is empty.
+// It must be appended to the commands which access the thread's state, such as the registers. Without the suffix,
+// the state of the thread selected by the last 'H' command (or the arbitrary one) is used.
+// The memory is shared among the threads and so the 'm' and 'M' commands don't need the suffix.
+// The commands which have the thread id parameter, such as vCont and qThreadStopInfo, don't need it either.
+func (c *Client) threadSuffix(threadID int) (string, error) {
+	if c.supportsThreadSuffix {
+		return fmt.Sprintf(";thread:%x;", threadID), nil
+	}
+
+	if c.selectedThreadID != threadID {
+		if err := c.send(fmt.Sprintf("Hg%x", threadID)); err != nil {
+			return "", err
+		}
+		if err := c.receiveAndCheck(); err != nil {
+			return "", err
+		}
+		c.selectedThreadID = threadID
+	}
+	return "", nil
+}
+
+// qThreadSuffixSupported returns false if the stub doesn't support the thread suffix.
+func (c *Client) qThreadSuffixSupported() (bool, error) {
+	const command = "QThreadSuffixSupported"
+	if err := c.send(command); err != nil {
+		return false, err
+	}
+	return c.receiveAndCheckSupported(command)
+}
+
+// receiveAndCheckSupported is same as receiveAndCheck except that it returns false if the stub doesn't support
+// the command, i.e. it returns the empty response.
+func (c *Client) receiveAndCheckSupported(command string) (bool, error) {
+	data, err := c.receive()
+	if err != nil {
+		return false, err
+	} else if data == "" {
+		log.Debugf("%s is not supported", command)
+		return false, nil
+	} else if data != "OK" {
+		return false, fmt.Errorf("the error response is returned: %s", data)
+	}
+	return true, nil
 }
 
 var errEndOfList = errors.New("the end of list")
@@ -172,6 +494,33 @@ type registerMetadata struct {
 	id, offset, size int
 }
 
+// defaultRegisterMetadataList is the registers in the order of the 'g' packet of gdb's amd64 target, which is used
+// if the stub doesn't support qRegisterInfo. The x87 registers (st0-st7, fctrl-fop) are between gs and xmm0.
+var defaultRegisterMetadataList = buildDefaultRegisterMetadataList()
+
+func buildDefaultRegisterMetadataList() []registerMetadata {
+	var regs []registerMetadata
+	offset := 0
+	add := func(id int, name string, size int) {
+		regs = append(regs, registerMetadata{name: name, id: id, offset: offset, size: size})
+		offset += size
+	}
+
+	for i, name := range []string{"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp", "rsp", "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15", "rip"} {
+		add(i, name, 8)
+	}
+	for i, name := range []string{"rflags", "cs", "ss", "ds", "es", "fs", "gs"} {
+		add(17+i, name, 4)
+	}
+	const x87RegistersSize = 8*10 + 8*4
+	offset += x87RegistersSize
+	for i := 0; i < 16; i++ {
+		add(40+i, fmt.Sprintf("xmm%d", i), 16)
+	}
+	add(56, "mxcsr", 4)
+	return regs
+}
+
 func (c *Client) collectRegisterMetadata() ([]registerMetadata, error) {
 	var regs []registerMetadata
 	for i := 0; ; i++ {
@@ -197,6 +546,11 @@ func (c *Client) qRegisterInfo(registerID int) (registerMetadata, error) {
 	data, err := c.receive()
 	if err != nil {
 		return registerMetadata{}, err
+	} else if data == "" {
+		if registerID == 0 {
+			return registerMetadata{}, errNotSupported
+		}
+		return registerMetadata{}, errEndOfList
 	}
 
 	if strings.HasPrefix(data, "E") {
@@ -241,13 +595,14 @@ func (c *Client) parseRegisterMetaData(registerID int, data string) (registerMet
 	return reg, nil
 }
 
-func (c *Client) qListThreadsInStopReply() error {
+// qListThreadsInStopReply returns false if the stub doesn't list the threads in the stop reply.
+func (c *Client) qListThreadsInStopReply() (bool, error) {
 	const command = "QListThreadsInStopReply"
 	if err := c.send(command); err != nil {
-		return err
+		return false, err
 	}
 
-	return c.receiveAndCheck()
+	return c.receiveAndCheckSupported(command)
 }
 
 func (c *Client) allocateMemory(size int) (uint64, error) {
@@ -259,7 +614,9 @@ func (c *Client) allocateMemory(size int) (uint64, error) {
 	data, err := c.receive()
 	if err != nil {
 		return 0, err
-	} else if data == "" || strings.HasPrefix(data, "E") {
+	} else if data == "" {
+		return 0, errNotSupported
+	} else if strings.HasPrefix(data, "E") {
 		return 0, fmt.Errorf("error response: %s", data)
 	}
 
@@ -338,10 +695,28 @@ func (c *Client) AttachProcess(pid int) error {
 	return c.initialize()
 }
 
+// Connect connects to the already-running gdb-remote stub (e.g. debugserver, gdbserver, qemu or rr) at the given address.
+// Unlike LaunchProcess and AttachProcess, the stub is not spawned by this client and the process is not killed on detach.
+// The lldb extensions the stub doesn't support are skipped: the thread is selected by the 'Hg' command instead of
+// the thread suffix, the registers are assumed to be in gdb's amd64 layout if qRegisterInfo is not supported,
+// and the process info is empty if qProcessInfo is not supported. ReadTLS requires the memory allocation by '_M'.
+func (c *Client) Connect(address string) error {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	return c.initialize()
+}
+
 // DetachProcess detaches from the prcoess.
 func (c *Client) DetachProcess() error {
 	defer c.close()
 	if c.killOnDetach {
+		if c.killSignal != 0 && c.killSignal != unix.SIGKILL {
+			return c.terminateProcess()
+		}
 		return c.killProcess()
 	}
 
@@ -370,6 +745,87 @@ func (c *Client) killProcess() error {
 	return nil
 }
 
+// terminateProcess continues the process with the kill signal so that the process's signal handlers run.
+// If the process stops by another signal meanwhile, it's continued with that signal again.
+// The process is killed if it doesn't exit within the terminateTimeout.
+func (c *Client) terminateProcess() error {
+	if err := c.send(buildVContSignalPacket(c.killSignal)); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(terminateTimeout)
+	for {
+		data, err := c.receiveWithTimeout(time.Until(deadline))
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			log.Debugf("the process did not exit in %v after the signal %v. kill it", terminateTimeout, c.killSignal)
+			return c.interruptAndKillProcess()
+		} else if err != nil {
+			return err
+		}
+
+		stopReplies, err := c.processOutputPacket(c.buildStopReplies(data))
+		if err != nil {
+			return err
+		} else if len(stopReplies) == 0 {
+			continue
+		}
+
+		switch stopReplies[0][0] {
+		case 'W', 'X':
+			return nil
+		case 'T':
+			// stopped by another signal, such as SIGURG the go runtime uses for the preemption.
+			signalNumber, err := hexToUint64(stopReplies[0][1:3], false)
+			if err != nil {
+				return err
+			}
+
+			command := "vCont;c"
+			if sig := syscall.Signal(signalNumber); sig != unix.SIGTRAP {
+				command = buildVContSignalPacket(sig)
+			}
+			if err := c.send(command); err != nil {
+				return err
+			}
+		default:
+			return c.killProcess()
+		}
+	}
+}
+
+// buildVContStepPacket returns the vCont packet which steps the thread, such as `vCont;s:103`.
+// If holdOthers is true, the stop action is explicitly applied to the other threads, such as `vCont;s:103;t`.
+// Otherwise, the other threads have no action. In the all-stop mode, the stub keeps such threads stopped
+// (debugserver sets the stop action to them by default), so the step holds the other threads either way.
+func buildVContStepPacket(threadID, signalNumber int, holdOthers bool) string {
+	var packet string
+	if signalNumber == 0 {
+		packet = fmt.Sprintf("vCont;s:%x", threadID)
+	} else {
+		packet = fmt.Sprintf("vCont;S%02x:%x", signalNumber, threadID)
+	}
+	if holdOthers {
+		// the action without the thread id applies to all the threads which have no action.
+		packet += ";t"
+	}
+	return packet
+}
+
+// buildVContSignalPacket returns the vCont packet which continues all the threads with the signal, such as `vCont;C0f`.
+func buildVContSignalPacket(sig syscall.Signal) string {
+	return fmt.Sprintf("vCont;C%02x", int(sig))
+}
+
+func (c *Client) interruptAndKillProcess() error {
+	if _, err := c.conn.Write([]byte{0x03}); err != nil {
+		return err
+	}
+	if _, err := c.receiveWithTimeout(terminateTimeout); err != nil {
+		return err
+	}
+	return c.killProcess()
+}
+
 // ReadRegisters reads the target threadID's registers.
 func (c *Client) ReadRegisters(threadID int) (Registers, error) {
 	data, err := c.readRegisters(threadID)
@@ -381,7 +837,11 @@ func (c *Client) ReadRegisters(threadID int) (Registers, error) {
 }
 
 func (c *Client) readRegisters(threadID int) (string, error) {
-	command := fmt.Sprintf("g;thread:%x;", threadID)
+	suffix, err := c.threadSuffix(threadID)
+	if err != nil {
+		return "", err
+	}
+	command := "g" + suffix
 	if err := c.send(command); err != nil {
 		return "", err
 	}
@@ -395,20 +855,81 @@ func (c *Client) readRegisters(threadID int) (string, error) {
 	return data, nil
 }
 
+// registerByName returns the field of the register which has the given name, such as `rip`.
+// It returns nil if the register is not the member of Registers.
+func registerByName(regs *Registers, name string) *uint64 {
+	switch name {
+	case "rip":
+		return &regs.Rip
+	case "rsp":
+		return &regs.Rsp
+	case "rcx":
+		return &regs.Rcx
+	case "rax":
+		return &regs.Rax
+	case "rbx":
+		return &regs.Rbx
+	case "rdi":
+		return &regs.Rdi
+	case "rsi":
+		return &regs.Rsi
+	case "r8":
+		return &regs.R8
+	case "r9":
+		return &regs.R9
+	case "r10":
+		return &regs.R10
+	case "r11":
+		return &regs.R11
+	case "rdx":
+		return &regs.Rdx
+	case "rbp":
+		return &regs.Rbp
+	case "r12":
+		return &regs.R12
+	case "r13":
+		return &regs.R13
+	case "r14":
+		return &regs.R14
+	case "r15":
+		return &regs.R15
+	}
+	return nil
+}
+
+// xmmRegisterByName returns the field of the xmm register which has the given name, such as `xmm0`.
+// It returns nil if the register is not the member of Registers.
+func xmmRegisterByName(regs *Registers, name string) *uint64 {
+	if !strings.HasPrefix(name, "xmm") {
+		return nil
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(name, "xmm"))
+	if err != nil || index < 0 || index >= len(regs.Xmm) {
+		return nil
+	}
+	return &regs.Xmm[index]
+}
+
 func (c *Client) parseRegisterData(data string) (Registers, error) {
 	var regs Registers
 	for _, metadata := range c.registerMetadataList {
-		rawValue := data[metadata.offset*2 : (metadata.offset+metadata.size)*2]
+		field := registerByName(&regs, metadata.name)
+		size := metadata.size
+		if field == nil {
+			// only the lower 64 bits of the xmm register are read.
+			if field = xmmRegisterByName(&regs, metadata.name); field == nil {
+				continue
+			} else if size > 8 {
+				size = 8
+			}
+		}
 
-		var err error
-		switch metadata.name {
-		case "rip":
-			regs.Rip, err = hexToUint64(rawValue, true)
-		case "rsp":
-			regs.Rsp, err = hexToUint64(rawValue, true)
-		case "rcx":
-			regs.Rcx, err = hexToUint64(rawValue, true)
+		if len(data) < (metadata.offset+size)*2 {
+			continue // the stub may not send the rest of the registers.
 		}
+		rawValue := data[metadata.offset*2 : (metadata.offset+size)*2]
+		var err error
+		*field, err = hexToUint64(rawValue, true)
 		if err != nil {
 			return Registers{}, err
 		}
@@ -417,6 +938,11 @@ func (c *Client) parseRegisterData(data string) (Registers, error) {
 	return regs, nil
 }
 
+// SetPC sets the program counter (rip) of the thread.
+func (c *Client) SetPC(threadID int, addr uint64) error {
+	return c.WriteRegisterByName(threadID, "rip", addr)
+}
+
 // WriteRegisters updates the registers' value.
 func (c *Client) WriteRegisters(threadID int, regs Registers) error {
 	data, err := c.readRegisters(threadID)
@@ -424,57 +950,173 @@ func (c *Client) WriteRegisters(threadID int, regs Registers) error {
 		return err
 	}
 
-	// The 'P' command is not used due to the bug explained here: https://github.com/llvm-mirror/lldb/commit/d8d7a40ca5377aa777e3840f3e9b6a63c6b09445
+	// The single register is written by the 'P' command if possible. See writeRegister.
 
 	for _, metadata := range c.registerMetadataList {
-		prefix := data[0 : metadata.offset*2]
-		suffix := data[(metadata.offset+metadata.size)*2:]
+		field := registerByName(&regs, metadata.name)
+		if field == nil {
+			continue
+		}
 
-		var err error
-		switch metadata.name {
-		case "rip":
-			data = fmt.Sprintf("%s%s%s", prefix, uint64ToHex(regs.Rip, true), suffix)
-		case "rsp":
-			data = fmt.Sprintf("%s%s%s", prefix, uint64ToHex(regs.Rsp, true), suffix)
-		case "rcx":
-			data = fmt.Sprintf("%s%s%s", prefix, uint64ToHex(regs.Rcx, true), suffix)
+		data = spliceRegisterData(data, metadata, *field)
+	}
+
+	return c.writeRegisters(threadID, data)
+}
+
+func (c *Client) writeRegisters(threadID int, data string) error {
+	suffix, err := c.threadSuffix(threadID)
+	if err != nil {
+		return err
+	}
+	command := fmt.Sprintf("G%s%s", data, suffix)
+	if err := c.send(command); err != nil {
+		return err
+	}
+
+	return c.receiveAndCheck()
+}
+
+// spliceRegisterData replaces the register's part of the register data with the value.
+func spliceRegisterData(data string, metadata registerMetadata, value uint64) string {
+	prefix := data[0 : metadata.offset*2]
+	suffix := data[(metadata.offset+metadata.size)*2:]
+	// the value is little endian, so the lower bytes come first.
+	return fmt.Sprintf("%s%s%s", prefix, uint64ToHex(value, true)[0:metadata.size*2], suffix)
+}
+
+// findRegisterMetadata returns the metadata of the register which has the given name, such as `rip`.
+// Only the registers up to 64 bits are supported.
+func (c *Client) findRegisterMetadata(name string) (registerMetadata, error) {
+	for _, metadata := range c.registerMetadataList {
+		if metadata.name != name {
+			continue
 		}
-		if err != nil {
-			return err
+		if metadata.size > 8 {
+			return registerMetadata{}, fmt.Errorf("the register is larger than 64 bits: %s", name)
 		}
+		return metadata, nil
+	}
+	return registerMetadata{}, fmt.Errorf("unknown register: %s", name)
+}
+
+// ReadRegisterByName reads the single register which has the given name, such as `rip` or `rflags`.
+// Unlike ReadRegisters, only the specified register is transferred. Any register the debugserver reports is available,
+// even if it's not the member of Registers.
+func (c *Client) ReadRegisterByName(threadID int, name string) (uint64, error) {
+	metadata, err := c.findRegisterMetadata(name)
+	if err != nil {
+		return 0, err
 	}
 
-	command := fmt.Sprintf("G%s;thread:%x;", data, threadID)
+	suffix, err := c.threadSuffix(threadID)
+	if err != nil {
+		return 0, err
+	}
+	command := fmt.Sprintf("p%x%s", metadata.id, suffix)
 	if err := c.send(command); err != nil {
+		return 0, err
+	}
+
+	data, err := c.receive()
+	if err != nil {
+		return 0, err
+	} else if strings.HasPrefix(data, "E") {
+		return 0, fmt.Errorf("error response: %s", data)
+	} else if len(data) != metadata.size*2 {
+		return 0, fmt.Errorf("invalid register data: %s", data)
+	}
+	return hexToUint64(data, true)
+}
+
+// WriteRegisterByName updates the single register which has the given name. The other registers are not changed.
+// Unlike WriteRegisters, only the specified register is transferred if the debugserver supports the 'P' command.
+func (c *Client) WriteRegisterByName(threadID int, name string, value uint64) error {
+	metadata, err := c.findRegisterMetadata(name)
+	if err != nil {
 		return err
 	}
 
-	return c.receiveAndCheck()
+	return c.writeRegister(threadID, metadata, value)
 }
 
-// ReadMemory reads the specified memory region.
+// writeRegister writes the single register by the 'P' command. If the debugserver doesn't support the command,
+// i.e. it returns the empty response, or rejects it by the error response like E01, it falls back to the 'G' command.
+// Some version of the debugserver doesn't handle the command correctly (see https://github.com/llvm-mirror/lldb/commit/d8d7a40ca5377aa777e3840f3e9b6a63c6b09445).
+// Once failed, the 'P' command is not tried again.
+func (c *Client) writeRegister(threadID int, metadata registerMetadata, value uint64) error {
+	if !c.pPacketUnsupported {
+		suffix, err := c.threadSuffix(threadID)
+		if err != nil {
+			return err
+		}
+		command := fmt.Sprintf("P%x=%s%s", metadata.id, uint64ToHex(value, true)[0:metadata.size*2], suffix)
+		if err := c.send(command); err != nil {
+			return err
+		}
+
+		data, err := c.receive()
+		if err != nil {
+			return err
+		} else if data == "OK" {
+			return nil
+		} else if data != "" && !strings.HasPrefix(data, "E") {
+			return fmt.Errorf("unexpected response to the 'P' command: %s", data)
+		}
+		log.Debugf("the 'P' command is not supported (%q). Use the 'G' command instead", data)
+		c.pPacketUnsupported = true
+	}
+
+	data, err := c.readRegisters(threadID)
+	if err != nil {
+		return err
+	}
+	return c.writeRegisters(threadID, spliceRegisterData(data, metadata, value))
+}
+
+// ReadMemory reads the specified memory region. The memory is shared among the threads.
+// The large region is read by multiple commands so that the response doesn't exceed the packet size.
 func (c *Client) ReadMemory(addr uint64, out []byte) error {
+	for len(out) > 0 {
+		size := len(out)
+		if size > maxReadMemorySize {
+			size = maxReadMemorySize
+		}
+
+		n, err := c.readMemory(addr, out[0:size])
+		if err != nil {
+			return err
+		} else if n == 0 {
+			log.Debugf("The data size read from the memory is smaller than the requested size. remaining: %d", len(out))
+			return nil
+		}
+
+		addr += uint64(n)
+		out = out[n:]
+	}
+	return nil
+}
+
+// readMemory reads the memory region using one 'm' command. It returns the size of the data actually read,
+// which may be smaller than the requested size.
+func (c *Client) readMemory(addr uint64, out []byte) (int, error) {
 	command := fmt.Sprintf("m%x,%x", addr, len(out))
 	if err := c.send(command); err != nil {
-		return err
+		return 0, err
 	}
 
 	data, err := c.receive()
 	if err != nil {
-		return err
+		return 0, err
 	} else if strings.HasPrefix(data, "E") {
-		return fmt.Errorf("error response: %s", data)
+		return 0, fmt.Errorf("error response: %s", data)
 	}
 
 	byteArrary, err := hexToByteArray(data)
 	if err != nil {
-		return err
-	}
-	if len(byteArrary) != len(out) {
-		log.Debugf("The data size read from the memory is smaller than the requested size. actual: %d, expected: %d", len(byteArrary), len(out))
+		return 0, err
 	}
-	copy(out, byteArrary)
-	return nil
+	return copy(out, byteArrary), nil
 }
 
 // WriteMemory write the data to the specified region
@@ -492,7 +1134,12 @@ func (c *Client) WriteMemory(addr uint64, data []byte) error {
 }
 
 // ReadTLS reads the offset from the beginning of the TLS block.
-func (c *Client) ReadTLS(threadID int, offset int32) (uint64, error) {
+// It steps the thread through the function `mov rcx, gs:[offset]` (see buildReadTLSFunction).
+// The function clobbers only rip and rcx, which are restored afterwards. The rflags are not changed by mov.
+func (c *Client) ReadTLS(threadID int, offset int32) (tls uint64, err error) {
+	if c.readTLSFuncAddr == 0 {
+		return 0, errors.New("failed to read the TLS: the stub doesn't support the memory allocation (_M)")
+	}
 	if err := c.updateReadTLSFunction(uint32(offset)); err != nil {
 		return 0, err
 	}
@@ -501,11 +1148,17 @@ func (c *Client) ReadTLS(threadID int, offset int32) (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
-	defer func() { err = c.WriteRegisters(threadID, originalRegs) }()
+	defer func() {
+		// the registers of the thread must be restored even if the error happens.
+		if restoreErr := c.WriteRegisterByName(threadID, "rip", originalRegs.Rip); err == nil {
+			err = restoreErr
+		}
+		if restoreErr := c.WriteRegisterByName(threadID, "rcx", originalRegs.Rcx); err == nil {
+			err = restoreErr
+		}
+	}()
 
-	modifiedRegs := originalRegs
-	modifiedRegs.Rip = c.readTLSFuncAddr
-	if err = c.WriteRegisters(threadID, modifiedRegs); err != nil {
+	if err = c.WriteRegisterByName(threadID, "rip", c.readTLSFuncAddr); err != nil {
 		return 0, err
 	}
 
@@ -513,8 +1166,7 @@ func (c *Client) ReadTLS(threadID int, offset int32) (uint64, error) {
 		return 0, err
 	}
 
-	modifiedRegs, err = c.ReadRegisters(threadID)
-	return modifiedRegs.Rcx, err
+	return c.ReadRegisterByName(threadID, "rcx")
 }
 
 func (c *Client) updateReadTLSFunction(offset uint32) error {
@@ -530,6 +1182,8 @@ func (c *Client) updateReadTLSFunction(offset uint32) error {
 	return nil
 }
 
+// buildReadTLSFunction returns the single instruction, `mov rcx, gs:[offset]`, which reads the TLS block.
+// ReadTLS restores only rip and rcx, so the function must not change the other registers.
 func (c *Client) buildReadTLSFunction(offset uint32) []byte {
 	offsetBytes := make([]byte, 4)
 	binary.LittleEndian.PutUint32(offsetBytes, offset)
@@ -545,15 +1199,12 @@ func (c *Client) ContinueAndWait() (Event, error) {
 }
 
 // StepAndWait executes the one instruction of the specified thread and waits until an event happens.
+// The other threads are held stopped during the step. The debugserver doesn't list the vCont's stop action, 't',
+// but it stops the threads the vCont packet has no action for. If the stub lists the action, it's explicitly used.
 // The returned event may not be the trapped event.
 // If unspecified thread is stopped, UnspecifiedThreadError is returned.
 func (c *Client) StepAndWait(threadID int) (Event, error) {
-	var command string
-	if c.pendingSignal == 0 {
-		command = fmt.Sprintf("vCont;s:%x", threadID)
-	} else {
-		command = fmt.Sprintf("vCont;S%02x:%x", c.pendingSignal, threadID)
-	}
+	command := buildVContStepPacket(threadID, c.pendingSignal, c.supportsVContStop)
 
 	if err := c.send(command); err != nil {
 		return Event{}, fmt.Errorf("send error: %v", err)
@@ -576,7 +1227,8 @@ func (c *Client) continueAndWait(signalNumber int) (Event, error) {
 		command = "vCont;c"
 	} else {
 		// Though the signal number is specified, it's like the debugserver does not pass the signals like SIGTERM and SIGINT to the debugee.
-		// QPassSignals can change this setting, but debugserver (900.0.64) doesn't support the query.
+		// After SetPassSignals succeeds, the listed signals are passed without stopping the debugee from the next continue,
+		// and so don't reach here. It has no effect if the debugserver returns the empty response to the query.
 		command = fmt.Sprintf("vCont;C%02x", signalNumber)
 	}
 	if err := c.send(command); err != nil {
@@ -704,10 +1356,20 @@ func (c *Client) handleTPacket(packet string) (Event, error) {
 	}
 
 	var threadIDs []int
+	var stoppedThreadID int
+	var execed bool
 	for _, kvInStr := range strings.Split(packet[3:len(packet)-1], ";") {
 		kvArr := strings.Split(kvInStr, ":")
 		key, value := kvArr[0], kvArr[1]
-		if key == "threads" {
+		if key == "reason" && value == "exec" {
+			execed = true
+		} else if key == "thread" {
+			threadIDInNum, err := hexToUint64(value, false)
+			if err != nil {
+				return Event{}, err
+			}
+			stoppedThreadID = int(threadIDInNum)
+		} else if key == "threads" {
 			for _, threadID := range strings.Split(value, ",") {
 				threadIDInNum, err := hexToUint64(threadID, false)
 				if err != nil {
@@ -718,10 +1380,26 @@ func (c *Client) handleTPacket(packet string) (Event, error) {
 		}
 	}
 
-	trappedThreadIDs, err := c.selectTrappedThreads(threadIDs)
-	if err != nil {
-		return Event{}, err
-	} else if len(trappedThreadIDs) == 0 {
+	if !c.listsThreadsInStopReply && threadIDs == nil && stoppedThreadID != 0 {
+		// the stub reports only the thread which stopped. The other threads are considered not trapped.
+		threadIDs = []int{stoppedThreadID}
+	}
+
+	if execed {
+		c.pendingSignal = 0
+		return Event{Type: EventTypeExec, Data: threadIDs}, nil
+	}
+
+	var trappedThreadIDs []int
+	if c.listsThreadsInStopReply || len(threadIDs) > 1 {
+		trappedThreadIDs, err = c.selectTrappedThreads(threadIDs)
+		if err != nil {
+			return Event{}, err
+		}
+	} else if syscall.Signal(signalNumber) == unix.SIGTRAP {
+		trappedThreadIDs = threadIDs
+	}
+	if len(trappedThreadIDs) == 0 {
 		return c.continueAndWait(int(signalNumber))
 	}
 	if syscall.Signal(signalNumber) != unix.SIGTRAP {
@@ -785,10 +1463,9 @@ func (c *Client) send(command string) error {
 		packet = fmt.Sprintf("$%s#%02x", command, calcChecksum([]byte(command)))
 	}
 
-	if n, err := c.conn.Write([]byte(packet)); err != nil {
+	c.lastPacket = []byte(packet)
+	if err := c.writePacket(c.lastPacket); err != nil {
 		return err
-	} else if n != len(packet) {
-		return fmt.Errorf("only part of the buffer is sent: %d / %d", n, len(packet))
 	}
 
 	if !c.noAckMode {
@@ -797,6 +1474,30 @@ func (c *Client) send(command string) error {
 	return nil
 }
 
+func (c *Client) writePacket(packet []byte) error {
+	// The connection may write only part of the buffer (e.g. the large M packet), so write the remaining part again.
+	buff := packet
+	for len(buff) > 0 {
+		n, err := c.conn.Write(buff)
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("only part of the buffer is sent: %d / %d", len(packet)-len(buff), len(packet))
+		}
+		buff = buff[n:]
+	}
+	return nil
+}
+
+// resendLastPacket sends the last packet again, as the nak requests.
+func (c *Client) resendLastPacket() error {
+	if c.lastPacket == nil {
+		return errors.New("received the nak before any packet is sent")
+	}
+	log.Debugf("received the nak. resend the packet: %s", c.lastPacket)
+	return c.writePacket(c.lastPacket)
+}
+
 func (c *Client) receiveAndCheck() error {
 	if data, err := c.receive(); err != nil {
 		return err
@@ -808,22 +1509,34 @@ func (c *Client) receiveAndCheck() error {
 }
 
 func (c *Client) receive() (string, error) {
-	var rawPacket []byte
+	rawPacket := c.unreadData
+	c.unreadData = nil
 	for {
+		// The ack may arrive after the noack mode starts (e.g. the ack for the QStartNoAckMode response).
+		// Such ack is not the part of the packet and so skipped here. The nak requests the last packet again.
+		for len(rawPacket) > 0 && (rawPacket[0] == '+' || rawPacket[0] == '-') {
+			if rawPacket[0] == '-' {
+				if err := c.resendLastPacket(); err != nil {
+					return "", err
+				}
+			}
+			rawPacket = rawPacket[1:]
+		}
+		if length := packetLength(rawPacket); length > 0 {
+			// the data after the packet, such as the next packet, is returned by the next receive.
+			if length < len(rawPacket) {
+				c.unreadData = rawPacket[length:]
+			}
+			rawPacket = rawPacket[0:length]
+			break
+		}
+
 		n, err := c.conn.Read(c.buffer)
 		if err != nil {
+			c.unreadData = rawPacket
 			return "", err
 		}
-
 		rawPacket = append(rawPacket, c.buffer[0:n]...)
-		if len(rawPacket) < 4 {
-			// there should be at least 4 bytes
-			continue
-		} else if rawPacket[len(rawPacket)-3] == '#' {
-			// received at least 1 packet.
-			// TODO: handle multiple packets case
-			break
-		}
 	}
 
 	packet := string(rawPacket)
@@ -851,13 +1564,53 @@ func (c *Client) sendAck() error {
 }
 
 func (c *Client) receiveAck() error {
-	if _, err := c.conn.Read(c.buffer[0:1]); err != nil {
-		return err
-	} else if c.buffer[0] != '+' {
-		return errors.New("failed to receive ack")
+	for i := 0; ; i++ {
+		var ack byte
+		if len(c.unreadData) > 0 {
+			ack, c.unreadData = c.unreadData[0], c.unreadData[1:]
+		} else {
+			if _, err := c.conn.Read(c.buffer[0:1]); err != nil {
+				return err
+			}
+			ack = c.buffer[0]
+		}
+
+		switch ack {
+		case '+':
+			return nil
+		case '-':
+			if i >= maxResends {
+				return fmt.Errorf("failed to receive ack: the packet is rejected %d times", i+1)
+			}
+			if err := c.resendLastPacket(); err != nil {
+				return err
+			}
+		default:
+			return errors.New("failed to receive ack")
+		}
 	}
+}
 
-	return nil
+// packetLength returns the length of the data up to the end of the first packet ($packet-data#checksum).
+// It returns 0 if the first packet is not complete. The data after the packet, such as the next packet and
+// the trailing acks, is not included in the length.
+func packetLength(data []byte) int {
+	start := bytes.IndexByte(data, '$')
+	if start < 0 {
+		return 0
+	}
+
+	i := start + 1
+	for ; i < len(data) && data[i] != '#'; i++ {
+		if data[i] == '}' {
+			i++ // the next byte is escaped and so is not the end of the packet.
+		}
+	}
+	if i+2 >= len(data) {
+		// the checksum is not received yet
+		return 0
+	}
+	return i + 3
 }
 
 func verifyPacket(packet string) error {
@@ -870,7 +1623,8 @@ func verifyPacket(packet string) error {
 	}
 
 	body := packet[1 : len(packet)-3]
-	bodyChecksum := strconv.FormatUint(uint64(calcChecksum([]byte(body))), 16)
+	// the checksum is always 2 hex digits, so pad the leading zero as the send method does.
+	bodyChecksum := fmt.Sprintf("%02x", calcChecksum([]byte(body)))
 	tailChecksum := packet[len(packet)-2:]
 	if tailChecksum != bodyChecksum {
 		return fmt.Errorf("invalid checksum: %s", tailChecksum)
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/nkbai/tgo/testutils"
+	"golang.org/x/arch/x86/x86asm"
 	"golang.org/x/sys/unix"
 )
 
@@ -64,6 +65,84 @@ func TestAttachProcess_WrongPID(t *testing.T) {
 	}
 }
 
+func TestConnect_NoStub(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := NewClient()
+	if err := client.Connect(addr); err == nil {
+		t.Fatalf("error should be returned")
+	}
+}
+
+func TestInitialize_NoLLDBExtensions(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		// the gdbserver-like stub, which returns the empty response to the lldb extensions.
+		stub := newTestClient(conn, false)
+		for {
+			data, err := stub.receive()
+			if err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			}
+
+			var resp string
+			switch {
+			case data == "QStartNoAckMode":
+				resp = "OK"
+			case data == "vCont?":
+				resp = "vCont;c;C;s;S"
+			case data == "Hg1a":
+				resp = "OK"
+			case data == "g":
+				resp = strings.Repeat("00", 16*8) + "5634120000000000" // rip
+			}
+			if err := stub.send(resp); err != nil {
+				ch <- fmt.Errorf("failed to send response: %v", err)
+				return
+			}
+			stub.noAckMode = true
+
+			if data == "g" {
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := &Client{conn: connForReceive, buffer: make([]byte, maxPacketSize)}
+	if err := client.initialize(); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	if client.supportsThreadSuffix || client.listsThreadsInStopReply || client.readTLSFuncAddr != 0 {
+		t.Errorf("the extensions are considered supported: %#v", client)
+	}
+	if len(client.registerMetadataList) != len(defaultRegisterMetadataList) {
+		t.Errorf("the default register layout is not used: %v", client.registerMetadataList)
+	}
+
+	regs, err := client.ReadRegisters(0x1a)
+	if err != nil {
+		t.Fatalf("failed to read registers: %v", err)
+	}
+	if regs.Rip != 0x123456 {
+		t.Errorf("wrong rip: %x", regs.Rip)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
 func TestDetachProcess_KillProc(t *testing.T) {
 	client := NewClient()
 	err := client.LaunchProcess(testutils.ProgramInfloop)
@@ -119,6 +198,33 @@ func TestReadRegisters(t *testing.T) {
 	}
 }
 
+func TestSetPC(t *testing.T) {
+	client := NewClient()
+	err := client.LaunchProcess(testutils.ProgramInfloop)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer client.DetachProcess()
+
+	threadIDs, err := client.ThreadIDs()
+	if err != nil {
+		t.Fatalf("failed to get thread ids: %v", err)
+	}
+
+	orgRegs, _ := client.ReadRegisters(threadIDs[0])
+	if err := client.SetPC(threadIDs[0], 0x1); err != nil {
+		t.Fatalf("failed to set pc: %v", err)
+	}
+
+	actualRegs, _ := client.ReadRegisters(threadIDs[0])
+	if actualRegs.Rip != 0x1 {
+		t.Errorf("wrong rip: %x", actualRegs.Rip)
+	}
+	if actualRegs.Rsp != orgRegs.Rsp {
+		t.Errorf("rsp is changed: %x", actualRegs.Rsp)
+	}
+}
+
 func TestWriteRegisters(t *testing.T) {
 	client := NewClient()
 	err := client.LaunchProcess(testutils.ProgramInfloop)
@@ -349,6 +455,37 @@ func TestContinueAndWait_Signaled(t *testing.T) {
 
 // No test for CoreDump as the debugserver does not pass the signals like SIGQUIT to the debugee.
 
+func TestHandleTPacket_Exec(t *testing.T) {
+	client := &Client{pendingSignal: 2}
+	event, err := client.handleTPacket("T05thread:1a;threads:1a;reason:exec;")
+	if err != nil {
+		t.Fatalf("failed to handle packet: %v", err)
+	}
+	if event.Type != EventTypeExec {
+		t.Errorf("wrong event type: %v", event.Type)
+	}
+	if threadIDs := event.Data.([]int); len(threadIDs) != 1 || threadIDs[0] != 0x1a {
+		t.Errorf("wrong thread ids: %v", threadIDs)
+	}
+	if client.pendingSignal != 0 {
+		t.Errorf("pending signal is not cleared: %d", client.pendingSignal)
+	}
+}
+
+func TestHandleTPacket_NoThreadsList(t *testing.T) {
+	client := &Client{}
+	event, err := client.handleTPacket("T05thread:1a;")
+	if err != nil {
+		t.Fatalf("failed to handle packet: %v", err)
+	}
+	if event.Type != EventTypeTrapped {
+		t.Errorf("wrong event type: %v", event.Type)
+	}
+	if threadIDs := event.Data.([]int); len(threadIDs) != 1 || threadIDs[0] != 0x1a {
+		t.Errorf("wrong thread ids: %v", threadIDs)
+	}
+}
+
 func TestStepAndWait(t *testing.T) {
 	client := NewClient()
 	err := client.LaunchProcess(testutils.ProgramInfloop)
@@ -486,6 +623,410 @@ func TestSetNoAckMode(t *testing.T) {
 	<-sendDone
 }
 
+func TestSetNoAckMode_DelayedAck(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, false)
+		_, _ = client.receive()
+		_ = client.send("OK")
+		client.noAckMode = true
+
+		if data, err := client.receive(); err != nil {
+			ch <- fmt.Errorf("failed to receive command: %v", err)
+			return
+		} else if data != "QThreadSuffixSupported" {
+			ch <- fmt.Errorf("unexpected data: %s", data)
+			return
+		}
+
+		// the stray ack arrives before the response.
+		if _, err := conn.Write([]byte("+")); err != nil {
+			ch <- fmt.Errorf("failed to write ack: %v", err)
+			return
+		}
+		if err := client.send("OK"); err != nil {
+			ch <- fmt.Errorf("failed to send command: %v", err)
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, false)
+
+	if err := client.setNoAckMode(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if supported, err := client.qThreadSuffixSupported(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !supported {
+		t.Errorf("not supported")
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSend_Nak(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		buff := make([]byte, 64)
+		for _, ack := range []string{"-", "+"} {
+			n, err := conn.Read(buff)
+			if err != nil {
+				ch <- fmt.Errorf("failed to read packet: %v", err)
+				return
+			} else if string(buff[:n]) != "$qC#b4" {
+				ch <- fmt.Errorf("unexpected packet: %s", buff[:n])
+				return
+			}
+
+			if _, err := conn.Write([]byte(ack)); err != nil {
+				ch <- fmt.Errorf("failed to write ack: %v", err)
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, false)
+	if err := client.send("qC"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSend_UnreadAck(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		buff := make([]byte, 64)
+		if n, err := conn.Read(buff); err != nil {
+			ch <- fmt.Errorf("failed to read packet: %v", err)
+		} else if string(buff[:n]) != "$qC#b4" {
+			ch <- fmt.Errorf("unexpected packet: %s", buff[:n])
+		}
+	}(connForSend, sendDone)
+
+	// the ack was received along with the last packet.
+	client := newTestClient(connForReceive, false)
+	client.unreadData = []byte("+")
+	if err := client.send("qC"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(client.unreadData) != 0 {
+		t.Errorf("the ack is not consumed: %q", client.unreadData)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReceive_Nak(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		if _, err := client.receive(); err != nil {
+			ch <- fmt.Errorf("failed to receive command: %v", err)
+			return
+		}
+		// the nak is sent even in the noack mode if the packet is corrupted.
+		if _, err := conn.Write([]byte("-")); err != nil {
+			ch <- fmt.Errorf("failed to write nak: %v", err)
+			return
+		}
+
+		if data, err := client.receive(); err != nil {
+			ch <- fmt.Errorf("failed to receive command: %v", err)
+			return
+		} else if data != "qC" {
+			ch <- fmt.Errorf("unexpected data: %s", data)
+			return
+		}
+		if err := client.send("QC1"); err != nil {
+			ch <- fmt.Errorf("failed to send command: %v", err)
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	if err := client.send("qC"); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+	if data, err := client.receive(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if data != "QC1" {
+		t.Errorf("unexpected data: %s", data)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadWriteRegisters_ThreadSuffix(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		for _, expected := range []string{"g;thread:1a;", "P0=0200000000000000;thread:1a;"} {
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != expected {
+				t.Errorf("unexpected data: %s", data)
+			}
+
+			response := "OK"
+			if strings.HasPrefix(expected, "g") {
+				response = "0100000000000000"
+			}
+			if err := client.send(response); err != nil {
+				ch <- fmt.Errorf("failed to send response: %v", err)
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	client.registerMetadataList = []registerMetadata{{name: "rip", id: 0, offset: 0, size: 8}}
+
+	regs, err := client.ReadRegisters(0x1a)
+	if err != nil {
+		t.Fatalf("failed to read registers: %v", err)
+	}
+	if regs.Rip != 0x1 {
+		t.Errorf("wrong rip: %x", regs.Rip)
+	}
+	if err := client.SetPC(0x1a, 0x2); err != nil {
+		t.Fatalf("failed to set pc: %v", err)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadWriteRegisterByName(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		// the debugserver doesn't support the 'P' command, so the 'G' command is used after the first empty response.
+		for _, expected := range []string{"p1;thread:1a;", "P1=ffff0000;thread:1a;", "g;thread:1a;", "G0100000000000000ffff0000;thread:1a;",
+			"g;thread:1a;", "G0100000000000000ffff0000;thread:1a;"} {
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != expected {
+				t.Errorf("unexpected data: %s", data)
+			}
+
+			response := "OK"
+			if strings.HasPrefix(expected, "p") {
+				response = "02020000"
+			} else if strings.HasPrefix(expected, "P") {
+				response = ""
+			} else if strings.HasPrefix(expected, "g") {
+				response = "0100000000000000" + "02020000"
+			}
+			if err := client.send(response); err != nil {
+				ch <- fmt.Errorf("failed to send response: %v", err)
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	client.registerMetadataList = []registerMetadata{{name: "rip", id: 0, offset: 0, size: 8}, {name: "rflags", id: 1, offset: 8, size: 4}}
+
+	if _, err := client.ReadRegisterByName(0x1a, "xmm0"); err == nil {
+		t.Errorf("error not returned for the unknown register")
+	}
+	val, err := client.ReadRegisterByName(0x1a, "rflags")
+	if err != nil {
+		t.Fatalf("failed to read register: %v", err)
+	}
+	if val != 0x202 {
+		t.Errorf("wrong rflags: %x", val)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.WriteRegisterByName(0x1a, "rflags", 0xffff); err != nil {
+			t.Fatalf("failed to write register: %v", err)
+		}
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteRegisterByName_ErrorResponse(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		// the debugserver rejects the 'P' command, so the 'G' command is used after the first attempt.
+		for _, expected := range []string{"P1=ffff0000;thread:1a;", "g;thread:1a;", "G0100000000000000ffff0000;thread:1a;",
+			"g;thread:1a;", "G0100000000000000ffff0000;thread:1a;"} {
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != expected {
+				t.Errorf("unexpected data: %s", data)
+			}
+
+			response := "OK"
+			if strings.HasPrefix(expected, "P") {
+				response = "E01"
+			} else if strings.HasPrefix(expected, "g") {
+				response = "0100000000000000" + "02020000"
+			}
+			if err := client.send(response); err != nil {
+				ch <- fmt.Errorf("failed to send response: %v", err)
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	client.registerMetadataList = []registerMetadata{{name: "rip", id: 0, offset: 0, size: 8}, {name: "rflags", id: 1, offset: 8, size: 4}}
+
+	for i := 0; i < 2; i++ {
+		if err := client.WriteRegisterByName(0x1a, "rflags", 0xffff); err != nil {
+			t.Errorf("failed to write register: %v", err)
+		}
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuildReadTLSFunction(t *testing.T) {
+	client := newTestClient(nil, false)
+	function := client.buildReadTLSFunction(0x30)
+
+	inst, err := x86asm.Decode(function, 64)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	// ReadTLS restores only rip and rcx.
+	if inst.Len != len(function) {
+		t.Errorf("the function has more than 1 instruction: %d / %d bytes", inst.Len, len(function))
+	}
+	if inst.Op != x86asm.MOV || inst.Args[0] != x86asm.RCX {
+		t.Errorf("the function changes the register other than rcx: %v", inst)
+	}
+	if mem, ok := inst.Args[1].(x86asm.Mem); !ok || mem.Segment != x86asm.GS || mem.Disp != 0x30 {
+		t.Errorf("wrong source: %v", inst.Args[1])
+	}
+}
+
+func TestParseRegisterData(t *testing.T) {
+	client := newTestClient(nil, false)
+	client.registerMetadataList = []registerMetadata{
+		{name: "rax", id: 0, offset: 0, size: 8},
+		{name: "rbx", id: 1, offset: 8, size: 8},
+		{name: "rflags", id: 2, offset: 16, size: 4},
+		{name: "r11", id: 3, offset: 20, size: 8},
+		{name: "r15", id: 4, offset: 28, size: 8},
+		{name: "xmm1", id: 5, offset: 36, size: 16},
+	}
+
+	regs, err := client.parseRegisterData("0100000000000000" + "0200000000000000" + "ffffffff" + "0300000000000000" + "0400000000000000" + "0500000000000000" + "0600000000000000")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if regs.Rax != 0x1 || regs.Rbx != 0x2 || regs.R11 != 0x3 || regs.R15 != 0x4 {
+		t.Errorf("wrong registers: %#v", regs)
+	}
+	// only the lower 64 bits of the xmm register are read.
+	if regs.Xmm[1] != 0x5 {
+		t.Errorf("wrong xmm1: %#x", regs.Xmm[1])
+	}
+}
+
+func TestReadMemory_Chunked(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	const size = maxReadMemorySize*2 + 10
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		for _, testdata := range []struct {
+			expectedCommand string
+			responseSize    int
+		}{
+			{expectedCommand: fmt.Sprintf("m1000,%x", maxReadMemorySize), responseSize: maxReadMemorySize},
+			// the server may return the smaller data than requested.
+			{expectedCommand: fmt.Sprintf("m%x,%x", 0x1000+maxReadMemorySize, maxReadMemorySize), responseSize: 10},
+			{expectedCommand: fmt.Sprintf("m%x,%x", 0x1000+maxReadMemorySize+10, maxReadMemorySize), responseSize: maxReadMemorySize},
+		} {
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != testdata.expectedCommand {
+				t.Errorf("unexpected data: %s", data)
+			}
+
+			if err := client.send(strings.Repeat("01", testdata.responseSize)); err != nil {
+				ch <- fmt.Errorf("failed to send response: %v", err)
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	out := make([]byte, size)
+	if err := client.ReadMemory(0x1000, out); err != nil {
+		t.Fatalf("failed to read memory: %v", err)
+	}
+	for i, b := range out {
+		if b != 0x1 {
+			t.Fatalf("wrong data at %d: %d", i, b)
+		}
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
 func TestSetNoAckMode_ErrorReturned(t *testing.T) {
 	connForReceive, connForSend := net.Pipe()
 
@@ -603,6 +1144,50 @@ func TestQRegisterInfo(t *testing.T) {
 	<-sendDone
 }
 
+func TestQProcessInfo(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		if data, err := client.receive(); err != nil {
+			ch <- fmt.Errorf("failed to receive command: %v", err)
+			return
+		} else if data != "qProcessInfo" {
+			t.Errorf("unexpected data: %s", data)
+		}
+
+		if err := client.send("pid:1a2b;parent-pid:1;real-uid:1f5;real-gid:14;effective-uid:1f5;effective-gid:14;cputype:1000007;cpusubtype:3;ostype:macosx;vendor:apple;endian:little;ptrsize:8;"); err != nil {
+			ch <- fmt.Errorf("failed to send response: %v", err)
+			return
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+
+	info, err := client.qProcessInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := ProcessInfo{PID: 0x1a2b, ParentPID: 1, RealUID: 0x1f5, RealGID: 0x14, EffectiveUID: 0x1f5, EffectiveGID: 0x14, CPUType: 0x1000007, CPUSubtype: 3, OSType: "macosx", Endian: "little", PtrSize: 8}
+	if info != expected {
+		t.Errorf("wrong info: %#v", info)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseProcessInfo_Invalid(t *testing.T) {
+	if _, err := parseProcessInfo("pid:xyz;"); err == nil {
+		t.Errorf("error not returned")
+	}
+}
+
 func TestQRegisterInfo_EndOfRegisterList(t *testing.T) {
 	connForReceive, connForSend := net.Pipe()
 
@@ -646,13 +1231,260 @@ func TestQListThreadsInStopReply(t *testing.T) {
 
 	client := newTestClient(connForReceive, true)
 
-	if err := client.qListThreadsInStopReply(); err != nil {
+	if supported, err := client.qListThreadsInStopReply(); err != nil {
 		t.Errorf("unexpected error: %v", err)
+	} else if !supported {
+		t.Errorf("not supported")
 	}
 
 	<-sendDone
 }
 
+func TestTerminateProcess_AnotherSignal(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	errCh := make(chan error, 1)
+	go func(conn net.Conn) {
+		defer close(errCh)
+
+		client := newTestClient(conn, true)
+		for _, exchange := range []struct{ command, reply string }{
+			{command: buildVContSignalPacket(unix.SIGTERM), reply: fmt.Sprintf("T%02xthread:1a;", int(unix.SIGURG))},
+			{command: buildVContSignalPacket(unix.SIGURG), reply: fmt.Sprintf("T%02xthread:1a;", int(unix.SIGTRAP))},
+			{command: "vCont;c", reply: "W00"},
+		} {
+			if data, err := client.receive(); err != nil {
+				errCh <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != exchange.command {
+				errCh <- fmt.Errorf("unexpected data: %s", data)
+				return
+			}
+
+			if err := client.send(exchange.reply); err != nil {
+				errCh <- fmt.Errorf("failed to send command: %v", err)
+				return
+			}
+		}
+	}(connForSend)
+
+	client := newTestClient(connForReceive, true)
+	client.killSignal = unix.SIGTERM
+
+	if err := client.terminateProcess(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQVContSupported(t *testing.T) {
+	for i, testdata := range []struct {
+		reply    string
+		expected bool
+	}{
+		{reply: "vCont;c;C;s;S;t", expected: true},
+		{reply: "vCont;c;C;s;S", expected: false}, // debugserver
+		{reply: "", expected: false},
+	} {
+		connForReceive, connForSend := net.Pipe()
+
+		sendDone := make(chan error, 1)
+		go func(conn net.Conn, ch chan error, reply string) {
+			defer close(ch)
+			defer conn.Close()
+
+			client := newTestClient(conn, true)
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != "vCont?" {
+				t.Errorf("unexpected data: %s", data)
+			}
+
+			if err := client.send(reply); err != nil {
+				ch <- fmt.Errorf("failed to send command: %v", err)
+				return
+			}
+		}(connForSend, sendDone, testdata.reply)
+
+		client := newTestClient(connForReceive, true)
+
+		if err := client.qVContSupported(); err != nil {
+			t.Errorf("[%d] unexpected error: %v", i, err)
+		}
+		if client.supportsVContStop != testdata.expected {
+			t.Errorf("[%d] wrong support: %v", i, client.supportsVContStop)
+		}
+
+		if err := <-sendDone; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestQSetWorkingDir(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		if data, err := client.receive(); err != nil {
+			ch <- fmt.Errorf("failed to receive command: %v", err)
+			return
+		} else if data != "QSetWorkingDir:2f746d70" {
+			t.Errorf("unexpected data: %s", data)
+		}
+
+		if err := client.send("OK"); err != nil {
+			ch <- fmt.Errorf("failed to send command: %v", err)
+			return
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+
+	if err := client.qSetWorkingDir("/tmp"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStepAndWait_DebugserverVContReply(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan error, 1)
+	go func(conn net.Conn, ch chan error) {
+		defer close(ch)
+		defer conn.Close()
+
+		client := newTestClient(conn, true)
+		for _, exchange := range []struct{ command, reply string }{
+			{command: "vCont?", reply: "vCont;c;C;s;S"}, // the actual reply of debugserver
+			// no action for the other threads, which debugserver keeps stopped.
+			{command: "vCont;s:103", reply: "T05thread:103;threads:103,104;"},
+			{command: "qThreadStopInfo103", reply: "T05thread:103;"},
+			{command: "qThreadStopInfo104", reply: "T00thread:104;"},
+		} {
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != exchange.command {
+				ch <- fmt.Errorf("unexpected data: %s", data)
+				return
+			}
+
+			if err := client.send(exchange.reply); err != nil {
+				ch <- fmt.Errorf("failed to send command: %v", err)
+				return
+			}
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	if err := client.qVContSupported(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	event, err := client.StepAndWait(0x103)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if threadIDs := event.Data.([]int); len(threadIDs) != 1 || threadIDs[0] != 0x103 {
+		t.Errorf("wrong trapped threads: %v", threadIDs)
+	}
+
+	if err := <-sendDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetPassSignals(t *testing.T) {
+	for i, testdata := range []struct {
+		signals   []int
+		expected  string
+		reply     string
+		expectErr bool
+	}{
+		{signals: []int{int(syscall.SIGINT), int(syscall.SIGTERM)}, expected: "QPassSignals:02;0f", reply: "OK"},
+		{signals: nil, expected: "QPassSignals:", reply: "OK"},
+		{signals: []int{int(syscall.SIGTERM)}, expected: "QPassSignals:0f", reply: ""}, // not supported
+		{signals: []int{int(syscall.SIGTERM)}, expected: "QPassSignals:0f", reply: "E01", expectErr: true},
+	} {
+		connForReceive, connForSend := net.Pipe()
+
+		sendDone := make(chan error, 1)
+		go func(conn net.Conn, ch chan error, expected, reply string) {
+			defer close(ch)
+			defer conn.Close()
+
+			client := newTestClient(conn, true)
+			if data, err := client.receive(); err != nil {
+				ch <- fmt.Errorf("failed to receive command: %v", err)
+				return
+			} else if data != expected {
+				t.Errorf("unexpected data: %s", data)
+			}
+
+			if err := client.send(reply); err != nil {
+				ch <- fmt.Errorf("failed to send command: %v", err)
+				return
+			}
+		}(connForSend, sendDone, testdata.expected, testdata.reply)
+
+		client := newTestClient(connForReceive, true)
+
+		err := client.SetPassSignals(testdata.signals)
+		if testdata.expectErr && err == nil {
+			t.Errorf("[%d] error should be returned", i)
+		} else if !testdata.expectErr && err != nil {
+			t.Errorf("[%d] unexpected error: %v", i, err)
+		}
+
+		if err := <-sendDone; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBuildAPacket(t *testing.T) {
+	actual := buildAPacket([]string{"/bin/ls", "-l"})
+	if actual != "A14,0,2f62696e2f6c73,4,1,2d6c" {
+		t.Errorf("unexpected packet: %s", actual)
+	}
+}
+
+func TestBuildVContSignalPacket(t *testing.T) {
+	actual := buildVContSignalPacket(syscall.SIGTERM)
+	if actual != "vCont;C0f" {
+		t.Errorf("unexpected packet: %s", actual)
+	}
+}
+
+func TestBuildVContStepPacket(t *testing.T) {
+	for i, testdata := range []struct {
+		signalNumber int
+		holdOthers   bool
+		expected     string
+	}{
+		{signalNumber: 0, holdOthers: false, expected: "vCont;s:103"},
+		{signalNumber: 0, holdOthers: true, expected: "vCont;s:103;t"},
+		{signalNumber: 0xf, holdOthers: true, expected: "vCont;S0f:103;t"},
+	} {
+		actual := buildVContStepPacket(0x103, testdata.signalNumber, testdata.holdOthers)
+		if actual != testdata.expected {
+			t.Errorf("[%d] unexpected packet: %s", i, actual)
+		}
+	}
+}
+
 func TestQfThreadInfo(t *testing.T) {
 	connForReceive, connForSend := net.Pipe()
 
@@ -711,6 +1543,46 @@ func TestSendAndReceive(t *testing.T) {
 	<-sendDone
 }
 
+func TestReceive_Framing(t *testing.T) {
+	for i, testdata := range []struct {
+		chunks   []string
+		expected []string
+	}{
+		{chunks: []string{"$comm", "and#", "00"}, expected: []string{"command"}},
+		{chunks: []string{"$O}#", "4#00"}, expected: []string{"O}#4"}}, // '#' escaped
+		{chunks: []string{"$OK#00+"}, expected: []string{"OK"}},        // trailing ack
+		{chunks: []string{"$O41#00$T05;", "#00"}, expected: []string{"O41", "T05;"}},
+		{chunks: []string{"$O41#00+$OK#00"}, expected: []string{"O41", "OK"}},
+	} {
+		connForReceive, connForSend := net.Pipe()
+
+		sendDone := make(chan bool)
+		go func(conn net.Conn, ch chan bool) {
+			defer close(ch)
+
+			for _, chunk := range testdata.chunks {
+				if _, err := conn.Write([]byte(chunk)); err != nil {
+					t.Errorf("[%d] failed to write: %v", i, err)
+					return
+				}
+			}
+		}(connForSend, sendDone)
+
+		client := newTestClient(connForReceive, true)
+		for _, expected := range testdata.expected {
+			data, err := client.receive()
+			if err != nil {
+				t.Fatalf("[%d] unexpected error: %v", i, err)
+			}
+			if data != expected {
+				t.Errorf("[%d] receieved unexpected data: %v", i, data)
+			}
+		}
+
+		<-sendDone
+	}
+}
+
 func TestSendAndReceive_NoAckMode(t *testing.T) {
 	connForReceive, connForSend := net.Pipe()
 	cmd := "command"
@@ -746,6 +1618,10 @@ func TestVerifyPacket(t *testing.T) {
 		{packet: "#command#df", expectError: true},
 		{packet: "$command$df", expectError: true},
 		{packet: "$command#00", expectError: true},
+		{packet: "$p4f#0a", expectError: false},
+		{packet: "$p4f#a", expectError: true},
+		{packet: "$pa0#01", expectError: false},
+		{packet: "$#00", expectError: false},
 	} {
 		actual := verifyPacket(test.packet)
 		if test.expectError && actual == nil {
@@ -790,6 +1666,42 @@ func TestUint64ToHex(t *testing.T) {
 	}
 }
 
+func TestSend_ShortWrite(t *testing.T) {
+	connForReceive, connForSend := net.Pipe()
+
+	sendDone := make(chan bool)
+	go func(conn net.Conn, ch chan bool) {
+		defer close(ch)
+
+		client := newTestClient(shortWriteConn{Conn: conn, maxSize: 3}, true)
+		if err := client.send("M1000,4:01020304"); err != nil {
+			t.Errorf("failed to send command: %v", err)
+		}
+	}(connForSend, sendDone)
+
+	client := newTestClient(connForReceive, true)
+	if data, err := client.receive(); err != nil {
+		t.Fatalf("failed to receive command: %v", err)
+	} else if data != "M1000,4:01020304" {
+		t.Errorf("unexpected data: %s", data)
+	}
+
+	<-sendDone
+}
+
+// shortWriteConn writes at most maxSize bytes each time.
+type shortWriteConn struct {
+	net.Conn
+	maxSize int
+}
+
+func (c shortWriteConn) Write(b []byte) (int, error) {
+	if len(b) > c.maxSize {
+		b = b[:c.maxSize]
+	}
+	return c.Conn.Write(b)
+}
+
 func TestChecksum(t *testing.T) {
 	for i, data := range []struct {
 		input    []byte
@@ -799,6 +1711,9 @@ func TestChecksum(t *testing.T) {
 		{input: []byte{0x7f, 0x80}, expected: 255},
 		{input: []byte{0x80, 0x80}, expected: 0},
 		{input: []byte{0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64}, expected: 0xdf},
+		{input: []byte("p4f"), expected: 0x0a},
+		{input: []byte{0xff, 0x02}, expected: 0x01},
+		{input: nil, expected: 0},
 	} {
 		sum := calcChecksum(data.input)
 		if sum != data.expected {
@@ -807,6 +1722,7 @@ func TestChecksum(t *testing.T) {
 	}
 }
 
+// newTestClient returns the client connected to the debugserver-like stub, which supports the lldb extensions.
 func newTestClient(conn net.Conn, noAckMode bool) *Client {
-	return &Client{conn: conn, noAckMode: noAckMode, buffer: make([]byte, maxPacketSize)}
+	return &Client{conn: conn, noAckMode: noAckMode, buffer: make([]byte, maxPacketSize), supportsThreadSuffix: true, listsThreadsInStopReply: true}
 }
@@ -10,6 +10,8 @@ import (
 	"runtime"
 	"strconv"
 	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/nkbai/tgo/log"
 	"golang.org/x/sys/unix"
@@ -38,6 +40,21 @@ func NewClient() *Client {
 	return clientProxy
 }
 
+func (c *Client) SetEnv(env []string) {
+	c.reqCh <- func() { c.raw.SetEnv(env) }
+	<-c.doneCh
+}
+
+func (c *Client) SetWorkingDir(dir string) {
+	c.reqCh <- func() { c.raw.SetWorkingDir(dir) }
+	<-c.doneCh
+}
+
+func (c *Client) SetKillSignal(sig syscall.Signal) {
+	c.reqCh <- func() { c.raw.SetKillSignal(sig) }
+	<-c.doneCh
+}
+
 func (c *Client) LaunchProcess(name string, arg ...string) (err error) {
 	c.reqCh <- func() { err = c.raw.LaunchProcess(name, arg...) }
 	<-c.doneCh
@@ -80,12 +97,26 @@ func (c *Client) WriteRegisters(threadID int, regs Registers) (err error) {
 	return
 }
 
+// SetPC sets the program counter (rip) of the thread.
+func (c *Client) SetPC(threadID int, addr uint64) (err error) {
+	c.reqCh <- func() { err = c.raw.SetPC(threadID, addr) }
+	_ = <-c.doneCh
+	return
+}
+
 func (c *Client) ReadTLS(threadID int, offset int32) (addr uint64, err error) {
 	c.reqCh <- func() { addr, err = c.raw.ReadTLS(threadID, offset) }
 	_ = <-c.doneCh
 	return
 }
 
+// ProgramHeaderAddr returns the address the program header table of the executable is loaded at.
+func (c *Client) ProgramHeaderAddr() (addr uint64, err error) {
+	c.reqCh <- func() { addr, err = c.raw.ProgramHeaderAddr() }
+	_ = <-c.doneCh
+	return
+}
+
 func (c *Client) ContinueAndWait() (ev Event, err error) {
 	c.reqCh <- func() { ev, err = c.raw.ContinueAndWait() }
 	_ = <-c.doneCh
@@ -105,6 +136,11 @@ type rawClient struct {
 	trappedThreadIDs []int
 
 	killOnDetach bool
+	// env and workingDir are passed to the process launched next. See SetEnv and SetWorkingDir.
+	env        []string
+	workingDir string
+	// killSignal is the signal sent to the launched process on detach. SIGKILL if 0.
+	killSignal syscall.Signal
 }
 
 // newRawClient returns the new debug api client which depends on linux ptrace.
@@ -112,12 +148,27 @@ func newRawClient() *rawClient {
 	return &rawClient{}
 }
 
+// SetEnv sets the environment variables, in the form of "key=value", which are added to the process launched next.
+// The process inherits the tracer's environment variables anyway.
+func (c *rawClient) SetEnv(env []string) {
+	c.env = env
+}
+
+// SetWorkingDir sets the working directory of the process launched next. The tracer's one is used if empty.
+func (c *rawClient) SetWorkingDir(dir string) {
+	c.workingDir = dir
+}
+
 // LaunchProcess launches the new prcoess with ptrace enabled.
 func (c *rawClient) LaunchProcess(name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Ptrace: true,
 	}
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	cmd.Dir = c.workingDir
 
 	if err := cmd.Start(); err != nil {
 		return err
@@ -186,7 +237,7 @@ func (c *rawClient) waitAndInitialize(threadID int) error {
 		return fmt.Errorf("unexpected signal: %s", status.StopSignal())
 	}
 
-	unix.PtraceSetOptions(threadID, unix.PTRACE_O_TRACECLONE)
+	unix.PtraceSetOptions(threadID, unix.PTRACE_O_TRACECLONE|unix.PTRACE_O_TRACEEXEC)
 
 	c.tracingThreadIDs = append(c.tracingThreadIDs, threadID)
 	c.trappedThreadIDs = append(c.trappedThreadIDs, threadID)
@@ -212,17 +263,51 @@ func (c *rawClient) DetachProcess() error {
 	return nil
 }
 
+// SetKillSignal sets the signal sent to the launched process when it's killed on detach. SIGKILL is sent if 0,
+// which is the default. Other signals, such as SIGTERM, give the process the chance to run its signal handlers.
+func (c *rawClient) SetKillSignal(sig syscall.Signal) {
+	c.killSignal = sig
+}
+
 func (c *rawClient) killProcess() error {
 	// it may be exited already
 	proc, _ := os.FindProcess(c.tracingProcessID)
+	if c.killSignal != 0 && c.killSignal != unix.SIGKILL {
+		_ = proc.Signal(c.killSignal)
+		if exited, err := c.waitProcessExit(terminateTimeout); exited || err != nil {
+			return err
+		}
+		log.Debugf("the process did not exit in %v after the signal %v. kill it", terminateTimeout, c.killSignal)
+	}
 	_ = proc.Kill()
 
+	_, err := c.waitProcessExit(0)
+	return err
+}
+
+// waitProcessExit waits until the thread leader exits. It returns false if the leader doesn't exit within the timeout.
+// 0 timeout means no limit.
+func (c *rawClient) waitProcessExit(timeout time.Duration) (bool, error) {
+	options := 0
+	if timeout > 0 {
+		options = unix.WNOHANG
+	}
+	deadline := time.Now().Add(timeout)
+
 	// We can't simply call proc.Wait, since it will hang when the thread leader exits while there are still subthreads.
 	// By calling wait4 like below, it reaps the subthreads first and then reaps the thread leader.
 	var status unix.WaitStatus
 	for {
-		if wpid, err := unix.Wait4(-1, &status, 0, nil); err != nil || wpid == c.tracingProcessID {
-			return err
+		wpid, err := unix.Wait4(-1, &status, options, nil)
+		if err != nil || wpid == c.tracingProcessID {
+			return true, err
+		}
+
+		if wpid == 0 {
+			if time.Now().After(deadline) {
+				return false, nil
+			}
+			time.Sleep(10 * time.Millisecond)
 		}
 	}
 }
@@ -267,7 +352,43 @@ func (c *rawClient) ReadRegisters(threadID int) (regs Registers, err error) {
 	regs.Rip = rawRegs.Rip
 	regs.Rsp = rawRegs.Rsp
 	regs.Rcx = rawRegs.Rcx
-	return regs, nil
+	regs.Rax = rawRegs.Rax
+	regs.Rbx = rawRegs.Rbx
+	regs.Rdi = rawRegs.Rdi
+	regs.Rsi = rawRegs.Rsi
+	regs.R8 = rawRegs.R8
+	regs.R9 = rawRegs.R9
+	regs.R10 = rawRegs.R10
+	regs.R11 = rawRegs.R11
+	regs.Rdx = rawRegs.Rdx
+	regs.Rbp = rawRegs.Rbp
+	regs.R12 = rawRegs.R12
+	regs.R13 = rawRegs.R13
+	regs.R14 = rawRegs.R14
+	regs.R15 = rawRegs.R15
+
+	regs.Xmm, err = readXmmRegisters(threadID)
+	return regs, err
+}
+
+// fpRegsSize is the size of user_fpregs_struct, the floating-point registers PTRACE_GETFPREGS reads.
+// The xmm registers, 16 bytes each, start at xmmRegsOffset.
+const (
+	fpRegsSize    = 512
+	xmmRegsOffset = 160
+)
+
+func readXmmRegisters(threadID int) (xmm [15]uint64, err error) {
+	buff := make([]byte, fpRegsSize)
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_GETFPREGS, uintptr(threadID), 0, uintptr(unsafe.Pointer(&buff[0])), 0, 0)
+	if errno != 0 {
+		return xmm, errno
+	}
+
+	for i := range xmm {
+		xmm[i] = binary.LittleEndian.Uint64(buff[xmmRegsOffset+i*16:])
+	}
+	return xmm, nil
 }
 
 // WriteRegisters change the registers of the prcoess.
@@ -280,6 +401,31 @@ func (c *rawClient) WriteRegisters(threadID int, regs Registers) error {
 	rawRegs.Rip = regs.Rip
 	rawRegs.Rsp = regs.Rsp
 	rawRegs.Rcx = regs.Rcx
+	rawRegs.Rax = regs.Rax
+	rawRegs.Rbx = regs.Rbx
+	rawRegs.Rdi = regs.Rdi
+	rawRegs.Rsi = regs.Rsi
+	rawRegs.R8 = regs.R8
+	rawRegs.R9 = regs.R9
+	rawRegs.R10 = regs.R10
+	rawRegs.R11 = regs.R11
+	rawRegs.Rdx = regs.Rdx
+	rawRegs.Rbp = regs.Rbp
+	rawRegs.R12 = regs.R12
+	rawRegs.R13 = regs.R13
+	rawRegs.R14 = regs.R14
+	rawRegs.R15 = regs.R15
+	return unix.PtraceSetRegs(threadID, &rawRegs)
+}
+
+// SetPC sets the program counter (rip) of the thread.
+func (c *rawClient) SetPC(threadID int, addr uint64) error {
+	var rawRegs unix.PtraceRegs
+	if err := unix.PtraceGetRegs(threadID, &rawRegs); err != nil {
+		return err
+	}
+
+	rawRegs.Rip = addr
 	return unix.PtraceSetRegs(threadID, &rawRegs)
 }
 
@@ -297,6 +443,26 @@ func (c *rawClient) ReadTLS(threadID int, offset int32) (uint64, error) {
 	return binary.LittleEndian.Uint64(buff), nil
 }
 
+// atPHDR is the type of the auxiliary vector entry which holds the address of the program header table.
+const atPHDR = 3
+
+// ProgramHeaderAddr returns the address the program header table of the executable is loaded at.
+// It's found in the auxiliary vector, not in the binary, because the PIE may be relocated.
+func (c *rawClient) ProgramHeaderAddr() (uint64, error) {
+	auxv, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", c.tracingProcessID))
+	if err != nil {
+		return 0, err
+	}
+
+	// the auxiliary vector is the list of the (type, value) pairs.
+	for i := 0; i+16 <= len(auxv); i += 16 {
+		if binary.LittleEndian.Uint64(auxv[i:]) == atPHDR {
+			return binary.LittleEndian.Uint64(auxv[i+8:]), nil
+		}
+	}
+	return 0, errors.New("no program header address in the auxiliary vector")
+}
+
 // ContinueAndWait resumes the list of processes and waits until an event happens.
 func (c *rawClient) ContinueAndWait() (Event, error) {
 	return c.continueAndWait(0)
@@ -320,6 +486,8 @@ func (c *rawClient) continueAndWait(sig int) (Event, error) {
 }
 
 // StepAndWait executes the single instruction of the specified process and waits until an event happens.
+// Only the specified thread is resumed, but the other threads are not stopped unless they are trapped.
+// Unlike the darwin client, the threads not trapped keep running during the step.
 // Note that an event happens to any children of the current process is reported.
 func (c *rawClient) StepAndWait(threadID int) (Event, error) {
 	if err := unix.PtraceSingleStep(threadID); err != nil {
@@ -352,6 +520,11 @@ func (c *rawClient) handleWaitStatus(status unix.WaitStatus, threadID int) (even
 					return Event{}, err
 				}
 				return c.continueAndWait(0)
+			} else if status.TrapCause() == unix.PTRACE_EVENT_EXEC {
+				// The other threads are destroyed and the thread which called execve takes over the thread group id.
+				c.tracingThreadIDs = []int{threadID}
+				c.trappedThreadIDs = []int{threadID}
+				return Event{Type: EventTypeExec, Data: []int{threadID}}, nil
 			}
 
 			event = Event{Type: EventTypeTrapped, Data: []int{threadID}}
@@ -1,10 +1,14 @@
 package debugapi
 
 import (
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"reflect"
 	"runtime"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -53,6 +57,34 @@ func TestLaunchProcess(t *testing.T) {
 	}
 }
 
+func TestProgramHeaderAddr(t *testing.T) {
+	client := NewClient()
+	if err := client.LaunchProcess(testutils.ProgramInfloop); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer client.DetachProcess()
+
+	elfFile, err := elf.Open(testutils.ProgramInfloop)
+	if err != nil {
+		t.Fatalf("failed to open the binary: %v", err)
+	}
+	defer elfFile.Close()
+	var expected uint64
+	for _, prog := range elfFile.Progs {
+		if prog.Type == elf.PT_PHDR {
+			expected = prog.Vaddr
+		}
+	}
+
+	// the program is not PIE and so not relocated.
+	addr, err := client.ProgramHeaderAddr()
+	if err != nil {
+		t.Fatalf("failed to get the program header address: %v", err)
+	} else if addr != expected {
+		t.Errorf("wrong address. expect: %#x, actual: %#x", expected, addr)
+	}
+}
+
 func TestLaunchProcess_ProgramNotExist(t *testing.T) {
 	client := newRawClient()
 	err := client.LaunchProcess("notexist")
@@ -61,6 +93,51 @@ func TestLaunchProcess_ProgramNotExist(t *testing.T) {
 	}
 }
 
+func TestLaunchProcess_EnvAndWorkingDir(t *testing.T) {
+	dir := os.TempDir()
+	client := newRawClient()
+	client.SetEnv([]string{"TGO_TEST_ENV=1"})
+	client.SetWorkingDir(dir)
+	err := client.LaunchProcess(testutils.ProgramInfloop)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer client.DetachProcess()
+
+	environ, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", client.tracingProcessID))
+	if err != nil {
+		t.Fatalf("failed to read environ: %v", err)
+	}
+	if !strings.Contains(string(environ), "TGO_TEST_ENV=1\x00") {
+		t.Errorf("env not set: %s", environ)
+	}
+
+	cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", client.tracingProcessID))
+	if err != nil {
+		t.Fatalf("failed to read cwd: %v", err)
+	}
+	if cwd != dir {
+		t.Errorf("wrong working dir: %s", cwd)
+	}
+}
+
+func TestDetachProcess_KillSignal(t *testing.T) {
+	client := newRawClient()
+	client.SetKillSignal(unix.SIGTERM)
+	err := client.LaunchProcess(testutils.ProgramInfloop)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	pid := client.tracingProcessID
+
+	if err := client.DetachProcess(); err != nil {
+		t.Fatalf("failed to detach process: %v", err)
+	}
+	if err := unix.Kill(pid, 0); err != unix.ESRCH {
+		t.Errorf("the process still exists: %v", err)
+	}
+}
+
 func TestAttachProcess(t *testing.T) {
 	cmd := exec.Command(testutils.ProgramInfloop)
 	_ = cmd.Start()
@@ -197,6 +274,44 @@ func TestWriteRegisters(t *testing.T) {
 	}
 }
 
+func TestWriteRegisters_GeneralPurpose(t *testing.T) {
+	client := newRawClient()
+	_ = client.LaunchProcess(testutils.ProgramInfloop)
+	defer client.DetachProcess()
+
+	pid := client.tracingThreadIDs[0]
+	regs, _ := client.ReadRegisters(pid)
+	regs.Rdx, regs.R12, regs.R15 = 0x1, 0x2, 0x3
+	if err := client.WriteRegisters(pid, regs); err != nil {
+		t.Fatalf("failed to write registers (pid: %d): %v", pid, err)
+	}
+
+	regs, _ = client.ReadRegisters(pid)
+	if regs.Rdx != 0x1 || regs.R12 != 0x2 || regs.R15 != 0x3 {
+		t.Errorf("wrong registers: %#v", regs)
+	}
+}
+
+func TestSetPC(t *testing.T) {
+	client := newRawClient()
+	_ = client.LaunchProcess(testutils.ProgramInfloop)
+	defer client.DetachProcess()
+
+	pid := client.tracingThreadIDs[0]
+	orgRegs, _ := client.ReadRegisters(pid)
+	if err := client.SetPC(pid, uint64(testutils.InfloopAddrMain)); err != nil {
+		t.Fatalf("failed to set pc (pid: %d): %v", pid, err)
+	}
+
+	regs, _ := client.ReadRegisters(pid)
+	if regs.Rip != uint64(testutils.InfloopAddrMain) {
+		t.Errorf("wrong rip: %x", regs.Rip)
+	}
+	if regs.Rsp != orgRegs.Rsp {
+		t.Errorf("rsp is changed: %x", regs.Rsp)
+	}
+}
+
 func TestReadTLS(t *testing.T) {
 	client := newRawClient()
 	err := client.LaunchProcess(testutils.ProgramInfloop)
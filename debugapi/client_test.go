@@ -0,0 +1,38 @@
+package debugapi
+
+import "testing"
+
+func TestEventTypePredicates(t *testing.T) {
+	for i, testdata := range []struct {
+		eventType                                         EventType
+		expectedExit, expectedTerminated, expectedTrapped bool
+	}{
+		{eventType: EventTypeTrapped, expectedTrapped: true},
+		{eventType: EventTypeCoreDump, expectedExit: true},
+		{eventType: EventTypeExited, expectedExit: true},
+		{eventType: EventTypeTerminated, expectedExit: true, expectedTerminated: true},
+		{eventType: EventTypeExec},
+	} {
+		if actual := IsExitEvent(testdata.eventType); actual != testdata.expectedExit {
+			t.Errorf("[%d] wrong exit event: %v", i, actual)
+		}
+		if actual := IsTerminatedEvent(testdata.eventType); actual != testdata.expectedTerminated {
+			t.Errorf("[%d] wrong terminated event: %v", i, actual)
+		}
+		if actual := IsTrappedEvent(testdata.eventType); actual != testdata.expectedTrapped {
+			t.Errorf("[%d] wrong trapped event: %v", i, actual)
+		}
+	}
+}
+
+func TestEventType_String(t *testing.T) {
+	if EventTypeExited.String() != "exited" {
+		t.Errorf("wrong name: %s", EventTypeExited)
+	}
+	if EventTypeExec.String() != "exec" {
+		t.Errorf("wrong name: %s", EventTypeExec)
+	}
+	if EventType(-1).String() != "unknown event type (-1)" {
+		t.Errorf("wrong name: %s", EventType(-1))
+	}
+}
@@ -19,7 +19,7 @@ import (
 	"github.com/nkbai/tgo/service"
 )
 
-const expectedVersion = 1
+const expectedVersion = 17
 
 var (
 	client            *rpc.Client
@@ -27,9 +27,13 @@ var (
 	tracerProgramName           = "tgo"
 	traceLevel                  = 1
 	parseLevel                  = 1
+	outputFormat                = ""
+	spansEndpoint               = ""
 	verbose                     = false
 	writer            io.Writer = os.Stdout
 	errorWriter       io.Writer = os.Stderr
+	maxDuration       time.Duration
+	startFunction     string
 	// Protects the server command and its rpc client
 	serverMtx sync.Mutex
 )
@@ -42,11 +46,33 @@ func SetTraceLevel(option int) {
 	traceLevel = option
 }
 
-// SetParseLevel sets the parse level. The trace log includes the function's args. The parselevel option determines how detailed these values should be. The default is 1.
+// SetParseLevel sets the parse level. The trace log includes the function's args. The parselevel option determines how detailed these values should be. If 0, the args are not read at all. The default is 1.
 func SetParseLevel(option int) {
 	parseLevel = option
 }
 
+// SetOutputFormat sets the format of the tracing log, "text", "json", "tree", "collapsed" or "spans". In the json format, each line is the JSON object which has the versioned schema (see tracer.Event). The default is "text".
+func SetOutputFormat(option string) {
+	outputFormat = option
+}
+
+// SetSpansEndpoint sets the OTLP/HTTP endpoint, such as "http://localhost:4318/v1/traces", to which the spans are sent in the "spans" output format. The default is empty, which writes the spans to the writer instead.
+func SetSpansEndpoint(option string) {
+	spansEndpoint = option
+}
+
+// SetMaxDuration sets the max time to trace. The tracing stops when the duration elapses since the tracing is enabled first. The default is 0, which means no limit.
+func SetMaxDuration(option time.Duration) {
+	maxDuration = option
+}
+
+// SetStartFunction sets the name of the function, such as "main.handler", where the tracing starts in addition to the Start's caller.
+// The function is traced from its beginning every time it's called after the first Start. It's useful when Start can't be
+// called at the beginning of the function. Set it before the first Start. The default is "", which adds no function.
+func SetStartFunction(option string) {
+	startFunction = option
+}
+
 // SetVerboseOption sets the verbose option. It true, the debug-level messages are written as well as the normal tracing log. The default is false.
 func SetVerboseOption(option bool) {
 	verbose = option
@@ -111,6 +137,9 @@ func initialize(startTracePoint, endTracePoint uintptr) error {
 		Pid:                    os.Getpid(),
 		TraceLevel:             traceLevel,
 		ParseLevel:             parseLevel,
+		OutputFormat:           outputFormat,
+		SpansEndpoint:          spansEndpoint,
+		MaxDuration:            maxDuration,
 		InitialStartTracePoint: startTracePoint,
 		GoVersion:              runtime.Version(),
 		ProgramPath:            programPath,
@@ -125,6 +154,12 @@ func initialize(startTracePoint, endTracePoint uintptr) error {
 		return err
 	}
 
+	if startFunction != "" {
+		if err := client.Call("Tracer.AddStartTracePointByName", startFunction, reply); err != nil {
+			return err
+		}
+	}
+
 	stopFuncAddr := reflect.ValueOf(Stop).Pointer()
 	return client.Call("Tracer.AddEndTracePoint", stopFuncAddr, reply)
 }
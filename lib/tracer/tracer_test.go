@@ -33,6 +33,16 @@ func TestStart(t *testing.T) {
 	}
 }
 
+func TestSetStartFunction(t *testing.T) {
+	cmd := exec.Command(testutils.ProgramStartFunction)
+	out, _ := cmd.CombinedOutput()
+
+	// the tracing stops before main.tracedFunc is called, and starts again at each call.
+	if strings.Count(string(out), "fmt.Println") != 4 && strings.Count(string(out), "fmt.Fprintln") != 4 /* inlined */ {
+		t.Errorf("unexpected output: %s", string(out))
+	}
+}
+
 func TestStart_NoTracerBinary(t *testing.T) {
 	origTracerName := tracerProgramName
 	tracerProgramName = "not-exist-tracer"
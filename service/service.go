@@ -4,13 +4,22 @@ import (
 	"errors"
 	"net"
 	"net/rpc"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/nkbai/tgo/debugapi"
 	"github.com/nkbai/tgo/log"
 	"github.com/nkbai/tgo/tracer"
 )
 
-const serviceVersion = 1 // increment whenever any changes are aded to service methods.
+const serviceVersion = 17 // increment whenever any changes are aded to service methods.
+
+// detachTimeout is the max time to wait for the tracer to detach when the server is interrupted by the signal.
+// The tracer detaches when the tracee is trapped next time, so it may not detach if the tracee hits no breakpoints.
+const detachTimeout = 5 * time.Second
 
 // Tracer is the wrapper of the actual tracer in tgo/tracer package.
 //
@@ -26,20 +35,63 @@ type Tracer struct {
 type AttachArgs struct {
 	Pid                    int
 	TraceLevel, ParseLevel int
+	// OutputFormat is the format of the traced data, such as "json". The default format is used if empty.
+	OutputFormat string
+	// SpansEndpoint is the OTLP/HTTP endpoint to which the spans are sent in the "spans" output format.
+	// The spans are written to the output if empty.
+	SpansEndpoint string
+	// MaxDuration is the max time to trace the tracee. No limit if 0.
+	MaxDuration time.Duration
+	// BreakOnFirstHit pauses the tracing when the start trace point is hit first time. Call Resume to continue.
+	BreakOnFirstHit bool
 	// This parameter is required because the tracer may not have a chance to set the new trace points
 	// after the attached tracee starts running without trace points.
+	// See also tracer.Controller.ContinueUntilStartTracePoint.
 	InitialStartTracePoint uintptr
 	Verbose                bool
 	GoVersion, ProgramPath string
 	FirstModuleDataAddr    uintptr
 }
 
+// LaunchAndTraceArgs is the input argument of the service method 'Tracer.LaunchAndTrace'
+type LaunchAndTraceArgs struct {
+	ProgramPath            string
+	Args                   []string
+	TraceLevel, ParseLevel int
+	// OutputFormat is the format of the traced data, such as "json". The default format is used if empty.
+	OutputFormat string
+	// SpansEndpoint is the OTLP/HTTP endpoint to which the spans are sent in the "spans" output format.
+	// The spans are written to the output if empty.
+	SpansEndpoint string
+	// MaxDuration is the max time to trace the tracee. No limit if 0.
+	MaxDuration time.Duration
+	// BreakOnFirstHit pauses the tracing when the start trace point is hit first time. Call Resume to continue.
+	BreakOnFirstHit bool
+	// InitialStartTracePointName is the name of the function where the tracing starts, such as 'main.main'.
+	InitialStartTracePointName string
+	GoVersion                  string
+	FirstModuleDataAddr        uintptr
+	// Env is the environment variables, in the form of "key=value", added to the launched program.
+	Env []string
+	// WorkingDir is the working directory of the launched program. The tracer's one is used if empty.
+	WorkingDir string
+	// KillSignal is the signal sent to the launched program when the tracer detaches. SIGKILL if 0.
+	KillSignal syscall.Signal
+}
+
 // Version returns the service version. The backward compatibility may be broken if the version is not same as the expected one.
 func (t *Tracer) Version(args struct{}, reply *int) error {
 	*reply = serviceVersion
 	return nil
 }
 
+// EventSchemaVersion returns the version of the event schema used in the json output format.
+// The consumers of the output can check it before reading the events.
+func (t *Tracer) EventSchemaVersion(args struct{}, reply *int) error {
+	*reply = tracer.EventSchemaVersion
+	return nil
+}
+
 // Attach lets the server attach to the specified process. It does nothing if the server is already attached.
 func (t *Tracer) Attach(args AttachArgs, reply *struct{}) error {
 	t.mtx.Lock()
@@ -48,6 +100,11 @@ func (t *Tracer) Attach(args AttachArgs, reply *struct{}) error {
 		return errors.New("already attached")
 	}
 
+	outputFormat, err := tracer.ParseOutputFormat(args.OutputFormat)
+	if err != nil {
+		return err
+	}
+
 	t.controller = tracer.NewController()
 	attrs := tracer.Attributes{
 		ProgramPath:         args.ProgramPath,
@@ -59,16 +116,69 @@ func (t *Tracer) Attach(args AttachArgs, reply *struct{}) error {
 	}
 	t.controller.SetTraceLevel(args.TraceLevel)
 	t.controller.SetParseLevel(args.ParseLevel)
+	t.controller.SetOutputFormat(outputFormat)
+	t.controller.SetSpansEndpoint(args.SpansEndpoint)
+	t.controller.SetMaxDuration(args.MaxDuration)
+	t.controller.SetBreakOnFirstHitOnly(args.BreakOnFirstHit)
 	t.controller.AddStartTracePoint(uint64(args.InitialStartTracePoint))
 
+	t.startMainLoop()
+	return nil
+}
+
+// LaunchAndTrace lets the server launch the new process and start tracing it from the specified function.
+// It returns error if the server already controls the process.
+func (t *Tracer) LaunchAndTrace(args LaunchAndTraceArgs, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.controller != nil {
+		return errors.New("already attached")
+	}
+
+	outputFormat, err := tracer.ParseOutputFormat(args.OutputFormat)
+	if err != nil {
+		return err
+	}
+
+	controller := tracer.NewController()
+	attrs := tracer.Attributes{
+		ProgramPath:         args.ProgramPath,
+		CompiledGoVersion:   args.GoVersion,
+		FirstModuleDataAddr: uint64(args.FirstModuleDataAddr),
+		Env:                 args.Env,
+		WorkingDir:          args.WorkingDir,
+		KillSignal:          args.KillSignal,
+	}
+	if err := controller.LaunchTracee(args.ProgramPath, args.Args, attrs); err != nil {
+		return err
+	}
+	controller.SetTraceLevel(args.TraceLevel)
+	controller.SetParseLevel(args.ParseLevel)
+	controller.SetOutputFormat(outputFormat)
+	controller.SetSpansEndpoint(args.SpansEndpoint)
+	controller.SetMaxDuration(args.MaxDuration)
+	controller.SetBreakOnFirstHitOnly(args.BreakOnFirstHit)
+	if err := controller.AddStartTracePointByName(args.InitialStartTracePointName); err != nil {
+		// the main loop detaches from the process immediately after interrupted.
+		controller.Interrupt()
+		_ = controller.MainLoop()
+		return err
+	}
+
+	t.controller = controller
+	t.startMainLoop()
+	return nil
+}
+
+func (t *Tracer) startMainLoop() {
+	controller := t.controller
 	go func() {
-		err := t.controller.MainLoop()
+		err := controller.MainLoop()
 		if err != nil && err != tracer.ErrInterrupted {
 			log.Debug(err)
 		}
 		t.errCh <- err
 	}()
-	return nil
 }
 
 // Detach lets the server detach from the attached process.
@@ -104,6 +214,52 @@ func (t *Tracer) AddStartTracePoint(args uintptr, reply *struct{}) error {
 	return t.controller.AddStartTracePoint(uint64(args))
 }
 
+// AddStartTracePointByName adds a new start trace point at the beginning of the specified function.
+func (t *Tracer) AddStartTracePointByName(args string, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return nil
+	}
+	return t.controller.AddStartTracePointByName(args)
+}
+
+// CallerArgs is the input argument of the service method 'Tracer.AddStartTracePointWithCaller'
+type CallerArgs struct {
+	StartTracePoint uintptr
+	// Caller is the name of the function the start trace point's function must be called from, such as 'main.handler'.
+	Caller string
+}
+
+// AddStartTracePointWithCaller adds a new start trace point which starts the tracing only when called from the specified caller.
+func (t *Tracer) AddStartTracePointWithCaller(args CallerArgs, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return nil
+	}
+	return t.controller.AddStartTracePointWithCaller(uint64(args.StartTracePoint), args.Caller)
+}
+
+// LineArgs is the input argument of the service method 'Tracer.AddStartTracePointAtLine'
+type LineArgs struct {
+	File string
+	Line int
+}
+
+// AddStartTracePointAtLine adds a new start trace point at the statement of the specified source location.
+func (t *Tracer) AddStartTracePointAtLine(args LineArgs, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return nil
+	}
+	return t.controller.AddStartTracePointAtLine(args.File, args.Line)
+}
+
 // AddEndTracePoint adds a new end trace point.
 func (t *Tracer) AddEndTracePoint(args uintptr, reply *struct{}) error {
 	t.mtx.Lock()
@@ -115,7 +271,182 @@ func (t *Tracer) AddEndTracePoint(args uintptr, reply *struct{}) error {
 	return t.controller.AddEndTracePoint(uint64(args))
 }
 
-// Serve serves the tracer service.
+// ClearAllTracePoints removes all the start and end trace points.
+func (t *Tracer) ClearAllTracePoints(args struct{}, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return nil
+	}
+	return t.controller.ClearAllTracePoints()
+}
+
+// currentController returns the controller, or nil if not attached. The calls which wait for the tracee to be trapped
+// use it instead of holding the lock, so that Detach is not blocked while the tracee runs.
+func (t *Tracer) currentController() *tracer.Controller {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.controller
+}
+
+// CurrentArguments returns the arguments of the function the last trapped go routine is running.
+func (t *Tracer) CurrentArguments(args struct{}, reply *[]tracer.Argument) error {
+	controller := t.currentController()
+	if controller == nil {
+		return errors.New("not attached")
+	}
+
+	currArgs, err := controller.CurrentArguments()
+	if err != nil {
+		return err
+	}
+	*reply = currArgs
+	return nil
+}
+
+// CurrentRegisters returns the registers of the thread the last trapped go routine is running on.
+func (t *Tracer) CurrentRegisters(args struct{}, reply *debugapi.Registers) error {
+	controller := t.currentController()
+	if controller == nil {
+		return errors.New("not attached")
+	}
+
+	regs, err := controller.CurrentRegisters()
+	if err != nil {
+		return err
+	}
+	*reply = regs
+	return nil
+}
+
+// ReadMemoryArgs is the input argument of the service method 'Tracer.ReadMemory'
+type ReadMemoryArgs struct {
+	Addr uintptr
+	Size int
+}
+
+// ReadMemory returns the memory of the tracee at the specified address.
+func (t *Tracer) ReadMemory(args ReadMemoryArgs, reply *[]byte) error {
+	controller := t.currentController()
+	if controller == nil {
+		return errors.New("not attached")
+	}
+
+	data, err := controller.ReadMemory(uint64(args.Addr), args.Size)
+	if err != nil {
+		return err
+	}
+	*reply = data
+	return nil
+}
+
+// ReadParameter returns the parsed value of the parameter of the function the last trapped go routine is running.
+func (t *Tracer) ReadParameter(args string, reply *string) error {
+	controller := t.currentController()
+	if controller == nil {
+		return errors.New("not attached")
+	}
+
+	value, err := controller.ReadParameter(args)
+	if err != nil {
+		return err
+	}
+	*reply = value
+	return nil
+}
+
+// Resume resumes the tracing paused at the first hit of the start trace point.
+func (t *Tracer) Resume(args struct{}, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return errors.New("not attached")
+	}
+	return t.controller.Resume()
+}
+
+// PauseTracing temporarily stops printing the traced data. The trace points are kept and the tracee keeps running.
+func (t *Tracer) PauseTracing(args struct{}, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return errors.New("not attached")
+	}
+	return t.controller.PauseTracing()
+}
+
+// ResumeTracing resumes the tracing paused by PauseTracing.
+func (t *Tracer) ResumeTracing(args struct{}, reply *struct{}) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return errors.New("not attached")
+	}
+	return t.controller.ResumeTracing()
+}
+
+// GoVersion returns the go version the tracee is compiled with, such as "go1.11.1". It's empty if unknown.
+// The version is found in the binary and so may differ from the GoVersion given when attached.
+func (t *Tracer) GoVersion(args struct{}, reply *string) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		return errors.New("not attached")
+	}
+	*reply = t.controller.GoVersion().Raw
+	return nil
+}
+
+// State returns the run state of the tracee, such as "running" or "stopped". It's "detached" if the server is not attached.
+func (t *Tracer) State(args struct{}, reply *string) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.controller == nil {
+		*reply = tracer.StateDetached.String()
+		return nil
+	}
+	*reply = t.controller.State().String()
+	return nil
+}
+
+// detachOnSignal detaches from the tracee as Detach does when the signal is received, so that the tracee is not left
+// stopped with the breakpoints installed. Then it calls the shutdown function to let the server exit.
+func (t *Tracer) detachOnSignal(sigCh <-chan os.Signal, shutdown func()) {
+	sig, ok := <-sigCh
+	if !ok {
+		return
+	}
+	log.Printf("received %v signal. detaching...", sig)
+
+	// Wait for the on-going Detach call if any.
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.controller != nil {
+		t.controller.Interrupt()
+		select {
+		case err := <-t.errCh:
+			if err != nil && err != tracer.ErrInterrupted {
+				log.Printf("%v", err)
+			} else {
+				log.Printf("detached")
+			}
+			t.controller = nil
+		case <-time.After(detachTimeout):
+			log.Printf("failed to detach in %v. The tracee may be left stopped", detachTimeout)
+		}
+	}
+
+	shutdown()
+}
+
+// Serve serves the tracer service. The server detaches from the tracee and exits when it receives
+// SIGINT or SIGTERM signal.
 func Serve(address string) error {
 	tracer := &Tracer{errCh: make(chan error)}
 	rpc.Register(tracer)
@@ -125,15 +456,35 @@ func Serve(address string) error {
 		return err
 	}
 
+	var connMtx sync.Mutex // protects conn
+	var conn net.Conn
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(sigCh)
+		close(sigCh)
+	}()
+	go tracer.detachOnSignal(sigCh, func() {
+		listener.Close()
+		connMtx.Lock()
+		defer connMtx.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+	})
+
 	// The server is running only for 1 client. So close the listener socket immediately and
 	// do not create a new go routine for a new connection.
-	conn, err := listener.Accept()
+	acceptedConn, err := listener.Accept()
 	listener.Close()
 	if err != nil {
 		return err
 	}
+	connMtx.Lock()
+	conn = acceptedConn
+	connMtx.Unlock()
 
-	rpc.ServeConn(conn)
-	conn.Close() // connection may be closed already
+	rpc.ServeConn(acceptedConn)
+	acceptedConn.Close() // connection may be closed already
 	return nil
 }
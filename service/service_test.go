@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
 	"runtime"
 	"testing"
@@ -15,7 +16,7 @@ func TestAttachAndDetach(t *testing.T) {
 	cmd := exec.Command(testutils.ProgramInfloop)
 	_ = cmd.Start()
 
-	tracer := &Tracer{}
+	tracer := &Tracer{errCh: make(chan error)}
 	args := AttachArgs{
 		Pid:                    cmd.Process.Pid,
 		InitialStartTracePoint: uintptr(testutils.InfloopAddrMain),
@@ -29,11 +30,88 @@ func TestAttachAndDetach(t *testing.T) {
 	if err := tracer.Detach(struct{}{}, nil); err != nil {
 		t.Errorf("failed to detach: %v", err)
 	}
+	waitDetached(t, tracer)
 
 	cmd.Process.Kill()
 	cmd.Process.Wait()
 }
 
+func TestDetachOnSignal(t *testing.T) {
+	cmd := exec.Command(testutils.ProgramInfloop)
+	_ = cmd.Start()
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+	}()
+
+	tracer := &Tracer{errCh: make(chan error)}
+	args := AttachArgs{
+		Pid:                    cmd.Process.Pid,
+		InitialStartTracePoint: uintptr(testutils.InfloopAddrMain),
+		ProgramPath:            testutils.ProgramInfloop,
+		GoVersion:              runtime.Version(),
+	}
+	if err := tracer.Attach(args, nil); err != nil {
+		t.Fatalf("failed to attach: %v", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	sigCh <- os.Interrupt
+	var shutdown bool
+	tracer.detachOnSignal(sigCh, func() { shutdown = true })
+
+	if tracer.controller != nil {
+		t.Errorf("not detached")
+	}
+	if !shutdown {
+		t.Errorf("not shut down")
+	}
+}
+
+func TestLaunchAndTraceAndDetach(t *testing.T) {
+	tracer := &Tracer{errCh: make(chan error)}
+	args := LaunchAndTraceArgs{
+		ProgramPath:                testutils.ProgramInfloop,
+		InitialStartTracePointName: "main.main",
+		GoVersion:                  runtime.Version(),
+	}
+	if err := tracer.LaunchAndTrace(args, nil); err != nil {
+		t.Fatalf("failed to launch: %v", err)
+	}
+	if err := tracer.LaunchAndTrace(args, nil); err == nil {
+		t.Errorf("error is not returned though the process is already traced")
+	}
+
+	if err := tracer.Detach(struct{}{}, nil); err != nil {
+		t.Errorf("failed to detach: %v", err)
+	}
+	waitDetached(t, tracer)
+}
+
+// waitDetached waits until the main loop finishes after Detach, which holds the lock until then.
+func waitDetached(t *testing.T, tracer *Tracer) {
+	tracer.mtx.Lock()
+	defer tracer.mtx.Unlock()
+	if tracer.controller != nil {
+		t.Errorf("not detached")
+	}
+}
+
+func TestLaunchAndTrace_UnknownFunction(t *testing.T) {
+	tracer := &Tracer{errCh: make(chan error)}
+	args := LaunchAndTraceArgs{
+		ProgramPath:                testutils.ProgramInfloop,
+		InitialStartTracePointName: "main.notExist",
+		GoVersion:                  runtime.Version(),
+	}
+	if err := tracer.LaunchAndTrace(args, nil); err == nil {
+		t.Errorf("error is not returned")
+	}
+	if tracer.controller != nil {
+		t.Errorf("controller is not cleared")
+	}
+}
+
 func TestServe(t *testing.T) {
 	unusedPort, err := findUnusedPort()
 	if err != nil {
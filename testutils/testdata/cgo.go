@@ -0,0 +1,22 @@
+package main
+
+// #include <stdio.h>
+// #include <stdlib.h>
+//
+// static void hello(const char *name) {
+//     printf("Hello %s\n", name);
+//     fflush(stdout);
+// }
+import "C"
+import "unsafe"
+
+//go:noinline
+func callC() {
+	name := C.CString("world")
+	C.hello(name)
+	C.free(unsafe.Pointer(name))
+}
+
+func main() {
+	callC()
+}
@@ -10,7 +10,10 @@ func main() {
 }
 
 func f() {
-	defer catch()
+	// deferred in the loop, so that the defer is not open-coded and the _defer struct is linked to the go routine.
+	for i := 0; i < 1; i++ {
+		defer catch()
+	}
 	fmt.Println("Calling g.")
 	g(0)
 	fmt.Println("Returned normally from g.")
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nkbai/tgo/lib/tracer"
+)
+
+//go:noinline
+func tracedFunc() {
+	fmt.Println("traced")
+}
+
+func main() {
+	tracer.SetStartFunction("main.tracedFunc")
+	if err := tracer.Start(); err != nil {
+		panic(err)
+	}
+	tracer.Stop()
+
+	tracedFunc()
+	tracedFunc()
+}
@@ -79,6 +79,15 @@ func (s S) M() {
 
 type S2 string
 
+type Mode int
+
+const (
+	ModeRead Mode = iota + 1
+	ModeWrite
+)
+
+const untypedCount = 12345
+
 func (s *S2) M() {
 }
 
@@ -134,6 +143,35 @@ func printNilMap(v map[int]int) {
 func printChan(v chan int) {
 }
 
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+//go:noinline
+func printGeneric[K comparable, V any](v Pair[K, V]) {
+}
+
+//go:noinline
+func callGeneric() {
+	printGeneric(Pair[string, int]{Key: "a", Val: 1})
+}
+
+type Padded struct {
+	b bool
+	c int32
+}
+
+//go:noinline
+func mixedResults() (int, float64, Padded, complex128, bool) {
+	return 1, 0.5, Padded{b: true, c: -1}, complex(2, 3), true
+}
+
+//go:noinline
+func printMixedResults() {
+	mixedResults()
+}
+
 func main() {
 	printBool(true)
 	printInt8(-1)
@@ -164,4 +202,6 @@ func main() {
 	printMap(map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8, 9: 9, 10: 10, 11: 11, 12: 12, 13: 13, 14: 14, 15: 15, 16: 16, 17: 17, 18: 18, 19: 19, 20: 20})
 	printNilMap(nil)
 	printChan(make(chan int))
+	callGeneric()
+	printMixedResults()
 }
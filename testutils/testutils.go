@@ -83,6 +83,8 @@ var (
 	TypePrintAddrPrintMap               uint64
 	TypePrintAddrPrintNilMap            uint64
 	TypePrintAddrPrintChan              uint64
+	TypePrintAddrPrintMixedResults      uint64
+	TypePrintAddrCallGeneric            uint64
 
 	ProgramStartStop             string
 	StartStopAddrTracedFunc      uint64
@@ -91,9 +93,17 @@ var (
 
 	ProgramStartOnly string
 
+	ProgramStartFunction string
+
 	ProgramSpecialFuncs             string
 	SpecialFuncsAddrMain            uint64
 	SpecialFuncsAddrFirstModuleData uint64
+
+	// ProgramCgo is empty if the program is not built, for example, due to the lack of the C compiler.
+	ProgramCgo             string
+	CgoAddrCallC           uint64
+	CgoAddrCFuncHello      uint64 // the C function the cgo generates to call `C.hello`.
+	CgoAddrFirstModuleData uint64
 )
 
 func init() {
@@ -124,9 +134,16 @@ func init() {
 	if err := buildProgramStartOnly(srcDirname); err != nil {
 		panic(err)
 	}
+	if err := buildProgramStartFunction(srcDirname); err != nil {
+		panic(err)
+	}
 	if err := buildProgramSpecialFuncs(srcDirname); err != nil {
 		panic(err)
 	}
+	if err := buildProgramCgo(srcDirname); err != nil {
+		log.Printf("skip the cgo program: %v", err)
+		ProgramCgo = ""
+	}
 
 	log.EnableDebugLog = true
 }
@@ -334,6 +351,10 @@ func buildProgramTypePrint(srcDirname string) error {
 			TypePrintAddrPrintNilMap = value
 		case "main.printChan":
 			TypePrintAddrPrintChan = value
+		case "main.printMixedResults":
+			TypePrintAddrPrintMixedResults = value
+		case "main.callGeneric":
+			TypePrintAddrCallGeneric = value
 		}
 		return nil
 	}
@@ -369,6 +390,12 @@ func buildProgramStartOnly(srcDirname string) error {
 	return buildProgram(ProgramStartOnly)
 }
 
+func buildProgramStartFunction(srcDirname string) error {
+	ProgramStartFunction = srcDirname + "/testdata/startFunction"
+
+	return buildProgram(ProgramStartFunction)
+}
+
 func buildProgramSpecialFuncs(srcDirname string) error {
 	ProgramSpecialFuncs = srcDirname + "/testdata/specialFuncs"
 
@@ -389,6 +416,30 @@ func buildProgramSpecialFuncs(srcDirname string) error {
 	return walkSymbols(ProgramSpecialFuncs, updateAddressIfMatched)
 }
 
+func buildProgramCgo(srcDirname string) error {
+	ProgramCgo = srcDirname + "/testdata/cgo"
+
+	if err := buildProgram(ProgramCgo); err != nil {
+		return err
+	}
+
+	updateAddressIfMatched := func(name string, value uint64) error {
+		switch name {
+		case "main.callC":
+			CgoAddrCallC = value
+		case "runtime.firstmoduledata":
+			CgoAddrFirstModuleData = value
+		default:
+			if strings.HasSuffix(name, "_Cfunc_hello") && !strings.HasPrefix(name, "main.") {
+				CgoAddrCFuncHello = value
+			}
+		}
+		return nil
+	}
+
+	return walkSymbols(ProgramCgo, updateAddressIfMatched)
+}
+
 func buildProgram(programName string) error {
 	// Optimization is enabled, because the tool aims to work well even if the binary is optimized.
 	linkOptions := ""
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -17,33 +18,129 @@ const (
 	// AttrVariableParameter is the extended DWARF attribute. If true, the parameter is output. Else, it's input.
 	attrVariableParameter = 0x4b
 	attrGoRuntimeType     = 0x2904 // DW_AT_go_runtime_type
+	attrGoEmbeddedField   = 0x2903 // DW_AT_go_embedded_field
 	dwarfOpCallFrameCFA   = 0x9c   // DW_OP_call_frame_cfa
 	dwarfOpFbreg          = 0x91   // DW_OP_fbreg
+	dwarfOpReg0           = 0x50   // DW_OP_reg0
+	dwarfOpReg31          = 0x6f   // DW_OP_reg31
+	dwarfOpRegx           = 0x90   // DW_OP_regx
+	dwarfOpPiece          = 0x93   // DW_OP_piece
 )
 
 // BinaryFile represents the program the tracee process is executing.
 type BinaryFile interface {
 	// FindFunction returns the function info to which the given pc specifies.
 	FindFunction(pc uint64) (*Function, error)
+	// FindFunctionByName returns the function info which has the given name.
+	FindFunctionByName(name string) (*Function, error)
+	// FindInitFunctions returns the init functions of the package, such as `main.init.0`.
+	FindInitFunctions(pkgName string) ([]*Function, error)
+	// FunctionSignature returns the parameters of the function which has the given name. No process is required.
+	FunctionSignature(name string) ([]Parameter, error)
+	// RuntimeFunctionAddr returns the start address of the runtime function.
+	RuntimeFunctionAddr(name string) (uint64, error)
+	// PrologueEndAddr returns the address where the function's prologue ends.
+	PrologueEndAddr(f *Function) (uint64, error)
+	// LineAddr returns the address of the statement at the source location, such as `main.go:42`.
+	LineAddr(file string, line int) (uint64, error)
+	// TypeByName returns the dwarf.Type which has the given name, such as `main.Config`.
+	TypeByName(name string) (dwarf.Type, error)
+	// Types returns all the named types in the debug info, sorted by name.
+	Types() ([]TypeEntry, error)
+	// GoVersion returns the go version the program is compiled with. The Raw field is empty if unknown.
+	GoVersion() GoVersion
+	// IsPIE returns true if the program is the position independent executable, which may be loaded at the address
+	// different from the one in the binary file.
+	IsPIE() bool
 	// Close closes the binary file.
 	Close() error
 	// findDwarfTypeByAddr finds the dwarf.Type to which the given address specifies.
 	// The given address must be the address of the type (not value) and need to be adjusted
 	// using the moduledata.
 	findDwarfTypeByAddr(typeAddr uint64) (dwarf.Type, error)
+	// findFunctionName returns the name of the function to which the given pc specifies. The parameters are not read.
+	findFunctionName(pc uint64) (string, error)
 	// moduleDataType returns the dwarf.Type of runtime.moduledata struct type.
 	moduleDataType() dwarf.Type
 	// runtimeGType returns the dwarf.Type of runtime.g struct type.
 	runtimeGType() dwarf.Type
+	// findConstantName returns the name of the package-level constant which has the given type and value.
+	// It returns false if no constant or 2 or more constants match.
+	findConstantName(typeName string, val int64) (string, bool)
+	// isEmbeddedField returns true if the field of the struct is the embedded field, such as `T` and `*T`.
+	isEmbeddedField(structName, fieldName string) bool
+	// readStaticData reads the data at the address from the binary file rather than the process memory.
+	// The data is the initial one and so may differ from the process memory if it's writable.
+	readStaticData(addr uint64, out []byte) error
+	// firstModuleDataAddr returns the address of runtime.firstmoduledata in the binary file. 0 if unknown.
+	firstModuleDataAddr() uint64
+	// osArgsAddr returns the address of os.Args in the binary file. 0 if unknown.
+	osArgsAddr() uint64
+	// programHeaderAddr returns the address of the ELF program header table in the binary file. 0 if unknown or not ELF.
+	programHeaderAddr() uint64
 }
 
+// firstModuleDataSymbol is the symbol of the first moduledata, which is used to find the address the program is loaded at.
+const firstModuleDataSymbol = "runtime.firstmoduledata"
+
+// osArgsSymbol is the symbol of the command-line arguments the os package holds.
+const osArgsSymbol = "os.Args"
+
 // debuggableBinaryFile represents the binary file with DWARF sections.
 type debuggableBinaryFile struct {
-	dwarf                dwarfData
-	closer               io.Closer
-	types                map[uint64]dwarf.Offset
+	dwarf  dwarfData
+	closer io.Closer
+	types  map[uint64]dwarf.Offset
+	// typeNames is the index of the types. The key is the type name.
+	typeNames map[string]dwarf.Offset
+	// constantNames is the index of the package-level constants. The name is empty if 2 or more constants have the same key.
+	constantNames map[constantKey]string
+	// embeddedFields is the set of the embedded fields, which have the DW_AT_go_embedded_field attribute.
+	embeddedFields       map[embeddedFieldKey]bool
 	cachedRuntimeGType   dwarf.Type
 	cachedModuleDataType dwarf.Type
+	// runtimeFuncAddrs caches the addresses of the runtime functions. The key is the function name.
+	runtimeFuncAddrs map[string]uint64
+	goVersion        GoVersion
+	segments         loadedSegments
+	pie              bool
+	// staticFirstModuleDataAddr is the address of the firstModuleDataSymbol in the binary file.
+	staticFirstModuleDataAddr uint64
+	// staticOSArgsAddr is the address of the osArgsSymbol in the binary file.
+	staticOSArgsAddr uint64
+	// staticProgramHeaderAddr is the address of the program header table in the binary file. Set only if ELF.
+	staticProgramHeaderAddr uint64
+	// dictionaryNames is the names of the dictionary symbols of the generic function instantiations,
+	// such as `main..dict.F[int]`. They tell the type arguments the shapes in the debug info hide.
+	dictionaryNames []string
+}
+
+// TypeEntry is the named type in the debug info.
+type TypeEntry struct {
+	Name string
+	Type dwarf.Type
+	// RuntimeTypeAddr is the address of the runtime type in the binary file. 0 if the type has no runtime type
+	// or the go version doesn't record it.
+	RuntimeTypeAddr uint64
+}
+
+// loadedSegment is the segment of the binary file, which is loaded to the process memory at the address.
+type loadedSegment struct {
+	io.ReaderAt
+	addr, size uint64
+}
+
+type loadedSegments []loadedSegment
+
+// ReadMemory reads the data at the virtual address from the segment which contains it.
+func (s loadedSegments) ReadMemory(addr uint64, out []byte) error {
+	for _, segment := range s {
+		if segment.addr <= addr && addr+uint64(len(out)) <= segment.addr+segment.size {
+			_, err := segment.ReadAt(out, int64(addr-segment.addr))
+			return err
+		}
+	}
+	return fmt.Errorf("no segment contains %#x", addr)
 }
 
 type dwarfData struct {
@@ -57,9 +154,13 @@ type Function struct {
 	// StartAddr is the start address of the function, inclusive.
 	StartAddr uint64
 	// EndAddr is the end address of the function, exclusive. 0 if unknown.
+	// If the code is not contiguous, it's the end of the range which contains StartAddr.
 	EndAddr uint64
 	// Parameters may be empty due to the lack of information.
 	Parameters []Parameter
+	// FrameBaseIsCFA is true if the parameter offsets are relative to the CFA. Otherwise, the offsets are
+	// not reliable and so the parameter values should not be read.
+	FrameBaseIsCFA bool
 }
 
 // Parameter represents a parameter given to or the returned from the function.
@@ -68,25 +169,47 @@ type Parameter struct {
 	Typ  dwarf.Type
 	// Offset is the offset from the beginning of the parameter list.
 	Offset int
+	// Pieces is the list of the locations each part of the value is stored in, in the order of the value's bytes.
+	// It's nil if the whole value is in the memory and Offset specifies its location.
+	Pieces []ParameterPiece
 	// Exist is false when the parameter is removed due to the optimization.
 	Exist    bool
 	IsOutput bool
 }
 
+// ParameterPiece represents the location of the part of the parameter value.
+// The Go internal ABI may pass the value in the registers, or split it into the registers and the stack.
+type ParameterPiece struct {
+	// Size is the size of the piece. 0 if the piece is the whole value.
+	Size int
+	// InRegister is true if the piece is in the register specified by RegisterNum (the DWARF register number).
+	// Otherwise, the piece is in the memory and Offset is the offset from the beginning of the parameter list.
+	InRegister  bool
+	RegisterNum int
+	Offset      int
+	// NoLocation is true if the piece has no location, such as the padding of the struct. The piece is read as zeros.
+	NoLocation bool
+}
+
 // OpenBinaryFile opens the specified program file.
 func OpenBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, error) {
 	return openBinaryFile(pathToProgram, goVersion)
 }
 
+// OpenBinaryReader opens the program from the reader. It is useful when the program is not on the file system.
+// The reader is not closed when the returned BinaryFile is closed.
+func OpenBinaryReader(r io.ReaderAt, goVersion GoVersion) (BinaryFile, error) {
+	return openBinaryReader(r, goVersion)
+}
+
 func newDebuggableBinaryFile(data dwarfData, goVersion GoVersion, closer io.Closer) (debuggableBinaryFile, error) {
-	binary := debuggableBinaryFile{dwarf: data, closer: closer}
+	binary := debuggableBinaryFile{dwarf: data, closer: closer, runtimeFuncAddrs: make(map[string]uint64)}
 
-	var err error
-	binary.types, err = binary.buildTypes(goVersion)
-	if err != nil {
+	if err := binary.buildTypes(goVersion); err != nil {
 		return debuggableBinaryFile{}, err
 	}
 
+	var err error
 	binary.cachedModuleDataType, err = binary.findModuleDataType()
 	if err != nil {
 		return debuggableBinaryFile{}, err
@@ -97,32 +220,149 @@ func newDebuggableBinaryFile(data dwarfData, goVersion GoVersion, closer io.Clos
 		return debuggableBinaryFile{}, err
 	}
 
+	binary.goVersion = binary.findGoVersion()
 	return binary, nil
 }
 
-func (b debuggableBinaryFile) buildTypes(goVersion GoVersion) (map[uint64]dwarf.Offset, error) {
-	if !goVersion.LaterThan(GoVersion{MajorVersion: 1, MinorVersion: 11, PatchVersion: 0}) {
-		// attrGoRuntimeType is not supported
-		return nil, nil
-	}
-	types := make(map[uint64]dwarf.Offset)
+// findGoVersion finds the go version from the producer attribute of the compile unit,
+// such as `Go cmd/compile go1.11.1; regabi`.
+func (b debuggableBinaryFile) findGoVersion() GoVersion {
+	const producerPrefix = "Go cmd/compile "
+
 	reader := b.dwarf.Reader()
 	for {
 		entry, err := reader.Next()
 		if err != nil || entry == nil {
-			return types, err
+			break
+		}
+
+		if entry.Tag == dwarf.TagCompileUnit {
+			producer, ok := entry.Val(dwarf.AttrProducer).(string)
+			if ok && strings.HasPrefix(producer, producerPrefix) {
+				version := strings.TrimPrefix(producer, producerPrefix)
+				if i := strings.IndexAny(version, "; "); i >= 0 {
+					version = version[:i]
+				}
+				return ParseGoVersion(version)
+			}
+		}
+		reader.SkipChildren()
+	}
+
+	log.Debugf("failed to find the go version from the binary")
+	return GoVersion{}
+}
+
+type constantKey struct {
+	typeName string
+	val      int64
+}
+
+type embeddedFieldKey struct {
+	structName, fieldName string
+}
+
+type constantEntry struct {
+	name       string
+	typeOffset dwarf.Offset
+	val        int64
+}
+
+// buildTypes builds the indexes of the types, constants and embedded fields.
+func (b *debuggableBinaryFile) buildTypes(goVersion GoVersion) error {
+	// attrGoRuntimeType is not supported before go 1.11
+	hasRuntimeType := goVersion.AtLeast(1, 11)
+	if hasRuntimeType {
+		b.types = make(map[uint64]dwarf.Offset)
+	}
+	b.typeNames = make(map[string]dwarf.Offset)
+	offsetToTypeName := make(map[dwarf.Offset]string)
+	b.embeddedFields = make(map[embeddedFieldKey]bool)
+	var constants []constantEntry
+	// structName is the name of the struct whose members are read now. Empty if not inside the struct.
+	var structName string
+	reader := b.dwarf.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return err
+		} else if entry == nil {
+			break
+		}
+
+		if entry.Tag == dwarf.TagStructType && entry.Children {
+			structName, _ = stringClassAttr(entry, dwarf.AttrName)
 		}
 
 		switch entry.Tag {
+		case 0:
+			structName = "" // the end of the children
+		case dwarf.TagMember:
+			if embedded, err := flagClassAttr(entry, attrGoEmbeddedField); err == nil && embedded && structName != "" {
+				if fieldName, err := stringClassAttr(entry, dwarf.AttrName); err == nil {
+					b.embeddedFields[embeddedFieldKey{structName: structName, fieldName: fieldName}] = true
+				}
+			}
+		case dwarf.TagConstant:
+			if constant, ok := parseConstantEntry(entry); ok {
+				constants = append(constants, constant)
+			}
 		case dwarf.TagArrayType, dwarf.TagPointerType, dwarf.TagStructType, dwarf.TagSubroutineType, dwarf.TagBaseType, dwarf.TagTypedef:
+			if name, err := stringClassAttr(entry, dwarf.AttrName); err == nil && name != "" {
+				if _, ok := b.typeNames[name]; !ok {
+					b.typeNames[name] = entry.Offset
+				}
+				offsetToTypeName[entry.Offset] = name
+			}
+
+			if !hasRuntimeType {
+				break
+			}
 			// based on the 'abbrevs' variable in src/cmd/internal/dwarf/dwarf.go. It indicates which tag types *may* have the DW_AT_go_runtime_type attribute.
 			val, err := addressClassAttr(entry, attrGoRuntimeType)
 			if err != nil || val == 0 {
 				break
 			}
-			types[val] = entry.Offset
+			b.types[val] = entry.Offset
 		}
 	}
+
+	b.constantNames = make(map[constantKey]string)
+	for _, constant := range constants {
+		typeName, ok := offsetToTypeName[constant.typeOffset]
+		if !ok || !isNamedTypeName(typeName) {
+			continue
+		}
+		key := constantKey{typeName: typeName, val: constant.val}
+		if _, ok := b.constantNames[key]; ok {
+			// ambiguous
+			b.constantNames[key] = ""
+			continue
+		}
+		b.constantNames[key] = constant.name
+	}
+	return nil
+}
+
+func parseConstantEntry(entry *dwarf.Entry) (constantEntry, bool) {
+	name, err := stringClassAttr(entry, dwarf.AttrName)
+	if err != nil {
+		return constantEntry{}, false
+	}
+	typeOffset, err := referenceClassAttr(entry, dwarf.AttrType)
+	if err != nil {
+		return constantEntry{}, false
+	}
+
+	switch val := entry.Val(dwarf.AttrConstValue).(type) {
+	case int64:
+		return constantEntry{name: name, typeOffset: typeOffset, val: val}, true
+	case uint64:
+		return constantEntry{name: name, typeOffset: typeOffset, val: int64(val)}, true
+	default:
+		// string constants and so on
+		return constantEntry{}, false
+	}
 }
 
 const moduleDataTypeName = "runtime.moduledata"
@@ -169,9 +409,572 @@ func (b debuggableBinaryFile) findDWARFEntryByName(match func(*dwarf.Entry) bool
 }
 
 // FindFunction looks up the function info described in the debug info section.
+// The shapes of the generic function's type arguments are resolved to the actual types if possible. See resolveShapes.
 func (b debuggableBinaryFile) FindFunction(pc uint64) (*Function, error) {
 	reader := subprogramReader{raw: b.dwarf.Reader(), dwarfData: b.dwarf}
-	return reader.Seek(pc)
+	function, err := reader.Seek(pc)
+	if err != nil {
+		return nil, err
+	}
+	b.resolveShapes(function)
+	return function, nil
+}
+
+// findFunctionName looks up the name of the function described in the debug info section. Unlike FindFunction,
+// the parameters are not read, and so the function compiled by the C compiler, whose parameters lack the attributes
+// the go compiler emits, is found.
+func (b debuggableBinaryFile) findFunctionName(pc uint64) (string, error) {
+	reader := subprogramReader{raw: b.dwarf.Reader(), dwarfData: b.dwarf}
+	function, err := reader.seekFunction(pc)
+	if err != nil {
+		return "", err
+	}
+	return function.Name, nil
+}
+
+// FindFunctionByName looks up the function info by the function name. The generic function can be specified without
+// the type parameters, such as `main.Map`, if it's instantiated only once. Otherwise, specify the instantiated name,
+// such as `main.Map[int,string]`, or the name in the debug info, which has the shapes of the type arguments,
+// such as `main.Map[go.shape.int,go.shape.string]`.
+func (b debuggableBinaryFile) FindFunctionByName(name string) (*Function, error) {
+	lowPC, err := b.findFunctionAddr(name)
+	if err != nil {
+		if lowPC, err = b.findGenericFunctionAddr(name); err != nil {
+			return nil, err
+		}
+	}
+	return b.FindFunction(lowPC)
+}
+
+// findGenericFunctionAddr finds the instantiation of the generic function which has the name without type parameters,
+// or which has the name with the actual type arguments.
+func (b debuggableBinaryFile) findGenericFunctionAddr(name string) (uint64, error) {
+	var instantiations []string
+	var addr uint64
+	reader := b.dwarf.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return 0, err
+		} else if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		reader.SkipChildren()
+
+		entryName, err := stringClassAttr(entry, dwarf.AttrName)
+		if err != nil || !strings.Contains(entryName, "[") {
+			continue
+		}
+		instantiatedName := b.instantiatedName(entryName)
+		if stripTypeParams(entryName) != name && instantiatedName != name {
+			continue
+		}
+		lowPC, err := addressClassAttr(entry, dwarf.AttrLowpc)
+		if err != nil {
+			continue // abstract instance
+		}
+		instantiations = append(instantiations, instantiatedName)
+		addr = lowPC
+	}
+
+	switch len(instantiations) {
+	case 0:
+		return 0, fmt.Errorf("%s: failed to find a matched entry", name)
+	case 1:
+		return addr, nil
+	default:
+		return 0, fmt.Errorf("%s: ambiguous generic function. specify one of %s", name, strings.Join(instantiations, ", "))
+	}
+}
+
+// stripTypeParams removes the type parameters from the name of the generic function or type,
+// such as `main.Pair[go.shape.int].Get` to `main.Pair.Get`.
+func stripTypeParams(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+
+	var stripped strings.Builder
+	depth := 0
+	for _, ch := range name {
+		switch {
+		case ch == '[':
+			depth++
+		case ch == ']':
+			depth--
+		case depth == 0:
+			stripped.WriteRune(ch)
+		}
+	}
+	return stripped.String()
+}
+
+// shapePrefix is the prefix of the shape type, such as `go.shape.int`, which the generic function is instantiated with.
+// All the type arguments which have the same underlying type share the shape and so the instantiation.
+const shapePrefix = "go.shape."
+
+// dictionaryInfix is the infix of the dictionary symbol of the generic function instantiation, such as `main..dict.F[int]`.
+const dictionaryInfix = "..dict."
+
+// resolveShapes replaces the shapes in the name of the generic function and its parameter types with the actual
+// type arguments, such as `main.F[go.shape.int]` to `main.F[int]`. The dictionary symbol of the instantiation tells
+// the type arguments. Nothing is replaced if the dictionary is unknown or the shapes are shared by 2 or more
+// instantiations, because the function alone can't tell which one is called.
+func (b debuggableBinaryFile) resolveShapes(function *Function) {
+	if !strings.Contains(function.Name, shapePrefix) {
+		return
+	}
+	instantiatedName := b.instantiatedName(function.Name)
+	if instantiatedName == function.Name {
+		return
+	}
+
+	_, shapes, _, _ := splitTypeArgs(function.Name)
+	_, typeArgs, _, _ := splitTypeArgs(instantiatedName)
+	function.Name = instantiatedName
+	for i, param := range function.Parameters {
+		if typedefType, ok := param.Typ.(*dwarf.TypedefType); ok && strings.HasPrefix(typedefType.Name, ".param") {
+			// the type parameter, like `.param0` for `K`, is the typedef of its shape.
+			function.Parameters[i].Typ = typedefType.Type
+			param.Typ = typedefType.Type
+		}
+		if param.Typ == nil || !strings.Contains(param.Typ.Common().Name, shapePrefix) {
+			continue
+		}
+		typeName := replaceTypeArgs(param.Typ.Common().Name, shapes, typeArgs)
+		offset, ok := b.typeNames[typeName]
+		if !ok {
+			log.Debugf("failed to find the type %s instantiated with the actual types", typeName)
+			continue
+		}
+		typ, err := b.dwarf.Type(offset)
+		if err != nil {
+			log.Debugf("failed to read the type %s: %v", typeName, err)
+			continue
+		}
+		if _, ok := param.Typ.(*dwarf.TypedefType); ok {
+			if _, ok := typ.(*dwarf.TypedefType); !ok {
+				// the index has the struct type rather than its typedef, which the named type is.
+				typ = &dwarf.TypedefType{CommonType: dwarf.CommonType{ByteSize: typ.Size(), Name: typeName}, Type: typ}
+			}
+		}
+		function.Parameters[i].Typ = typ
+	}
+}
+
+// instantiatedName returns the name of the generic function with the actual type arguments, such as `main.F[int]`
+// for `main.F[go.shape.int]`. It returns the given name if the instantiation is unknown or ambiguous.
+func (b debuggableBinaryFile) instantiatedName(shapeName string) string {
+	prefix, shapes, suffix, ok := splitTypeArgs(shapeName)
+	if !ok {
+		return shapeName
+	}
+	// the dictionary of `github.com/a/b.F[go.shape.int].M` is `github.com/a/b..dict.F[int].M`.
+	pkgEnd := strings.LastIndex(prefix, "/") + 1
+	dot := strings.Index(prefix[pkgEnd:], ".")
+	if dot < 0 {
+		return shapeName
+	}
+	pkgEnd += dot
+	dictPrefix := prefix[:pkgEnd] + dictionaryInfix + prefix[pkgEnd+1:]
+
+	var candidate string
+	for _, dictName := range b.dictionaryNames {
+		if !strings.HasPrefix(dictName, dictPrefix+"[") {
+			continue
+		}
+		_, typeArgs, dictSuffix, ok := splitTypeArgs(dictName)
+		if !ok || dictSuffix != suffix || !matchShapes(shapes, typeArgs) {
+			continue
+		}
+		if candidate != "" {
+			return shapeName // ambiguous
+		}
+		candidate = prefix + "[" + strings.Join(typeArgs, ",") + "]" + suffix
+	}
+	if candidate == "" {
+		return shapeName
+	}
+	return candidate
+}
+
+// matchShapes returns true if the type arguments may have the shapes. The predeclared types should have the shape
+// of the same name, like `go.shape.int` or `go.shape.int_0` of the older go versions. The other types are assumed
+// to match, because their underlying types are unknown from the names.
+func matchShapes(shapes, typeArgs []string) bool {
+	if len(shapes) != len(typeArgs) {
+		return false
+	}
+	for i, shape := range shapes {
+		if !strings.HasPrefix(shape, shapePrefix) {
+			if shape != typeArgs[i] {
+				return false
+			}
+			continue
+		}
+		if !isPredeclaredTypeName(typeArgs[i]) {
+			continue
+		}
+		shapeName := strings.TrimPrefix(shape, shapePrefix)
+		if index := strings.LastIndex(shapeName, "_"); index >= 0 {
+			if _, err := strconv.Atoi(shapeName[index+1:]); err == nil {
+				shapeName = shapeName[:index]
+			}
+		}
+		if shapeName != typeArgs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isPredeclaredTypeName returns true if the name is the identifier without the package, such as `int` and `string`.
+func isPredeclaredTypeName(name string) bool {
+	for _, ch := range name {
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '_' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// splitTypeArgs splits the name of the generic function or type into the part before the type arguments,
+// the type arguments and the part after them, such as `main.Pair`, [`int`, `string`] and `.Get` for
+// `main.Pair[int,string].Get`. It returns false if the name has no type arguments.
+func splitTypeArgs(name string) (prefix string, typeArgs []string, suffix string, ok bool) {
+	start := strings.Index(name, "[")
+	if start < 0 {
+		return name, nil, "", false
+	}
+
+	depth := 0
+	argStart := start + 1
+	for i := start; i < len(name); i++ {
+		switch name[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+			if depth == 0 {
+				typeArgs = append(typeArgs, name[argStart:i])
+				return name[:start], typeArgs, name[i+1:], true
+			}
+		case ',':
+			if depth == 1 {
+				typeArgs = append(typeArgs, name[argStart:i])
+				argStart = i + 1
+			}
+		}
+	}
+	return name, nil, "", false
+}
+
+// replaceTypeArgs replaces the shapes in the type name with the corresponding type arguments.
+func replaceTypeArgs(typeName string, shapes, typeArgs []string) string {
+	indexes := make([]int, 0, len(shapes))
+	for i := range shapes {
+		if i < len(typeArgs) && shapes[i] != typeArgs[i] {
+			indexes = append(indexes, i)
+		}
+	}
+	// the longer shape first, so that `go.shape.int64` is not replaced as `go.shape.int`.
+	sort.Slice(indexes, func(i, j int) bool { return len(shapes[indexes[i]]) > len(shapes[indexes[j]]) })
+
+	var oldnew []string
+	for _, i := range indexes {
+		oldnew = append(oldnew, shapes[i], typeArgs[i])
+	}
+	return strings.NewReplacer(oldnew...).Replace(typeName)
+}
+
+// FunctionSignature returns the parameters of the function as described in the debug info.
+// Unlike the parameters of the function Process.FindFunction returns, the locations the debug info doesn't tell
+// (e.g. the offsets of the unnamed results in some go versions) are not filled in and so their Exist fields are false.
+func (b debuggableBinaryFile) FunctionSignature(name string) ([]Parameter, error) {
+	function, err := b.FindFunctionByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return function.Parameters, nil
+}
+
+// FindInitFunctions looks up the init functions of the package. It includes `init` the compiler generates to initialize
+// the package-level variables, as well as `init.0`, `init.1`, ... which are the init functions in the source code.
+func (b debuggableBinaryFile) FindInitFunctions(pkgName string) ([]*Function, error) {
+	prefix := pkgName + ".init"
+	var functions []*Function
+	reader := b.dwarf.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return nil, err
+		} else if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+
+		name, err := stringClassAttr(entry, dwarf.AttrName)
+		if err != nil || !isInitFuncName(name, prefix) {
+			continue
+		}
+		lowPC, err := addressClassAttr(entry, dwarf.AttrLowpc)
+		if err != nil {
+			continue // abstract instance
+		}
+
+		function, err := b.FindFunction(lowPC)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, function)
+	}
+
+	if len(functions) == 0 {
+		return nil, fmt.Errorf("no init functions in %s", pkgName)
+	}
+	return functions, nil
+}
+
+// isInitFuncName returns true if the name is `<prefix>` or `<prefix>.<number>`.
+func isInitFuncName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	suffix := strings.TrimPrefix(name, prefix)
+	if suffix == "" {
+		return true
+	}
+	if len(suffix) < 2 || suffix[0] != '.' {
+		return false
+	}
+	for _, ch := range suffix[1:] {
+		if !unicode.IsDigit(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// RuntimeFunctionAddr returns the start address of the runtime function. The address is cached.
+// The tracer sets the breakpoints at runtime.deferreturn and runtime.mallocgc (see Process.RuntimeFunctionAddr)
+// to pop the functions unwound by the panic and to trace the allocations.
+// It resolves the address from the binary rather than hard-coding it, because these functions may differ among go versions.
+func (b debuggableBinaryFile) RuntimeFunctionAddr(name string) (uint64, error) {
+	if !strings.HasPrefix(name, "runtime.") {
+		return 0, fmt.Errorf("not runtime function: %s", name)
+	}
+
+	if addr, ok := b.runtimeFuncAddrs[name]; ok {
+		return addr, nil
+	}
+
+	addr, err := b.findFunctionAddr(name)
+	if err != nil {
+		return 0, err
+	}
+	b.runtimeFuncAddrs[name] = addr
+	return addr, nil
+}
+
+func (b debuggableBinaryFile) findFunctionAddr(name string) (uint64, error) {
+	entry, err := b.findDWARFEntryByName(func(entry *dwarf.Entry) bool {
+		if entry.Tag != dwarf.TagSubprogram {
+			return false
+		}
+		if _, err := addressClassAttr(entry, dwarf.AttrLowpc); err != nil {
+			return false // abstract instance
+		}
+		entryName, err := stringClassAttr(entry, dwarf.AttrName)
+		return entryName == name && err == nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return addressClassAttr(entry, dwarf.AttrLowpc)
+}
+
+// PrologueEndAddr returns the first address marked as the end of the prologue in the line table.
+// The arguments are copied to their final locations (if necessary) at this address.
+func (b debuggableBinaryFile) PrologueEndAddr(f *Function) (uint64, error) {
+	reader := b.dwarf.Reader()
+	compileUnit, err := reader.SeekPC(f.StartAddr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the compile unit of %s: %v", f.Name, err)
+	}
+
+	lineReader, err := b.dwarf.LineReader(compileUnit)
+	if err != nil {
+		return 0, err
+	} else if lineReader == nil {
+		return 0, fmt.Errorf("no line table: %s", f.Name)
+	}
+
+	var entry dwarf.LineEntry
+	if err := lineReader.SeekPC(f.StartAddr, &entry); err != nil {
+		return 0, fmt.Errorf("failed to find the line entry of %s: %v", f.Name, err)
+	}
+
+	for {
+		if f.EndAddr != 0 && entry.Address >= f.EndAddr {
+			break
+		}
+		if entry.PrologueEnd {
+			return entry.Address, nil
+		}
+		if entry.EndSequence {
+			break
+		}
+
+		if err := lineReader.Next(&entry); err != nil {
+			break
+		}
+	}
+	return 0, fmt.Errorf("prologue end not found: %s", f.Name)
+}
+
+// LineAddr finds the address of the statement at the line in the line tables. The file matches if it's the same as,
+// or the path suffix of, the file name in the table. The error is returned if 2 or more files match, like `print.go`
+// matches both `fmt/print.go` and `runtime/print.go`. If the line has no statement, such as the blank line,
+// it snaps to the nearest statement below it in the same function.
+func (b debuggableBinaryFile) LineAddr(file string, line int) (uint64, error) {
+	var foundAddr uint64
+	foundLine := -1
+	var matchedFileName string
+	// stmtEntries is the statements in the matched file, used to find the function which encloses the line.
+	var stmtEntries []dwarf.LineEntry
+	reader := b.dwarf.Reader()
+	for {
+		compileUnit, err := reader.Next()
+		if err != nil {
+			return 0, err
+		} else if compileUnit == nil {
+			break
+		}
+		if compileUnit.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		reader.SkipChildren()
+
+		lineReader, err := b.dwarf.LineReader(compileUnit)
+		if err != nil || lineReader == nil {
+			continue
+		}
+
+		var entry dwarf.LineEntry
+		for lineReader.Next(&entry) == nil {
+			if !entry.IsStmt || entry.EndSequence || entry.File == nil || !matchFileName(entry.File.Name, file) {
+				continue
+			}
+			if matchedFileName == "" {
+				matchedFileName = entry.File.Name
+			} else if matchedFileName != entry.File.Name {
+				return 0, fmt.Errorf("%s is ambiguous: both %s and %s match", file, matchedFileName, entry.File.Name)
+			}
+			stmtEntries = append(stmtEntries, entry)
+
+			if entry.Line < line {
+				continue
+			}
+			if foundLine == -1 || entry.Line < foundLine || (entry.Line == foundLine && entry.Address < foundAddr) {
+				foundAddr, foundLine = entry.Address, entry.Line
+			}
+		}
+	}
+
+	if foundLine == -1 {
+		return 0, fmt.Errorf("no statement at %s:%d", file, line)
+	} else if foundLine != line && !b.functionStartsBefore(foundAddr, line, stmtEntries) {
+		return 0, fmt.Errorf("no statement at %s:%d in the function. The next statement at line %d is in another function", file, line, foundLine)
+	}
+	return foundAddr, nil
+}
+
+// functionStartsBefore returns true if the function which contains the address has the statement at or above the line.
+// If not, the line is outside the function, such as the blank line between the functions.
+func (b debuggableBinaryFile) functionStartsBefore(addr uint64, line int, stmtEntries []dwarf.LineEntry) bool {
+	function, err := b.FindFunction(addr)
+	if err != nil || function.EndAddr == 0 {
+		return true // unknown range. Assume the line is inside the function.
+	}
+
+	for _, entry := range stmtEntries {
+		if function.StartAddr <= entry.Address && entry.Address < function.EndAddr && entry.Line <= line {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFileName(name, file string) bool {
+	return name == file || strings.HasSuffix(name, "/"+file)
+}
+
+func (b debuggableBinaryFile) readStaticData(addr uint64, out []byte) error {
+	return b.segments.ReadMemory(addr, out)
+}
+
+// TypeByName looks up the type by the name.
+func (b debuggableBinaryFile) TypeByName(name string) (dwarf.Type, error) {
+	offset, ok := b.typeNames[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found", name)
+	}
+	return b.dwarf.Type(offset)
+}
+
+// Types returns all the named types in the debug info, sorted by name.
+func (b debuggableBinaryFile) Types() ([]TypeEntry, error) {
+	runtimeTypeAddrs := make(map[dwarf.Offset]uint64, len(b.types))
+	for addr, offset := range b.types {
+		if existing, ok := runtimeTypeAddrs[offset]; !ok || addr < existing {
+			runtimeTypeAddrs[offset] = addr
+		}
+	}
+
+	names := make([]string, 0, len(b.typeNames))
+	for name := range b.typeNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]TypeEntry, 0, len(names))
+	for _, name := range names {
+		offset := b.typeNames[name]
+		typ, err := b.dwarf.Type(offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read type %s: %v", name, err)
+		}
+		entries = append(entries, TypeEntry{Name: name, Type: typ, RuntimeTypeAddr: runtimeTypeAddrs[offset]})
+	}
+	return entries, nil
+}
+
+// GoVersion returns the go version found in the debug info.
+func (b debuggableBinaryFile) GoVersion() GoVersion {
+	return b.goVersion
+}
+
+// IsPIE returns true if the program is the position independent executable.
+func (b debuggableBinaryFile) IsPIE() bool {
+	return b.pie
+}
+
+func (b debuggableBinaryFile) firstModuleDataAddr() uint64 {
+	return b.staticFirstModuleDataAddr
+}
+
+func (b debuggableBinaryFile) osArgsAddr() uint64 {
+	return b.staticOSArgsAddr
+}
+
+func (b debuggableBinaryFile) programHeaderAddr() uint64 {
+	return b.staticProgramHeaderAddr
 }
 
 // Close releases the resources associated with the binary.
@@ -184,6 +987,15 @@ func (b debuggableBinaryFile) findDwarfTypeByAddr(typeAddr uint64) (dwarf.Type,
 	return b.dwarf.Type(implTypOffset)
 }
 
+func (b debuggableBinaryFile) findConstantName(typeName string, val int64) (string, bool) {
+	name := b.constantNames[constantKey{typeName: typeName, val: val}]
+	return name, name != ""
+}
+
+func (b debuggableBinaryFile) isEmbeddedField(structName, fieldName string) bool {
+	return b.embeddedFields[embeddedFieldKey{structName: structName, fieldName: fieldName}]
+}
+
 func (b debuggableBinaryFile) moduleDataType() dwarf.Type {
 	return b.cachedModuleDataType
 }
@@ -195,13 +1007,17 @@ func (b debuggableBinaryFile) runtimeGType() dwarf.Type {
 // IsExported returns true if the function is exported.
 // See https://golang.org/ref/spec#Exported_identifiers for the spec.
 func (f Function) IsExported() bool {
-	elems := strings.Split(f.Name, ".")
+	// the type parameters may contain the package names, like `main.F[go.shape.int]`.
+	elems := strings.Split(stripTypeParams(f.Name), ".")
 	for _, ch := range elems[len(elems)-1] {
 		return unicode.IsUpper(ch)
 	}
 	return false
 }
 
+// dictParamName is the name of the hidden parameter of the generic function.
+const dictParamName = ".dict"
+
 type subprogramReader struct {
 	raw       *dwarf.Reader
 	dwarfData dwarfData
@@ -232,6 +1048,17 @@ func (r subprogramReader) Next(setParameters bool) (*Function, error) {
 }
 
 func (r subprogramReader) Seek(pc uint64) (*Function, error) {
+	function, err := r.seekFunction(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	function.Parameters, err = r.parameters()
+	return function, err
+}
+
+// seekFunction is same as Seek except that the parameters are not read.
+func (r subprogramReader) seekFunction(pc uint64) (*Function, error) {
 	_, err := r.raw.SeekPC(pc)
 	if err != nil {
 		return nil, err
@@ -251,32 +1078,23 @@ func (r subprogramReader) Seek(pc uint64) (*Function, error) {
 			continue
 		}
 
-		function, err := r.buildFunction(subprogram)
-		if err != nil {
-			return nil, err
-		}
-
-		function.Parameters, err = r.parameters()
-		return function, err
+		return r.buildFunction(subprogram)
 	}
 }
 
 func (r subprogramReader) includesPC(subprogram *dwarf.Entry, pc uint64) bool {
-	lowPC, err := addressClassAttr(subprogram, dwarf.AttrLowpc)
-	if err != nil {
-		// inlined subprogram doesn't have the lowPC and highPC attributes.
-		return false
-	}
-
-	highPC, err := addressClassAttr(subprogram, dwarf.AttrHighpc)
+	// inlined subprogram doesn't have the lowPC and highPC (or ranges) attributes. No ranges are returned in that case.
+	ranges, err := r.dwarfData.Ranges(subprogram)
 	if err != nil {
 		return false
 	}
 
-	if pc < lowPC || highPC <= pc {
-		return false
+	for _, pcRange := range ranges {
+		if pcRange[0] <= pc && pc < pcRange[1] {
+			return true
+		}
 	}
-	return true
+	return false
 }
 
 func (r subprogramReader) isInline(subprogram *dwarf.Entry) bool {
@@ -294,24 +1112,59 @@ func (r subprogramReader) buildFunction(subprogram *dwarf.Entry) (*Function, err
 		return nil, errors.New("name attr not found")
 	}
 
-	lowPC, err := addressClassAttr(subprogram, dwarf.AttrLowpc)
+	lowPC, highPC, err := r.findPCRange(subprogram)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %v", name, err)
 	}
 
-	highPC, err := addressClassAttr(subprogram, dwarf.AttrHighpc)
+	frameBase, err := locationClassAttr(subprogram, dwarf.AttrFrameBase)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %v", name, err)
 	}
+	frameBaseIsCFA := len(frameBase) == 1 && frameBase[0] == dwarfOpCallFrameCFA
+	if !frameBaseIsCFA {
+		log.Debugf("The frame base attribute of %s has the unexpected value. The parameter values are not available.", name)
+	}
 
-	frameBase, err := locationClassAttr(subprogram, dwarf.AttrFrameBase)
+	return &Function{Name: name, StartAddr: lowPC, EndAddr: highPC, FrameBaseIsCFA: frameBaseIsCFA}, nil
+}
+
+// findPCRange returns the start and end address of the subprogram. If the code is not contiguous and described by
+// the ranges attribute, the range which contains the entry pc is returned.
+func (r subprogramReader) findPCRange(subprogram *dwarf.Entry) (uint64, uint64, error) {
+	lowPC, lowPCErr := addressClassAttr(subprogram, dwarf.AttrLowpc)
+	highPC, highPCErr := addressClassAttr(subprogram, dwarf.AttrHighpc)
+	if lowPCErr == nil && highPCErr == nil {
+		return lowPC, highPC, nil
+	}
+
+	ranges, err := r.dwarfData.Ranges(subprogram)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %v", name, err)
-	} else if len(frameBase) != 1 || frameBase[0] != dwarfOpCallFrameCFA {
-		log.Printf("The frame base attribute of %s has the unexpected value. The parameter values may be wrong.", name)
+		return 0, 0, err
+	} else if len(ranges) == 0 {
+		return 0, 0, errors.New("neither high pc nor ranges attr found")
 	}
 
-	return &Function{Name: name, StartAddr: lowPC, EndAddr: highPC}, nil
+	entryPC := ranges[0][0]
+	if lowPCErr == nil {
+		// the low pc is the base address of the ranges and also the entry pc in this case.
+		entryPC = lowPC
+	} else if addr, err := addressClassAttr(subprogram, dwarf.AttrEntrypc); err == nil {
+		entryPC = addr
+	} else {
+		for _, pcRange := range ranges {
+			if pcRange[0] < entryPC {
+				entryPC = pcRange[0]
+			}
+		}
+	}
+
+	for _, pcRange := range ranges {
+		if pcRange[0] <= entryPC && entryPC < pcRange[1] {
+			return entryPC, pcRange[1], nil
+		}
+	}
+	return 0, 0, fmt.Errorf("entry pc %#x is not in the ranges", entryPC)
 }
 
 func (r subprogramReader) parameters() ([]Parameter, error) {
@@ -319,8 +1172,11 @@ func (r subprogramReader) parameters() ([]Parameter, error) {
 	for {
 		param, err := r.nextParameter()
 		if err != nil || param == nil {
-			// the parameters are sorted by the name.
-			sort.Slice(params, func(i, j int) bool { return params[i].Offset < params[j].Offset })
+			// the parameters are sorted by the name. The parameters in the registers have no offset,
+			// but they are in the declaration order in that case.
+			if !hasPieces(params) {
+				sort.Slice(params, func(i, j int) bool { return params[i].Offset < params[j].Offset })
+			}
 			return params, err
 		}
 
@@ -329,6 +1185,15 @@ func (r subprogramReader) parameters() ([]Parameter, error) {
 	}
 }
 
+func hasPieces(params []Parameter) bool {
+	for _, param := range params {
+		if param.Pieces != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (r subprogramReader) nextParameter() (*Parameter, error) {
 	for {
 		param, err := r.raw.Next()
@@ -340,6 +1205,11 @@ func (r subprogramReader) nextParameter() (*Parameter, error) {
 			r.raw.SkipChildren()
 			continue
 		}
+		if name, _ := stringClassAttr(param, dwarf.AttrName); name == dictParamName {
+			// the dictionary of the type arguments, which the compiler passes to the generic function.
+			r.raw.SkipChildren()
+			continue
+		}
 
 		return r.buildParameter(param)
 	}
@@ -373,73 +1243,144 @@ func (r subprogramReader) buildParameter(param *dwarf.Entry) (*Parameter, error)
 		return nil, err
 	}
 
-	offset, exist, err := r.findLocation(param)
-	return &Parameter{Name: name, Typ: typ, Offset: offset, IsOutput: isOutput, Exist: exist}, err
+	loc, exist, err := r.findLocation(param)
+	return &Parameter{Name: name, Typ: typ, Offset: loc.offset, Pieces: loc.pieces, IsOutput: isOutput, Exist: exist}, err
+}
+
+// parameterLocation is the location of the parameter value. See Parameter for the meaning of each field.
+type parameterLocation struct {
+	offset int
+	pieces []ParameterPiece
 }
 
-func (r subprogramReader) findLocation(param *dwarf.Entry) (offset int, exist bool, err error) {
-	offset, exist, err = r.findLocationByLocationDesc(param)
-	if err != nil && r.dwarfData.locationList != nil {
-		offset, exist, err = r.findLocationByLocationList(param)
+func (r subprogramReader) findLocation(param *dwarf.Entry) (loc parameterLocation, exist bool, err error) {
+	loc, exist, err = r.findLocationByLocationDesc(param)
+	if err == nil {
+		return
+	}
+	if _, locListErr := locationListClassAttr(param, dwarf.AttrLocation); locListErr != nil {
+		return // neither the location description nor the location list
+	}
+
+	loc, exist, err = r.findLocationByLocationList(param)
+	if err != nil {
+		// the location list section may be missing or broken. It's not fatal because the parameter can be marked as not existing.
+		log.Debugf("failed to find the location of the parameter at %#x: %v", param.Offset, err)
+		return parameterLocation{}, false, nil
 	}
 	return
 }
 
-func (r subprogramReader) findLocationByLocationDesc(param *dwarf.Entry) (offset int, exist bool, err error) {
-	loc, err := locationClassAttr(param, dwarf.AttrLocation)
+func (r subprogramReader) findLocationByLocationDesc(param *dwarf.Entry) (parameterLocation, bool, error) {
+	locDesc, err := locationClassAttr(param, dwarf.AttrLocation)
 	if err != nil {
-		return 0, false, fmt.Errorf("loc attr not found: %v", err)
+		return parameterLocation{}, false, fmt.Errorf("loc attr not found: %v", err)
 	}
 
-	if len(loc) == 0 {
+	if len(locDesc) == 0 {
 		// the location description may be empty due to the optimization (see the DWARF spec 2.6.1.1.4)
-		return 0, false, nil
+		return parameterLocation{}, false, nil
 	}
 
-	offset, err = parseLocationDesc(loc)
+	loc, err := parseLocationDesc(locDesc)
 	if err != nil {
 		log.Debugf("failed to parse location description at %#x: %v", param.Offset, err)
 	}
-	return offset, err == nil, nil
+	return loc, err == nil, nil
 }
 
-// parseLocationDesc returns the offset from the beginning of the parameter list.
-// It assumes the value is present in the memory and not separated.
-// Also, it's supposed the function's frame base always specifies to the CFA.
-func parseLocationDesc(loc []byte) (int, error) {
-	if len(loc) == 0 {
-		return 0, errors.New("location description is empty")
+// parseLocationDesc returns the location of the value the location description specifies.
+// The value may be in the memory, in the register, or split into the multiple pieces by DW_OP_piece.
+// It's supposed the function's frame base always specifies to the CFA.
+func parseLocationDesc(locDesc []byte) (parameterLocation, error) {
+	if len(locDesc) == 0 {
+		return parameterLocation{}, errors.New("location description is empty")
 	}
 
-	// TODO: support the value in the register and the separated value.
-	switch loc[0] {
-	case dwarfOpCallFrameCFA:
-		return 0, nil
-	case dwarfOpFbreg:
-		return decodeSignedLEB128(loc[1:]), nil
-	default:
-		return 0, fmt.Errorf("unknown operation: %#x", loc[0])
+	var pieces []ParameterPiece
+	var curr *ParameterPiece // the location of the current piece. nil if not specified yet.
+	for i := 0; i < len(locDesc); {
+		op := locDesc[i]
+		i++
+
+		switch {
+		case op == dwarfOpCallFrameCFA:
+			curr = &ParameterPiece{}
+		case op == dwarfOpFbreg:
+			n := lengthOfLEB128(locDesc[i:])
+			if n == 0 {
+				return parameterLocation{}, errors.New("the operand of DW_OP_fbreg is truncated")
+			}
+			curr = &ParameterPiece{Offset: decodeSignedLEB128(locDesc[i:])}
+			i += n
+		case dwarfOpReg0 <= op && op <= dwarfOpReg31:
+			curr = &ParameterPiece{InRegister: true, RegisterNum: int(op - dwarfOpReg0)}
+		case op == dwarfOpRegx:
+			n := lengthOfLEB128(locDesc[i:])
+			if n == 0 {
+				return parameterLocation{}, errors.New("the operand of DW_OP_regx is truncated")
+			}
+			curr = &ParameterPiece{InRegister: true, RegisterNum: decodeUnsignedLEB128(locDesc[i:])}
+			i += n
+		case op == dwarfOpPiece:
+			n := lengthOfLEB128(locDesc[i:])
+			if n == 0 {
+				return parameterLocation{}, errors.New("the operand of DW_OP_piece is truncated")
+			}
+			size := decodeUnsignedLEB128(locDesc[i:])
+			i += n
+
+			if curr == nil {
+				// the piece without the location is optimized out.
+				return parameterLocation{}, fmt.Errorf("the piece #%d is optimized out", len(pieces))
+			}
+			curr.Size = size
+			pieces = append(pieces, *curr)
+			curr = nil
+		default:
+			return parameterLocation{}, fmt.Errorf("unknown operation: %#x", op)
+		}
+	}
+
+	if pieces != nil {
+		if curr != nil {
+			return parameterLocation{}, errors.New("the location is not followed by DW_OP_piece")
+		}
+		return parameterLocation{pieces: pieces}, nil
+	}
+
+	if curr == nil {
+		return parameterLocation{}, errors.New("no location is specified")
+	} else if curr.InRegister {
+		return parameterLocation{pieces: []ParameterPiece{*curr}}, nil
 	}
+	return parameterLocation{offset: curr.Offset}, nil
 }
 
-func (r subprogramReader) findLocationByLocationList(param *dwarf.Entry) (int, bool, error) {
-	loc, err := locationListClassAttr(param, dwarf.AttrLocation)
+func (r subprogramReader) findLocationByLocationList(param *dwarf.Entry) (parameterLocation, bool, error) {
+	locListOffset, err := locationListClassAttr(param, dwarf.AttrLocation)
 	if err != nil {
-		return 0, false, fmt.Errorf("loc list attr not found: %v", err)
+		return parameterLocation{}, false, fmt.Errorf("loc list attr not found: %v", err)
 	}
 
-	locList := buildLocationList(r.dwarfData.locationList, int(loc))
-	if len(locList.locListEntries) == 0 {
-		return 0, false, errors.New("no location list entry")
+	if r.dwarfData.locationList == nil {
+		return parameterLocation{}, false, errors.New("no location list section")
+	}
+
+	locList, err := buildLocationList(r.dwarfData.locationList, int(locListOffset))
+	if err != nil {
+		return parameterLocation{}, false, err
+	} else if len(locList.locListEntries) == 0 {
+		return parameterLocation{}, false, errors.New("no location list entry")
 	}
 
 	// TODO: it's more precise to choose the right location list entry using PC and address offsets.
 	//       Usually the first entry specifies to the right location in our use case, though.
-	offset, err := parseLocationDesc(locList.locListEntries[0].locationDesc)
+	loc, err := parseLocationDesc(locList.locListEntries[0].locationDesc)
 	if err != nil {
 		log.Debugf("failed to parse location list at %#x: %v", param.Offset, err)
 	}
-	return offset, err == nil, nil
+	return loc, err == nil, nil
 }
 
 type locationList struct {
@@ -452,8 +1393,12 @@ type locationListEntry struct {
 	locationDesc           []byte
 }
 
-func buildLocationList(locSectionData []byte, offset int) (locList locationList) {
+func buildLocationList(locSectionData []byte, offset int) (locList locationList, err error) {
+	outOfRange := func(size int) bool { return offset < 0 || offset+size > len(locSectionData) }
 	for {
+		if outOfRange(16) {
+			return locList, fmt.Errorf("location list entry at %#x is out of the section (size: %#x)", offset, len(locSectionData))
+		}
 		beginOffset := binary.LittleEndian.Uint64(locSectionData[offset : offset+8])
 		offset += 8
 		endOffset := binary.LittleEndian.Uint64(locSectionData[offset : offset+8])
@@ -469,9 +1414,15 @@ func buildLocationList(locSectionData []byte, offset int) (locList locationList)
 
 		// location list entry
 		locListEntry := locationListEntry{beginOffset: int(beginOffset), endOffset: int(endOffset)}
+		if outOfRange(2) {
+			return locList, fmt.Errorf("location description length at %#x is out of the section", offset)
+		}
 		locationDescLen := int(binary.LittleEndian.Uint16(locSectionData[offset : offset+2]))
 		offset += 2
 
+		if outOfRange(locationDescLen) {
+			return locList, fmt.Errorf("location description at %#x is out of the section", offset)
+		}
 		locListEntry.locationDesc = locSectionData[offset : offset+locationDescLen]
 		offset += locationDescLen
 
@@ -619,6 +1570,28 @@ func decodeSignedLEB128(input []byte) (val int) {
 	return val
 }
 
+func decodeUnsignedLEB128(input []byte) (val int) {
+	for i := 0; i < len(input); i++ {
+		val |= int(input[i]) & 0x7F << (7 * uint(i))
+
+		if input[i]>>7&0x1 == 0x0 {
+			break
+		}
+	}
+	return val
+}
+
+// lengthOfLEB128 returns the number of bytes the LEB128-encoded value at the beginning of the input uses.
+// It returns 0 if the input is truncated.
+func lengthOfLEB128(input []byte) int {
+	for i, b := range input {
+		if b>>7&0x1 == 0x0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
 type symbol struct {
 	Name  string
 	Value uint64
@@ -626,7 +1599,15 @@ type symbol struct {
 
 // nonDebuggableBinaryFile represents the binary file WITHOUT DWARF sections.
 type nonDebuggableBinaryFile struct {
-	closer io.Closer
+	closer   io.Closer
+	segments loadedSegments
+	pie      bool
+	// staticFirstModuleDataAddr is the address of the firstModuleDataSymbol in the binary file.
+	staticFirstModuleDataAddr uint64
+	// staticOSArgsAddr is the address of the osArgsSymbol in the binary file.
+	staticOSArgsAddr uint64
+	// staticProgramHeaderAddr is the address of the program header table in the binary file. Set only if ELF.
+	staticProgramHeaderAddr uint64
 }
 
 func newNonDebuggableBinaryFile(closer io.Closer) (nonDebuggableBinaryFile, error) {
@@ -638,6 +1619,68 @@ func (b nonDebuggableBinaryFile) FindFunction(pc uint64) (*Function, error) {
 	return nil, errors.New("no DWARF info")
 }
 
+func (b nonDebuggableBinaryFile) findFunctionName(pc uint64) (string, error) {
+	return "", errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) FindFunctionByName(name string) (*Function, error) {
+	return nil, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) FunctionSignature(name string) ([]Parameter, error) {
+	return nil, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) FindInitFunctions(pkgName string) ([]*Function, error) {
+	return nil, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) RuntimeFunctionAddr(name string) (uint64, error) {
+	return 0, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) PrologueEndAddr(f *Function) (uint64, error) {
+	return 0, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) LineAddr(file string, line int) (uint64, error) {
+	return 0, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) readStaticData(addr uint64, out []byte) error {
+	return b.segments.ReadMemory(addr, out)
+}
+
+func (b nonDebuggableBinaryFile) TypeByName(name string) (dwarf.Type, error) {
+	return nil, errors.New("no DWARF info")
+}
+
+func (b nonDebuggableBinaryFile) Types() ([]TypeEntry, error) {
+	return nil, errors.New("no DWARF info")
+}
+
+// GoVersion always returns the unknown version because the version is found in the debug info.
+func (b nonDebuggableBinaryFile) GoVersion() GoVersion {
+	return GoVersion{}
+}
+
+// IsPIE returns true if the program is the position independent executable.
+func (b nonDebuggableBinaryFile) IsPIE() bool {
+	return b.pie
+}
+
+func (b nonDebuggableBinaryFile) firstModuleDataAddr() uint64 {
+	return b.staticFirstModuleDataAddr
+}
+
+func (b nonDebuggableBinaryFile) osArgsAddr() uint64 {
+	return b.staticOSArgsAddr
+}
+
+func (b nonDebuggableBinaryFile) programHeaderAddr() uint64 {
+	return b.staticProgramHeaderAddr
+}
+
 func (b nonDebuggableBinaryFile) Close() error {
 	return b.closer.Close()
 }
@@ -745,6 +1788,14 @@ var moduleDataType = &dwarf.StructType{
 	},
 }
 
+func (b nonDebuggableBinaryFile) findConstantName(typeName string, val int64) (string, bool) {
+	return "", false
+}
+
+func (b nonDebuggableBinaryFile) isEmbeddedField(structName, fieldName string) bool {
+	return false
+}
+
 func (b nonDebuggableBinaryFile) moduleDataType() dwarf.Type {
 	return moduleDataType
 }
@@ -7,6 +7,7 @@ import (
 	"debug/macho"
 	"encoding/binary"
 	"io"
+	"strings"
 )
 
 var locationListSectionNames = []string{
@@ -19,6 +20,18 @@ func openBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, erro
 	if err != nil {
 		return nil, err
 	}
+	return newBinaryFile(machoFile, goVersion)
+}
+
+func openBinaryReader(r io.ReaderAt, goVersion GoVersion) (BinaryFile, error) {
+	machoFile, err := macho.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return newBinaryFile(machoFile, goVersion)
+}
+
+func newBinaryFile(machoFile *macho.File, goVersion GoVersion) (BinaryFile, error) {
 	var closer io.Closer = machoFile
 
 	data, locList, err := findDWARF(machoFile)
@@ -27,6 +40,10 @@ func openBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, erro
 		if err != nil {
 			closer.Close()
 		}
+		binaryFile.segments = findLoadedSegments(machoFile)
+		binaryFile.pie = isPIE(machoFile)
+		binaryFile.staticFirstModuleDataAddr = findSymbolAddr(machoFile, firstModuleDataSymbol)
+		binaryFile.staticOSArgsAddr = findSymbolAddr(machoFile, osArgsSymbol)
 		return binaryFile, err
 	}
 
@@ -34,9 +51,56 @@ func openBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, erro
 	if err != nil {
 		closer.Close()
 	}
+	binaryFile.dictionaryNames = findDictionaryNames(machoFile)
+	binaryFile.segments = findLoadedSegments(machoFile)
+	binaryFile.pie = isPIE(machoFile)
+	binaryFile.staticFirstModuleDataAddr = findSymbolAddr(machoFile, firstModuleDataSymbol)
+	binaryFile.staticOSArgsAddr = findSymbolAddr(machoFile, osArgsSymbol)
 	return binaryFile, err
 }
 
+// isPIE returns true if the MH_PIE flag is set. The loader randomizes the address of such a program unless ASLR is disabled.
+func isPIE(machoFile *macho.File) bool {
+	return machoFile.Flags&macho.FlagPIE != 0
+}
+
+// findSymbolAddr returns the address of the symbol. 0 if not found, for example, when the binary is stripped.
+func findSymbolAddr(machoFile *macho.File, name string) uint64 {
+	if machoFile.Symtab == nil {
+		return 0
+	}
+
+	for _, sym := range machoFile.Symtab.Syms {
+		if sym.Name == name {
+			return sym.Value
+		}
+	}
+	return 0
+}
+
+// findDictionaryNames returns the names of the dictionary symbols of the generic function instantiations.
+func findDictionaryNames(machoFile *macho.File) (names []string) {
+	if machoFile.Symtab == nil {
+		return nil
+	}
+
+	for _, sym := range machoFile.Symtab.Syms {
+		if strings.Contains(sym.Name, dictionaryInfix) {
+			names = append(names, sym.Name)
+		}
+	}
+	return names
+}
+
+func findLoadedSegments(machoFile *macho.File) (segments loadedSegments) {
+	for _, load := range machoFile.Loads {
+		if segment, ok := load.(*macho.Segment); ok && segment.Filesz > 0 {
+			segments = append(segments, loadedSegment{ReaderAt: segment, addr: segment.Addr, size: segment.Filesz})
+		}
+	}
+	return
+}
+
 func findDWARF(machoFile *macho.File) (data *dwarf.Data, locList []byte, err error) {
 	var locListSection *macho.Section
 	for _, locListSectionName := range locationListSectionNames {
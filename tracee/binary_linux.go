@@ -7,6 +7,7 @@ import (
 	"debug/elf"
 	"encoding/binary"
 	"io"
+	"strings"
 )
 
 var locationListSectionNames = []string{
@@ -19,6 +20,18 @@ func openBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, erro
 	if err != nil {
 		return nil, err
 	}
+	return newBinaryFile(elfFile, goVersion)
+}
+
+func openBinaryReader(r io.ReaderAt, goVersion GoVersion) (BinaryFile, error) {
+	elfFile, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return newBinaryFile(elfFile, goVersion)
+}
+
+func newBinaryFile(elfFile *elf.File, goVersion GoVersion) (BinaryFile, error) {
 	var closer io.Closer = elfFile
 
 	data, locList, err := findDWARF(elfFile)
@@ -27,6 +40,11 @@ func openBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, erro
 		if err != nil {
 			closer.Close()
 		}
+		binaryFile.segments = findLoadedSegments(elfFile)
+		binaryFile.pie = isPIE(elfFile)
+		binaryFile.staticFirstModuleDataAddr = findSymbolAddr(elfFile, firstModuleDataSymbol)
+		binaryFile.staticOSArgsAddr = findSymbolAddr(elfFile, osArgsSymbol)
+		binaryFile.staticProgramHeaderAddr = findProgramHeaderAddr(elfFile)
 		return binaryFile, err
 	}
 
@@ -34,9 +52,69 @@ func openBinaryFile(pathToProgram string, goVersion GoVersion) (BinaryFile, erro
 	if err != nil {
 		closer.Close()
 	}
+	binaryFile.dictionaryNames = findDictionaryNames(elfFile)
+	binaryFile.segments = findLoadedSegments(elfFile)
+	binaryFile.pie = isPIE(elfFile)
+	binaryFile.staticFirstModuleDataAddr = findSymbolAddr(elfFile, firstModuleDataSymbol)
+	binaryFile.staticOSArgsAddr = findSymbolAddr(elfFile, osArgsSymbol)
+	binaryFile.staticProgramHeaderAddr = findProgramHeaderAddr(elfFile)
 	return binaryFile, err
 }
 
+// isPIE returns true if the ELF file is the shared object, which the PIE is built as.
+func isPIE(elfFile *elf.File) bool {
+	return elfFile.Type == elf.ET_DYN
+}
+
+// findSymbolAddr returns the address of the symbol. 0 if not found, for example, when the binary is stripped.
+func findSymbolAddr(elfFile *elf.File, name string) uint64 {
+	syms, err := elfFile.Symbols()
+	if err != nil {
+		return 0
+	}
+
+	for _, sym := range syms {
+		if sym.Name == name {
+			return sym.Value
+		}
+	}
+	return 0
+}
+
+// findDictionaryNames returns the names of the dictionary symbols of the generic function instantiations.
+func findDictionaryNames(elfFile *elf.File) (names []string) {
+	syms, err := elfFile.Symbols()
+	if err != nil {
+		return nil
+	}
+
+	for _, sym := range syms {
+		if strings.Contains(sym.Name, dictionaryInfix) {
+			names = append(names, sym.Name)
+		}
+	}
+	return names
+}
+
+// findProgramHeaderAddr returns the address of the program header table. 0 if the PT_PHDR segment is not found.
+func findProgramHeaderAddr(elfFile *elf.File) uint64 {
+	for _, prog := range elfFile.Progs {
+		if prog.Type == elf.PT_PHDR {
+			return prog.Vaddr
+		}
+	}
+	return 0
+}
+
+func findLoadedSegments(elfFile *elf.File) (segments loadedSegments) {
+	for _, prog := range elfFile.Progs {
+		if prog.Type == elf.PT_LOAD {
+			segments = append(segments, loadedSegment{ReaderAt: prog, addr: prog.Vaddr, size: prog.Filesz})
+		}
+	}
+	return
+}
+
 func findDWARF(elfFile *elf.File) (data *dwarf.Data, locList []byte, err error) {
 	var locListSection *elf.Section
 	for _, locListSectionName := range locationListSectionNames {
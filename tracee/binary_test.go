@@ -4,8 +4,10 @@ import (
 	"debug/dwarf"
 	"debug/elf"
 	"debug/macho"
+	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/nkbai/tgo/testutils"
@@ -25,6 +27,26 @@ func TestOpenBinaryFile(t *testing.T) {
 	}
 }
 
+func TestOpenBinaryReader(t *testing.T) {
+	file, err := os.Open(testutils.ProgramHelloworld)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	binary, err := OpenBinaryReader(file, GoVersion{})
+	if err != nil {
+		t.Fatalf("failed to create new binary: %v", err)
+	}
+
+	if binary.moduleDataType() == nil {
+		t.Errorf("runtime.moduledata type is nil")
+	}
+	if binary.runtimeGType() == nil {
+		t.Errorf("runtime.g type is nil")
+	}
+}
+
 func TestOpenNonDwarfBinaryFile(t *testing.T) {
 	binary, err := OpenBinaryFile(testutils.ProgramHelloworldNoDwarf, GoVersion{})
 	if err != nil {
@@ -44,6 +66,33 @@ func TestOpenNonDwarfBinaryFile(t *testing.T) {
 	}
 }
 
+func TestGoVersion(t *testing.T) {
+	binary, err := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	if err != nil {
+		t.Fatalf("failed to create new binary: %v", err)
+	}
+
+	// the test programs are compiled by the same go as the test.
+	if goVersion := binary.GoVersion(); goVersion != ParseGoVersion(runtime.Version()) {
+		t.Errorf("wrong go version: %#v", goVersion)
+	}
+}
+
+func TestIsPIE(t *testing.T) {
+	binary, err := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	if err != nil {
+		t.Fatalf("failed to create new binary: %v", err)
+	}
+
+	// the go linker builds PIE by default only on darwin.
+	if expected := runtime.GOOS == "darwin"; binary.IsPIE() != expected {
+		t.Errorf("wrong PIE flag: %v", binary.IsPIE())
+	}
+	if binary.firstModuleDataAddr() != testutils.HelloworldAddrFirstModuleData {
+		t.Errorf("wrong first moduledata address: %#x", binary.firstModuleDataAddr())
+	}
+}
+
 func TestOpenBinaryFile_ProgramNotFound(t *testing.T) {
 	_, err := OpenBinaryFile("./notexist", GoVersion{})
 	if err == nil {
@@ -65,6 +114,357 @@ func TestFindFunction(t *testing.T) {
 	if function.Parameters == nil {
 		t.Fatal("parameters field is nil")
 	}
+
+	if !function.FrameBaseIsCFA {
+		t.Errorf("frame base is not CFA")
+	}
+}
+
+func TestFindFunctionName_CFunction(t *testing.T) {
+	if testutils.ProgramCgo == "" {
+		t.Skip("the cgo program is not built")
+	}
+	binary, _ := OpenBinaryFile(testutils.ProgramCgo, GoVersion{})
+	debuggableBinary, ok := binary.(debuggableBinaryFile)
+	if !ok {
+		t.Fatalf("not debuggable binary")
+	}
+	name, err := debuggableBinary.findFunctionName(testutils.CgoAddrCFuncHello)
+	if err != nil {
+		t.Fatalf("failed to find function name: %v", err)
+	}
+	if cgoFuncName(name) != "C.hello" {
+		t.Errorf("wrong name: %s", name)
+	}
+}
+
+func TestFindFunctionByName(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	function, err := binary.FindFunctionByName("main.main")
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+
+	if function.StartAddr != testutils.HelloworldAddrMain {
+		t.Errorf("wrong start address: %#x", function.StartAddr)
+	}
+
+	if _, err := binary.FindFunctionByName("main.notexist"); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestFunctionSignature(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	params, err := binary.FunctionSignature("main.twoParameters")
+	if err != nil {
+		t.Fatalf("failed to get signature: %v", err)
+	}
+
+	if len(params) != 2 {
+		t.Fatalf("wrong number of parameters: %d", len(params))
+	}
+	for i, name := range []string{"j", "i"} {
+		if params[i].Name != name || params[i].IsOutput || params[i].Typ.String() != "int" {
+			t.Errorf("[%d] wrong parameter: %#v", i, params[i])
+		}
+	}
+
+	if _, err := binary.FunctionSignature("main.notexist"); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestFindInitFunctions(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	functions, err := binary.FindInitFunctions("os")
+	if err != nil {
+		t.Fatalf("failed to find init functions: %v", err)
+	}
+
+	for _, function := range functions {
+		if !strings.HasPrefix(function.Name, "os.init") {
+			t.Errorf("wrong function: %s", function.Name)
+		}
+	}
+
+	if _, err := binary.FindInitFunctions("notexist"); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestIsInitFuncName(t *testing.T) {
+	for i, testdata := range []struct {
+		name     string
+		expected bool
+	}{
+		{name: "main.init", expected: true},
+		{name: "main.init.0", expected: true},
+		{name: "main.init.12", expected: true},
+		{name: "main.init.0.func1", expected: false},
+		{name: "main.initConfig", expected: false},
+		{name: "main.init.", expected: false},
+		{name: "main.main", expected: false},
+	} {
+		if actual := isInitFuncName(testdata.name, "main.init"); actual != testdata.expected {
+			t.Errorf("[%d] wrong result: %v", i, actual)
+		}
+	}
+}
+
+func TestFindFunctionByName_Generic(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramTypePrint, GoVersion{})
+	function, err := binary.FindFunctionByName("main.printGeneric")
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	if function.Name != "main.printGeneric[string,int]" {
+		t.Errorf("wrong function name: %s", function.Name)
+	}
+	if len(function.Parameters) != 1 || function.Parameters[0].Name != "v" {
+		t.Fatalf("wrong parameters: %#v", function.Parameters)
+	}
+	if typeName := function.Parameters[0].Typ.String(); typeName != "main.Pair[string,int]" {
+		t.Errorf("wrong parameter type: %s", typeName)
+	}
+
+	instantiated, err := binary.FindFunctionByName(function.Name)
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	if instantiated.StartAddr != function.StartAddr {
+		t.Errorf("wrong function: %#x", instantiated.StartAddr)
+	}
+
+	shape, err := binary.FindFunctionByName("main.printGeneric[go.shape.string,go.shape.int]")
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	if shape.StartAddr != function.StartAddr {
+		t.Errorf("wrong function: %#x", shape.StartAddr)
+	}
+}
+
+func TestInstantiatedName(t *testing.T) {
+	binary := debuggableBinaryFile{dictionaryNames: []string{
+		"main..dict.F[int]",
+		"main..dict.G[main.T,string]",
+		"main..dict.G[main.U,string]",
+		"main..dict.Pair[int,main.T].Get",
+		"github.com/a/b..dict.H[[]int]",
+	}}
+	for i, testdata := range []struct {
+		name     string
+		expected string
+	}{
+		{name: "main.F[go.shape.int]", expected: "main.F[int]"},
+		{name: "main.F[go.shape.int_0]", expected: "main.F[int]"},
+		{name: "main.F[go.shape.string]", expected: "main.F[go.shape.string]"},
+		// main.T and main.U share the shape.
+		{name: "main.G[go.shape.int,go.shape.string]", expected: "main.G[go.shape.int,go.shape.string]"},
+		{name: "main.Pair[go.shape.int,go.shape.struct {}].Get", expected: "main.Pair[int,main.T].Get"},
+		{name: "main.Pair[go.shape.int,go.shape.struct {}].Set", expected: "main.Pair[go.shape.int,go.shape.struct {}].Set"},
+		{name: "github.com/a/b.H[go.shape.[]int]", expected: "github.com/a/b.H[[]int]"},
+		{name: "main.f", expected: "main.f"},
+	} {
+		if actual := binary.instantiatedName(testdata.name); actual != testdata.expected {
+			t.Errorf("[%d] wrong result: %s", i, actual)
+		}
+	}
+}
+
+func TestReplaceTypeArgs(t *testing.T) {
+	actual := replaceTypeArgs("main.Pair[go.shape.int,go.shape.int64]", []string{"go.shape.int", "go.shape.int64"}, []string{"int", "main.Duration"})
+	if actual != "main.Pair[int,main.Duration]" {
+		t.Errorf("wrong result: %s", actual)
+	}
+}
+
+func TestStripTypeParams(t *testing.T) {
+	for i, testdata := range []struct {
+		name     string
+		expected string
+	}{
+		{name: "main.f", expected: "main.f"},
+		{name: "main.Map[go.shape.int,go.shape.string]", expected: "main.Map"},
+		{name: "main.Pair[go.shape.int,main.Pair[go.shape.int,go.shape.int]].Get", expected: "main.Pair.Get"},
+	} {
+		if actual := stripTypeParams(testdata.name); actual != testdata.expected {
+			t.Errorf("[%d] wrong result: %s", i, actual)
+		}
+	}
+}
+
+func TestTypeByName(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramTypePrint, GoVersion{})
+	typ, err := binary.TypeByName("main.S")
+	if err != nil {
+		t.Fatalf("failed to find type: %v", err)
+	}
+
+	if _, ok := typ.(*dwarf.StructType); !ok {
+		t.Errorf("wrong type: %#v", typ)
+	}
+	if typ.String() != "struct main.S" {
+		t.Errorf("wrong name: %s", typ)
+	}
+
+	if _, err := binary.TypeByName("main.notexist"); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestTypes(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramTypePrint, ParseGoVersion(runtime.Version()))
+	entries, err := binary.Types()
+	if err != nil {
+		t.Fatalf("failed to list types: %v", err)
+	}
+
+	var found bool
+	for i, entry := range entries {
+		if i > 0 && entries[i-1].Name >= entry.Name {
+			t.Fatalf("not sorted: %s, %s", entries[i-1].Name, entry.Name)
+		}
+		if entry.Name == "main.S" {
+			found = true
+			if entry.Type.String() != "struct main.S" || entry.RuntimeTypeAddr == 0 {
+				t.Errorf("wrong entry: %s, %#x", entry.Type, entry.RuntimeTypeAddr)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("main.S not found")
+	}
+
+	nonDwarfBinary, _ := OpenBinaryFile(testutils.ProgramHelloworldNoDwarf, GoVersion{})
+	if _, err := nonDwarfBinary.Types(); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestFindConstantName(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramTypePrint, GoVersion{})
+	name, ok := binary.findConstantName("main.Mode", 2)
+	if !ok {
+		t.Fatalf("constant not found")
+	}
+	if name != "main.ModeWrite" {
+		t.Errorf("wrong name: %s", name)
+	}
+
+	if _, ok := binary.findConstantName("main.Mode", 3); ok {
+		t.Errorf("constant should not be found")
+	}
+	if _, ok := binary.findConstantName("int", 12345); ok {
+		t.Errorf("untyped constant should not be found")
+	}
+}
+
+func TestIsEmbeddedField(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramTypePrint, GoVersion{})
+	if !binary.isEmbeddedField("main.S", "T") {
+		t.Errorf("T should be embedded")
+	}
+	if binary.isEmbeddedField("main.S", "a") {
+		t.Errorf("a should not be embedded")
+	}
+}
+
+func TestRuntimeFunctionAddr(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	addr, err := binary.RuntimeFunctionAddr("runtime.gopanic")
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	if addr == 0 {
+		t.Errorf("address is 0")
+	}
+
+	if cachedAddr, err := binary.RuntimeFunctionAddr("runtime.gopanic"); err != nil || cachedAddr != addr {
+		t.Errorf("wrong cached address: %#x, %v", cachedAddr, err)
+	}
+
+	if _, err := binary.RuntimeFunctionAddr("main.main"); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestPrologueEndAddr(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	function, err := binary.FindFunction(testutils.HelloworldAddrMain)
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+
+	addr, err := binary.PrologueEndAddr(function)
+	if err != nil {
+		t.Fatalf("failed to find prologue end: %v", err)
+	}
+	if addr <= function.StartAddr || (function.EndAddr != 0 && addr >= function.EndAddr) {
+		t.Errorf("wrong address: %#x", addr)
+	}
+}
+
+func TestLineAddr(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	for i, testdata := range []struct {
+		file     string
+		line     int
+		expected string
+	}{
+		{file: "helloworld.go", line: 10, expected: "main.noParameter"},
+		{file: "testdata/helloworld.go", line: 15, expected: "main.oneParameter"},
+	} {
+		addr, err := binary.LineAddr(testdata.file, testdata.line)
+		if err != nil {
+			t.Errorf("[%d] failed to find the address: %v", i, err)
+			continue
+		}
+		function, err := binary.FindFunction(addr)
+		if err != nil {
+			t.Errorf("[%d] failed to find the function: %v", i, err)
+		} else if function.Name != testdata.expected {
+			t.Errorf("[%d] wrong function: %s", i, function.Name)
+		}
+	}
+
+	if _, err := binary.LineAddr("notexist.go", 1); err == nil {
+		t.Errorf("error should be returned")
+	}
+	if _, err := binary.LineAddr("helloworld.go", 12); err == nil {
+		t.Errorf("error should be returned if the blank line is outside the function")
+	}
+	if _, err := binary.LineAddr("print.go", 10); err == nil {
+		t.Errorf("error should be returned if both fmt/print.go and runtime/print.go match")
+	}
+}
+
+func TestLineAddr_BlankLineInFunction(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramGoRoutines, GoVersion{})
+	addr, err := binary.LineAddr("goroutines.go", 29)
+	if err != nil {
+		t.Fatalf("failed to find the address: %v", err)
+	}
+
+	function, err := binary.FindFunction(addr)
+	if err != nil {
+		t.Fatalf("failed to find the function: %v", err)
+	} else if function.Name != "main.main" {
+		t.Errorf("wrong function: %s", function.Name)
+	}
+}
+
+func TestReadStaticData(t *testing.T) {
+	binary, _ := OpenBinaryFile(testutils.ProgramHelloworld, GoVersion{})
+	out := make([]byte, 8)
+	if err := binary.readStaticData(testutils.HelloworldAddrFirstModuleData, out); err != nil {
+		t.Errorf("failed to read: %v", err)
+	}
+
+	if err := binary.readStaticData(0, out); err == nil {
+		t.Errorf("error should be returned")
+	}
 }
 
 func TestIsExported(t *testing.T) {
@@ -78,6 +478,8 @@ func TestIsExported(t *testing.T) {
 		{name: "fmt.(*pp).fmtBool", expected: false},
 		{name: "_rt0_amd64_linux", expected: false},
 		{name: "type..hash.runtime.version_key", expected: false},
+		{name: "main.Map[go.shape.int,go.shape.string]", expected: true},
+		{name: "main.mapValues[go.shape.int]", expected: false},
 	} {
 		function := Function{Name: testdata.name}
 		actual := function.IsExported()
@@ -134,6 +536,77 @@ func TestSeek(t *testing.T) {
 	}
 }
 
+func TestFindPCRange_Ranges(t *testing.T) {
+	dwarfData := findDwarfData(t, testutils.ProgramHelloworld)
+	reader := subprogramReader{raw: dwarfData.Reader(), dwarfData: dwarfData}
+
+	// emulate the subprogram described by the ranges attribute using the compile unit's one.
+	compileUnit, err := dwarfData.Reader().Next()
+	if err != nil {
+		t.Fatalf("failed to read the compile unit: %v", err)
+	}
+	rangesField := compileUnit.AttrField(dwarf.AttrRanges)
+	if rangesField == nil {
+		t.Skip("the compile unit has no ranges attribute")
+	}
+	expectedRanges, err := dwarfData.Ranges(compileUnit)
+	if err != nil || len(expectedRanges) == 0 {
+		t.Fatalf("failed to find the ranges: %v", err)
+	}
+
+	subprogram := &dwarf.Entry{Offset: compileUnit.Offset, Tag: dwarf.TagSubprogram, Field: []dwarf.Field{*rangesField}}
+	lowPC, highPC, err := reader.findPCRange(subprogram)
+	if err != nil {
+		t.Fatalf("failed to find the pc range: %v", err)
+	}
+	if lowPC != expectedRanges[0][0] || highPC != expectedRanges[0][1] {
+		t.Errorf("wrong pc range: %#x-%#x", lowPC, highPC)
+	}
+	if !reader.includesPC(subprogram, expectedRanges[len(expectedRanges)-1][1]-1) {
+		t.Errorf("the last range is not included")
+	}
+}
+
+func TestSeek_NoLocationListSection(t *testing.T) {
+	dwarfData := findDwarfData(t, testutils.ProgramHelloworld)
+	dwarfData.locationList = nil // emulate the binary which lacks the section
+	reader := subprogramReader{raw: dwarfData.Reader(), dwarfData: dwarfData}
+
+	function, err := reader.Seek(testutils.HelloworldAddrErrorsNew)
+	if err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	if len(function.Parameters) == 0 {
+		t.Errorf("no parameters")
+	}
+}
+
+func TestBuildLocationList_OutOfRange(t *testing.T) {
+	for i, testdata := range []struct {
+		data   []byte
+		offset int
+	}{
+		{data: nil, offset: 0},
+		{data: make([]byte, 16), offset: 8},
+		{data: []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}, offset: 0},             // no length of the location description
+		{data: []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0x9c}, offset: 0}, // short location description
+	} {
+		if _, err := buildLocationList(testdata.data, testdata.offset); err == nil {
+			t.Errorf("[%d] error is not returned", i)
+		}
+	}
+
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0x9c}
+	data = append(data, make([]byte, 16)...) // end of list entry
+	locList, err := buildLocationList(data, 0)
+	if err != nil {
+		t.Fatalf("failed to build location list: %v", err)
+	}
+	if len(locList.locListEntries) != 1 || locList.locListEntries[0].locationDesc[0] != 0x9c {
+		t.Errorf("wrong entries: %v", locList.locListEntries)
+	}
+}
+
 func TestSeek_InvalidPC(t *testing.T) {
 	dwarfData := findDwarfData(t, testutils.ProgramHelloworld)
 	reader := subprogramReader{raw: dwarfData.Reader(), dwarfData: dwarfData}
@@ -348,6 +821,55 @@ func TestDecodeSignedLEB128(t *testing.T) {
 	}
 }
 
+func TestParseLocationDesc(t *testing.T) {
+	for i, data := range []struct {
+		input    []byte
+		expected parameterLocation
+	}{
+		{input: []byte{dwarfOpCallFrameCFA}, expected: parameterLocation{}},
+		{input: []byte{dwarfOpFbreg, 0x08}, expected: parameterLocation{offset: 8}},
+		{input: []byte{dwarfOpReg0 + 3}, expected: parameterLocation{pieces: []ParameterPiece{{InRegister: true, RegisterNum: 3}}}},
+		{input: []byte{dwarfOpRegx, 0x11}, expected: parameterLocation{pieces: []ParameterPiece{{InRegister: true, RegisterNum: 17}}}},
+		{
+			// string: the pointer in rax and the length in rbx
+			input: []byte{dwarfOpReg0, dwarfOpPiece, 0x08, dwarfOpReg0 + 3, dwarfOpPiece, 0x08},
+			expected: parameterLocation{pieces: []ParameterPiece{
+				{Size: 8, InRegister: true, RegisterNum: 0},
+				{Size: 8, InRegister: true, RegisterNum: 3},
+			}},
+		},
+		{
+			// the first half in rcx and the second half spilled to the stack
+			input: []byte{dwarfOpReg0 + 2, dwarfOpPiece, 0x08, dwarfOpFbreg, 0x10, dwarfOpPiece, 0x08},
+			expected: parameterLocation{pieces: []ParameterPiece{
+				{Size: 8, InRegister: true, RegisterNum: 2},
+				{Size: 8, Offset: 16},
+			}},
+		},
+	} {
+		actual, err := parseLocationDesc(data.input)
+		if err != nil {
+			t.Errorf("[%d] failed to parse: %v", i, err)
+		} else if !reflect.DeepEqual(data.expected, actual) {
+			t.Errorf("[%d] wrong location. expected: %v, actual: %v", i, data.expected, actual)
+		}
+	}
+}
+
+func TestParseLocationDesc_Invalid(t *testing.T) {
+	for i, input := range [][]byte{
+		{},
+		{dwarfOpPiece, 0x08, dwarfOpReg0, dwarfOpPiece, 0x08}, // the first piece is optimized out
+		{dwarfOpReg0, dwarfOpPiece, 0x08, dwarfOpReg0 + 3},    // no DW_OP_piece after the last location
+		{dwarfOpFbreg, 0x80}, // truncated operand
+		{0x03},               // DW_OP_addr is not supported
+	} {
+		if _, err := parseLocationDesc(input); err == nil {
+			t.Errorf("[%d] error not returned", i)
+		}
+	}
+}
+
 // This test checks if the binary has the dwarf_frame section and its Common Information Entry is not changed.
 // AFAIK, the entry is rarely changed and so the check is skipped at runtime.
 func TestDebugFrameSection(t *testing.T) {
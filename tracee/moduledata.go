@@ -53,10 +53,21 @@ func (md *moduleData) functab(reader memoryReader, index int) (entry, funcoff ui
 	}
 
 	for _, field := range ftabType.(*dwarf.StructType).Field {
-		val := binary.LittleEndian.Uint64(buff[field.ByteOffset : field.ByteOffset+field.Type.Size()])
+		var val uint64
+		fieldBuff := buff[field.ByteOffset : field.ByteOffset+field.Type.Size()]
+		switch len(fieldBuff) {
+		case 4:
+			// some go version uses the 32-bit offsets.
+			val = uint64(binary.LittleEndian.Uint32(fieldBuff))
+		case 8:
+			val = binary.LittleEndian.Uint64(fieldBuff)
+		}
 		switch field.Name {
 		case "entry":
 			entry = val
+		case "entryoff":
+			// some go version holds the offset from the beginning of the text section.
+			entry = md.text(reader) + val
 		case "funcoff":
 			funcoff = val
 		}
@@ -72,6 +83,10 @@ func (md *moduleData) findfunctab(reader memoryReader) uint64 {
 	return md.retrieveUint64(reader, "findfunctab")
 }
 
+func (md *moduleData) text(reader memoryReader) uint64 {
+	return md.retrieveUint64(reader, "text")
+}
+
 func (md *moduleData) minpc(reader memoryReader) uint64 {
 	return md.retrieveUint64(reader, "minpc")
 }
@@ -1,11 +1,15 @@
 package tracee
 
 import (
+	"bytes"
 	"debug/dwarf"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"syscall"
+	"unicode"
 
 	"github.com/nkbai/tgo/debugapi"
 	"github.com/nkbai/tgo/log"
@@ -25,6 +29,12 @@ type Process struct {
 	breakpoints    map[uint64]breakpoint
 	Binary         BinaryFile
 	GoVersion      GoVersion
+	// LoadBias is the difference between the address the program is loaded at and the one in the binary file.
+	// It's non-zero only if the binary is PIE (see BinaryFile.IsPIE) and is relocated. The addresses the Process
+	// returns are relocated by the bias, while the ones the Binary returns are the static ones.
+	LoadBias uint64
+	// Args is the command-line arguments of the tracee, including the program name. nil if unknown.
+	Args           []string
 	moduleDataList []*moduleData
 	valueParser    valueParser
 }
@@ -43,12 +53,24 @@ type StackFrame struct {
 type Attributes struct {
 	ProgramPath         string
 	CompiledGoVersion   string
+	// FirstModuleDataAddr is the runtime address of runtime.firstmoduledata. Required if the binary is PIE on darwin.
+	// On linux, the load bias is found in the auxiliary vector if it's 0.
 	FirstModuleDataAddr uint64
+	// Env is the environment variables, in the form of "key=value", added to the launched process. Ignored when attached.
+	Env []string
+	// WorkingDir is the working directory of the launched process. The tracer's one is used if empty. Ignored when attached.
+	WorkingDir string
+	// KillSignal is the signal sent to the launched process when it's killed on detach. SIGKILL if 0. Ignored when attached.
+	// Use SIGTERM, for example, to let the process clean up. The process is killed by SIGKILL if it doesn't exit in time.
+	KillSignal syscall.Signal
 }
 
 // LaunchProcess launches new tracee process.
 func LaunchProcess(name string, arg []string, attrs Attributes) (*Process, error) {
 	debugapiClient := debugapi.NewClient()
+	debugapiClient.SetEnv(attrs.Env)
+	debugapiClient.SetWorkingDir(attrs.WorkingDir)
+	debugapiClient.SetKillSignal(attrs.KillSignal)
 	if err := debugapiClient.LaunchProcess(name, arg...); err != nil {
 		return nil, err
 	}
@@ -59,8 +81,10 @@ func LaunchProcess(name string, arg []string, attrs Attributes) (*Process, error
 	proc, err := newProcess(debugapiClient, attrs)
 	if err != nil {
 		debugapiClient.DetachProcess()
+		return nil, err
 	}
-	return proc, err
+	proc.Args = append([]string{name}, arg...)
+	return proc, nil
 }
 
 // AttachProcess attaches to the existing tracee process.
@@ -74,8 +98,13 @@ func AttachProcess(pid int, attrs Attributes) (*Process, error) {
 	proc, err := newProcess(debugapiClient, attrs)
 	if err != nil {
 		debugapiClient.DetachProcess() // keep the attached process running
+		return nil, err
 	}
-	return proc, err
+
+	if proc.Args, err = proc.readOSArgs(); err != nil {
+		log.Debugf("failed to read os.Args: %v", err)
+	}
+	return proc, nil
 }
 
 func newProcess(debugapiClient *debugapi.Client, attrs Attributes) (*Process, error) {
@@ -87,11 +116,140 @@ func newProcess(debugapiClient *debugapi.Client, attrs Attributes) (*Process, er
 	if err != nil {
 		return nil, err
 	}
+	proc.LoadBias, err = computeLoadBias(proc.Binary, attrs.FirstModuleDataAddr, proc.readProgramHeaderAddr)
+	if err != nil {
+		proc.Binary.Close()
+		return nil, err
+	}
+	if proc.Binary.IsPIE() {
+		log.Debugf("the binary is PIE. load bias: %#x", proc.LoadBias)
+	}
 	proc.moduleDataList = parseModuleDataList(attrs.FirstModuleDataAddr, proc.Binary.moduleDataType(), debugapiClient)
-	proc.valueParser = valueParser{reader: debugapiClient, mapRuntimeType: proc.mapRuntimeType}
+	proc.valueParser = valueParser{reader: debugapiClient, mapRuntimeType: proc.mapRuntimeType, findFunction: proc.FindFunction, readStaticData: proc.readStaticData, isEmbeddedField: proc.Binary.isEmbeddedField, invalidPointerThreshold: defaultInvalidPointerThreshold, linkFields: defaultLinkFields, maxFields: defaultMaxFieldsToPrint}
 	return proc, nil
 }
 
+// computeLoadBias returns the load bias of the binary. It's 0 if the binary is not PIE.
+// The bias is the difference between the runtime address of the first moduledata and the one in the binary.
+// If either is unknown, the address of the program header table, which readProgramHeaderAddr returns, is used instead.
+func computeLoadBias(binary BinaryFile, firstModuleDataAddr uint64, readProgramHeaderAddr func() (uint64, error)) (uint64, error) {
+	if !binary.IsPIE() {
+		return 0, nil
+	}
+
+	if staticAddr := binary.firstModuleDataAddr(); staticAddr != 0 && firstModuleDataAddr != 0 {
+		return firstModuleDataAddr - staticAddr, nil
+	}
+
+	staticAddr := binary.programHeaderAddr()
+	if staticAddr == 0 {
+		return 0, errors.New("the binary is PIE, but the load bias is unknown. Specify the address of the first moduledata")
+	}
+	addr, err := readProgramHeaderAddr()
+	if err != nil {
+		return 0, fmt.Errorf("the binary is PIE, but failed to find the load bias: %v", err)
+	}
+	return addr - staticAddr, nil
+}
+
+// relocate returns the copy of the function whose addresses are relocated by the load bias.
+func (p *Process) relocate(function *Function) *Function {
+	if p.LoadBias == 0 {
+		return function
+	}
+
+	relocated := *function
+	relocated.StartAddr += p.LoadBias
+	if relocated.EndAddr != 0 {
+		relocated.EndAddr += p.LoadBias
+	}
+	return &relocated
+}
+
+func (p *Process) readStaticData(addr uint64, out []byte) error {
+	return p.Binary.readStaticData(addr-p.LoadBias, out)
+}
+
+const (
+	maxOSArgs   = 1 << 16
+	maxOSArgLen = 1 << 20
+)
+
+// readOSArgs reads the command-line arguments from os.Args in the process memory.
+// os.Args is set during the package initialization and so it's empty before that.
+func (p *Process) readOSArgs() ([]string, error) {
+	staticAddr := p.Binary.osArgsAddr()
+	if staticAddr == 0 {
+		return nil, errors.New("os.Args is not found")
+	}
+
+	addr := staticAddr + p.LoadBias
+	header := make([]byte, 24)
+	if err := p.debugapiClient.ReadMemory(addr, header); err != nil {
+		return nil, fmt.Errorf("failed to read memory at %#x: %v", addr, err)
+	}
+	arrayAddr, length := binary.LittleEndian.Uint64(header[0:8]), binary.LittleEndian.Uint64(header[8:16])
+	if length > maxOSArgs {
+		return nil, fmt.Errorf("too many args: %d", length)
+	}
+
+	args := make([]string, 0, length)
+	elems := make([]byte, 16*length)
+	if err := p.debugapiClient.ReadMemory(arrayAddr, elems); err != nil {
+		return nil, fmt.Errorf("failed to read memory at %#x: %v", arrayAddr, err)
+	}
+	for i := 0; i < int(length); i++ {
+		strAddr, strLen := binary.LittleEndian.Uint64(elems[i*16:i*16+8]), binary.LittleEndian.Uint64(elems[i*16+8:i*16+16])
+		if strLen > maxOSArgLen {
+			return nil, fmt.Errorf("too long arg: %d", strLen)
+		}
+
+		buff := make([]byte, strLen)
+		if err := p.debugapiClient.ReadMemory(strAddr, buff); err != nil {
+			return nil, fmt.Errorf("failed to read memory at %#x: %v", strAddr, err)
+		}
+		args = append(args, string(buff))
+	}
+	return args, nil
+}
+
+// FindInitFunctions is the same as BinaryFile.FindInitFunctions except that the addresses are relocated.
+func (p *Process) FindInitFunctions(pkgName string) ([]*Function, error) {
+	functions, err := p.Binary.FindInitFunctions(pkgName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, function := range functions {
+		functions[i] = p.relocate(function)
+	}
+	return functions, nil
+}
+
+// LineAddr is the same as BinaryFile.LineAddr except that the address is relocated.
+func (p *Process) LineAddr(file string, line int) (uint64, error) {
+	addr, err := p.Binary.LineAddr(file, line)
+	if err != nil {
+		return 0, err
+	}
+	return addr + p.LoadBias, nil
+}
+
+// PrologueEndAddr is the same as BinaryFile.PrologueEndAddr except that the function and the address are relocated.
+func (p *Process) PrologueEndAddr(function *Function) (uint64, error) {
+	static := *function
+	static.StartAddr -= p.LoadBias
+	if static.EndAddr != 0 {
+		static.EndAddr -= p.LoadBias
+	}
+
+	addr, err := p.Binary.PrologueEndAddr(&static)
+	if err != nil {
+		return 0, err
+	}
+	return addr + p.LoadBias, nil
+}
+
 func parseModuleDataList(firstModuleDataAddr uint64, moduleDataType dwarf.Type, reader memoryReader) (moduleDataList []*moduleData) {
 	moduleDataAddr := firstModuleDataAddr
 	for moduleDataAddr != 0 {
@@ -113,6 +271,10 @@ func (p *Process) mapRuntimeType(runtimeTypeAddr uint64) (dwarf.Type, error) {
 		}
 	}
 
+	if md == nil {
+		return nil, fmt.Errorf("no module data contains the runtime type at %#x", runtimeTypeAddr)
+	}
+
 	return p.Binary.findDwarfTypeByAddr(runtimeTypeAddr - md.types(reader))
 }
 
@@ -136,16 +298,105 @@ func (p *Process) close() error {
 	return p.Binary.Close()
 }
 
+// SetFlattenEmbeddedFields sets whether the fields of the embedded struct are shown as the fields of the embedding struct.
+func (p *Process) SetFlattenEmbeddedFields(flatten bool) {
+	p.valueParser.flattenEmbeddedFields = flatten
+}
+
+// SetParseInterfaceMethods sets whether the concrete methods which satisfy the non-empty interface are parsed.
+func (p *Process) SetParseInterfaceMethods(parse bool) {
+	p.valueParser.parseInterfaceMethods = parse
+}
+
+// SetParseConstantNames sets whether the integer value is annotated with the name of the package-level constant
+// which has the same type and value, such as `200 (net/http.StatusOK)`. The value is not annotated if 2 or more constants match.
+func (p *Process) SetParseConstantNames(parse bool) {
+	if parse {
+		p.valueParser.findConstantName = p.Binary.findConstantName
+	} else {
+		p.valueParser.findConstantName = nil
+	}
+}
+
+// SetInvalidPointerThreshold sets the address below which the pointer is considered as invalid and not dereferenced.
+// The default value is the typical size of the null page, 0x1000.
+func (p *Process) SetInvalidPointerThreshold(threshold uint64) {
+	p.valueParser.invalidPointerThreshold = threshold
+}
+
+// SetMaxPointerDepth sets the max number of the pointer indirections followed when the value is parsed. 0 means no limit.
+func (p *Process) SetMaxPointerDepth(depth int) {
+	p.valueParser.maxPointerDepth = depth
+}
+
+// SetMaxStringLen sets the max number of the bytes read from the string value. The longer string is truncated.
+// 0 means no limit, though the string is truncated at 1 MiB anyway.
+func (p *Process) SetMaxStringLen(maxLen int) {
+	p.valueParser.maxStringLen = maxLen
+}
+
+// SetMapLenOnly sets whether to parse only the number of the entries of the map. The buckets are not read.
+func (p *Process) SetMapLenOnly(lenOnly bool) {
+	p.valueParser.mapLenOnly = lenOnly
+}
+
+// SetMaxFieldsToPrint sets the max number of the fields printed for the struct and the entries for the map.
+// The rest are abbreviated with `...`. 0 means no limit.
+func (p *Process) SetMaxFieldsToPrint(maxFields int) {
+	p.valueParser.maxFields = maxFields
+}
+
+// SetByteArrayFormat sets the representation of the byte array value, such as `[16]byte`.
+func (p *Process) SetByteArrayFormat(format ByteArrayFormat) {
+	p.valueParser.byteArrayFormat = format
+}
+
+// SetUnsafePointerHint sets the type the unsafe.Pointer points to, so that the pointed value is parsed as `*typeName`.
+// The owner is the struct name, such as `main.X`, for the field, or the function name for the parameter.
+func (p *Process) SetUnsafePointerHint(owner, name, typeName string) error {
+	typ, err := p.Binary.TypeByName(typeName)
+	if err != nil {
+		return err
+	}
+
+	if p.valueParser.unsafePointerHints == nil {
+		p.valueParser.unsafePointerHints = make(map[unsafePointerHintKey]dwarf.Type)
+	}
+	p.valueParser.unsafePointerHints[unsafePointerHintKey{owner: owner, name: name}] = typ
+	return nil
+}
+
+// SetMaxLinkedNodes sets the max number of the nodes followed when the pointer to the linked data structure, such as
+// the linked list and tree, is parsed. 0 disables the traversal.
+func (p *Process) SetMaxLinkedNodes(maxNodes int) {
+	p.valueParser.maxLinkedNodes = maxNodes
+}
+
+// SetLinkFields sets the names of the fields which link the nodes of the linked data structure.
+// The field must be the pointer to the struct it belongs to. The default is `next`, `left` and `right`.
+func (p *Process) SetLinkFields(names []string) {
+	p.valueParser.linkFields = names
+}
+
 // ContinueAndWait continues the execution and waits until an event happens.
 // Note that the id of the stopped thread may be different from the id of the continued thread.
 func (p *Process) ContinueAndWait() (debugapi.Event, error) {
 	event, err := p.debugapiClient.ContinueAndWait()
 	if debugapi.IsExitEvent(event.Type) {
+		p.forgetBreakpoints()
 		err = p.close()
+	} else if event.Type == debugapi.EventTypeExec {
+		p.forgetBreakpoints()
 	}
 	return event, err
 }
 
+// forgetBreakpoints forgets the breakpoints without restoring the original instructions.
+// After the process executes a new program or exits, the memory is replaced or gone and so the instructions must not be written back.
+func (p *Process) forgetBreakpoints() {
+	p.breakpoints = make(map[uint64]breakpoint)
+}
+
 // SingleStep executes one instruction while clearing and setting breakpoints.
 // If not all the threads are stopped, there is some possibility that another thread
 // passes through the breakpoint while single-stepping.
@@ -161,9 +412,16 @@ func (p *Process) SingleStep(threadID int, trappedAddr uint64) error {
 		}
 	}
 
-	if _, err := p.stepAndWait(threadID); err != nil {
+	event, err := p.stepAndWait(threadID)
+	if err != nil {
 		unspecifiedError, ok := err.(debugapi.UnspecifiedThreadError)
 		if !ok {
+			if bpSet && p.ExistBreakpoint(trappedAddr) {
+				// keep the memory consistent with the breakpoint list so that the later clear restores the same instructions.
+				if writeErr := p.debugapiClient.WriteMemory(trappedAddr, breakpointInsts); writeErr != nil {
+					log.Debugf("failed to set the breakpoint at %#x again: %v", trappedAddr, writeErr)
+				}
+			}
 			return err
 		}
 
@@ -171,6 +429,8 @@ func (p *Process) SingleStep(threadID int, trappedAddr uint64) error {
 			return err
 		}
 		return p.SingleStep(threadID, trappedAddr)
+	} else if event.Type == debugapi.EventTypeExec {
+		return errors.New("the process executed a new program while single-stepping")
 	}
 
 	if bpSet {
@@ -180,19 +440,16 @@ func (p *Process) SingleStep(threadID int, trappedAddr uint64) error {
 }
 
 func (p *Process) setPC(threadID int, addr uint64) error {
-	regs, err := p.debugapiClient.ReadRegisters(threadID)
-	if err != nil {
-		return err
-	}
-
-	regs.Rip = addr
-	return p.debugapiClient.WriteRegisters(threadID, regs)
+	return p.debugapiClient.SetPC(threadID, addr)
 }
 
 func (p *Process) stepAndWait(threadID int) (event debugapi.Event, err error) {
 	event, err = p.debugapiClient.StepAndWait(threadID)
 	if debugapi.IsExitEvent(event.Type) {
+		p.forgetBreakpoints()
 		err = p.close()
+	} else if event.Type == debugapi.EventTypeExec {
+		p.forgetBreakpoints()
 	}
 	return event, err
 }
@@ -245,6 +502,16 @@ func (p *Process) ExistBreakpoint(addr uint64) bool {
 // To be accurate, we need to check the .debug_frame section to find the CFA and return address.
 // But we omit the check here because this function is called at only the beginning or end of the tracee's function call.
 func (p *Process) StackFrameAt(rsp, rip uint64) (*StackFrame, error) {
+	return p.stackFrameAt(rsp, rip, nil)
+}
+
+// StackFrameWithRegisters returns the stack frame as StackFrameAt does, but it also reads the parameters
+// passed in the registers (see the Go internal ABI). The regs should be the registers' values at the rip.
+func (p *Process) StackFrameWithRegisters(rsp, rip uint64, regs debugapi.Registers) (*StackFrame, error) {
+	return p.stackFrameAt(rsp, rip, &regs)
+}
+
+func (p *Process) stackFrameAt(rsp, rip uint64, regs *debugapi.Registers) (*StackFrame, error) {
 	function, err := p.FindFunction(rip)
 	if err != nil {
 		return nil, err
@@ -256,7 +523,7 @@ func (p *Process) StackFrameAt(rsp, rip uint64) (*StackFrame, error) {
 	}
 	retAddr := binary.LittleEndian.Uint64(buff)
 
-	inputArgs, outputArgs, err := p.currentArgs(function.Parameters, rsp+8)
+	inputArgs, outputArgs, err := p.currentArgs(p.valueParser.hintedParameters(function.Name, function.Parameters), rsp+8, regs)
 	if err != nil {
 		return nil, err
 	}
@@ -271,8 +538,9 @@ func (p *Process) StackFrameAt(rsp, rip uint64) (*StackFrame, error) {
 
 // FindFunction finds the function to which pc specifies.
 func (p *Process) FindFunction(pc uint64) (*Function, error) {
-	function, err := p.Binary.FindFunction(pc)
+	function, err := p.Binary.FindFunction(pc - p.LoadBias)
 	if err == nil {
+		function = p.relocate(function)
 		p.fillInOutputParameters(pc, function.Parameters)
 		p.fillInUnknownParameter(pc, function.Parameters)
 		return function, err
@@ -281,7 +549,93 @@ func (p *Process) FindFunction(pc uint64) (*Function, error) {
 	return p.findFunctionByModuleData(pc)
 }
 
+// CgoCallFuncName is the runtime function through which the go routine calls the C function. The C function runs on the system stack.
+const CgoCallFuncName = "runtime.cgocall"
+
+// cgoFuncPrefix is the prefix of the C wrapper functions cgo generates, such as `_cgo_0123456789ab_Cfunc_puts`.
+const cgoFuncPrefix = "_cgo_"
+
+// CgoCallee returns the name of the C function the go routine is going to call, such as `C.puts`.
+// The go routine must be trapped at the beginning of runtime.cgocall.
+// The address is returned in hex if the C function is not found in the debug info.
+func (p *Process) CgoCallee(goRoutineInfo GoRoutineInfo) (string, error) {
+	// func cgocall(fn, arg unsafe.Pointer) int32
+	fnAddr := goRoutineInfo.Registers.Rax
+	if !p.usesRegisterABI() {
+		buff := make([]byte, 8)
+		addr := goRoutineInfo.CurrentStackAddr + 8
+		if err := p.debugapiClient.ReadMemory(addr, buff); err != nil {
+			return "", fmt.Errorf("failed to read memory at %#x: %v", addr, err)
+		}
+		fnAddr = binary.LittleEndian.Uint64(buff)
+	}
+
+	name, err := p.Binary.findFunctionName(fnAddr - p.LoadBias)
+	if err != nil {
+		log.Debugf("failed to find the C function at %#x: %v", fnAddr, err)
+		return fmt.Sprintf("%#x", fnAddr), nil
+	}
+	return cgoFuncName(name), nil
+}
+
+// MallocFuncName is the runtime function which allocates the memory in the heap.
+const MallocFuncName = "runtime.mallocgc"
+
+// Allocation is the heap allocation made by runtime.mallocgc.
+type Allocation struct {
+	Size uint64
+	// TypeName is the name of the allocated type, such as `main.T`. Empty if the type is unknown,
+	// for example, when the allocated memory contains no pointers and so the runtime passes nil.
+	TypeName string
+}
+
+// Allocation returns the allocation the go routine is going to make.
+// The go routine must be trapped at the beginning of runtime.mallocgc.
+func (p *Process) Allocation(goRoutineInfo GoRoutineInfo) (Allocation, error) {
+	// func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer
+	size, typeAddr := goRoutineInfo.Registers.Rax, goRoutineInfo.Registers.Rbx
+	if !p.usesRegisterABI() {
+		buff := make([]byte, 16)
+		addr := goRoutineInfo.CurrentStackAddr + 8
+		if err := p.debugapiClient.ReadMemory(addr, buff); err != nil {
+			return Allocation{}, fmt.Errorf("failed to read memory at %#x: %v", addr, err)
+		}
+		size = binary.LittleEndian.Uint64(buff[0:8])
+		typeAddr = binary.LittleEndian.Uint64(buff[8:16])
+	}
+
+	alloc := Allocation{Size: size}
+	if typeAddr != 0 {
+		typ, err := p.mapRuntimeType(typeAddr)
+		if err != nil {
+			log.Debugf("failed to find the type at %#x: %v", typeAddr, err)
+		} else {
+			alloc.TypeName = typ.String()
+		}
+	}
+	return alloc, nil
+}
+
+// cgoFuncName converts the name of the C wrapper function to the name used in the go code, such as `C.puts`.
+// The name is returned as it is if it's not the wrapper function.
+func cgoFuncName(name string) string {
+	if !strings.HasPrefix(name, cgoFuncPrefix) {
+		return name
+	}
+
+	const cfuncMarker = "_Cfunc_"
+	if i := strings.Index(name, cfuncMarker); i >= 0 {
+		return "C." + name[i+len(cfuncMarker):]
+	}
+	return name
+}
+
 func (p *Process) fillInOutputParameters(pc uint64, params []Parameter) {
+	if p.usesRegisterABI() {
+		fillInOutputRegisters(params)
+		return
+	}
+
 	if !p.canFillInOutputParameters(pc, params) {
 		return
 	}
@@ -330,6 +684,130 @@ func (p *Process) doFillInOutputParameters(pc uint64, params []Parameter) {
 	return
 }
 
+// resultRegisters is the list of the integer registers the Go internal ABI uses to return the results, in the order of the assignment.
+// The values are the DWARF register numbers of RAX, RBX, RCX, RDI, RSI, R8, R9, R10 and R11.
+var resultRegisters = []int{0, 3, 2, 5, 4, 8, 9, 10, 11}
+
+const (
+	// resultFloatRegisters is the number of the xmm registers the Go internal ABI uses to return the floating-point results.
+	// They are assigned from xmm0.
+	resultFloatRegisters = 15
+	// xmm0RegNum is the DWARF register number of xmm0. xmm1-xmm15 follow it.
+	xmm0RegNum = 17
+)
+
+// usesRegisterABI returns true if the go functions pass the arguments and results in the registers (go 1.17 or later).
+func (p *Process) usesRegisterABI() bool {
+	return p.GoVersion.AtLeast(1, 17)
+}
+
+// fillInOutputRegisters assigns the registers to the output parameters as the Go internal ABI does.
+// The debug info tells nothing about the results' locations at the return, but the ABI determines them.
+// The result which doesn't fit in the registers is passed on the stack, and its location depends on the caller's frame.
+// So if any result doesn't fit, all the results are considered stack-assigned and not to exist, rather than
+// risking reading some results from the wrong registers.
+func fillInOutputRegisters(params []Parameter) {
+	var assigner resultRegisterAssigner
+	allAssigned := true
+	for i, param := range params {
+		if !param.IsOutput {
+			continue
+		}
+
+		pieces, ok := assigner.assign(param.Typ)
+		if !ok {
+			allAssigned = false
+			break
+		}
+		params[i].Exist = true
+		params[i].Pieces = pieces
+	}
+
+	if allAssigned {
+		return
+	}
+	for i, param := range params {
+		if param.IsOutput {
+			params[i].Exist = false
+			params[i].Pieces = nil
+		}
+	}
+}
+
+// resultRegisterAssigner assigns the registers to the results in order. nextIntReg and nextFloatReg
+// are the indexes of the next integer register (in resultRegisters) and xmm register.
+type resultRegisterAssigner struct {
+	nextIntReg, nextFloatReg int
+}
+
+// assign assigns the registers to the value of the type. It returns false if the value doesn't fit in the remaining registers
+// or its type is not supported. The registers are not consumed in that case.
+func (a *resultRegisterAssigner) assign(typ dwarf.Type) ([]ParameterPiece, bool) {
+	pieces := []ParameterPiece{}
+	nextIntReg, nextFloatReg := a.nextIntReg, a.nextFloatReg
+	assignIntReg := func(size int64) bool {
+		if size > 8 || nextIntReg >= len(resultRegisters) {
+			return false
+		}
+		pieces = append(pieces, ParameterPiece{Size: int(size), InRegister: true, RegisterNum: resultRegisters[nextIntReg]})
+		nextIntReg++
+		return true
+	}
+	assignFloatReg := func(size int64) bool {
+		if size > 8 || nextFloatReg >= resultFloatRegisters {
+			return false
+		}
+		pieces = append(pieces, ParameterPiece{Size: int(size), InRegister: true, RegisterNum: xmm0RegNum + nextFloatReg})
+		nextFloatReg++
+		return true
+	}
+
+	var assign func(typ dwarf.Type) bool
+	assign = func(typ dwarf.Type) bool {
+		switch typ := typ.(type) {
+		case *dwarf.TypedefType:
+			return assign(typ.Type)
+		case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.CharType, *dwarf.UcharType, *dwarf.PtrType, *dwarf.FuncType:
+			return assignIntReg(typ.Size())
+		case *dwarf.FloatType:
+			return assignFloatReg(typ.Size())
+		case *dwarf.ComplexType:
+			// the real and imaginary parts use the separate registers.
+			return assignFloatReg(typ.Size()/2) && assignFloatReg(typ.Size()/2)
+		case *dwarf.StructType:
+			var offset int64
+			for _, field := range typ.Field {
+				if field.ByteOffset > offset {
+					pieces = append(pieces, ParameterPiece{Size: int(field.ByteOffset - offset), NoLocation: true})
+				}
+				if !assign(field.Type) {
+					return false
+				}
+				offset = field.ByteOffset + field.Type.Size()
+			}
+			if typ.Size() > offset {
+				pieces = append(pieces, ParameterPiece{Size: int(typ.Size() - offset), NoLocation: true})
+			}
+			return true
+		case *dwarf.ArrayType:
+			if typ.Count == 0 {
+				return true
+			} else if typ.Count == 1 {
+				return assign(typ.Type)
+			}
+			return false
+		default:
+			return false
+		}
+	}
+
+	if !assign(typ) {
+		return nil, false
+	}
+	a.nextIntReg, a.nextFloatReg = nextIntReg, nextFloatReg
+	return pieces, true
+}
+
 func (p *Process) fillInUnknownParameter(pc uint64, params []Parameter) {
 	if !p.canFillInUnknownParameter(pc, params) {
 		return
@@ -474,6 +952,70 @@ var _funcType = &dwarf.StructType{
 	},
 }
 
+// RuntimeFunctionAddr is the same as BinaryFile.RuntimeFunctionAddr except that the address is relocated.
+// Like FindFunctionByName, it searches the moduledata if the function is not found in the DWARF info.
+func (p *Process) RuntimeFunctionAddr(name string) (uint64, error) {
+	addr, err := p.Binary.RuntimeFunctionAddr(name)
+	if err == nil {
+		return addr + p.LoadBias, nil
+	}
+
+	function, err := p.FindFunctionByName(name)
+	if err != nil {
+		return 0, err
+	}
+	return function.StartAddr, nil
+}
+
+// FindFunctionByName finds the function which has the specified name.
+// Like FindFunction, it searches the moduledata if the function is not found in the DWARF info (e.g. the assembly functions).
+func (p *Process) FindFunctionByName(name string) (*Function, error) {
+	function, err := p.Binary.FindFunctionByName(name)
+	if err == nil {
+		function = p.relocate(function)
+		p.fillInOutputParameters(function.StartAddr, function.Parameters)
+		return function, nil
+	}
+
+	entry, err := p.findFunctionEntryByNameInModuleData(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.findFunctionByModuleData(entry)
+}
+
+// findFunctionEntryByNameInModuleData linearly searches the functab and so can be slow.
+func (p *Process) findFunctionEntryByNameInModuleData(name string) (uint64, error) {
+	var nameoffField *dwarf.StructField
+	for _, field := range _funcType.Field {
+		if field.Name == "nameoff" {
+			nameoffField = field
+		}
+	}
+
+	for _, md := range p.moduleDataList {
+		// the last entry is the end of the functions.
+		for i := 0; i < md.ftabLen(p.debugapiClient)-1; i++ {
+			entry, funcoff := md.functab(p.debugapiClient, i)
+
+			funcTypePtr := md.pclntable(p.debugapiClient, int(funcoff))
+			buff := make([]byte, nameoffField.Type.Size())
+			if err := p.debugapiClient.ReadMemory(funcTypePtr+uint64(nameoffField.ByteOffset), buff); err != nil {
+				return 0, err
+			}
+
+			funcName, err := p.resolveNameoff(md, int(int32(binary.LittleEndian.Uint32(buff))))
+			if err != nil {
+				return 0, err
+			}
+			if funcName == name {
+				return entry, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("failed to find the function %s", name)
+}
+
 // findFunctionByModuleData has the same logic as the runtime.findfunc.
 func (p *Process) findFunctionByModuleData(pc uint64) (*Function, error) {
 	md := p.findModuleDataByPC(pc)
@@ -524,7 +1066,8 @@ func (p *Process) findFunctionByModuleData(pc uint64) (*Function, error) {
 		params = append(params, param)
 	}
 
-	return &Function{Name: funcName, StartAddr: entry, EndAddr: endAddr, Parameters: params}, nil
+	// the parameters here are built from the args size and so their offsets are always relative to the CFA.
+	return &Function{Name: funcName, StartAddr: entry, EndAddr: endAddr, Parameters: params, FrameBaseIsCFA: true}, nil
 }
 
 func (p *Process) findModuleDataByPC(pc uint64) *moduleData {
@@ -620,7 +1163,7 @@ func (p *Process) adjustFtabIndex(md *moduleData, pc uint64, ftabIdx int) int {
 	} else {
 		// linear search to find func with pc >= entry.
 		nextEntry, _ := md.functab(p.debugapiClient, ftabIdx+1)
-		for nextEntry <= pc {
+		for nextEntry <= pc && ftabIdx+1 < ftabLen {
 			ftabIdx++
 			nextEntry, _ = md.functab(p.debugapiClient, ftabIdx+1)
 		}
@@ -657,7 +1200,9 @@ func (p *Process) resolveNameoff(md *moduleData, nameoff int) (string, error) {
 	}
 }
 
-func (p *Process) currentArgs(params []Parameter, addrBeginningOfArgs uint64) (inputArgs []Argument, outputArgs []Argument, err error) {
+// currentArgs returns the arguments. The regs may be nil if the registers' values are unknown.
+// In that case, the parameters in the registers are not available.
+func (p *Process) currentArgs(params []Parameter, addrBeginningOfArgs uint64, regs *debugapi.Registers) (inputArgs []Argument, outputArgs []Argument, err error) {
 	for _, param := range params {
 		param := param // without this, all the closures point to the last param.
 		parseValue := func(depth int) value {
@@ -665,9 +1210,8 @@ func (p *Process) currentArgs(params []Parameter, addrBeginningOfArgs uint64) (i
 				return nil
 			}
 
-			size := param.Typ.Size()
-			buff := make([]byte, size)
-			if err = p.debugapiClient.ReadMemory(addrBeginningOfArgs+uint64(param.Offset), buff); err != nil {
+			buff, err := p.readParameter(param, addrBeginningOfArgs, regs)
+			if err != nil {
 				log.Debugf("failed to read the '%s' value: %v", param.Name, err)
 				return nil
 			}
@@ -684,6 +1228,101 @@ func (p *Process) currentArgs(params []Parameter, addrBeginningOfArgs uint64) (i
 	return
 }
 
+// readParameter reads the raw value of the parameter. Each piece of the value is read from the stack
+// or the register, depending on its location.
+func (p *Process) readParameter(param Parameter, addrBeginningOfArgs uint64, regs *debugapi.Registers) ([]byte, error) {
+	size := int(param.Typ.Size())
+	buff := make([]byte, size)
+	if param.Pieces == nil {
+		err := p.debugapiClient.ReadMemory(addrBeginningOfArgs+uint64(param.Offset), buff)
+		return buff, err
+	}
+
+	offset := 0
+	for _, piece := range param.Pieces {
+		pieceSize := piece.Size
+		if pieceSize == 0 {
+			pieceSize = size - offset
+		}
+		if offset+pieceSize > size {
+			return nil, fmt.Errorf("the piece exceeds the value size (%d)", size)
+		}
+		pieceBuff := buff[offset : offset+pieceSize]
+
+		if piece.NoLocation {
+			// the buffer is zero-filled already.
+		} else if !piece.InRegister {
+			if err := p.debugapiClient.ReadMemory(addrBeginningOfArgs+uint64(piece.Offset), pieceBuff); err != nil {
+				return nil, err
+			}
+		} else {
+			if regs == nil {
+				return nil, errors.New("the registers' values are unknown")
+			}
+			regVal, ok := registerValue(*regs, piece.RegisterNum)
+			if !ok {
+				return nil, fmt.Errorf("unsupported register: %d", piece.RegisterNum)
+			} else if pieceSize > 8 {
+				return nil, fmt.Errorf("too large piece in the register: %d", pieceSize)
+			}
+
+			regBuff := make([]byte, 8)
+			binary.LittleEndian.PutUint64(regBuff, regVal)
+			copy(pieceBuff, regBuff)
+		}
+		offset += pieceSize
+	}
+	return buff, nil
+}
+
+// registerValue returns the value of the register the DWARF register number specifies (see the System V AMD64 ABI).
+// Only the registers the Go internal ABI uses to pass the arguments are supported.
+// The value of the xmm register is its lower 64 bits.
+func registerValue(regs debugapi.Registers, regNum int) (uint64, bool) {
+	if xmm0RegNum <= regNum && regNum < xmm0RegNum+len(regs.Xmm) {
+		return regs.Xmm[regNum-xmm0RegNum], true
+	}
+
+	switch regNum {
+	case 0:
+		return regs.Rax, true
+	case 2:
+		return regs.Rcx, true
+	case 3:
+		return regs.Rbx, true
+	case 4:
+		return regs.Rsi, true
+	case 5:
+		return regs.Rdi, true
+	case 7:
+		return regs.Rsp, true
+	case 8:
+		return regs.R8, true
+	case 9:
+		return regs.R9, true
+	case 10:
+		return regs.R10, true
+	case 11:
+		return regs.R11, true
+	}
+	return 0, false
+}
+
+// ReadMemory reads the memory of the tracee at the address. The tracee must be stopped.
+func (p *Process) ReadMemory(addr uint64, out []byte) error {
+	return p.debugapiClient.ReadMemory(addr, out)
+}
+
+// FormatValue reads the value of the given type at the address and returns its string representation.
+// The type can be found by BinaryFile.TypeByName. The `depth` option specifies to the depth of the parsing.
+func (p *Process) FormatValue(typ dwarf.Type, addr uint64, depth int) (string, error) {
+	buff := make([]byte, typ.Size())
+	if err := p.debugapiClient.ReadMemory(addr, buff); err != nil {
+		return "", err
+	}
+	return p.valueParser.parseValue(typ, buff, depth).String(), nil
+}
+
 // ReadInstructions reads the instructions of the specified function from memory.
 func (p *Process) ReadInstructions(f *Function) ([]x86asm.Inst, error) {
 	if f.EndAddr == 0 {
@@ -695,11 +1334,7 @@ func (p *Process) ReadInstructions(f *Function) ([]x86asm.Inst, error) {
 		return nil, err
 	}
 
-	for addr, bp := range p.breakpoints {
-		if f.StartAddr <= addr && addr < f.EndAddr {
-			copy(buff[addr-f.StartAddr:], bp.orgInsts)
-		}
-	}
+	p.restoreOriginalInsts(f.StartAddr, buff)
 
 	var pos int
 	var insts []x86asm.Inst
@@ -717,6 +1352,67 @@ func (p *Process) ReadInstructions(f *Function) ([]x86asm.Inst, error) {
 	return insts, nil
 }
 
+// maxInstLength is the maximum length of the x86-64 instruction.
+const maxInstLength = 15
+
+// pageSize is the unit the memory is mapped in.
+const pageSize = 4096
+
+// ReadInstructionsAt reads at most `count` instructions from the specified address.
+// Unlike ReadInstructions, the address doesn't need to be the beginning of the function,
+// but it must be the beginning of some instruction to decode correctly.
+// Fewer instructions are returned if the text segment ends before `count` instructions.
+func (p *Process) ReadInstructionsAt(addr uint64, count int) ([]x86asm.Inst, error) {
+	buff, err := readAvailableMemory(p.debugapiClient, addr, count*maxInstLength)
+	if err != nil {
+		return nil, err
+	}
+
+	p.restoreOriginalInsts(addr, buff)
+
+	var pos int
+	var insts []x86asm.Inst
+	for pos < len(buff) && len(insts) < count {
+		inst, err := x86asm.Decode(buff[pos:len(buff)], 64)
+		if err != nil {
+			log.Debugf("decode error at %#x: %v", addr+uint64(pos), err)
+			break
+		}
+		insts = append(insts, inst)
+		pos += inst.Len
+	}
+
+	return insts, nil
+}
+
+// readAvailableMemory reads at most `size` bytes at the address. If the region exceeds the end of the mapped memory,
+// the data up to the end is returned. The error is returned only if no data is available.
+func readAvailableMemory(reader memoryReader, addr uint64, size int) ([]byte, error) {
+	buff := make([]byte, size)
+	err := reader.ReadMemory(addr, buff)
+	for err != nil {
+		// the mapped memory ends at the page boundary. So shrink the region to the last boundary before its end.
+		end := (addr + uint64(len(buff)) - 1) &^ (pageSize - 1)
+		if end <= addr {
+			return nil, err
+		}
+		buff = buff[:end-addr]
+		err = reader.ReadMemory(addr, buff)
+	}
+	return buff, nil
+}
+
+// restoreOriginalInsts replaces the breakpoint instructions in the buff with the original ones.
+// `startAddr` is the address the buff is read from.
+func (p *Process) restoreOriginalInsts(startAddr uint64, buff []byte) {
+	endAddr := startAddr + uint64(len(buff))
+	for addr, bp := range p.breakpoints {
+		if startAddr <= addr && addr < endAddr {
+			copy(buff[addr-startAddr:], bp.orgInsts)
+		}
+	}
+}
+
 // GoRoutineInfo describes the various info of the go routine like pc.
 type GoRoutineInfo struct {
 	ID                int64
@@ -726,6 +1422,14 @@ type GoRoutineInfo struct {
 	NextDeferFuncAddr uint64
 	Panicking         bool
 	PanicHandler      *PanicHandler
+	// PanicValue is the value passed to the panic, which the deferred function can recover.
+	// It's nil if not panicking or the value is not found.
+	PanicValue *Argument
+	// OnSystemStack is true if the thread is running the runtime code on the system stack (g0 or gsignal)
+	// rather than the user go routine. If true, only ID, CurrentPC and CurrentStackAddr are filled in.
+	OnSystemStack bool
+	// Registers is the registers' values of the thread the go routine is running on.
+	Registers debugapi.Registers
 }
 
 // PanicHandler holds the function info which (will) handles panic.
@@ -756,12 +1460,21 @@ func (p *Process) CurrentGoRoutineInfo(threadID int) (GoRoutineInfo, error) {
 	}
 	id := int64(binary.LittleEndian.Uint64(idRawVal))
 
+	if p.onSystemStack(gAddr) {
+		// the stack and defer info of g0 are not related to the user go routine.
+		regs, err := p.debugapiClient.ReadRegisters(threadID)
+		if err != nil {
+			return GoRoutineInfo{}, err
+		}
+		return GoRoutineInfo{ID: id, CurrentPC: regs.Rip, CurrentStackAddr: regs.Rsp, OnSystemStack: true}, nil
+	}
+
 	stackType, stackRawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "stack")
 	if err != nil {
 		return GoRoutineInfo{}, err
 	}
 	stackVal := p.valueParser.parseValue(stackType, stackRawVal, 1)
-	stackHi := stackVal.(structValue).fields["hi"].(uint64Value).val
+	stackHi := withoutConstantName(stackVal.(structValue).fields["hi"]).(uint64Value).val
 
 	regs, err := p.debugapiClient.ReadRegisters(threadID)
 	if err != nil {
@@ -769,13 +1482,21 @@ func (p *Process) CurrentGoRoutineInfo(threadID int) (GoRoutineInfo, error) {
 	}
 	usedStackSize := stackHi - regs.Rsp
 
-	_, panicRawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "_panic")
+	ptrToPanicType, panicRawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "_panic")
 	if err != nil {
 		return GoRoutineInfo{}, err
 	}
 	panicAddr := binary.LittleEndian.Uint64(panicRawVal)
 	panicking := panicAddr != 0
 
+	var panicValue *Argument
+	if panicking {
+		panicValue, err = p.findPanicValue(panicAddr, ptrToPanicType)
+		if err != nil {
+			log.Debugf("failed to find the panic value: %v", err)
+		}
+	}
+
 	panicHandler, err := p.findPanicHandler(gAddr, panicAddr, stackHi)
 	if err != nil {
 		return GoRoutineInfo{}, err
@@ -786,7 +1507,143 @@ func (p *Process) CurrentGoRoutineInfo(threadID int) (GoRoutineInfo, error) {
 		return GoRoutineInfo{}, err
 	}
 
-	return GoRoutineInfo{ID: id, UsedStackSize: usedStackSize, CurrentPC: regs.Rip, CurrentStackAddr: regs.Rsp, NextDeferFuncAddr: nextDeferFuncAddr, Panicking: panicking, PanicHandler: panicHandler}, nil
+	return GoRoutineInfo{ID: id, UsedStackSize: usedStackSize, CurrentPC: regs.Rip, CurrentStackAddr: regs.Rsp, NextDeferFuncAddr: nextDeferFuncAddr, Panicking: panicking, PanicHandler: panicHandler, PanicValue: panicValue, Registers: regs}, nil
+}
+
+// onSystemStack returns true if the g is the m's g0 or gsignal, which runs the runtime code on the system stack.
+// It returns false if it can't be determined, for example, when the runtime.g type lacks the m field.
+func (p *Process) onSystemStack(gAddr uint64) bool {
+	ptrToMType, rawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "m")
+	if err != nil {
+		return false
+	}
+	mAddr := binary.LittleEndian.Uint64(rawVal)
+	ptrType, ok := ptrToMType.(*dwarf.PtrType)
+	if mAddr == 0 || !ok {
+		return false
+	}
+
+	for _, fieldName := range []string{"g0", "gsignal"} {
+		_, rawVal, err := p.findFieldInStruct(mAddr, ptrType.Type, fieldName)
+		if err == nil && binary.LittleEndian.Uint64(rawVal) == gAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// GoRoutineStatus is the scheduling status of the go routine.
+type GoRoutineStatus struct {
+	// Status is the name of the g's atomicstatus, such as "running" and "waiting".
+	Status string
+	// WaitReason describes why the go routine is waiting, such as "chan receive". Empty if unknown or not waiting.
+	WaitReason string
+}
+
+// String returns the wait reason if the go routine is waiting and the reason is known. Otherwise, it returns the status.
+func (s GoRoutineStatus) String() string {
+	if s.Status == gStatusWaiting && s.WaitReason != "" {
+		return s.WaitReason
+	}
+	return s.Status
+}
+
+// gStatusNames is the names of the g's status, which is the same as the runtime's gStatusStrings.
+var gStatusNames = []string{"idle", "runnable", "running", "syscall", "waiting", "moribund_unused", "dead", "enqueue_unused", "copystack", "preempted"}
+
+// gStatusWaiting is the name of the status in which the wait reason is valid.
+const gStatusWaiting = "waiting"
+
+// gStatusScan is the bit which is set while the stack of the go routine is scanned by GC.
+const gStatusScan = 0x1000
+
+// CurrentGoRoutineStatus returns the status and the wait reason of the go routine the thread is running.
+func (p *Process) CurrentGoRoutineStatus(threadID int) (GoRoutineStatus, error) {
+	gAddr, err := p.debugapiClient.ReadTLS(threadID, p.offsetToG())
+	if err != nil {
+		return GoRoutineStatus{}, err
+	}
+
+	statusType, statusRawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "atomicstatus")
+	if err != nil {
+		return GoRoutineStatus{}, err
+	}
+	if structType, ok := statusType.(*dwarf.StructType); ok {
+		// atomic.Uint32 in the newer go versions.
+		for _, field := range structType.Field {
+			if field.Name == "value" {
+				statusRawVal = statusRawVal[field.ByteOffset : field.ByteOffset+field.Type.Size()]
+			}
+		}
+	}
+	if len(statusRawVal) < 4 {
+		return GoRoutineStatus{}, fmt.Errorf("unexpected size of atomicstatus: %d", len(statusRawVal))
+	}
+	rawStatus := binary.LittleEndian.Uint32(statusRawVal) &^ gStatusScan
+
+	var status GoRoutineStatus
+	if int(rawStatus) < len(gStatusNames) {
+		status.Status = gStatusNames[rawStatus]
+	} else {
+		status.Status = fmt.Sprintf("unknown status (%d)", rawStatus)
+	}
+	if status.Status != gStatusWaiting {
+		// the runtime doesn't clear the wait reason after the go routine wakes up.
+		return status, nil
+	}
+
+	waitReasonType, waitReasonRawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "waitreason")
+	if err != nil {
+		log.Debugf("failed to find the wait reason: %v", err)
+		return status, nil
+	}
+	status.WaitReason = p.waitReasonString(waitReasonType, waitReasonRawVal)
+	return status, nil
+}
+
+// waitReasonString returns the string representation of the wait reason. The wait reason is the string in the older go versions,
+// while it's the integer constant such as `waitReasonChanReceive` in the newer ones.
+func (p *Process) waitReasonString(typ dwarf.Type, rawVal []byte) string {
+	const constantPrefix = "runtime.waitReason"
+
+	switch val := withoutConstantName(p.valueParser.parseValue(typ, rawVal, 1)).(type) {
+	case stringValue:
+		return val.val
+	case uint8Value:
+		if val.val == 0 {
+			return "" // waitReasonZero
+		}
+		name, ok := p.Binary.findConstantName(typ.String(), int64(val.val))
+		if !ok || !strings.HasPrefix(name, constantPrefix) {
+			return fmt.Sprintf("wait reason %d", val.val)
+		}
+		return splitCamelCase(strings.TrimPrefix(name, constantPrefix))
+	}
+	return ""
+}
+
+// splitCamelCase converts the camel case name into the space-separated words, such as `ChanReceive` to `chan receive`.
+// The acronyms like `GC` are kept upper case.
+func splitCamelCase(name string) string {
+	isUpper := func(i int) bool { return i < len(name) && unicode.IsUpper(rune(name[i])) }
+	isLower := func(i int) bool { return i < len(name) && unicode.IsLower(rune(name[i])) }
+
+	var words []string
+	start := 0
+	for i := 1; i <= len(name); i++ {
+		// the word ends before the upper case letter which follows the lower case one or begins the next word like `GCAssist`.
+		if i < len(name) && !(isUpper(i) && (isLower(i-1) || isLower(i+1))) {
+			continue
+		}
+
+		word := name[start:i]
+		if strings.ToUpper(word) != word {
+			word = strings.ToLower(word)
+		}
+		words = append(words, word)
+		start = i
+	}
+	return strings.Join(words, " ")
 }
 
 func (p *Process) singleStepUnspecifiedThreads(threadID int, err debugapi.UnspecifiedThreadError) error {
@@ -816,8 +1673,54 @@ func (p *Process) findNextDeferFuncAddr(gAddr uint64) (uint64, error) {
 		return 0x0, nil
 	}
 
+	return p.deferFuncAddr(deferAddr, ptrToDeferType.(*dwarf.PtrType).Type)
+}
+
+// maxDeferChainLength is the max number of the _defer structs DeferChain walks, in case the list is broken.
+const maxDeferChainLength = 1024
+
+// DeferChain returns the deferred functions the go routine the thread is running has queued but not called yet,
+// from the most recently deferred one. The open-coded defers are not included, because they are not linked to the g.
+func (p *Process) DeferChain(threadID int) ([]*Function, error) {
+	gAddr, err := p.debugapiClient.ReadTLS(threadID, p.offsetToG())
+	if err != nil {
+		return nil, err
+	}
+
+	ptrToDeferType, rawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "_defer")
+	if err != nil {
+		return nil, err
+	}
 	deferType := ptrToDeferType.(*dwarf.PtrType).Type
-	_, rawVal, err = p.findFieldInStruct(deferAddr, deferType, "fn")
+
+	var funcs []*Function
+	for deferAddr := binary.LittleEndian.Uint64(rawVal); deferAddr != 0x0; {
+		if len(funcs) >= maxDeferChainLength {
+			return funcs, errors.New("too long defer chain")
+		}
+
+		funcAddr, err := p.deferFuncAddr(deferAddr, deferType)
+		if err != nil {
+			return nil, err
+		}
+		function, err := p.FindFunction(funcAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the deferred function at %#x: %v", funcAddr, err)
+		}
+		funcs = append(funcs, function)
+
+		_, rawVal, err := p.findFieldInStruct(deferAddr, deferType, "link")
+		if err != nil {
+			return nil, err
+		}
+		deferAddr = binary.LittleEndian.Uint64(rawVal)
+	}
+	return funcs, nil
+}
+
+// deferFuncAddr returns the address of the function the _defer struct at `deferAddr` calls.
+func (p *Process) deferFuncAddr(deferAddr uint64, deferType dwarf.Type) (uint64, error) {
+	_, rawVal, err := p.findFieldInStruct(deferAddr, deferType, "fn")
 	if err != nil {
 		return 0, err
 	}
@@ -854,6 +1757,23 @@ func (p *Process) findFieldInStruct(structAddr uint64, structType dwarf.Type, fi
 	return nil, nil, fmt.Errorf("field %s not found", fieldName)
 }
 
+// findPanicValue returns the `arg` field of the runtime._panic, which is the interface value passed to the panic.
+func (p *Process) findPanicValue(panicAddr uint64, ptrToPanicType dwarf.Type) (*Argument, error) {
+	ptrType, ok := ptrToPanicType.(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected _panic type: %s", ptrToPanicType)
+	}
+
+	argType, argRawVal, err := p.findFieldInStruct(panicAddr, ptrType.Type, "arg")
+	if err != nil {
+		return nil, err
+	}
+	parseValue := func(depth int) value {
+		return p.valueParser.parseValue(argType, argRawVal, depth)
+	}
+	return &Argument{Typ: argType, parseValue: parseValue}, nil
+}
+
 func (p *Process) findPanicHandler(gAddr, panicAddr, stackHi uint64) (*PanicHandler, error) {
 	ptrToDeferType, rawVal, err := p.findFieldInStruct(gAddr, p.Binary.runtimeGType(), "_defer")
 	if err != nil {
@@ -920,22 +1840,46 @@ type Argument struct {
 	Name string
 	Typ  dwarf.Type
 	// parseValue lazily parses the value. The parsing every time is not only wasting resource, but the value may not be initialized yet.
+	// The value is unknown and printed as `-` if nil.
 	parseValue func(int) value
 }
 
 // ParseValue parses the arg value and returns string representation.
 // The `depth` option specifies to the depth of the parsing.
 func (arg Argument) ParseValue(depth int) string {
-	val := arg.parseValue(depth)
-	var valStr string
-	if val == nil {
-		valStr = "-"
-	} else {
-		valStr = val.String()
+	var buf bytes.Buffer
+	arg.WriteValue(&buf, depth)
+	return buf.String()
+}
+
+// WriteValue parses the arg value and writes the same representation as ParseValue to the buffer.
+// It avoids the allocations of the intermediate strings and so is useful when the buffer is reused.
+func (arg Argument) WriteValue(buf *bytes.Buffer, depth int) {
+	if arg.Name != "" {
+		buf.WriteString(arg.Name)
+		buf.WriteString(" = ")
 	}
 
-	if arg.Name == "" {
-		return valStr
+	var val value
+	if arg.parseValue != nil {
+		val = arg.parseValue(depth)
 	}
-	return fmt.Sprintf("%s = %s", arg.Name, valStr)
+	if val == nil {
+		buf.WriteByte('-')
+		return
+	}
+	val.writeTo(buf)
+}
+
+// WriteTypedValue is same as WriteValue except that the type name follows the arg name, such as `n int = 42`.
+// The type name is omitted if the arg has no name.
+func (arg Argument) WriteTypedValue(buf *bytes.Buffer, depth int) {
+	if arg.Name != "" && arg.Typ != nil {
+		buf.WriteString(arg.Name)
+		buf.WriteByte(' ')
+		buf.WriteString(arg.Typ.String())
+		buf.WriteString(" = ")
+		arg.Name = ""
+	}
+	arg.WriteValue(buf, depth)
 }
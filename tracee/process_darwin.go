@@ -1,8 +1,15 @@
 package tracee
 
+import "errors"
+
 func (p *Process) offsetToG() int32 {
-	if p.GoVersion.LaterThan(GoVersion{MajorVersion: 1, MinorVersion: 11}) {
+	if p.GoVersion.AtLeast(1, 11) {
 		return 0x30
 	}
 	return 0x8a0
 }
+
+// readProgramHeaderAddr returns the error because the mach-o binary has no program header table.
+func (p *Process) readProgramHeaderAddr() (uint64, error) {
+	return 0, errors.New("no program header table in the mach-o binary")
+}
@@ -3,3 +3,7 @@ package tracee
 func (p *Process) offsetToG() int32 {
 	return -8
 }
+
+func (p *Process) readProgramHeaderAddr() (uint64, error) {
+	return p.debugapiClient.ProgramHeaderAddr()
+}
@@ -1,11 +1,15 @@
 package tracee
 
 import (
+	"bytes"
 	"debug/dwarf"
+	"errors"
 	"os/exec"
+	"reflect"
 	"runtime"
 	"testing"
 
+	"github.com/nkbai/tgo/debugapi"
 	"github.com/nkbai/tgo/testutils"
 	"golang.org/x/arch/x86/x86asm"
 )
@@ -32,6 +36,33 @@ func TestLaunchProcess(t *testing.T) {
 	}
 }
 
+func TestReadOSArgs(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramHelloworld, []string{"a", "b c"}, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+	if len(proc.Args) != 3 || proc.Args[0] != testutils.ProgramHelloworld {
+		t.Errorf("wrong args: %v", proc.Args)
+	}
+
+	// os.Args is set before main.main.
+	if err := proc.SetBreakpoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set breakpoint: %v", err)
+	}
+	if _, err := proc.ContinueAndWait(); err != nil {
+		t.Fatalf("failed to continue: %v", err)
+	}
+
+	args, err := proc.readOSArgs()
+	if err != nil {
+		t.Fatalf("failed to read os.Args: %v", err)
+	}
+	if len(args) != 3 || args[1] != "a" || args[2] != "b c" {
+		t.Errorf("wrong args: %v", args)
+	}
+}
+
 func TestAttachProcess(t *testing.T) {
 	cmd := exec.Command(testutils.ProgramInfloop)
 	_ = cmd.Start()
@@ -69,6 +100,45 @@ func TestDetach(t *testing.T) {
 	}
 }
 
+func TestClearBreakpoint_RestoreOriginalInsts(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramHelloworld, nil, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+
+	addr := testutils.HelloworldAddrNoParameter
+	orgInsts := make([]byte, 8)
+	if err := proc.debugapiClient.ReadMemory(addr, orgInsts); err != nil {
+		t.Fatalf("failed to read memory: %v", err)
+	}
+
+	// setting the breakpoint twice must not save the breakpoint instruction as the original one.
+	for i := 0; i < 2; i++ {
+		if err := proc.SetBreakpoint(addr); err != nil {
+			t.Fatalf("failed to set breakpoint: %v", err)
+		}
+	}
+	event, err := proc.ContinueAndWait()
+	if err != nil {
+		t.Fatalf("failed to continue and wait: %v", err)
+	}
+	if err := proc.SingleStep(event.Data.([]int)[0], addr); err != nil {
+		t.Fatalf("single-step failed: %v", err)
+	}
+	if err := proc.ClearBreakpoint(addr); err != nil {
+		t.Fatalf("failed to clear breakpoint: %v", err)
+	}
+
+	insts := make([]byte, len(orgInsts))
+	if err := proc.debugapiClient.ReadMemory(addr, insts); err != nil {
+		t.Fatalf("failed to read memory: %v", err)
+	}
+	if !bytes.Equal(insts, orgInsts) {
+		t.Errorf("original instructions are not restored: %v, expected %v", insts, orgInsts)
+	}
+}
+
 func TestContinueAndWait(t *testing.T) {
 	proc, err := LaunchProcess(testutils.ProgramHelloworld, nil, helloworldAttr)
 	if err != nil {
@@ -254,6 +324,47 @@ func TestStackFrameAt_NoDwarfCase(t *testing.T) {
 	}
 }
 
+func TestFindFunctionByName_NoDwarfCase(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramHelloworldNoDwarf, nil, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+
+	function, err := proc.FindFunctionByName("main.main")
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	if function.StartAddr != testutils.HelloworldAddrMain {
+		t.Errorf("wrong start address: %#x", function.StartAddr)
+	}
+}
+
+func TestProcessRuntimeFunctionAddr(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramHelloworld, nil, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+
+	function, err := proc.FindFunctionByName(MallocFuncName)
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	addr, err := proc.RuntimeFunctionAddr(MallocFuncName)
+	if err != nil {
+		t.Fatalf("failed to find the address: %v", err)
+	} else if addr != function.StartAddr {
+		t.Errorf("wrong address. expect: %#x, actual: %#x", function.StartAddr, addr)
+	}
+
+	proc.LoadBias = 0x1000
+	if relocatedAddr, err := proc.RuntimeFunctionAddr(MallocFuncName); err != nil || relocatedAddr != addr+0x1000 {
+		t.Errorf("the address is not relocated: %#x, %v", relocatedAddr, err)
+	}
+	proc.LoadBias = 0
+}
+
 func TestFindFunction_FillInOneUnknownParameterOffset(t *testing.T) {
 	for i, testdata := range []uint64{
 		testutils.HelloworldAddrOneParameter,
@@ -317,6 +428,17 @@ func TestFindFunction_FillInOutputParametersOffset(t *testing.T) {
 		t.Fatalf("failed to find func: %v", err)
 	}
 
+	if proc.usesRegisterABI() {
+		// the results are returned in rax and rbx.
+		if !f.Parameters[0].Exist || !reflect.DeepEqual(f.Parameters[0].Pieces, []ParameterPiece{{Size: 8, InRegister: true, RegisterNum: 0}}) || f.Parameters[0].Name != "~r0" {
+			t.Errorf("Invalid parameter: %#v", f.Parameters[0])
+		}
+		if !f.Parameters[1].Exist || !reflect.DeepEqual(f.Parameters[1].Pieces, []ParameterPiece{{Size: 8, InRegister: true, RegisterNum: 3}}) || f.Parameters[1].Name != "~r1" {
+			t.Errorf("Invalid parameter: %#v", f.Parameters[1])
+		}
+		return
+	}
+
 	if !f.Parameters[0].Exist || f.Parameters[0].Offset != 0 || f.Parameters[0].Name != "~r0" {
 		t.Errorf("Invalid parameter: %#v", f.Parameters[0])
 	}
@@ -463,6 +585,57 @@ func TestReadInstructions_SetBreakpointBefore(t *testing.T) {
 	}
 }
 
+func TestReadInstructionsAt(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramHelloworld, nil, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+
+	proc.SetBreakpoint(testutils.HelloworldAddrMain)
+
+	insts, err := proc.ReadInstructionsAt(testutils.HelloworldAddrMain, 3)
+	if err != nil {
+		t.Fatalf("failed to read instructions: %v", err)
+	}
+
+	if len(insts) != 3 {
+		t.Errorf("wrong number of insts: %d", len(insts))
+	}
+	if insts[0].Op == x86asm.INT {
+		t.Errorf("breakpoint is not reset")
+	}
+}
+
+func TestReadAvailableMemory(t *testing.T) {
+	// the memory is mapped up to 0x2000.
+	reader := fakeMemoryReader{0x1000: make([]byte, 0x1000)}
+	for i, testdata := range []struct {
+		addr         uint64
+		size         int
+		expectedSize int
+		expectError  bool
+	}{
+		{addr: 0x1000, size: 0x10, expectedSize: 0x10},
+		{addr: 0x1ff8, size: 0x10, expectedSize: 0x8},
+		{addr: 0x2000, size: 0x10, expectError: true},
+	} {
+		data, err := readAvailableMemory(reader, testdata.addr, testdata.size)
+		if testdata.expectError {
+			if err == nil {
+				t.Errorf("[%d] error should be returned", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[%d] failed to read memory: %v", i, err)
+		} else if len(data) != testdata.expectedSize {
+			t.Errorf("[%d] wrong size: %#x", i, len(data))
+		}
+	}
+}
+
 func TestCurrentGoRoutineInfo(t *testing.T) {
 	for i, testProgram := range []string{testutils.ProgramHelloworld, testutils.ProgramHelloworldNoDwarf} {
 		proc, err := LaunchProcess(testProgram, nil, helloworldAttr)
@@ -510,6 +683,43 @@ func TestCurrentGoRoutineInfo(t *testing.T) {
 	}
 }
 
+func TestCurrentGoRoutineInfo_SystemStack(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramHelloworld, nil, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+
+	// runtime.schedule always runs on g0.
+	addr, err := proc.Binary.RuntimeFunctionAddr("runtime.schedule")
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	if err := proc.SetBreakpoint(addr); err != nil {
+		t.Fatalf("failed to set breakpoint: %v", err)
+	}
+
+	event, err := proc.ContinueAndWait()
+	if err != nil {
+		t.Fatalf("failed to continue and wait: %v", err)
+	}
+
+	threadIDs := event.Data.([]int)
+	goRoutineInfo, err := proc.CurrentGoRoutineInfo(threadIDs[0])
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !goRoutineInfo.OnSystemStack {
+		t.Errorf("not on system stack")
+	}
+	if goRoutineInfo.ID != 0 {
+		t.Errorf("wrong id: %d", goRoutineInfo.ID)
+	}
+	if goRoutineInfo.CurrentPC != addr+1 {
+		t.Errorf("wrong pc: %#x", goRoutineInfo.CurrentPC)
+	}
+}
+
 func TestCurrentGoRoutineInfo_Panicking(t *testing.T) {
 	for _, testProgram := range []string{testutils.ProgramPanic, testutils.ProgramPanicNoDwarf} {
 		proc, err := LaunchProcess(testProgram, nil, helloworldAttr)
@@ -536,12 +746,106 @@ func TestCurrentGoRoutineInfo_Panicking(t *testing.T) {
 			t.Errorf("not panicking")
 		}
 
+		if goRoutineInfo.PanicValue == nil {
+			t.Errorf("no panic value")
+		} else if val := goRoutineInfo.PanicValue.ParseValue(1); val != `"2"` {
+			t.Errorf("wrong panic value: %s", val)
+		}
+
 		if goRoutineInfo.PanicHandler.PCAtDefer == 0 {
 			t.Errorf("invalid panic handler")
 		}
 	}
 }
 
+func TestDeferChain(t *testing.T) {
+	proc, err := LaunchProcess(testutils.ProgramPanic, nil, helloworldAttr)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	defer proc.Detach()
+
+	if err := proc.SetBreakpoint(testutils.PanicAddrInsideThrough); err != nil {
+		t.Fatalf("failed to set breakpoint: %v", err)
+	}
+
+	event, err := proc.ContinueAndWait()
+	if err != nil {
+		t.Fatalf("failed to continue and wait: %v", err)
+	}
+
+	tids := event.Data.([]int)
+	funcs, err := proc.DeferChain(tids[0])
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	// through(1) is running and the deferred calls of g(0) are open-coded, so only main.f's one is linked.
+	if len(funcs) != 1 || funcs[0] == nil || funcs[0].Name != "main.catch" {
+		t.Errorf("wrong deferred functions: %v", funcs)
+	}
+}
+
+func TestCgoFuncName(t *testing.T) {
+	for i, testdata := range []struct {
+		name     string
+		expected string
+	}{
+		{"_cgo_0123456789ab_Cfunc_puts", "C.puts"},
+		{"_cgo_0123456789ab_Cmalloc", "_cgo_0123456789ab_Cmalloc"},
+		{"puts", "puts"},
+	} {
+		actual := cgoFuncName(testdata.name)
+		if actual != testdata.expected {
+			t.Errorf("[%d] wrong name. expect: %s, actual %s", i, testdata.expected, actual)
+		}
+	}
+}
+
+func TestComputeLoadBias(t *testing.T) {
+	readProgramHeaderAddr := func() (uint64, error) { return 0x7040, nil }
+	failToReadProgramHeaderAddr := func() (uint64, error) { return 0, errors.New("not found") }
+	for i, testdata := range []struct {
+		binary                BinaryFile
+		firstModuleDataAddr   uint64
+		readProgramHeaderAddr func() (uint64, error)
+		expected              uint64
+		expectErr             bool
+	}{
+		{debuggableBinaryFile{pie: true, staticFirstModuleDataAddr: 0x1000}, 0x5000, failToReadProgramHeaderAddr, 0x4000, false},
+		{debuggableBinaryFile{pie: false, staticFirstModuleDataAddr: 0x1000}, 0x5000, failToReadProgramHeaderAddr, 0, false},
+		{debuggableBinaryFile{pie: false}, 0, failToReadProgramHeaderAddr, 0, false},
+		{debuggableBinaryFile{pie: true, staticProgramHeaderAddr: 0x40}, 0, readProgramHeaderAddr, 0x7000, false},
+		{nonDebuggableBinaryFile{pie: true, staticFirstModuleDataAddr: 0x1000, staticProgramHeaderAddr: 0x40}, 0, readProgramHeaderAddr, 0x7000, false},
+		{debuggableBinaryFile{pie: true}, 0x5000, readProgramHeaderAddr, 0, true},
+		{debuggableBinaryFile{pie: true, staticProgramHeaderAddr: 0x40}, 0, failToReadProgramHeaderAddr, 0, true},
+	} {
+		actual, err := computeLoadBias(testdata.binary, testdata.firstModuleDataAddr, testdata.readProgramHeaderAddr)
+		if testdata.expectErr {
+			if err == nil {
+				t.Errorf("[%d] error should be returned", i)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("[%d] failed to compute the load bias: %v", i, err)
+		}
+		if actual != testdata.expected {
+			t.Errorf("[%d] wrong load bias. expect: %#x, actual %#x", i, testdata.expected, actual)
+		}
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	proc := &Process{LoadBias: 0x4000}
+	function := &Function{Name: "main.f", StartAddr: 0x1000, EndAddr: 0x1100}
+	relocated := proc.relocate(function)
+	if relocated.StartAddr != 0x5000 || relocated.EndAddr != 0x5100 {
+		t.Errorf("wrong addresses: %#x, %#x", relocated.StartAddr, relocated.EndAddr)
+	}
+	if function.StartAddr != 0x1000 {
+		t.Errorf("original function is modified: %#x", function.StartAddr)
+	}
+}
+
 func TestArgument_ParseValue(t *testing.T) {
 	for i, testdata := range []struct {
 		arg      Argument
@@ -550,6 +854,7 @@ func TestArgument_ParseValue(t *testing.T) {
 		{Argument{Name: "a", parseValue: func(int) value { return int8Value{val: 1} }}, "a = 1"},
 		{Argument{Name: "a", parseValue: func(int) value { return nil }}, "a = -"},
 		{Argument{Name: "", parseValue: func(int) value { return int8Value{val: 1} }}, "1"},
+		{Argument{Name: "a"}, "a = -"},
 	} {
 		actual := testdata.arg.ParseValue(0)
 		if actual != testdata.expected {
@@ -558,3 +863,181 @@ func TestArgument_ParseValue(t *testing.T) {
 	}
 
 }
+
+func TestArgument_WriteTypedValue(t *testing.T) {
+	intType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	for i, testdata := range []struct {
+		arg      Argument
+		expected string
+	}{
+		{Argument{Name: "n", Typ: intType, parseValue: func(int) value { return int64Value{val: 42} }}, "n int = 42"},
+		{Argument{Name: "n", parseValue: func(int) value { return int64Value{val: 42} }}, "n = 42"},
+		{Argument{Name: "", Typ: intType, parseValue: func(int) value { return int64Value{val: 42} }}, "42"},
+	} {
+		var buf bytes.Buffer
+		testdata.arg.WriteTypedValue(&buf, 1)
+		if buf.String() != testdata.expected {
+			t.Errorf("[%d] wrong result. expect: %s, actual %s", i, testdata.expected, buf.String())
+		}
+	}
+}
+
+func TestReadParameter_Registers(t *testing.T) {
+	// func f(s string, b byte) where s is passed in rax and rbx, and b in rcx
+	stringType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 16}}
+	byteType := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1}}}
+	regs := debugapi.Registers{Rax: 0x1122334455667788, Rbx: 5, Rcx: 0x1ff}
+
+	proc := &Process{}
+	for i, testdata := range []struct {
+		param    Parameter
+		expected []byte
+	}{
+		{
+			param:    Parameter{Typ: stringType, Pieces: []ParameterPiece{{Size: 8, InRegister: true, RegisterNum: 0}, {Size: 8, InRegister: true, RegisterNum: 3}}},
+			expected: []byte{0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 5, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			param:    Parameter{Typ: byteType, Pieces: []ParameterPiece{{InRegister: true, RegisterNum: 2}}},
+			expected: []byte{0xff},
+		},
+	} {
+		actual, err := proc.readParameter(testdata.param, 0, &regs)
+		if err != nil {
+			t.Fatalf("[%d] failed to read: %v", i, err)
+		}
+		if !reflect.DeepEqual(testdata.expected, actual) {
+			t.Errorf("[%d] wrong value. expect: %v, actual: %v", i, testdata.expected, actual)
+		}
+	}
+
+	regs.Xmm[1] = 0x3ff0000000000000
+	floatType := &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "float64"}}}
+	xmmParam := Parameter{Typ: floatType, Pieces: []ParameterPiece{{InRegister: true, RegisterNum: 18}}}
+	if actual, err := proc.readParameter(xmmParam, 0, &regs); err != nil {
+		t.Errorf("failed to read the xmm register: %v", err)
+	} else if expected := []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wrong value. expect: %v, actual: %v", expected, actual)
+	}
+	if _, err := proc.readParameter(Parameter{Typ: byteType, Pieces: []ParameterPiece{{InRegister: true, RegisterNum: 6}}}, 0, &regs); err == nil {
+		t.Errorf("error not returned for the unsupported register")
+	}
+	if _, err := proc.readParameter(Parameter{Typ: byteType, Pieces: []ParameterPiece{{InRegister: true, RegisterNum: 2}}}, 0, nil); err == nil {
+		t.Errorf("error not returned when the registers are unknown")
+	}
+}
+
+func TestFillInOutputRegisters(t *testing.T) {
+	// func f(a int) (int, string, float64, struct{b bool; c int32}, complex128, bool)
+	intType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	int32Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "int32"}}}
+	stringType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "string",
+		Field: []*dwarf.StructField{
+			{Name: "str", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}}, ByteOffset: 0},
+			{Name: "len", Type: intType, ByteOffset: 8},
+		},
+	}
+	floatType := &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8}}}
+	boolType := &dwarf.BoolType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1}}}
+	paddedStructType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 8},
+		Field: []*dwarf.StructField{
+			{Name: "b", Type: boolType, ByteOffset: 0},
+			{Name: "c", Type: int32Type, ByteOffset: 4},
+		},
+	}
+	complexType := &dwarf.ComplexType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 16}}}
+	params := []Parameter{
+		{Name: "a", Typ: intType, Exist: true},
+		{Name: "~r0", Typ: intType, IsOutput: true},
+		{Name: "~r1", Typ: stringType, IsOutput: true},
+		{Name: "~r2", Typ: floatType, IsOutput: true},
+		{Name: "~r3", Typ: paddedStructType, IsOutput: true},
+		{Name: "~r4", Typ: complexType, IsOutput: true},
+		{Name: "~r5", Typ: boolType, IsOutput: true},
+	}
+	fillInOutputRegisters(params)
+
+	// the integers are in rax, rbx, rcx, rdi, rsi and r8 and the floats are in xmm0, xmm1 and xmm2.
+	regs := debugapi.Registers{Rax: 7, Rbx: 0x1000, Rcx: 3, Rdi: 0xff01, Rsi: 0xffffffff, R8: 1}
+	regs.Xmm[0], regs.Xmm[1], regs.Xmm[2] = 0x3ff0000000000000, 1, 2
+	proc := &Process{}
+	for i, testdata := range []struct {
+		param    Parameter
+		expected []byte
+	}{
+		{param: params[1], expected: []byte{7, 0, 0, 0, 0, 0, 0, 0}},
+		{param: params[2], expected: []byte{0, 0x10, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0}},
+		{param: params[3], expected: []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+		{param: params[4], expected: []byte{1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}},
+		{param: params[5], expected: []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}},
+		{param: params[6], expected: []byte{1}},
+	} {
+		if !testdata.param.Exist {
+			t.Fatalf("[%d] not exist", i)
+		}
+		actual, err := proc.readParameter(testdata.param, 0, &regs)
+		if err != nil {
+			t.Fatalf("[%d] failed to read: %v", i, err)
+		}
+		if !reflect.DeepEqual(testdata.expected, actual) {
+			t.Errorf("[%d] wrong value. expect: %v, actual: %v", i, testdata.expected, actual)
+		}
+	}
+
+	if params[0].Pieces != nil {
+		t.Errorf("the input parameter is changed")
+	}
+}
+
+func TestFillInOutputRegisters_StackAssigned(t *testing.T) {
+	// func f() (int, [2]int, bool)
+	intType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	arrayType := &dwarf.ArrayType{CommonType: dwarf.CommonType{ByteSize: 16}, Type: intType, Count: 2}
+	boolType := &dwarf.BoolType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1}}}
+	params := []Parameter{
+		{Name: "~r0", Typ: intType, IsOutput: true},
+		{Name: "~r1", Typ: arrayType, IsOutput: true},
+		{Name: "~r2", Typ: boolType, IsOutput: true},
+	}
+	fillInOutputRegisters(params)
+
+	for i, param := range params {
+		if param.Exist || param.Pieces != nil {
+			t.Errorf("[%d] the result is assigned to the registers: %v", i, param.Pieces)
+		}
+	}
+}
+
+func TestGoRoutineStatus_String(t *testing.T) {
+	for i, testdata := range []struct {
+		status   GoRoutineStatus
+		expected string
+	}{
+		{GoRoutineStatus{Status: "running"}, "running"},
+		{GoRoutineStatus{Status: "waiting", WaitReason: "chan receive"}, "chan receive"},
+		{GoRoutineStatus{Status: "runnable", WaitReason: "chan receive"}, "runnable"},
+	} {
+		if actual := testdata.status.String(); actual != testdata.expected {
+			t.Errorf("[%d] wrong status. expect: %s, actual %s", i, testdata.expected, actual)
+		}
+	}
+}
+
+func TestSplitCamelCase(t *testing.T) {
+	for i, testdata := range []struct {
+		name     string
+		expected string
+	}{
+		{"ChanReceive", "chan receive"},
+		{"GCAssistMarking", "GC assist marking"},
+		{"Sleep", "sleep"},
+		{"", ""},
+	} {
+		if actual := splitCamelCase(testdata.name); actual != testdata.expected {
+			t.Errorf("[%d] wrong result. expect: %s, actual %s", i, testdata.expected, actual)
+		}
+	}
+}
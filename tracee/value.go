@@ -1,21 +1,65 @@
 package tracee
 
 import (
+	"bytes"
 	"debug/dwarf"
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/nkbai/tgo/log"
 )
 
 const maxContainerItemsToPrint = 8
 
+// defaultMaxFieldsToPrint is the default max number of the fields printed for the struct and the entries for the map.
+// Unlike the container items, the limit is large enough to print the fields of the most structs.
+const defaultMaxFieldsToPrint = 32
+
+// defaultInvalidPointerThreshold is the default size of the null page. The pointer to this page is considered as invalid.
+const defaultInvalidPointerThreshold = 0x1000
+
+// defaultLinkFields is the default names of the fields which link the nodes of the linked list or tree.
+var defaultLinkFields = []string{"next", "left", "right"}
+
 type value interface {
 	String() string
 	Size() int64
+	// writeTo writes the string representation to the buffer. Unlike String(), it avoids the allocations
+	// for the intermediate strings.
+	writeTo(buf *bytes.Buffer)
+}
+
+// valueString returns the string representation of the value using its writeTo method.
+func valueString(v value) string {
+	var buf bytes.Buffer
+	v.writeTo(&buf)
+	return buf.String()
+}
+
+func writeInt(buf *bytes.Buffer, val int64) {
+	var scratch [24]byte
+	buf.Write(strconv.AppendInt(scratch[:0], val, 10))
+}
+
+func writeUint(buf *bytes.Buffer, val uint64) {
+	var scratch [24]byte
+	buf.Write(strconv.AppendUint(scratch[:0], val, 10))
+}
+
+func writeHex(buf *bytes.Buffer, val uint64) {
+	var scratch [24]byte
+	buf.WriteString("0x")
+	buf.Write(strconv.AppendUint(scratch[:0], val, 16))
+}
+
+func writeFloat(buf *bytes.Buffer, val float64, bitSize int) {
+	var scratch [32]byte
+	buf.Write(strconv.AppendFloat(scratch[:0], val, 'g', -1, bitSize))
 }
 
 type int8Value struct {
@@ -24,7 +68,11 @@ type int8Value struct {
 }
 
 func (v int8Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v int8Value) writeTo(buf *bytes.Buffer) {
+	writeInt(buf, int64(v.val))
 }
 
 type int16Value struct {
@@ -33,7 +81,11 @@ type int16Value struct {
 }
 
 func (v int16Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v int16Value) writeTo(buf *bytes.Buffer) {
+	writeInt(buf, int64(v.val))
 }
 
 type int32Value struct {
@@ -42,7 +94,11 @@ type int32Value struct {
 }
 
 func (v int32Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v int32Value) writeTo(buf *bytes.Buffer) {
+	writeInt(buf, int64(v.val))
 }
 
 type int64Value struct {
@@ -51,7 +107,11 @@ type int64Value struct {
 }
 
 func (v int64Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v int64Value) writeTo(buf *bytes.Buffer) {
+	writeInt(buf, v.val)
 }
 
 type uint8Value struct {
@@ -60,7 +120,11 @@ type uint8Value struct {
 }
 
 func (v uint8Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v uint8Value) writeTo(buf *bytes.Buffer) {
+	writeUint(buf, uint64(v.val))
 }
 
 type uint16Value struct {
@@ -69,7 +133,11 @@ type uint16Value struct {
 }
 
 func (v uint16Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v uint16Value) writeTo(buf *bytes.Buffer) {
+	writeUint(buf, uint64(v.val))
 }
 
 type uint32Value struct {
@@ -78,7 +146,11 @@ type uint32Value struct {
 }
 
 func (v uint32Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v uint32Value) writeTo(buf *bytes.Buffer) {
+	writeUint(buf, uint64(v.val))
 }
 
 type uint64Value struct {
@@ -87,7 +159,11 @@ type uint64Value struct {
 }
 
 func (v uint64Value) String() string {
-	return fmt.Sprintf("%d", v.val)
+	return valueString(v)
+}
+
+func (v uint64Value) writeTo(buf *bytes.Buffer) {
+	writeUint(buf, v.val)
 }
 
 type float32Value struct {
@@ -96,7 +172,11 @@ type float32Value struct {
 }
 
 func (v float32Value) String() string {
-	return fmt.Sprintf("%g", v.val)
+	return valueString(v)
+}
+
+func (v float32Value) writeTo(buf *bytes.Buffer) {
+	writeFloat(buf, float64(v.val), 32)
 }
 
 type float64Value struct {
@@ -105,7 +185,11 @@ type float64Value struct {
 }
 
 func (v float64Value) String() string {
-	return fmt.Sprintf("%g", v.val)
+	return valueString(v)
+}
+
+func (v float64Value) writeTo(buf *bytes.Buffer) {
+	writeFloat(buf, v.val, 64)
 }
 
 type complex64Value struct {
@@ -114,7 +198,11 @@ type complex64Value struct {
 }
 
 func (v complex64Value) String() string {
-	return fmt.Sprintf("%g", v.val)
+	return valueString(v)
+}
+
+func (v complex64Value) writeTo(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "%g", v.val)
 }
 
 type complex128Value struct {
@@ -123,7 +211,11 @@ type complex128Value struct {
 }
 
 func (v complex128Value) String() string {
-	return fmt.Sprintf("%g", v.val)
+	return valueString(v)
+}
+
+func (v complex128Value) writeTo(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "%g", v.val)
 }
 
 type boolValue struct {
@@ -132,81 +224,286 @@ type boolValue struct {
 }
 
 func (v boolValue) String() string {
-	return fmt.Sprintf("%t", v.val)
+	return valueString(v)
+}
+
+func (v boolValue) writeTo(buf *bytes.Buffer) {
+	if v.val {
+		buf.WriteString("true")
+	} else {
+		buf.WriteString("false")
+	}
 }
 
 type ptrValue struct {
 	*dwarf.PtrType
 	addr       uint64
 	pointedVal value
+	// invalid is true if the addr points to the null page.
+	invalid bool
 }
 
 func (v ptrValue) String() string {
+	return valueString(v)
+}
+
+func (v ptrValue) writeTo(buf *bytes.Buffer) {
+	if v.invalid {
+		buf.WriteString("<invalid pointer ")
+		writeHex(buf, v.addr)
+		buf.WriteByte('>')
+		return
+	}
 	if v.pointedVal != nil {
-		return fmt.Sprintf("&%s", v.pointedVal)
+		buf.WriteByte('&')
+		v.pointedVal.writeTo(buf)
+		return
+	}
+	writeHex(buf, v.addr)
+}
+
+// linkedValue is the pointer to the linked data structure, whose nodes are followed via the link fields.
+type linkedValue struct {
+	*dwarf.PtrType
+	head *linkedNode
+	// list is true if the node has only one link field. The nodes are printed as the sequence rather than the tree.
+	list bool
+}
+
+type linkedNode struct {
+	// fields is the list of the fields other than the link fields, in the declaration order.
+	fields []linkedField
+	links  []linkedLink
+}
+
+type linkedField struct {
+	name string
+	val  value
+}
+
+type linkedLink struct {
+	name string
+	// node is the linked node. nil if the link is not followed.
+	node *linkedNode
+	// end describes why the link is not followed, such as `nil` or `...` (the node limit is reached).
+	end string
+}
+
+func (v linkedValue) String() string {
+	return valueString(v)
+}
+
+func (v linkedValue) writeTo(buf *bytes.Buffer) {
+	if !v.list {
+		v.head.writeTo(buf)
+		return
+	}
+
+	buf.WriteByte('[')
+	for node := v.head; ; {
+		node.writeFieldsTo(buf)
+		link := node.links[0]
+		if link.node == nil {
+			if link.end != "nil" {
+				buf.WriteString(" -> ")
+				buf.WriteString(link.end)
+			}
+			break
+		}
+		buf.WriteString(" -> ")
+		node = link.node
+	}
+	buf.WriteByte(']')
+}
+
+func (n *linkedNode) writeTo(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	n.writeFields(buf)
+	for i, link := range n.links {
+		if i > 0 || len(n.fields) > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(link.name)
+		buf.WriteString(": ")
+		if link.node != nil {
+			link.node.writeTo(buf)
+		} else {
+			buf.WriteString(link.end)
+		}
+	}
+	buf.WriteByte('}')
+}
+
+// writeFieldsTo writes the fields other than the link fields, like `{val: 1}`.
+func (n *linkedNode) writeFieldsTo(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	n.writeFields(buf)
+	buf.WriteByte('}')
+}
+
+func (n *linkedNode) writeFields(buf *bytes.Buffer) {
+	for i, field := range n.fields {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(field.name)
+		buf.WriteString(": ")
+		field.val.writeTo(buf)
 	}
-	return fmt.Sprintf("%#x", v.addr)
 }
 
 type funcValue struct {
 	*dwarf.FuncType
 	addr uint64
+	// name is the name of the function the addr points to. Empty if unknown.
+	name string
 }
 
 func (v funcValue) String() string {
-	return fmt.Sprintf("%#x", v.addr)
+	return valueString(v)
+}
+
+func (v funcValue) writeTo(buf *bytes.Buffer) {
+	if v.name != "" {
+		buf.WriteString(v.name)
+		return
+	}
+	writeHex(buf, v.addr)
 }
 
 type stringValue struct {
 	*dwarf.StructType
 	val string
+	// truncated is true if the val is the prefix of the actual string.
+	truncated bool
 }
 
 func (v stringValue) String() string {
-	return strconv.Quote(v.val)
+	return valueString(v)
+}
+
+func (v stringValue) writeTo(buf *bytes.Buffer) {
+	var scratch [64]byte
+	buf.Write(strconv.AppendQuote(scratch[:0], v.val))
+	if v.truncated {
+		buf.WriteString("...")
+	}
 }
 
 type sliceValue struct {
 	*dwarf.StructType
 	val []value
+	// abbreviated is true if the slice is not empty but its elements are not read.
+	abbreviated bool
 }
 
 func (v sliceValue) String() string {
+	return valueString(v)
+}
+
+func (v sliceValue) writeTo(buf *bytes.Buffer) {
+	if v.abbreviated {
+		buf.WriteString("[]{...}")
+		return
+	}
 	if len(v.val) == 0 {
-		return "nil"
+		buf.WriteString("nil")
+		return
 	}
 
-	var vals []string
-	abbrev := false
-	for i, v := range v.val {
+	buf.WriteString("[]{")
+	writeContainerItems(buf, v.val)
+	buf.WriteByte('}')
+}
+
+// writeContainerItems writes the comma-separated items. The items more than maxContainerItemsToPrint are abbreviated.
+func writeContainerItems(buf *bytes.Buffer, vals []value) {
+	for i, v := range vals {
 		if i >= maxContainerItemsToPrint {
-			abbrev = true
+			buf.WriteString(", ...")
 			break
 		}
-		vals = append(vals, v.String())
-	}
-
-	if abbrev {
-		return fmt.Sprintf("[]{%s, ...}", strings.Join(vals, ", "))
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		v.writeTo(buf)
 	}
-	return fmt.Sprintf("[]{%s}", strings.Join(vals, ", "))
 }
 
 type structValue struct {
 	*dwarf.StructType
-	fields      map[string]value
+	fields map[string]value
+	// fieldNames is the names of the fields in the declaration order. The fields promoted from the flattened
+	// embedded structs follow the struct's own fields. If nil, the fields are printed in the name order.
+	fieldNames  []string
 	abbreviated bool
+	// maxFields is the max number of the fields printed. 0 means no limit.
+	maxFields int
 }
 
 func (v structValue) String() string {
+	return valueString(v)
+}
+
+func (v structValue) writeTo(buf *bytes.Buffer) {
 	if v.abbreviated {
-		return "{...}"
+		buf.WriteString("{...}")
+		return
+	}
+
+	buf.WriteByte('{')
+	names := v.orderedFieldNames()
+	if v.maxFields > 0 && len(names) > v.maxFields {
+		for _, name := range names[:v.maxFields] {
+			buf.WriteString(name)
+			buf.WriteString(": ")
+			v.fields[name].writeTo(buf)
+			buf.WriteString(", ")
+		}
+		buf.WriteString("...}")
+		return
+	}
+
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(name)
+		buf.WriteString(": ")
+		v.fields[name].writeTo(buf)
+	}
+	buf.WriteByte('}')
+}
+
+// orderedFieldNames returns the field names in the declaration order so that the same fields are printed every time.
+func (v structValue) orderedFieldNames() []string {
+	if v.fieldNames != nil {
+		return v.fieldNames
 	}
-	var vals []string
-	for name, val := range v.fields {
-		vals = append(vals, fmt.Sprintf("%s: %s", name, val))
+
+	names := make([]string, 0, len(v.fields))
+	for name := range v.fields {
+		names = append(names, name)
 	}
-	return fmt.Sprintf("{%s}", strings.Join(vals, ", "))
+	sort.Strings(names)
+	return names
+}
+
+// syncValue represents the well-known types in the sync package, such as sync.Mutex.
+type syncValue struct {
+	*dwarf.StructType
+	state string
+}
+
+func (v syncValue) String() string {
+	return valueString(v)
+}
+
+func (v syncValue) writeTo(buf *bytes.Buffer) {
+	buf.WriteString(strings.TrimPrefix(v.StructName, "sync."))
+	buf.WriteByte('(')
+	buf.WriteString(v.state)
+	buf.WriteByte(')')
 }
 
 type interfaceValue struct {
@@ -214,14 +511,27 @@ type interfaceValue struct {
 	implType    dwarf.Type
 	implVal     value
 	abbreviated bool
+	// methods is the list of the concrete methods which satisfy the interface. Empty if not parsed.
+	methods []interfaceMethod
+}
+
+type interfaceMethod struct {
+	name     string
+	funcName string
 }
 
 func (v interfaceValue) String() string {
+	return valueString(v)
+}
+
+func (v interfaceValue) writeTo(buf *bytes.Buffer) {
 	if v.abbreviated {
-		return "{...}"
+		buf.WriteString("{...}")
+		return
 	}
 	if v.implType == nil {
-		return "nil"
+		buf.WriteString("nil")
+		return
 	}
 
 	typeName := v.implType.String()
@@ -230,7 +540,28 @@ func (v interfaceValue) String() string {
 		// just to make the logs cleaner
 		typeName = strings.TrimPrefix(typeName, structPrefix)
 	}
-	return fmt.Sprintf("%s(%s)", typeName, v.implVal)
+	buf.WriteString(typeName)
+	buf.WriteByte('(')
+	if v.implVal != nil {
+		v.implVal.writeTo(buf)
+	} else {
+		buf.WriteString("nil")
+	}
+	buf.WriteByte(')')
+
+	if len(v.methods) == 0 {
+		return
+	}
+	buf.WriteByte('{')
+	for i, method := range v.methods {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(method.name)
+		buf.WriteString(": ")
+		buf.WriteString(method.funcName)
+	}
+	buf.WriteByte('}')
 }
 
 type arrayValue struct {
@@ -239,33 +570,192 @@ type arrayValue struct {
 }
 
 func (v arrayValue) String() string {
-	var vals []string
-	abbrev := false
-	for i, v := range v.val {
-		if i >= maxContainerItemsToPrint {
-			abbrev = true
-			break
+	return valueString(v)
+}
+
+func (v arrayValue) writeTo(buf *bytes.Buffer) {
+	numPrinted := len(v.val)
+	if numPrinted > maxContainerItemsToPrint {
+		numPrinted = maxContainerItemsToPrint
+	}
+
+	buf.WriteByte('[')
+	writeInt(buf, int64(numPrinted))
+	buf.WriteString("]{")
+	writeContainerItems(buf, v.val)
+	buf.WriteByte('}')
+}
+
+// ByteArrayFormat is the representation of the byte array value, such as `[16]byte`.
+type ByteArrayFormat string
+
+const (
+	// ByteArrayFormatDecimal prints the byte array as the list of the decimal integers, like the other arrays. It's the default.
+	ByteArrayFormatDecimal ByteArrayFormat = "decimal"
+	// ByteArrayFormatHex prints the byte array as the hex string, such as `0x0a1b`.
+	ByteArrayFormatHex ByteArrayFormat = "hex"
+	// ByteArrayFormatString prints the byte array as the quoted string if it's printable, ignoring the trailing NULs.
+	// Otherwise, it's printed in the hex format.
+	ByteArrayFormatString ByteArrayFormat = "string"
+)
+
+// maxByteArrayLenToPrint is the max number of the bytes printed for the byte array in the hex or string format.
+const maxByteArrayLenToPrint = 64
+
+type byteArrayValue struct {
+	*dwarf.ArrayType
+	val    []byte
+	format ByteArrayFormat
+}
+
+func (v byteArrayValue) String() string {
+	return valueString(v)
+}
+
+func (v byteArrayValue) writeTo(buf *bytes.Buffer) {
+	val := v.val
+	truncated := len(val) > maxByteArrayLenToPrint
+	if truncated {
+		val = val[:maxByteArrayLenToPrint]
+	}
+
+	if v.format == ByteArrayFormatString {
+		if str := bytes.TrimRight(val, "\x00"); isPrintable(str) {
+			var scratch [64]byte
+			buf.Write(strconv.AppendQuote(scratch[:0], string(str)))
+			if truncated {
+				buf.WriteString("...")
+			}
+			return
+		}
+	}
+
+	const hexDigits = "0123456789abcdef"
+	buf.WriteString("0x")
+	for _, b := range val {
+		buf.WriteByte(hexDigits[b>>4])
+		buf.WriteByte(hexDigits[b&0xf])
+	}
+	if truncated {
+		buf.WriteString("...")
+	}
+}
+
+// isPrintable returns true if the data is the non-empty UTF-8 string and all its runes are printable.
+func isPrintable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !strconv.IsPrint(r) {
+			return false
 		}
-		vals = append(vals, v.String())
 	}
+	return true
+}
+
+// runtimeTypeValue is the runtime-internal struct abbreviated to the label, such as `runtime.g(goid=7)`.
+type runtimeTypeValue struct {
+	*dwarf.StructType
+	labels []runtimeTypeLabel
+}
+
+type runtimeTypeLabel struct {
+	name string
+	val  value
+}
+
+func (v runtimeTypeValue) String() string {
+	return valueString(v)
+}
 
-	if abbrev {
-		return fmt.Sprintf("[%d]{%s, ...}", len(vals), strings.Join(vals, ", "))
+func (v runtimeTypeValue) writeTo(buf *bytes.Buffer) {
+	buf.WriteString(v.StructName)
+	buf.WriteByte('(')
+	for i, label := range v.labels {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(label.name)
+		buf.WriteByte('=')
+		label.val.writeTo(buf)
 	}
-	return fmt.Sprintf("[%d]{%s}", len(vals), strings.Join(vals, ", "))
+	buf.WriteByte(')')
 }
 
 type mapValue struct {
 	*dwarf.TypedefType
 	val map[value]value
+	// maxEntries is the max number of the entries printed. 0 means no limit.
+	maxEntries int
 }
 
 func (v mapValue) String() string {
-	var vals []string
-	for k, v := range v.val {
-		vals = append(vals, fmt.Sprintf("%s: %s", k, v))
+	return valueString(v)
+}
+
+func (v mapValue) writeTo(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	numPrinted := 0
+	for k, val := range v.val {
+		if v.maxEntries > 0 && numPrinted >= v.maxEntries {
+			buf.WriteString(", ...")
+			break
+		}
+		if numPrinted > 0 {
+			buf.WriteString(", ")
+		}
+		numPrinted++
+		k.writeTo(buf)
+		buf.WriteString(": ")
+		val.writeTo(buf)
 	}
-	return fmt.Sprintf("{%s}", strings.Join(vals, ", "))
+	buf.WriteByte('}')
+}
+
+// mapLenValue is the map of which only the number of the entries is parsed, such as `map[string]int(len 3)`.
+type mapLenValue struct {
+	*dwarf.TypedefType
+	len   uint64
+	isNil bool
+}
+
+func (v mapLenValue) String() string {
+	return valueString(v)
+}
+
+func (v mapLenValue) writeTo(buf *bytes.Buffer) {
+	if v.isNil {
+		buf.WriteString("nil")
+		return
+	}
+	fmt.Fprintf(buf, "%s(len %d)", v.TypedefType.String(), v.len)
+}
+
+// constantValue is the integer value annotated with the name of the constant which has the same type and value.
+type constantValue struct {
+	value
+	name string
+}
+
+func (v constantValue) String() string {
+	return valueString(v)
+}
+
+func (v constantValue) writeTo(buf *bytes.Buffer) {
+	v.value.writeTo(buf)
+	buf.WriteString(" (")
+	buf.WriteString(v.name)
+	buf.WriteByte(')')
+}
+
+// withoutConstantName returns the value not annotated with the constant name.
+// Use this when the value is asserted to the concrete type.
+func withoutConstantName(v value) value {
+	if constant, ok := v.(constantValue); ok {
+		return constant.value
+	}
+	return v
 }
 
 type voidValue struct {
@@ -274,12 +764,104 @@ type voidValue struct {
 }
 
 func (v voidValue) String() string {
-	return fmt.Sprintf("%v", v.val)
+	return valueString(v)
+}
+
+func (v voidValue) writeTo(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "%v", v.val)
 }
 
 type valueParser struct {
 	reader         memoryReader
 	mapRuntimeType func(addr uint64) (dwarf.Type, error)
+	// findFunction is used to resolve the function name from its address. The name is not resolved if nil.
+	findFunction func(pc uint64) (*Function, error)
+	// readStaticData reads the data from the binary file. It's the fallback used when the read-only data,
+	// such as the statically allocated itab, can't be read from the process memory. Not used if nil.
+	readStaticData func(addr uint64, out []byte) error
+	// flattenEmbeddedFields promotes the fields of the embedded struct to the embedding struct.
+	flattenEmbeddedFields bool
+	// isEmbeddedField returns true if the field of the struct is the embedded field. No field is embedded if nil.
+	isEmbeddedField func(structName, fieldName string) bool
+	// parseInterfaceMethods is true if the concrete methods which satisfy the non-empty interface are parsed.
+	// It requires additional memory reads and function lookups per interface value.
+	parseInterfaceMethods bool
+	// invalidPointerThreshold is the address below which the pointer is not dereferenced.
+	// Some debug servers return zeros rather than error when reading the null page.
+	invalidPointerThreshold uint64
+	// findConstantName is used to annotate the integer value with the constant name. Not annotated if nil.
+	findConstantName func(typeName string, val int64) (string, bool)
+	// maxPointerDepth is the max number of the pointer indirections followed from the parsed value. 0 means no limit.
+	// Unlike `remainingDepth`, it's not decremented by the struct.
+	maxPointerDepth int
+	// pointerDepth is the number of the pointer indirections followed so far.
+	pointerDepth int
+	// maxLinkedNodes is the max number of the nodes followed when the pointer to the linked data structure is parsed.
+	// 0 disables the traversal and the pointer is parsed like the other pointers.
+	maxLinkedNodes int
+	// linkFields is the names of the fields which link the nodes of the linked data structure.
+	linkFields []string
+	// maxStringLen is the max number of the bytes read from the string value. 0 means maxStringReadLen.
+	maxStringLen int
+	// mapLenOnly is true if only the number of the entries is parsed from the map header. The buckets are not read.
+	mapLenOnly bool
+	// maxFields is the max number of the fields printed for the struct and the entries for the map. 0 means no limit.
+	maxFields int
+	// byteArrayFormat is the representation of the byte array. The empty format means ByteArrayFormatDecimal.
+	byteArrayFormat ByteArrayFormat
+	// unsafePointerHints is the type the unsafe.Pointer field or parameter points to.
+	unsafePointerHints map[unsafePointerHintKey]dwarf.Type
+}
+
+// unsafePointerHintKey specifies the unsafe.Pointer. The owner is the struct name for the field and the function name
+// for the parameter.
+type unsafePointerHintKey struct {
+	owner, name string
+}
+
+// hintedType returns the pointer to the hinted type if the unsafe.Pointer has the type hint. Otherwise, it returns the type as it is.
+func (b valueParser) hintedType(owner, name string, typ dwarf.Type) dwarf.Type {
+	if len(b.unsafePointerHints) == 0 {
+		return typ
+	}
+
+	ptrType, ok := typ.(*dwarf.PtrType)
+	if !ok {
+		return typ
+	}
+	if _, ok := ptrType.Type.(*dwarf.VoidType); !ok {
+		return typ
+	}
+
+	pointedType, ok := b.unsafePointerHints[unsafePointerHintKey{owner: owner, name: name}]
+	if !ok {
+		return typ
+	}
+	return &dwarf.PtrType{CommonType: ptrType.CommonType, Type: pointedType}
+}
+
+// hintedParameters returns the parameters whose unsafe.Pointer types are replaced with the hinted types.
+// The parameters are returned as they are if no hint applies.
+func (b valueParser) hintedParameters(funcName string, params []Parameter) []Parameter {
+	if len(b.unsafePointerHints) == 0 {
+		return params
+	}
+
+	var hinted []Parameter
+	for i, param := range params {
+		typ := b.hintedType(funcName, param.Name, param.Typ)
+		if typ == param.Typ {
+			continue
+		}
+		if hinted == nil {
+			hinted = append([]Parameter(nil), params...)
+		}
+		hinted[i].Typ = typ
+	}
+	if hinted == nil {
+		return params
+	}
+	return hinted
 }
 
 type memoryReader interface {
@@ -294,25 +876,33 @@ func (b valueParser) parseValue(rawTyp dwarf.Type, val []byte, remainingDepth in
 	case *dwarf.IntType:
 		switch typ.Size() {
 		case 1:
-			return int8Value{IntType: typ, val: int8(val[0])}
+			v := int8Value{IntType: typ, val: int8(val[0])}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		case 2:
-			return int16Value{IntType: typ, val: int16(binary.LittleEndian.Uint16(val))}
+			v := int16Value{IntType: typ, val: int16(binary.LittleEndian.Uint16(val))}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		case 4:
-			return int32Value{IntType: typ, val: int32(binary.LittleEndian.Uint32(val))}
+			v := int32Value{IntType: typ, val: int32(binary.LittleEndian.Uint32(val))}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		case 8:
-			return int64Value{IntType: typ, val: int64(binary.LittleEndian.Uint64(val))}
+			v := int64Value{IntType: typ, val: int64(binary.LittleEndian.Uint64(val))}
+			return b.withConstantName(v, typ.Name, v.val)
 		}
 
 	case *dwarf.UintType:
 		switch typ.Size() {
 		case 1:
-			return uint8Value{UintType: typ, val: val[0]}
+			v := uint8Value{UintType: typ, val: val[0]}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		case 2:
-			return uint16Value{UintType: typ, val: binary.LittleEndian.Uint16(val)}
+			v := uint16Value{UintType: typ, val: binary.LittleEndian.Uint16(val)}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		case 4:
-			return uint32Value{UintType: typ, val: binary.LittleEndian.Uint32(val)}
+			v := uint32Value{UintType: typ, val: binary.LittleEndian.Uint32(val)}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		case 8:
-			return uint64Value{UintType: typ, val: binary.LittleEndian.Uint64(val)}
+			v := uint64Value{UintType: typ, val: binary.LittleEndian.Uint64(val)}
+			return b.withConstantName(v, typ.Name, int64(v.val))
 		}
 
 	case *dwarf.FloatType:
@@ -345,24 +935,42 @@ func (b valueParser) parseValue(rawTyp dwarf.Type, val []byte, remainingDepth in
 			return ptrValue{PtrType: typ}
 		}
 
+		if addr < b.invalidPointerThreshold {
+			return ptrValue{PtrType: typ, addr: addr, invalid: true}
+		}
+
 		if _, ok := typ.Type.(*dwarf.VoidType); ok {
 			// unsafe.Pointer
 			return ptrValue{PtrType: typ, addr: addr}
 		}
 
+		if b.maxPointerDepth > 0 && b.pointerDepth >= b.maxPointerDepth {
+			return ptrValue{PtrType: typ, addr: addr}
+		}
+
+		if b.maxLinkedNodes > 0 && remainingDepth > 0 {
+			if structType, ok := typ.Type.(*dwarf.StructType); ok {
+				if linkFields := b.findLinkFields(structType); len(linkFields) > 0 {
+					return b.parseLinkedValue(typ, structType, linkFields, addr, remainingDepth)
+				}
+			}
+		}
+
 		buff := make([]byte, typ.Type.Size())
 		if err := b.reader.ReadMemory(addr, buff); err != nil {
 			log.Debugf("failed to read memory (addr: %x): %v", addr, err)
 			// the value may not be initialized yet (or too large)
 			return ptrValue{PtrType: typ, addr: addr}
 		}
-		pointedVal := b.parseValue(typ.Type, buff, remainingDepth)
+		pointedParser := b
+		pointedParser.pointerDepth++
+		pointedVal := pointedParser.parseValue(typ.Type, buff, remainingDepth)
 		return ptrValue{PtrType: typ, addr: addr, pointedVal: pointedVal}
 
 	case *dwarf.FuncType:
-		// TODO: print the pointer to the actual function (and the variables in closure if possible).
+		// TODO: print the variables in closure if possible.
 		addr := binary.LittleEndian.Uint64(val)
-		return funcValue{FuncType: typ, addr: addr}
+		return funcValue{FuncType: typ, addr: addr, name: b.resolveFuncName(addr)}
 
 	case *dwarf.StructType:
 		switch {
@@ -374,6 +982,16 @@ func (b valueParser) parseValue(rawTyp dwarf.Type, val []byte, remainingDepth in
 			return b.parseInterfaceValue(typ, val, remainingDepth)
 		case typ.StructName == "runtime.eface":
 			return b.parseEmptyInterfaceValue(typ, val, remainingDepth)
+		case runtimeTypeLabelFields[typ.StructName] != nil:
+			if runtimeTypeVal, ok := b.parseRuntimeTypeValue(typ, val); ok {
+				return runtimeTypeVal
+			}
+			return b.parseStructValue(typ, val, remainingDepth)
+		case typ.StructName == "sync.Mutex" || typ.StructName == "sync.WaitGroup" || typ.StructName == "sync.Once":
+			if syncVal, ok := b.parseSyncValue(typ, val); ok {
+				return syncVal
+			}
+			return b.parseStructValue(typ, val, remainingDepth)
 		default:
 			return b.parseStructValue(typ, val, remainingDepth)
 		}
@@ -381,6 +999,9 @@ func (b valueParser) parseValue(rawTyp dwarf.Type, val []byte, remainingDepth in
 		if typ.Count == -1 {
 			break
 		}
+		if b.byteArrayFormat != "" && b.byteArrayFormat != ByteArrayFormatDecimal && isByteType(typ.Type) {
+			return byteArrayValue{ArrayType: typ, val: val[:typ.Count], format: b.byteArrayFormat}
+		}
 		var vals []value
 		stride := int(typ.Type.Size())
 		for i := 0; i < int(typ.Count); i++ {
@@ -388,6 +1009,11 @@ func (b valueParser) parseValue(rawTyp dwarf.Type, val []byte, remainingDepth in
 		}
 		return arrayValue{ArrayType: typ, val: vals}
 	case *dwarf.TypedefType:
+		if b.mapLenOnly && strings.HasPrefix(typ.String(), "map[") {
+			if mapLenVal, ok := b.parseMapLen(typ, val); ok {
+				return mapLenVal
+			}
+		}
 		//if strings.HasPrefix(typ.String(), "map[") {
 		//	return b.parseMapValue(typ, val, remainingDepth)
 		//}
@@ -398,45 +1024,156 @@ func (b valueParser) parseValue(rawTyp dwarf.Type, val []byte, remainingDepth in
 	return voidValue{Type: rawTyp, val: val}
 }
 
+// isByteType returns true if the type is byte (uint8), including its named types.
+func isByteType(typ dwarf.Type) bool {
+	for {
+		typedefType, ok := typ.(*dwarf.TypedefType)
+		if !ok {
+			break
+		}
+		typ = typedefType.Type
+	}
+	uintType, ok := typ.(*dwarf.UintType)
+	return ok && uintType.Size() == 1
+}
+
+// withConstantName annotates the integer value with the name of the constant if the constant has the same type and value.
+// Only the named types are annotated, because the untyped constants, like `const n = 1`, have the builtin type `int`
+// and so any int value would be annotated.
+func (b valueParser) withConstantName(v value, typeName string, val int64) value {
+	if b.findConstantName == nil || !isNamedTypeName(typeName) {
+		return v
+	}
+	if name, ok := b.findConstantName(typeName, val); ok {
+		return constantValue{value: v, name: name}
+	}
+	return v
+}
+
+// isNamedTypeName returns true if the type name is the defined type's one, which has the package path like `main.Mode`.
+func isNamedTypeName(typeName string) bool {
+	return strings.Contains(typeName, ".")
+}
+
+func (b valueParser) resolveFuncName(addr uint64) string {
+	if b.findFunction == nil || addr == 0 {
+		return ""
+	}
+
+	// the func value is the pointer to the funcval struct, whose first field is the pointer to the function.
+	buff := make([]byte, 8)
+	if err := b.reader.ReadMemory(addr, buff); err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", addr, err)
+		return ""
+	}
+	funcAddr := binary.LittleEndian.Uint64(buff)
+
+	f, err := b.findFunction(funcAddr)
+	if err != nil {
+		log.Debugf("failed to find the function (addr: %x): %v", funcAddr, err)
+		return ""
+	} else if f.StartAddr != funcAddr {
+		return ""
+	}
+	return f.Name
+}
+
+// maxStringReadLen is the max number of the bytes read from the string value even if the max string length is not set.
+// The corrupted string header may have the huge length.
+const maxStringReadLen = 1 << 20
+
 func (b valueParser) parseStringValue(typ *dwarf.StructType, val []byte) stringValue {
 	addr := binary.LittleEndian.Uint64(val[:8])
-	len := int(binary.LittleEndian.Uint64(val[8:]))
-	buff := make([]byte, len)
+	length := binary.LittleEndian.Uint64(val[8:])
+
+	maxLen := uint64(maxStringReadLen)
+	if b.maxStringLen > 0 && uint64(b.maxStringLen) < maxLen {
+		maxLen = uint64(b.maxStringLen)
+	}
+	readLen := length
+	if readLen > maxLen {
+		// read the next rune as well to cut the string at the rune boundary.
+		readLen = maxLen + utf8.UTFMax
+		if readLen > length {
+			readLen = length
+		}
+	}
 
+	buff := make([]byte, readLen)
 	if err := b.reader.ReadMemory(addr, buff); err != nil {
 		log.Debugf("failed to read memory (addr: %x): %v", addr, err)
 		return stringValue{StructType: typ}
 	}
-	return stringValue{StructType: typ, val: string(buff)}
+	if length <= maxLen {
+		return stringValue{StructType: typ, val: string(buff)}
+	}
+
+	cut := int(maxLen)
+	for cut > 0 && !utf8.RuneStart(buff[cut]) {
+		cut--
+	}
+	return stringValue{StructType: typ, val: string(buff[:cut]), truncated: true}
 }
 
+// parseSliceValue parses the slice value. The slice header is read directly rather than parsed as the struct value,
+// so the elements are parsed using the same `remainingDepth` as the slice, like the interface's dynamic value.
+// The array pointer is the part of the slice, so it's not counted as the pointer indirection either.
 func (b valueParser) parseSliceValue(typ *dwarf.StructType, val []byte, remainingDepth int) sliceValue {
-	// Values are wrapped by slice struct. So +1 here.
-	structVal := b.parseStructValue(typ, val, remainingDepth+1)
-	length := int(structVal.fields["len"].(int64Value).val)
-	if length == 0 {
+	arrayField, ok := findField(typ, "array")
+	if !ok {
 		return sliceValue{StructType: typ}
 	}
+	arrayPtrType, ok := arrayField.Type.(*dwarf.PtrType)
+	if !ok {
+		return sliceValue{StructType: typ}
+	}
+	arrayAddr, _ := findFieldAddr(typ, val, "array")
+	lenData, ok := findFieldData(typ, val, "len")
+	if !ok || len(lenData) != 8 {
+		return sliceValue{StructType: typ}
+	}
+	length := int64(binary.LittleEndian.Uint64(lenData))
+	if length <= 0 || arrayAddr == 0 {
+		return sliceValue{StructType: typ}
+	}
+	if arrayAddr < b.invalidPointerThreshold {
+		return sliceValue{StructType: typ, abbreviated: true}
+	}
 
-	firstElem := structVal.fields["array"].(ptrValue)
-	sliceVal := sliceValue{StructType: typ, val: []value{firstElem.pointedVal}}
-
-	for i := 1; i < length; i++ {
-		addr := firstElem.addr + uint64(firstElem.pointedVal.Size())*uint64(i)
-		buff := make([]byte, 8)
-		binary.LittleEndian.PutUint64(buff, addr)
-		elem := b.parseValue(firstElem.PtrType, buff, remainingDepth).(ptrValue)
-		sliceVal.val = append(sliceVal.val, elem.pointedVal)
+	elemType := arrayPtrType.Type
+	elemSize := elemType.Size()
+	if elemSize <= 0 {
+		return sliceValue{StructType: typ, abbreviated: true}
+	}
+	// the elements more than maxContainerItemsToPrint are not printed. Read one more to tell if the items are abbreviated.
+	if length > maxContainerItemsToPrint+1 {
+		length = maxContainerItemsToPrint + 1
 	}
 
+	sliceVal := sliceValue{StructType: typ}
+	buff, err := readAvailableMemory(b.reader, arrayAddr, int(elemSize*length))
+	if err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", arrayAddr, err)
+	}
+	for i := int64(0); (i+1)*elemSize <= int64(len(buff)); i++ {
+		sliceVal.val = append(sliceVal.val, b.parseValue(elemType, buff[i*elemSize:(i+1)*elemSize], remainingDepth))
+	}
+	if len(sliceVal.val) == 0 {
+		sliceVal.abbreviated = true
+	}
 	return sliceVal
 }
 
+// parseInterfaceValue parses the non-empty interface value.
+// The iface and itab structs are read directly rather than parsed as the struct values. So the dynamic value is parsed
+// using the same `remainingDepth` as the interface value, like the pointer.
 func (b valueParser) parseInterfaceValue(typ *dwarf.StructType, val []byte, remainingDepth int) interfaceValue {
-	// Interface is represented by the iface and itab struct. So remainingDepth needs to be at least 2.
-	structVal := b.parseStructValue(typ, val, 2)
-	ptrToTab := structVal.fields["tab"].(ptrValue)
-	if ptrToTab.pointedVal == nil {
+	tabField, ok := findField(typ, "tab")
+	if !ok {
+		return interfaceValue{StructType: typ}
+	}
+	tabAddr, ok := findFieldAddr(typ, val, "tab")
+	if !ok || tabAddr == 0 {
 		return interfaceValue{StructType: typ}
 	}
 	if b.mapRuntimeType == nil {
@@ -444,35 +1181,127 @@ func (b valueParser) parseInterfaceValue(typ *dwarf.StructType, val []byte, rema
 		return interfaceValue{StructType: typ, abbreviated: true}
 	}
 
-	tab := ptrToTab.pointedVal.(structValue)
-	runtimeTypeAddr := tab.fields["_type"].(ptrValue).addr
-	implType, err := b.mapRuntimeType(runtimeTypeAddr)
-	if err != nil {
-		log.Debugf("failed to find the impl type (runtime type addr: %x): %v", runtimeTypeAddr, err)
+	tabPtrType, ok := tabField.Type.(*dwarf.PtrType)
+	if !ok {
+		return interfaceValue{StructType: typ}
+	}
+	tabType, ok := tabPtrType.Type.(*dwarf.StructType)
+	if !ok {
+		return interfaceValue{StructType: typ}
+	}
+	tabBuff := make([]byte, tabType.Size())
+	if err := b.readItab(tabAddr, tabBuff); err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", tabAddr, err)
+		return interfaceValue{StructType: typ}
+	}
+	runtimeTypeAddr, ok := findFieldAddr(tabType, tabBuff, "_type")
+	if !ok {
 		return interfaceValue{StructType: typ}
 	}
 
-	data := structVal.fields["data"].(ptrValue)
-	if _, ok := implType.(*dwarf.PtrType); ok {
-		buff := make([]byte, 8)
-		binary.LittleEndian.PutUint64(buff, data.addr)
-		return interfaceValue{StructType: typ, implType: implType, implVal: b.parseValue(implType, buff, remainingDepth)}
+	dataAddr, _ := findFieldAddr(typ, val, "data")
+	interfaceVal := b.parseInterfaceDynamicValue(typ, runtimeTypeAddr, dataAddr, remainingDepth)
+	if b.parseInterfaceMethods && interfaceVal.implType != nil {
+		interfaceVal.methods = b.parseItabMethods(tabType, tabAddr, tabBuff)
 	}
+	return interfaceVal
+}
 
-	// When the actual type is not pointer, we need the explicit dereference because data.addr is the pointer to the data.
-	dataBuff := make([]byte, implType.Size())
-	if err := b.reader.ReadMemory(data.addr, dataBuff); err != nil {
-		log.Debugf("failed to read memory (addr: %x): %v", data.addr, err)
-		return interfaceValue{StructType: typ}
+// readItab reads the itab from the process memory. The itab of the interface value converted at compile time is
+// statically allocated in the read-only data, so it's read from the binary file if the process memory read fails.
+func (b valueParser) readItab(tabAddr uint64, tabBuff []byte) error {
+	err := b.reader.ReadMemory(tabAddr, tabBuff)
+	if err == nil || b.readStaticData == nil {
+		return err
 	}
-	return interfaceValue{StructType: typ, implType: implType, implVal: b.parseValue(implType, dataBuff, remainingDepth)}
+
+	if staticErr := b.readStaticData(tabAddr, tabBuff); staticErr != nil {
+		return err
+	}
+	return nil
 }
 
+// parseItabMethods resolves the method pointers in the itab to the function names.
+func (b valueParser) parseItabMethods(tabType *dwarf.StructType, tabAddr uint64, tabBuff []byte) []interfaceMethod {
+	if b.findFunction == nil {
+		return nil
+	}
+
+	numMethods, ok := b.numInterfaceMethods(tabType, tabBuff)
+	if !ok || numMethods <= 0 {
+		return nil
+	}
+	funField, ok := findField(tabType, "fun")
+	if !ok {
+		if funField, ok = findField(tabType, "Fun"); !ok {
+			return nil
+		}
+	}
+
+	// the fun field is declared as the array of size 1, but actually has the same number of elements as the interface methods.
+	funBuff := make([]byte, 8*numMethods)
+	funAddr := tabAddr + uint64(funField.ByteOffset)
+	if err := b.reader.ReadMemory(funAddr, funBuff); err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", funAddr, err)
+		return nil
+	}
+
+	var methods []interfaceMethod
+	for i := 0; i < numMethods; i++ {
+		pc := binary.LittleEndian.Uint64(funBuff[i*8 : (i+1)*8])
+		if pc == 0 {
+			return nil // the concrete type doesn't implement the interface
+		}
+		f, err := b.findFunction(pc)
+		if err != nil {
+			log.Debugf("failed to find the function (addr: %x): %v", pc, err)
+			return nil
+		}
+		methods = append(methods, interfaceMethod{name: f.Name[strings.LastIndex(f.Name, ".")+1:], funcName: f.Name})
+	}
+	return methods
+}
+
+// numInterfaceMethods returns the number of the methods the interface type (pointed by the itab) has.
+func (b valueParser) numInterfaceMethods(tabType *dwarf.StructType, tabBuff []byte) (int, bool) {
+	interField, ok := findField(tabType, "inter")
+	if !ok {
+		if interField, ok = findField(tabType, "Inter"); !ok {
+			return 0, false
+		}
+	}
+	interPtrType, ok := interField.Type.(*dwarf.PtrType)
+	if !ok {
+		return 0, false
+	}
+	interType, ok := interPtrType.Type.(*dwarf.StructType)
+	if !ok {
+		return 0, false
+	}
+
+	interAddr, ok := findFieldAddr(tabType, tabBuff, interField.Name)
+	if !ok || interAddr == 0 {
+		return 0, false
+	}
+	interBuff := make([]byte, interType.Size())
+	if err := b.reader.ReadMemory(interAddr, interBuff); err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", interAddr, err)
+		return 0, false
+	}
+
+	// the field name is changed in go 1.21.
+	for _, methodsFieldName := range []string{"mhdr", "Methods"} {
+		if lenData, ok := findFieldData(interType, interBuff, methodsFieldName, "len"); ok && len(lenData) == 8 {
+			return int(binary.LittleEndian.Uint64(lenData)), true
+		}
+	}
+	return 0, false
+}
+
+// parseEmptyInterfaceValue parses the empty interface value. See parseInterfaceValue for the depth of the dynamic value.
 func (b valueParser) parseEmptyInterfaceValue(typ *dwarf.StructType, val []byte, remainingDepth int) interfaceValue {
-	// Empty interface is represented by the eface struct. So remainingDepth needs to be at least 1.
-	structVal := b.parseStructValue(typ, val, 1)
-	data := structVal.fields["data"].(ptrValue)
-	if data.addr == 0 {
+	dataAddr, ok := findFieldAddr(typ, val, "data")
+	if !ok || dataAddr == 0 {
 		return interfaceValue{StructType: typ}
 	}
 	if b.mapRuntimeType == nil {
@@ -480,39 +1309,361 @@ func (b valueParser) parseEmptyInterfaceValue(typ *dwarf.StructType, val []byte,
 		return interfaceValue{StructType: typ, abbreviated: true}
 	}
 
-	runtimeTypeAddr := structVal.fields["_type"].(ptrValue).addr
+	runtimeTypeAddr, ok := findFieldAddr(typ, val, "_type")
+	if !ok {
+		return interfaceValue{StructType: typ}
+	}
+	return b.parseInterfaceDynamicValue(typ, runtimeTypeAddr, dataAddr, remainingDepth)
+}
+
+func (b valueParser) parseInterfaceDynamicValue(typ *dwarf.StructType, runtimeTypeAddr, dataAddr uint64, remainingDepth int) interfaceValue {
 	implType, err := b.mapRuntimeType(runtimeTypeAddr)
 	if err != nil {
 		log.Debugf("failed to find the impl type (runtime type addr: %x): %v", runtimeTypeAddr, err)
 		return interfaceValue{StructType: typ}
 	}
 
-	if _, ok := implType.(*dwarf.PtrType); ok {
+	if isDirectIface(implType) {
+		// The data word is the value itself.
 		buff := make([]byte, 8)
-		binary.LittleEndian.PutUint64(buff, data.addr)
+		binary.LittleEndian.PutUint64(buff, dataAddr)
 		return interfaceValue{StructType: typ, implType: implType, implVal: b.parseValue(implType, buff, remainingDepth)}
 	}
 
-	// When the actual type is not pointer, we need the explicit dereference because data.addr is the pointer to the data.
+	// When the actual type is not pointer-shaped, we need the explicit dereference because data.addr is the pointer to the data.
 	dataBuff := make([]byte, implType.Size())
-	if err := b.reader.ReadMemory(data.addr, dataBuff); err != nil {
-		log.Debugf("failed to read memory (addr: %x): %v", data.addr, err)
+	if err := b.reader.ReadMemory(dataAddr, dataBuff); err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", dataAddr, err)
 		return interfaceValue{StructType: typ}
 	}
-
 	return interfaceValue{StructType: typ, implType: implType, implVal: b.parseValue(implType, dataBuff, remainingDepth)}
 }
 
+// isDirectIface returns true if the value of the type is stored in the data word of the interface directly.
+// It's the case of the pointer-shaped types, such as the pointer, map, chan, func and the struct or the array
+// which has only one pointer-shaped element (see the kindDirectIface flag in the runtime).
+func isDirectIface(typ dwarf.Type) bool {
+	switch typ := typ.(type) {
+	case *dwarf.PtrType, *dwarf.FuncType:
+		return true
+	case *dwarf.TypedefType:
+		// the map and chan types are the typedefs of the pointers.
+		return isDirectIface(typ.Type)
+	case *dwarf.StructType:
+		return typ.Kind == "struct" && len(typ.Field) == 1 && isDirectIface(typ.Field[0].Type)
+	case *dwarf.ArrayType:
+		return typ.Count == 1 && isDirectIface(typ.Type)
+	}
+	return false
+}
+
 func (b valueParser) parseStructValue(typ *dwarf.StructType, val []byte, remainingDepth int) structValue {
 	if remainingDepth <= 0 {
 		return structValue{StructType: typ, abbreviated: true}
 	}
 
 	fields := make(map[string]value)
+	var fieldNames []string
+	var embeddedVals []structValue
+	for _, field := range typ.Field {
+		fieldType := b.hintedType(typ.StructName, field.Name, field.Type)
+		fieldVal := b.parseValue(fieldType, val[field.ByteOffset:field.ByteOffset+field.Type.Size()], remainingDepth-1)
+		if b.flattenEmbeddedFields && b.isEmbeddedField != nil && b.isEmbeddedField(typ.StructName, field.Name) {
+			if embeddedVal, ok := embeddedStructValue(fieldVal); ok {
+				embeddedVals = append(embeddedVals, embeddedVal)
+				continue
+			}
+		}
+		fields[field.Name] = fieldVal
+		fieldNames = append(fieldNames, field.Name)
+	}
+
+	for _, embeddedVal := range embeddedVals {
+		for _, name := range embeddedVal.orderedFieldNames() {
+			if _, ok := fields[name]; ok {
+				continue // shadowed by the field of the embedding struct
+			}
+			fields[name] = embeddedVal.fields[name]
+			fieldNames = append(fieldNames, name)
+		}
+	}
+	return structValue{StructType: typ, fields: fields, fieldNames: fieldNames, maxFields: b.maxFields}
+}
+
+// embeddedStructValue returns the struct value of the embedded field, which is the struct (`T`) or
+// the pointer to the struct (`*T`). It returns false if the value is not the parsed struct, e.g. the nil pointer.
+func embeddedStructValue(fieldVal value) (structValue, bool) {
+	switch val := fieldVal.(type) {
+	case structValue:
+		return val, !val.abbreviated
+	case ptrValue:
+		if structVal, ok := val.pointedVal.(structValue); ok {
+			return structVal, !structVal.abbreviated
+		}
+	}
+	return structValue{}, false
+}
+
+// findLinkFields returns the indexes of the fields which link to the same struct type and whose names are
+// one of the link fields.
+func (b valueParser) findLinkFields(typ *dwarf.StructType) []int {
+	var indexes []int
+	for i, field := range typ.Field {
+		ptrType, ok := field.Type.(*dwarf.PtrType)
+		if !ok {
+			continue
+		}
+		if pointedType, ok := ptrType.Type.(*dwarf.StructType); !ok || pointedType.StructName != typ.StructName {
+			continue
+		}
+
+		for _, name := range b.linkFields {
+			if field.Name == name {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// linkedTraversal is the state shared while the nodes of one linked data structure are followed.
+type linkedTraversal struct {
+	remainingNodes int
+	visited        map[uint64]bool
+}
+
+// parseLinkedValue follows the link fields (the indexes found by findLinkFields) from the node at the addr until the number of the nodes reaches maxLinkedNodes.
+// The fields other than the link fields are parsed as the struct fields.
+func (b valueParser) parseLinkedValue(typ *dwarf.PtrType, structType *dwarf.StructType, linkFields []int, addr uint64, remainingDepth int) value {
+	traversal := &linkedTraversal{remainingNodes: b.maxLinkedNodes, visited: make(map[uint64]bool)}
+	head, end := b.parseLinkedNode(structType, linkFields, addr, remainingDepth, traversal)
+	if head == nil {
+		log.Debugf("failed to parse the linked node (addr: %x): %s", addr, end)
+		return ptrValue{PtrType: typ, addr: addr}
+	}
+	return linkedValue{PtrType: typ, head: head, list: len(linkFields) == 1}
+}
+
+// parseLinkedNode parses the node at the addr. If the node is not parsed, it returns nil and the reason.
+func (b valueParser) parseLinkedNode(typ *dwarf.StructType, linkFields []int, addr uint64, remainingDepth int, traversal *linkedTraversal) (*linkedNode, string) {
+	if traversal.visited[addr] {
+		return nil, fmt.Sprintf("<cycle %#x>", addr)
+	}
+	if traversal.remainingNodes <= 0 {
+		return nil, "..."
+	}
+
+	buff := make([]byte, typ.Size())
+	if err := b.reader.ReadMemory(addr, buff); err != nil {
+		log.Debugf("failed to read memory (addr: %x): %v", addr, err)
+		return nil, fmt.Sprintf("%#x", addr)
+	}
+	traversal.remainingNodes--
+	traversal.visited[addr] = true
+
+	node := &linkedNode{}
+	nextLink := 0
+	for i, field := range typ.Field {
+		rawVal := buff[field.ByteOffset : field.ByteOffset+field.Type.Size()]
+		if nextLink >= len(linkFields) || linkFields[nextLink] != i {
+			node.fields = append(node.fields, linkedField{name: field.Name, val: b.parseValue(field.Type, rawVal, remainingDepth-1)})
+			continue
+		}
+		nextLink++
+
+		link := linkedLink{name: field.Name}
+		switch linkAddr := binary.LittleEndian.Uint64(rawVal); {
+		case linkAddr == 0:
+			link.end = "nil"
+		case linkAddr < b.invalidPointerThreshold:
+			link.end = fmt.Sprintf("<invalid pointer %#x>", linkAddr)
+		default:
+			link.node, link.end = b.parseLinkedNode(typ, linkFields, linkAddr, remainingDepth, traversal)
+		}
+		node.links = append(node.links, link)
+	}
+	return node, ""
+}
+
+// parseSyncValue parses the value of the sync types. It returns false if the type has the unknown layout.
+// The layouts of these types change depending on the go version (for example, sync.Mutex wraps
+// internal/sync.Mutex since go 1.24), so the field names are checked instead of the version.
+func (b valueParser) parseSyncValue(typ *dwarf.StructType, val []byte) (syncValue, bool) {
+	switch typ.StructName {
+	case "sync.Mutex":
+		// go 1.24 or later: {_ noCopy; mu internal/sync.Mutex{state int32; sema uint32}}
+		// older: {state int32; sema uint32}
+		state, ok := findFieldData(typ, val, "mu", "state")
+		if !ok {
+			state, ok = findFieldData(typ, val, "state")
+		}
+		if !ok || len(state) != 4 {
+			return syncValue{}, false
+		}
+
+		const mutexLocked = 1
+		if binary.LittleEndian.Uint32(state)&mutexLocked != 0 {
+			return syncValue{StructType: typ, state: "locked"}, true
+		}
+		return syncValue{StructType: typ, state: "unlocked"}, true
+
+	case "sync.WaitGroup":
+		// go 1.20 or later: {noCopy; state atomic.Uint64; sema uint32}
+		// go 1.18 and 1.19: {noCopy; state1 uint64; state2 uint32}
+		// The high 32 bits of the state are the counter. The state of the older versions depends on the alignment and not supported.
+		state, ok := findFieldData(typ, val, "state")
+		if !ok {
+			state, ok = findFieldData(typ, val, "state1")
+		}
+		if !ok || len(state) != 8 {
+			return syncValue{}, false
+		}
+
+		counter := int32(binary.LittleEndian.Uint64(state) >> 32)
+		return syncValue{StructType: typ, state: fmt.Sprintf("counter=%d", counter)}, true
+
+	case "sync.Once":
+		// The type of the done field is uint32, atomic.Uint32 or atomic.Bool depending on the version. Any non-zero value means done.
+		done, ok := findFieldData(typ, val, "done")
+		if !ok {
+			return syncValue{}, false
+		}
+
+		for _, v := range done {
+			if v != 0 {
+				return syncValue{StructType: typ, state: "done"}, true
+			}
+		}
+		return syncValue{StructType: typ, state: "not done"}, true
+	}
+	return syncValue{}, false
+}
+
+func findField(typ *dwarf.StructType, fieldName string) (*dwarf.StructField, bool) {
 	for _, field := range typ.Field {
-		fields[field.Name] = b.parseValue(field.Type, val[field.ByteOffset:field.ByteOffset+field.Type.Size()], remainingDepth-1)
+		if field.Name == fieldName {
+			return field, true
+		}
+	}
+	return nil, false
+}
+
+// findFieldAddr returns the address the pointer field holds.
+func findFieldAddr(typ *dwarf.StructType, val []byte, fieldName string) (uint64, bool) {
+	data, ok := findFieldData(typ, val, fieldName)
+	if !ok || len(data) != 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(data), true
+}
+
+// findFieldData returns the raw data of the field. Specify the nested field names if the field is inside the struct field.
+func findFieldData(typ *dwarf.StructType, val []byte, fieldNames ...string) ([]byte, bool) {
+	for i, fieldName := range fieldNames {
+		found, ok := findField(typ, fieldName)
+		if !ok || found.ByteOffset+found.Type.Size() > int64(len(val)) {
+			return nil, false
+		}
+		val = val[found.ByteOffset : found.ByteOffset+found.Type.Size()]
+
+		if i == len(fieldNames)-1 {
+			break
+		}
+		typ, ok = found.Type.(*dwarf.StructType)
+		if !ok {
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// runtimeTypeLabelField is the field printed as the label of the runtime-internal type.
+type runtimeTypeLabelField struct {
+	name string
+	// fieldNames is the candidates of the field name, because the name differs among the go versions.
+	fieldNames []string
+}
+
+// runtimeTypeLabelFields is the fields printed for the runtime-internal types instead of all the fields.
+// These structs are huge and their raw dumps are rarely useful.
+var runtimeTypeLabelFields = map[string][]runtimeTypeLabelField{
+	"runtime.g":                 {{name: "goid", fieldNames: []string{"goid"}}},
+	"runtime.hmap":              {{name: "count", fieldNames: []string{"count"}}},
+	"internal/runtime/maps.Map": {{name: "used", fieldNames: []string{"used"}}},
+	"runtime._type":             {{name: "size", fieldNames: []string{"size", "Size_"}}, {name: "kind", fieldNames: []string{"kind", "Kind_"}}},
+	"internal/abi.Type":         {{name: "size", fieldNames: []string{"Size_"}}, {name: "kind", fieldNames: []string{"Kind_"}}},
+}
+
+// parseRuntimeTypeValue parses only the label fields of the runtime-internal type.
+// It returns false if any label field is not found.
+func (b valueParser) parseRuntimeTypeValue(typ *dwarf.StructType, val []byte) (runtimeTypeValue, bool) {
+	runtimeTypeVal := runtimeTypeValue{StructType: typ}
+	for _, labelField := range runtimeTypeLabelFields[typ.StructName] {
+		found := false
+		for _, fieldName := range labelField.fieldNames {
+			field, ok := findField(typ, fieldName)
+			if !ok {
+				continue
+			}
+			data, ok := findFieldData(typ, val, fieldName)
+			if !ok {
+				return runtimeTypeValue{}, false
+			}
+			// the label field is the integer, so the depth doesn't matter.
+			runtimeTypeVal.labels = append(runtimeTypeVal.labels, runtimeTypeLabel{name: labelField.name, val: b.parseValue(field.Type, data, 0)})
+			found = true
+			break
+		}
+		if !found {
+			return runtimeTypeValue{}, false
+		}
+	}
+	return runtimeTypeVal, true
+}
+
+// parseMapLen reads only the number of the entries from the map header, which is `count` in the hmap struct or
+// `used` in the swiss table map. It returns false if the header is unknown.
+func (b valueParser) parseMapLen(typ *dwarf.TypedefType, val []byte) (mapLenValue, bool) {
+	ptrType, ok := typ.Type.(*dwarf.PtrType)
+	if !ok || len(val) != 8 {
+		return mapLenValue{}, false
+	}
+	headerType, ok := ptrType.Type.(*dwarf.StructType)
+	if !ok {
+		return mapLenValue{}, false
+	}
+
+	addr := binary.LittleEndian.Uint64(val)
+	if addr == 0 {
+		return mapLenValue{TypedefType: typ, isNil: true}, true
+	} else if addr < b.invalidPointerThreshold {
+		return mapLenValue{}, false
+	}
+
+	countField, ok := findField(headerType, "count")
+	if !ok {
+		if countField, ok = findField(headerType, "used"); !ok {
+			return mapLenValue{}, false
+		}
+	}
+
+	buff := make([]byte, countField.Type.Size())
+	if err := b.reader.ReadMemory(addr+uint64(countField.ByteOffset), buff); err != nil {
+		log.Debugf("failed to read the map header at %#x: %v", addr, err)
+		return mapLenValue{}, false
+	}
+
+	var count uint64
+	switch len(buff) {
+	case 8:
+		count = binary.LittleEndian.Uint64(buff)
+	case 4:
+		count = uint64(binary.LittleEndian.Uint32(buff))
+	default:
+		return mapLenValue{}, false
 	}
-	return structValue{StructType: typ, fields: fields}
+	return mapLenValue{TypedefType: typ, len: count}, true
 }
 
 func (b valueParser) parseMapValue(typ *dwarf.TypedefType, val []byte, remainingDepth int) mapValue {
@@ -523,7 +1674,7 @@ func (b valueParser) parseMapValue(typ *dwarf.TypedefType, val []byte, remaining
 	}
 
 	hmapVal := ptrVal.(ptrValue).pointedVal.(structValue)
-	numBuckets := 1 << hmapVal.fields["B"].(uint8Value).val
+	numBuckets := 1 << withoutConstantName(hmapVal.fields["B"]).(uint8Value).val
 	ptrToBuckets := hmapVal.fields["buckets"].(ptrValue)
 	ptrToOldBuckets := hmapVal.fields["oldbuckets"].(ptrValue)
 	if ptrToOldBuckets.addr != 0 {
@@ -548,7 +1699,7 @@ func (b valueParser) parseMapValue(typ *dwarf.TypedefType, val []byte, remaining
 		ptrToBuckets = b.parseValue(ptrToBuckets.PtrType, buff, remainingDepth+1).(ptrValue)
 	}
 
-	return mapValue{TypedefType: typ, val: mapValues}
+	return mapValue{TypedefType: typ, val: mapValues, maxEntries: b.maxFields}
 }
 
 func (b valueParser) parseBucket(ptrToBucket ptrValue, remainingDepth int) map[value]value {
@@ -563,7 +1714,7 @@ func (b valueParser) parseBucket(ptrToBucket ptrValue, remainingDepth int) map[v
 	values := buckets.fields["values"].(arrayValue)
 
 	for j, hash := range tophash.val {
-		if hash.(uint8Value).val == 0 {
+		if withoutConstantName(hash).(uint8Value).val == 0 {
 			continue
 		}
 		mapValues[keys.val[j]] = values.val[j]
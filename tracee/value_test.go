@@ -1,6 +1,10 @@
 package tracee
 
 import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"runtime"
 	"strings"
@@ -103,8 +107,8 @@ func TestParseValue_NotFixedStringCase(t *testing.T) {
 			}
 		}},
 		{funcAddr: testutils.TypePrintAddrPrintFunc, testFunc: func(t *testing.T, val value) {
-			if !strings.HasPrefix(val.String(), "0x") {
-				t.Errorf("wrong prefix: %s", val)
+			if val.String() != "main.main.func1" {
+				t.Errorf("wrong function name: %s", val)
 			}
 		}},
 		{funcAddr: testutils.TypePrintAddrPrintInterface, testFunc: func(t *testing.T, val value) {
@@ -195,3 +199,950 @@ func TestParseValue_NotFixedStringCase(t *testing.T) {
 		proc.SingleStep(tids[0], testdata.funcAddr)
 	}
 }
+
+func TestParseStructValue_FlattenEmbeddedFields(t *testing.T) {
+	intType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "int8"}}}
+	baseType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 2},
+		StructName: "main.Base",
+		Field: []*dwarf.StructField{
+			{Name: "X", Type: intType, ByteOffset: 0},
+			{Name: "Y", Type: intType, ByteOffset: 1},
+		},
+	}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: baseType}
+	// S has the embedded field `Base` and the ordinary field `Base2 Base`.
+	typ := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 5},
+		StructName: "main.S",
+		Field: []*dwarf.StructField{
+			{Name: "Base", Type: baseType, ByteOffset: 0},
+			{Name: "Y", Type: intType, ByteOffset: 2},
+			{Name: "Base2", Type: baseType, ByteOffset: 3},
+		},
+	}
+	// P has the embedded pointer `*Base` and the ordinary field `Base Base`, which has the same name as its type.
+	ptrEmbeddingType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 10},
+		StructName: "main.P",
+		Field: []*dwarf.StructField{
+			{Name: "Base", Type: baseType, ByteOffset: 0},
+			{Name: "Ptr", Type: ptrType, ByteOffset: 2},
+		},
+	}
+	embeddedFields := map[string]bool{"main.S.Base": true, "main.P.Ptr": true}
+	isEmbeddedField := func(structName, fieldName string) bool { return embeddedFields[structName+"."+fieldName] }
+	reader := fakeMemoryReader{0x1000: []byte{4, 5}}
+
+	for i, testdata := range []struct {
+		typ            *dwarf.StructType
+		val            []byte
+		flatten        bool
+		expectedFields []string
+	}{
+		{typ: typ, val: []byte{1, 2, 3, 6, 7}, flatten: false, expectedFields: []string{"Base", "Y", "Base2"}},
+		{typ: typ, val: []byte{1, 2, 3, 6, 7}, flatten: true, expectedFields: []string{"X", "Y", "Base2"}},
+		{typ: ptrEmbeddingType, val: append([]byte{1, 2}, uint64sData(0x1000)...), flatten: true, expectedFields: []string{"Base", "X", "Y"}},
+	} {
+		parser := valueParser{reader: reader, flattenEmbeddedFields: testdata.flatten, isEmbeddedField: isEmbeddedField}
+		val := parser.parseStructValue(testdata.typ, testdata.val, 3)
+		if len(val.fields) != len(testdata.expectedFields) {
+			t.Errorf("[%d] wrong number of fields: %v", i, val.fields)
+		}
+		for _, name := range testdata.expectedFields {
+			if _, ok := val.fields[name]; !ok {
+				t.Errorf("[%d] field %s not found: %v", i, name, val.fields)
+			}
+		}
+	}
+
+	parser := valueParser{flattenEmbeddedFields: true, isEmbeddedField: isEmbeddedField}
+	val := parser.parseStructValue(typ, []byte{1, 2, 3, 6, 7}, 2)
+	if val.fields["Y"].(int8Value).val != 3 {
+		t.Errorf("the embedding struct's field should not be shadowed: %v", val.fields)
+	}
+}
+
+type fakeMemoryReader map[uint64][]byte
+
+func (r fakeMemoryReader) ReadMemory(addr uint64, out []byte) error {
+	for baseAddr, data := range r {
+		if baseAddr <= addr && addr+uint64(len(out)) <= baseAddr+uint64(len(data)) {
+			copy(out, data[addr-baseAddr:])
+			return nil
+		}
+	}
+	return errors.New("invalid address")
+}
+
+func uint64sData(vals ...uint64) []byte {
+	data := make([]byte, 8*len(vals))
+	for i, val := range vals {
+		binary.LittleEndian.PutUint64(data[i*8:(i+1)*8], val)
+	}
+	return data
+}
+
+func emptyInterfaceData(runtimeTypeAddr, dataAddr uint64) []byte {
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint64(data[0:8], runtimeTypeAddr)
+	binary.LittleEndian.PutUint64(data[8:16], dataAddr)
+	return data
+}
+
+func TestParseEmptyInterfaceValue_Nested(t *testing.T) {
+	const (
+		runtimeTypeAddrOfS   = 0x1000
+		runtimeTypeAddrOfInt = 0x1100
+	)
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	efaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.eface",
+		Field: []*dwarf.StructField{
+			{Name: "_type", Type: voidPtrType, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+	// type S struct { I interface{} }
+	sType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "main.S",
+		Kind:       "struct",
+		Field:      []*dwarf.StructField{{Name: "I", Type: efaceType, ByteOffset: 0}},
+	}
+
+	reader := fakeMemoryReader{
+		0x10000: emptyInterfaceData(runtimeTypeAddrOfS, 0x20000), // S{I: S{...}}
+		0x20000: emptyInterfaceData(runtimeTypeAddrOfInt, 0x30000),
+		0x30000: {1, 0, 0, 0, 0, 0, 0, 0},
+	}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) {
+		switch addr {
+		case runtimeTypeAddrOfS:
+			return sType, nil
+		case runtimeTypeAddrOfInt:
+			return int64Type, nil
+		}
+		return nil, errors.New("unknown type")
+	}
+	parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType}
+
+	for i, testdata := range []struct {
+		depth    int
+		expected string
+	}{
+		// The interface is transparent like the pointer, so each struct consumes the depth.
+		{depth: 0, expected: "main.S({...})"},
+		{depth: 1, expected: "main.S({I: main.S({...})})"},
+		{depth: 2, expected: "main.S({I: main.S({I: int64(1)})})"},
+		{depth: 3, expected: "main.S({I: main.S({I: int64(1)})})"},
+	} {
+		val := parser.parseValue(efaceType, emptyInterfaceData(runtimeTypeAddrOfS, 0x10000), testdata.depth)
+		if val.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, val)
+		}
+	}
+}
+
+// sliceType returns the type of the slice whose element is `elemType`.
+func sliceType(name string, elemType dwarf.Type) *dwarf.StructType {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	return &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 24},
+		StructName: name,
+		Kind:       "struct",
+		Field: []*dwarf.StructField{
+			{Name: "array", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: elemType}, ByteOffset: 0},
+			{Name: "len", Type: int64Type, ByteOffset: 8},
+			{Name: "cap", Type: int64Type, ByteOffset: 16},
+		},
+	}
+}
+
+func TestParseValue_SliceOfInterfaces(t *testing.T) {
+	const (
+		runtimeTypeAddrOfInt    = 0x1000
+		runtimeTypeAddrOfString = 0x1100
+		runtimeTypeAddrOfBool   = 0x1200
+	)
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	boolType := &dwarf.BoolType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "bool"}}}
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	stringType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "string",
+		Kind:       "struct",
+		Field: []*dwarf.StructField{
+			{Name: "str", Type: voidPtrType, ByteOffset: 0},
+			{Name: "len", Type: int64Type, ByteOffset: 8},
+		},
+	}
+	efaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.eface",
+		Field: []*dwarf.StructField{
+			{Name: "_type", Type: voidPtrType, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+
+	// []interface{}{1, "x", true}
+	elems := append(emptyInterfaceData(runtimeTypeAddrOfInt, 0x20000), emptyInterfaceData(runtimeTypeAddrOfString, 0x30000)...)
+	elems = append(elems, emptyInterfaceData(runtimeTypeAddrOfBool, 0x40000)...)
+	reader := fakeMemoryReader{
+		0x10000: elems,
+		0x20000: uint64sData(1),
+		0x30000: uint64sData(0x50000, 1),
+		0x40000: {1},
+		0x50000: []byte("x"),
+	}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) {
+		switch addr {
+		case runtimeTypeAddrOfInt:
+			return int64Type, nil
+		case runtimeTypeAddrOfString:
+			return stringType, nil
+		case runtimeTypeAddrOfBool:
+			return boolType, nil
+		}
+		return nil, errors.New("unknown type")
+	}
+	parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType}
+
+	for i, depth := range []int{0, 1} {
+		val := parser.parseValue(sliceType("[]interface {}", efaceType), uint64sData(0x10000, 3, 3), depth)
+		if expected := `[]{int(1), string("x"), bool(true)}`; val.String() != expected {
+			t.Errorf("[%d] wrong value: %s", i, val)
+		}
+	}
+}
+
+func TestParseValue_InterfaceOfSlice(t *testing.T) {
+	const runtimeTypeAddrOfSlice = 0x1000
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	efaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.eface",
+		Field: []*dwarf.StructField{
+			{Name: "_type", Type: voidPtrType, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+	intSliceType := sliceType("[]int", int64Type)
+
+	// interface{}([]int{1, 2})
+	reader := fakeMemoryReader{
+		0x10000: uint64sData(0x20000, 2, 2),
+		0x20000: uint64sData(1, 2),
+	}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) { return intSliceType, nil }
+	parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType}
+
+	for i, depth := range []int{0, 1} {
+		val := parser.parseValue(efaceType, emptyInterfaceData(runtimeTypeAddrOfSlice, 0x10000), depth)
+		if expected := "[]int([]{1, 2})"; val.String() != expected {
+			t.Errorf("[%d] wrong value: %s", i, val)
+		}
+	}
+
+	// the elements are not read if the array pointer is invalid.
+	parser.invalidPointerThreshold = 0x1000
+	val := parser.parseValue(intSliceType, uint64sData(0x10, 2, 2), 1)
+	if expected := "[]{...}"; val.String() != expected {
+		t.Errorf("wrong value: %s", val)
+	}
+}
+
+type countingMemoryReader struct {
+	memoryReader
+	count int
+}
+
+func (r *countingMemoryReader) ReadMemory(addr uint64, out []byte) error {
+	r.count++
+	return r.memoryReader.ReadMemory(addr, out)
+}
+
+func TestParseSliceValue_LongSlice(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	reader := &countingMemoryReader{memoryReader: fakeMemoryReader{0x10000: uint64sData(0, 1, 2, 3, 4, 5, 6, 7, 8, 9)}}
+	parser := valueParser{reader: reader}
+
+	// only the printed elements are read at once, even if the length is broken.
+	val := parser.parseValue(sliceType("[]int", int64Type), uint64sData(0x10000, 1<<40, 1<<40), 1)
+	if expected := "[]{0, 1, 2, 3, 4, 5, 6, 7, ...}"; val.String() != expected {
+		t.Errorf("wrong value: %s", val)
+	}
+	if reader.count != 1 {
+		t.Errorf("wrong number of reads: %d", reader.count)
+	}
+}
+
+func TestParseSliceValue_ZeroSizeElement(t *testing.T) {
+	emptyStructType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 0}, StructName: "struct {}", Kind: "struct"}
+	reader := &countingMemoryReader{memoryReader: fakeMemoryReader{}}
+	parser := valueParser{reader: reader}
+
+	val := parser.parseValue(sliceType("[]struct {}", emptyStructType), uint64sData(0x10000, 3, 3), 1)
+	if expected := "[]{...}"; val.String() != expected {
+		t.Errorf("wrong value: %s", val)
+	}
+	if reader.count != 0 {
+		t.Errorf("the memory is read: %d", reader.count)
+	}
+}
+
+func TestParseEmptyInterfaceValue_DirectIface(t *testing.T) {
+	const runtimeTypeAddrOfP = 0x1000
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	efaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.eface",
+		Field: []*dwarf.StructField{
+			{Name: "_type", Type: voidPtrType, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+	// type P struct { p *int64 }
+	pType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 8},
+		StructName: "main.P",
+		Kind:       "struct",
+		Field: []*dwarf.StructField{
+			{Name: "p", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: int64Type}, ByteOffset: 0},
+		},
+	}
+
+	// The data word is the value of P itself, not the pointer to P.
+	reader := fakeMemoryReader{0x20000: {7, 0, 0, 0, 0, 0, 0, 0}}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) {
+		if addr == runtimeTypeAddrOfP {
+			return pType, nil
+		}
+		return nil, errors.New("unknown type")
+	}
+	parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType}
+
+	val := parser.parseValue(efaceType, emptyInterfaceData(runtimeTypeAddrOfP, 0x20000), 2)
+	if val.String() != "main.P({p: &7})" {
+		t.Errorf("wrong value: %s", val)
+	}
+}
+
+func TestIsDirectIface(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: int64Type}
+	for i, testdata := range []struct {
+		typ      dwarf.Type
+		expected bool
+	}{
+		{typ: ptrType, expected: true},
+		{typ: &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "map[int]int"}, Type: ptrType}, expected: true},
+		{typ: &dwarf.StructType{Kind: "struct", Field: []*dwarf.StructField{{Type: ptrType}}}, expected: true},
+		{typ: &dwarf.ArrayType{Type: ptrType, Count: 1}, expected: true},
+		{typ: int64Type, expected: false},
+		{typ: &dwarf.StructType{Kind: "struct", Field: []*dwarf.StructField{{Type: ptrType}, {Type: ptrType}}}, expected: false},
+		{typ: &dwarf.ArrayType{Type: ptrType, Count: 2}, expected: false},
+	} {
+		if actual := isDirectIface(testdata.typ); actual != testdata.expected {
+			t.Errorf("[%d] wrong result: %v", i, actual)
+		}
+	}
+}
+
+func TestParseValue_MaxStringLen(t *testing.T) {
+	stringType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 16}, StructName: "string", Kind: "struct"}
+	// the string data is followed by the unreadable memory, so the test fails if more than the limit plus a rune is read.
+	reader := fakeMemoryReader{0x10000: []byte("abcdefgh"), 0x20000: []byte("ab\u3042cdefg")}
+	for i, testdata := range []struct {
+		maxStringLen int
+		val          []byte
+		expected     string
+	}{
+		{maxStringLen: 0, val: uint64sData(0x10000, 8), expected: `"abcdefgh"`},
+		{maxStringLen: 8, val: uint64sData(0x10000, 8), expected: `"abcdefgh"`},
+		{maxStringLen: 3, val: uint64sData(0x10000, 8), expected: `"abc"...`},
+		{maxStringLen: 3, val: uint64sData(0x10000, 1<<40), expected: `"abc"...`},
+		{maxStringLen: 4, val: uint64sData(0x20000, 10), expected: `"ab"...`}, // cut before the multi-byte rune
+	} {
+		parser := valueParser{reader: reader, maxStringLen: testdata.maxStringLen}
+		actual := parser.parseValue(stringType, testdata.val, 1)
+		if actual.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, actual)
+		}
+	}
+}
+
+func TestParseValue_ByteArrayFormat(t *testing.T) {
+	uint8Type := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "uint8"}}}
+	arrayType := &dwarf.ArrayType{CommonType: dwarf.CommonType{ByteSize: 4}, Type: uint8Type, Count: 4}
+	for i, testdata := range []struct {
+		format   ByteArrayFormat
+		val      []byte
+		expected string
+	}{
+		{format: "", val: []byte{0x0a, 0x1b, 0x2c, 0x3d}, expected: "[4]{10, 27, 44, 61}"},
+		{format: ByteArrayFormatDecimal, val: []byte{0x0a, 0x1b, 0x2c, 0x3d}, expected: "[4]{10, 27, 44, 61}"},
+		{format: ByteArrayFormatHex, val: []byte{0x0a, 0x1b, 0x2c, 0x3d}, expected: "0x0a1b2c3d"},
+		{format: ByteArrayFormatHex, val: []byte("abcd"), expected: "0x61626364"},
+		{format: ByteArrayFormatString, val: []byte("abcd"), expected: `"abcd"`},
+		{format: ByteArrayFormatString, val: []byte{'a', 'b', 0, 0}, expected: `"ab"`},
+		{format: ByteArrayFormatString, val: []byte{0x0a, 0x1b, 0x2c, 0x3d}, expected: "0x0a1b2c3d"},
+		{format: ByteArrayFormatString, val: []byte{0, 0, 0, 0}, expected: "0x00000000"},
+	} {
+		parser := valueParser{byteArrayFormat: testdata.format}
+		actual := parser.parseValue(arrayType, testdata.val, 1)
+		if actual.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, actual)
+		}
+	}
+
+	longArrayType := &dwarf.ArrayType{CommonType: dwarf.CommonType{ByteSize: 100}, Type: uint8Type, Count: 100}
+	parser := valueParser{byteArrayFormat: ByteArrayFormatHex}
+	actual := parser.parseValue(longArrayType, make([]byte, 100), 1).String()
+	if actual != "0x"+strings.Repeat("00", maxByteArrayLenToPrint)+"..." {
+		t.Errorf("wrong value: %s", actual)
+	}
+}
+
+func TestParseValue_MaxFields(t *testing.T) {
+	int8Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "int8"}}}
+	structType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 3}, StructName: "main.X", Kind: "struct"}
+	structType.Field = []*dwarf.StructField{{Name: "a", Type: int8Type, ByteOffset: 0}, {Name: "b", Type: int8Type, ByteOffset: 1}, {Name: "c", Type: int8Type, ByteOffset: 2}}
+
+	parser := valueParser{maxFields: 2}
+	if actual := parser.parseValue(structType, []byte{1, 2, 3}, 1); actual.String() != "{a: 1, b: 2, ...}" {
+		t.Errorf("wrong value: %s", actual)
+	}
+
+	mapVal := mapValue{val: map[value]value{int8Value{val: 1}: boolValue{val: false}, int8Value{val: 2}: boolValue{val: true}}, maxEntries: 1}
+	if actual := mapVal.String(); actual != "{1: false, ...}" && actual != "{2: true, ...}" {
+		t.Errorf("wrong value: %s", actual)
+	}
+}
+
+func TestParseValue_RuntimeType(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	uint8Type := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "uint8"}}}
+	gType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 16}, StructName: "runtime.g", Kind: "struct"}
+	gType.Field = []*dwarf.StructField{{Name: "stackguard0", Type: int64Type, ByteOffset: 0}, {Name: "goid", Type: int64Type, ByteOffset: 8}}
+	abiType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 9}, StructName: "internal/abi.Type", Kind: "struct"}
+	abiType.Field = []*dwarf.StructField{{Name: "Size_", Type: int64Type, ByteOffset: 0}, {Name: "Kind_", Type: uint8Type, ByteOffset: 8}}
+	unknownGType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 8}, StructName: "runtime.g", Kind: "struct"}
+	unknownGType.Field = []*dwarf.StructField{{Name: "id", Type: int64Type, ByteOffset: 0}}
+
+	for i, testdata := range []struct {
+		typ      dwarf.Type
+		val      []byte
+		expected string
+	}{
+		{typ: gType, val: uint64sData(1, 7), expected: "runtime.g(goid=7)"},
+		{typ: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: gType}, val: uint64sData(0x10000), expected: "&runtime.g(goid=7)"},
+		{typ: abiType, val: append(uint64sData(8), 2), expected: "internal/abi.Type(size=8, kind=2)"},
+		{typ: unknownGType, val: uint64sData(7), expected: "{id: 7}"}, // the field is not found
+	} {
+		parser := valueParser{reader: fakeMemoryReader{0x10000: uint64sData(1, 7)}}
+		actual := parser.parseValue(testdata.typ, testdata.val, 1)
+		if actual.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, actual)
+		}
+	}
+}
+
+func TestParseValue_UnsafePointerHint(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	fooType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 8}, StructName: "main.Foo", Kind: "struct"}
+	fooType.Field = []*dwarf.StructField{{Name: "a", Type: int64Type, ByteOffset: 0}}
+	unsafePtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "unsafe.Pointer"}, Type: &dwarf.VoidType{}}
+	xType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 8}, StructName: "main.X", Kind: "struct"}
+	xType.Field = []*dwarf.StructField{{Name: "data", Type: unsafePtrType, ByteOffset: 0}}
+
+	parser := valueParser{reader: fakeMemoryReader{0x10000: uint64sData(7)}}
+	if actual := parser.parseValue(xType, uint64sData(0x10000), 2); actual.String() != "{data: 0x10000}" {
+		t.Errorf("wrong value without hint: %s", actual)
+	}
+
+	parser.unsafePointerHints = map[unsafePointerHintKey]dwarf.Type{{owner: "main.X", name: "data"}: fooType}
+	if actual := parser.parseValue(xType, uint64sData(0x10000), 2); actual.String() != "{data: &{a: 7}}" {
+		t.Errorf("wrong value with hint: %s", actual)
+	}
+
+	params := []Parameter{{Name: "p", Typ: unsafePtrType}, {Name: "n", Typ: int64Type}}
+	parser.unsafePointerHints[unsafePointerHintKey{owner: "main.f", name: "p"}] = fooType
+	hinted := parser.hintedParameters("main.f", params)
+	if hinted[0].Typ.(*dwarf.PtrType).Type != fooType || hinted[1].Typ != int64Type {
+		t.Errorf("wrong hinted parameters: %v", hinted)
+	}
+	if params[0].Typ != unsafePtrType {
+		t.Errorf("original parameters are changed")
+	}
+}
+
+func TestParseValue_MapLenOnly(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	hmapType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 16}, StructName: "hash<string,int>", Kind: "struct"}
+	hmapType.Field = []*dwarf.StructField{
+		{Name: "count", Type: int64Type, ByteOffset: 0},
+		{Name: "buckets", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}, ByteOffset: 8},
+	}
+	mapType := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "map[string]int"}, Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: hmapType}}
+
+	// the buckets are not readable, so the test fails if they are read.
+	parser := valueParser{reader: fakeMemoryReader{0x10000: uint64sData(1000, 0x20000)}, mapLenOnly: true}
+	for i, testdata := range []struct {
+		val      []byte
+		expected string
+	}{
+		{val: uint64sData(0x10000), expected: "map[string]int(len 1000)"},
+		{val: uint64sData(0), expected: "nil"},
+	} {
+		actual := parser.parseValue(mapType, testdata.val, 1)
+		if actual.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, actual)
+		}
+	}
+}
+
+func TestParseEmptyInterfaceValue_SelfReferential(t *testing.T) {
+	const runtimeTypeAddrOfPtrToS = 0x1000
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	efaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.eface",
+		Field: []*dwarf.StructField{
+			{Name: "_type", Type: voidPtrType, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+	sType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "main.S",
+		Kind:       "struct",
+		Field:      []*dwarf.StructField{{Name: "I", Type: efaceType, ByteOffset: 0}},
+	}
+	ptrToSType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: sType}
+
+	// s := &S{}; s.I = s
+	reader := fakeMemoryReader{0x10000: emptyInterfaceData(runtimeTypeAddrOfPtrToS, 0x10000)}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) { return ptrToSType, nil }
+	parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType}
+
+	val := parser.parseValue(efaceType, emptyInterfaceData(runtimeTypeAddrOfPtrToS, 0x10000), 2)
+	if val.String() != "*struct main.S(&{I: *struct main.S(&{I: *struct main.S(&{...})})})" {
+		t.Errorf("wrong value: %s", val)
+	}
+}
+
+func TestParseInterfaceValue_Methods(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	uintptrType := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "uintptr"}}}
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	imethodsType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 24},
+		StructName: "[]runtime.imethod",
+		Field: []*dwarf.StructField{
+			{Name: "array", Type: voidPtrType, ByteOffset: 0},
+			{Name: "len", Type: int64Type, ByteOffset: 8},
+			{Name: "cap", Type: int64Type, ByteOffset: 16},
+		},
+	}
+	interfaceTypeType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 24},
+		StructName: "runtime.interfacetype",
+		Field:      []*dwarf.StructField{{Name: "mhdr", Type: imethodsType, ByteOffset: 0}},
+	}
+	itabType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 24},
+		StructName: "runtime.itab",
+		Field: []*dwarf.StructField{
+			{Name: "inter", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: interfaceTypeType}, ByteOffset: 0},
+			{Name: "_type", Type: voidPtrType, ByteOffset: 8},
+			{Name: "fun", Type: &dwarf.ArrayType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: uintptrType, Count: 1}, ByteOffset: 16},
+		},
+	}
+	ifaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.iface",
+		Field: []*dwarf.StructField{
+			{Name: "tab", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: itabType}, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+
+	reader := fakeMemoryReader{
+		0x1000: uint64sData(0x3000, 0x4000, 0x5000, 0x5100), // itab
+		0x2000: uint64sData(5),                              // data
+		0x3000: uint64sData(0, 2, 2),                        // interfacetype
+	}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) { return int64Type, nil }
+	findFunction := func(pc uint64) (*Function, error) {
+		switch pc {
+		case 0x5000:
+			return &Function{Name: "main.T.Read", StartAddr: pc}, nil
+		case 0x5100:
+			return &Function{Name: "main.T.Write", StartAddr: pc}, nil
+		}
+		return nil, errors.New("unknown function")
+	}
+
+	for i, testdata := range []struct {
+		parseMethods bool
+		expected     string
+	}{
+		{parseMethods: false, expected: "int64(5)"},
+		{parseMethods: true, expected: "int64(5){Read: main.T.Read, Write: main.T.Write}"},
+	} {
+		parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType, findFunction: findFunction, parseInterfaceMethods: testdata.parseMethods}
+		val := parser.parseValue(ifaceType, uint64sData(0x1000, 0x2000), 1)
+		if val.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, val)
+		}
+	}
+}
+
+func TestParseInterfaceValue_StaticItab(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	voidPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: &dwarf.VoidType{}}
+	itabType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.itab",
+		Field: []*dwarf.StructField{
+			{Name: "inter", Type: voidPtrType, ByteOffset: 0},
+			{Name: "_type", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+	ifaceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 16},
+		StructName: "runtime.iface",
+		Field: []*dwarf.StructField{
+			{Name: "tab", Type: &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: itabType}, ByteOffset: 0},
+			{Name: "data", Type: voidPtrType, ByteOffset: 8},
+		},
+	}
+
+	// the itab is only in the binary file and the data is the global variable.
+	reader := fakeMemoryReader{0x2000: uint64sData(5)}
+	staticData := fakeMemoryReader{0x1000: uint64sData(0, 0x3000)}
+	mapRuntimeType := func(addr uint64) (dwarf.Type, error) {
+		if addr != 0x3000 {
+			return nil, errors.New("unknown type")
+		}
+		return int64Type, nil
+	}
+
+	parser := valueParser{reader: reader, mapRuntimeType: mapRuntimeType, readStaticData: staticData.ReadMemory}
+	val := parser.parseValue(ifaceType, uint64sData(0x1000, 0x2000), 1)
+	if val.String() != "int64(5)" {
+		t.Errorf("wrong value: %s", val)
+	}
+
+	parser.readStaticData = nil
+	val = parser.parseValue(ifaceType, uint64sData(0x1000, 0x2000), 1)
+	if val.String() == "int64(5)" {
+		t.Errorf("the itab is read without the fallback")
+	}
+}
+
+func TestParseSyncValue(t *testing.T) {
+	int32Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "int32"}}}
+	uint32Type := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "uint32"}}}
+	uint64Type := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "uint64"}}}
+	mutexType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 8},
+		StructName: "sync.Mutex",
+		Field: []*dwarf.StructField{
+			{Name: "state", Type: int32Type, ByteOffset: 0},
+			{Name: "sema", Type: uint32Type, ByteOffset: 4},
+		},
+	}
+	waitGroupType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 12},
+		StructName: "sync.WaitGroup",
+		Field: []*dwarf.StructField{
+			{Name: "state", Type: uint64Type, ByteOffset: 0},
+			{Name: "sema", Type: uint32Type, ByteOffset: 8},
+		},
+	}
+	onceType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 12},
+		StructName: "sync.Once",
+		Field: []*dwarf.StructField{
+			{Name: "done", Type: uint32Type, ByteOffset: 0},
+			{Name: "m", Type: mutexType, ByteOffset: 4},
+		},
+	}
+
+	for i, testdata := range []struct {
+		typ      *dwarf.StructType
+		val      []byte
+		expected string
+	}{
+		{typ: mutexType, val: []byte{1, 0, 0, 0, 0, 0, 0, 0}, expected: "Mutex(locked)"},
+		{typ: mutexType, val: []byte{0, 0, 0, 0, 0, 0, 0, 0}, expected: "Mutex(unlocked)"},
+		{typ: waitGroupType, val: []byte{0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}, expected: "WaitGroup(counter=2)"},
+		{typ: onceType, val: []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, expected: "Once(done)"},
+	} {
+		val := (valueParser{}).parseValue(testdata.typ, testdata.val, 1)
+		if val.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, val)
+		}
+	}
+}
+
+func TestParseValue_InvalidPointer(t *testing.T) {
+	int8Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "int8"}}}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: int8Type}
+
+	parser := valueParser{invalidPointerThreshold: defaultInvalidPointerThreshold}
+	val := parser.parseValue(ptrType, []byte{0x10, 0, 0, 0, 0, 0, 0, 0}, 1)
+	if val.String() != "<invalid pointer 0x10>" {
+		t.Errorf("wrong value: %s", val)
+	}
+
+	val = parser.parseValue(ptrType, []byte{0, 0, 0, 0, 0, 0, 0, 0}, 1)
+	if val.String() != "0x0" {
+		t.Errorf("wrong value: %s", val)
+	}
+}
+
+func TestParseValue_LargeStruct(t *testing.T) {
+	uint8Type := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "uint8"}}}
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	const arraySize = 64 * 1024
+	arrayType := &dwarf.ArrayType{CommonType: dwarf.CommonType{ByteSize: arraySize}, Type: uint8Type, Count: arraySize}
+	// type S struct { A [64 * 1024]uint8; B int64 }
+	sType := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: arraySize + 8},
+		StructName: "main.S",
+		Kind:       "struct",
+		Field: []*dwarf.StructField{
+			{Name: "A", Type: arrayType, ByteOffset: 0},
+			{Name: "B", Type: int64Type, ByteOffset: arraySize},
+		},
+	}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: sType}
+
+	data := make([]byte, arraySize+8)
+	data[arraySize-1] = 1
+	binary.LittleEndian.PutUint64(data[arraySize:], 2)
+	parser := valueParser{reader: fakeMemoryReader{0x10000: data}}
+	val := parser.parseValue(ptrType, uint64sData(0x10000), 2)
+
+	sVal := val.(ptrValue).pointedVal.(structValue)
+	if arrayVal := sVal.fields["A"].(arrayValue); len(arrayVal.val) != arraySize || arrayVal.val[arraySize-1].(uint8Value).val != 1 {
+		t.Errorf("wrong array: %v", arrayVal.val[arraySize-1])
+	}
+	if bVal := sVal.fields["B"].(int64Value); bVal.val != 2 {
+		t.Errorf("wrong value: %s", bVal)
+	}
+}
+
+func TestParseValue_MaxPointerDepth(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: int64Type}
+	ptrPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: ptrType}
+	ptrPtrPtrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: ptrPtrType}
+
+	reader := fakeMemoryReader{
+		0x10000: uint64sData(0x20000),
+		0x20000: uint64sData(0x30000),
+		0x30000: uint64sData(7),
+	}
+	for i, testdata := range []struct {
+		maxPointerDepth int
+		expected        string
+	}{
+		{maxPointerDepth: 0, expected: "&&&7"},
+		{maxPointerDepth: 3, expected: "&&&7"},
+		{maxPointerDepth: 2, expected: "&&0x30000"},
+		{maxPointerDepth: 1, expected: "&0x20000"},
+	} {
+		parser := valueParser{reader: reader, maxPointerDepth: testdata.maxPointerDepth}
+		// the max pointer depth is independent of the parse depth.
+		actual := parser.parseValue(ptrPtrPtrType, uint64sData(0x10000), 1)
+		if actual.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, actual)
+		}
+	}
+}
+
+func TestParseValue_LinkedList(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	nodeType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 16}, StructName: "main.node", Kind: "struct"}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: nodeType}
+	nodeType.Field = []*dwarf.StructField{
+		{Name: "val", Type: int64Type, ByteOffset: 0},
+		{Name: "next", Type: ptrType, ByteOffset: 8},
+	}
+
+	for i, testdata := range []struct {
+		reader         fakeMemoryReader
+		maxLinkedNodes int
+		expected       string
+	}{
+		{
+			reader:         fakeMemoryReader{0x10000: uint64sData(1, 0x20000), 0x20000: uint64sData(2, 0)},
+			maxLinkedNodes: 8,
+			expected:       "[{val: 1} -> {val: 2}]",
+		},
+		{
+			reader:         fakeMemoryReader{0x10000: uint64sData(1, 0x20000), 0x20000: uint64sData(2, 0x30000), 0x30000: uint64sData(3, 0)},
+			maxLinkedNodes: 2,
+			expected:       "[{val: 1} -> {val: 2} -> ...]",
+		},
+		{
+			reader:         fakeMemoryReader{0x10000: uint64sData(1, 0x20000), 0x20000: uint64sData(2, 0x10000)},
+			maxLinkedNodes: 8,
+			expected:       "[{val: 1} -> {val: 2} -> <cycle 0x10000>]",
+		},
+	} {
+		parser := valueParser{reader: testdata.reader, maxLinkedNodes: testdata.maxLinkedNodes, linkFields: defaultLinkFields}
+		// the remaining depth is not decremented by the link fields.
+		actual := parser.parseValue(ptrType, uint64sData(0x10000), 1)
+		if actual.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, actual)
+		}
+	}
+
+	parser := valueParser{reader: fakeMemoryReader{0x10000: uint64sData(1, 0)}, linkFields: defaultLinkFields}
+	if _, ok := parser.parseValue(ptrType, uint64sData(0x10000), 1).(ptrValue); !ok {
+		t.Errorf("the traversal is not disabled by default")
+	}
+}
+
+func TestParseValue_LinkedTree(t *testing.T) {
+	int64Type := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int64"}}}
+	nodeType := &dwarf.StructType{CommonType: dwarf.CommonType{ByteSize: 24}, StructName: "main.tree", Kind: "struct"}
+	ptrType := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}, Type: nodeType}
+	nodeType.Field = []*dwarf.StructField{
+		{Name: "val", Type: int64Type, ByteOffset: 0},
+		{Name: "left", Type: ptrType, ByteOffset: 8},
+		{Name: "right", Type: ptrType, ByteOffset: 16},
+	}
+
+	reader := fakeMemoryReader{
+		0x10000: uint64sData(1, 0x20000, 0x30000),
+		0x20000: uint64sData(2, 0, 0),
+		0x30000: uint64sData(3, 0x40000, 0),
+		0x40000: uint64sData(4, 0, 0),
+	}
+	parser := valueParser{reader: reader, maxLinkedNodes: 3, linkFields: []string{"left", "right"}}
+	actual := parser.parseValue(ptrType, uint64sData(0x10000), 1)
+	expected := "{val: 1, left: {val: 2, left: nil, right: nil}, right: {val: 3, left: ..., right: nil}}"
+	if actual.String() != expected {
+		t.Errorf("wrong value: %s", actual)
+	}
+}
+
+func TestParseValue_ConstantName(t *testing.T) {
+	modeType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "main.Mode"}}}
+	findConstantName := func(typeName string, val int64) (string, bool) {
+		if typeName == "main.Mode" && val == 2 {
+			return "main.ModeWrite", true
+		}
+		return "", false
+	}
+
+	intType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8, Name: "int"}}}
+	for i, testdata := range []struct {
+		typ              dwarf.Type
+		findConstantName func(string, int64) (string, bool)
+		val              []byte
+		expected         string
+	}{
+		{findConstantName: findConstantName, val: uint64sData(2), expected: "2 (main.ModeWrite)"},
+		{findConstantName: findConstantName, val: uint64sData(3), expected: "3"},
+		{findConstantName: nil, val: uint64sData(2), expected: "2"},
+		// the untyped constants have the builtin type.
+		{typ: intType, findConstantName: func(string, int64) (string, bool) { return "main.untyped", true }, val: uint64sData(2), expected: "2"},
+	} {
+		parser := valueParser{findConstantName: testdata.findConstantName}
+		typ := testdata.typ
+		if typ == nil {
+			typ = modeType
+		}
+		val := parser.parseValue(typ, testdata.val, 1)
+		if val.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, val)
+		}
+		if val.Size() != 8 {
+			t.Errorf("[%d] wrong size: %d", i, val.Size())
+		}
+	}
+}
+
+func TestValueWriteTo(t *testing.T) {
+	var ints []value
+	for i := 0; i < maxContainerItemsToPrint+1; i++ {
+		ints = append(ints, int64Value{val: int64(i)})
+	}
+
+	for i, testdata := range []struct {
+		val      value
+		expected string
+	}{
+		{val: int8Value{val: -1}, expected: "-1"},
+		{val: uint64Value{val: 18446744073709551615}, expected: "18446744073709551615"},
+		{val: float32Value{val: 0.1}, expected: "0.1"},
+		{val: float64Value{val: 1e21}, expected: "1e+21"},
+		{val: complex128Value{val: complex(1, -2)}, expected: "(1-2i)"},
+		{val: boolValue{val: true}, expected: "true"},
+		{val: ptrValue{addr: 0xc000010000}, expected: "0xc000010000"},
+		{val: ptrValue{addr: 0x10, invalid: true}, expected: "<invalid pointer 0x10>"},
+		{val: ptrValue{pointedVal: int8Value{val: 1}}, expected: "&1"},
+		{val: funcValue{addr: 0x1000}, expected: "0x1000"},
+		{val: stringValue{val: "a\n"}, expected: `"a\n"`},
+		{val: sliceValue{}, expected: "nil"},
+		{val: sliceValue{val: ints[0:2]}, expected: "[]{0, 1}"},
+		{val: sliceValue{val: ints}, expected: "[]{0, 1, 2, 3, 4, 5, 6, 7, ...}"},
+		{val: arrayValue{val: ints[0:2]}, expected: "[2]{0, 1}"},
+		{val: structValue{fields: map[string]value{"a": int8Value{val: 1}}}, expected: "{a: 1}"},
+		{val: structValue{abbreviated: true}, expected: "{...}"},
+		{val: structValue{fields: map[string]value{"b": int8Value{val: 2}, "a": int8Value{val: 1}, "c": int8Value{val: 3}}, maxFields: 2}, expected: "{a: 1, b: 2, ...}"},
+		{val: structValue{fields: map[string]value{"b": int8Value{val: 2}, "a": int8Value{val: 1}, "c": int8Value{val: 3}}, fieldNames: []string{"c", "a", "b"}, maxFields: 2}, expected: "{c: 3, a: 1, ...}"},
+		{val: structValue{fields: map[string]value{"b": int8Value{val: 2}, "a": int8Value{val: 1}}, fieldNames: []string{"b", "a"}}, expected: "{b: 2, a: 1}"},
+		{val: interfaceValue{}, expected: "nil"},
+		{val: interfaceValue{implType: &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{Name: "int"}}}}, expected: "int(nil)"},
+		{val: mapValue{val: map[value]value{int8Value{val: 1}: boolValue{val: false}}}, expected: "{1: false}"},
+		{val: voidValue{val: []byte{1, 2}}, expected: "[1 2]"},
+	} {
+		var buf bytes.Buffer
+		testdata.val.writeTo(&buf)
+		if buf.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, buf.String())
+		}
+		if testdata.val.String() != testdata.expected {
+			t.Errorf("[%d] wrong value: %s", i, testdata.val)
+		}
+	}
+}
+
+func BenchmarkValueString(b *testing.B) {
+	val := benchmarkValue()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = val.String()
+	}
+}
+
+func BenchmarkValueWriteTo(b *testing.B) {
+	val := benchmarkValue()
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		val.writeTo(&buf)
+	}
+}
+
+func benchmarkValue() value {
+	var vals []value
+	for i := 0; i < maxContainerItemsToPrint; i++ {
+		vals = append(vals, int64Value{val: int64(i)})
+	}
+	return sliceValue{val: vals}
+}
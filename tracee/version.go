@@ -47,21 +47,55 @@ func ParseGoVersion(raw string) GoVersion {
 
 // LaterThan returns true if the version is equal to or later than the given version.
 func (v GoVersion) LaterThan(target GoVersion) bool {
-	if v.Devel {
-		return true
-	}
+	return v.Compare(target) >= 0
+}
+
+// AtLeast returns true if the version is equal to or later than the given major and minor version, such as 1.17.
+// Useful to select the handling which depends on the runtime's data layout or ABI.
+func (v GoVersion) AtLeast(major, minor int) bool {
+	return v.LaterThan(GoVersion{MajorVersion: major, MinorVersion: minor})
+}
+
+// Before returns true if the version is earlier than the given version.
+func (v GoVersion) Before(target GoVersion) bool {
+	return v.Compare(target) < 0
+}
 
-	if v.MajorVersion > target.MajorVersion {
-		return true
-	} else if v.MajorVersion < target.MajorVersion {
-		return false
+// Equal returns true if the version is same as the given version. The raw string is not compared.
+func (v GoVersion) Equal(target GoVersion) bool {
+	return v.Compare(target) == 0
+}
+
+// Compare returns -1, 0 or 1 if the version is earlier than, same as or later than the given version respectively.
+// The devel version is considered later than any released version.
+func (v GoVersion) Compare(target GoVersion) int {
+	if v.Devel || target.Devel {
+		switch {
+		case v.Devel && target.Devel:
+			return 0
+		case v.Devel:
+			return 1
+		default:
+			return -1
+		}
 	}
 
-	if v.MinorVersion > target.MinorVersion {
-		return true
-	} else if v.MinorVersion < target.MinorVersion {
-		return false
+	if c := compareInt(v.MajorVersion, target.MajorVersion); c != 0 {
+		return c
+	}
+	if c := compareInt(v.MinorVersion, target.MinorVersion); c != 0 {
+		return c
 	}
+	return compareInt(v.PatchVersion, target.PatchVersion)
+}
 
-	return v.PatchVersion >= target.PatchVersion
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
 }
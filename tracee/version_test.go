@@ -70,3 +70,35 @@ func TestGoVersion_LaterThan(t *testing.T) {
 		}
 	}
 }
+
+func TestGoVersion_Compare(t *testing.T) {
+	for i, testdata := range []struct {
+		a, b   GoVersion
+		expect int
+	}{
+		{a: GoVersion{Devel: true}, b: GoVersion{Devel: true}, expect: 0},
+		{a: GoVersion{Devel: true}, b: GoVersion{MajorVersion: 1, MinorVersion: 20}, expect: 1},
+		{a: GoVersion{MajorVersion: 1, MinorVersion: 20}, b: GoVersion{Devel: true}, expect: -1},
+		{a: GoVersion{MajorVersion: 1, MinorVersion: 11}, b: GoVersion{Raw: "go1.11", MajorVersion: 1, MinorVersion: 11}, expect: 0},
+		{a: GoVersion{MajorVersion: 1, MinorVersion: 9}, b: GoVersion{MajorVersion: 1, MinorVersion: 11}, expect: -1},
+		{a: GoVersion{MajorVersion: 1, MinorVersion: 11, PatchVersion: 2}, b: GoVersion{MajorVersion: 1, MinorVersion: 11, PatchVersion: 1}, expect: 1},
+	} {
+		actual := testdata.a.Compare(testdata.b)
+		if actual != testdata.expect {
+			t.Errorf("[%d] wrong result: %v", i, actual)
+		}
+		if testdata.a.Equal(testdata.b) != (testdata.expect == 0) || testdata.a.Before(testdata.b) != (testdata.expect < 0) {
+			t.Errorf("[%d] inconsistent with Compare", i)
+		}
+	}
+}
+
+func TestGoVersion_AtLeast(t *testing.T) {
+	v := GoVersion{MajorVersion: 1, MinorVersion: 17, PatchVersion: 3}
+	if !v.AtLeast(1, 17) || !v.AtLeast(1, 11) {
+		t.Errorf("should be at least the earlier version")
+	}
+	if v.AtLeast(1, 18) || v.AtLeast(2, 0) {
+		t.Errorf("should not be at least the later version")
+	}
+}
@@ -58,12 +58,15 @@ func (b Breakpoints) ClearConditional(addr uint64, goRoutineID int64) error {
 }
 
 // ClearAllByGoRoutineID clears all the breakpoints associated with the specified go routine.
+// The non-conditional breakpoints, such as the start trace points, are kept.
 func (b Breakpoints) ClearAllByGoRoutineID(goRoutineID int64) error {
 	for addr, bp := range b.setBreakpoints {
+		disassociated := false
 		for bp.Disassociate(goRoutineID) {
+			disassociated = true
 		}
 
-		if !bp.NoAssociation() {
+		if !disassociated || !bp.NoAssociation() {
 			continue
 		}
 		if err := b.Clear(addr); err != nil {
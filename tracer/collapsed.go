@@ -0,0 +1,51 @@
+package tracer
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// collapsedStacks aggregates the traced calls into the collapsed stacks, such as `main.main;main.f;main.g 3`,
+// which flamegraph.pl and some pprof tools can read. The count is the number of the calls, not the samples.
+type collapsedStacks struct {
+	// stacks is the functions each go routine is calling, from the outermost one.
+	stacks map[int64][]string
+	counts map[string]int
+}
+
+// Enter records the call of the function at the depth. The functions deeper than or at the same depth have returned.
+func (s *collapsedStacks) Enter(goRoutineID int64, depth int, funcName string) {
+	if s.stacks == nil {
+		s.stacks = make(map[int64][]string)
+		s.counts = make(map[string]int)
+	}
+
+	stack := s.stacks[goRoutineID]
+	if depth-1 < len(stack) {
+		stack = stack[:depth-1]
+	}
+	stack = append(stack, funcName)
+	s.stacks[goRoutineID] = stack
+	s.counts[strings.Join(stack, ";")]++
+}
+
+// WriteTo writes the collapsed stacks sorted by the stack, one stack per line.
+func (s *collapsedStacks) WriteTo(w io.Writer) (int64, error) {
+	keys := make([]string, 0, len(s.counts))
+	for key := range s.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(key)
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Itoa(s.counts[key]))
+		buf.WriteByte('\n')
+	}
+	return buf.WriteTo(w)
+}
@@ -0,0 +1,37 @@
+package tracer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCollapsedStacks(t *testing.T) {
+	var stacks collapsedStacks
+	stacks.Enter(1, 1, "main.main")
+	stacks.Enter(1, 2, "main.f")
+	stacks.Enter(1, 3, "main.g")
+	stacks.Enter(1, 2, "main.f") // main.f and main.g returned
+	stacks.Enter(1, 3, "main.g")
+	stacks.Enter(2, 1, "main.h")
+	stacks.Enter(1, 2, "main.h")
+
+	buff := &bytes.Buffer{}
+	if _, err := stacks.WriteTo(buff); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	expected := "main.h 1\nmain.main 1\nmain.main;main.f 2\nmain.main;main.f;main.g 2\nmain.main;main.h 1\n"
+	if buff.String() != expected {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestCollapsedStacks_Empty(t *testing.T) {
+	var stacks collapsedStacks
+	buff := &bytes.Buffer{}
+	if _, err := stacks.WriteTo(buff); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if buff.Len() != 0 {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
@@ -1,22 +1,67 @@
 package tracer
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nkbai/tgo/debugapi"
+	"github.com/nkbai/tgo/log"
 	"github.com/nkbai/tgo/tracee"
 	"golang.org/x/arch/x86/x86asm"
 )
 
 const chanBufferSize = 64
 
+// RFC3339Micro is the RFC3339 format with microseconds. Useful for the timestamp format.
+const RFC3339Micro = "2006-01-02T15:04:05.000000Z07:00"
+
 // ErrInterrupted indicates the tracer is interrupted due to the Interrupt() call.
 var ErrInterrupted = errors.New("interrupted")
 
+// ErrExecuted indicates the tracee executed a new program. Tracing the new program is not supported
+// because the addresses of the old program are no longer valid, so the tracer detaches from it.
+var ErrExecuted = errors.New("the process executed a new program")
+
+// State is the run state of the tracee.
+type State int
+
+const (
+	// StateDetached means the controller is not attached to the tracee yet or already detached.
+	StateDetached State = iota
+	// StateRunning means the tracee is running.
+	StateRunning
+	// StateStopped means the tracee is stopped, for example, while the controller handles the breakpoint.
+	StateStopped
+	// StateExited means the tracee exited.
+	StateExited
+	// StatePaused means the tracee is stopped at the start trace point and waits for Resume. See SetBreakOnFirstHitOnly.
+	StatePaused
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDetached:
+		return "detached"
+	case StateRunning:
+		return "running"
+	case StateStopped:
+		return "stopped"
+	case StateExited:
+		return "exited"
+	case StatePaused:
+		return "paused"
+	default:
+		return fmt.Sprintf("unknown state (%d)", int(s))
+	}
+}
+
 type breakpointType int
 
 const (
@@ -26,35 +71,201 @@ const (
 	breakpointTypeDeferredFunc
 	breakpointTypeReturn
 	breakpointTypeReturnAndCall
+	breakpointTypePrologueEnd
+	breakpointTypeSyscall
+	breakpointTypeMalloc
+	breakpointTypeDeferReturn
+	breakpointTypeReturnInst
 )
 
+// deferReturnFuncName is the function which runs the deferred functions at the function exit.
+// The go routine recovered from the panic resumes at the call to this function in the function which deferred the recover.
+const deferReturnFuncName = "runtime.deferreturn"
+
+// syscallFuncNames is the list of the functions which make the system calls. Their first argument is the syscall number.
+var syscallFuncNames = []string{"syscall.Syscall", "syscall.Syscall6", "syscall.RawSyscall", "syscall.RawSyscall6"}
+
 // Controller controls the associated tracee process.
 type Controller struct {
 	process             *tracee.Process
 	firstModuleDataAddr uint64
 	statusStore         map[int64]goRoutineStatus
 	callInstAddrCache   map[uint64][]uint64
+	// returnInstAddrCache caches the addresses of the return instructions. The key is the function's start address.
+	returnInstAddrCache map[uint64][]uint64
+	// prologueEndAddrCache caches the end address of the prologue. The key is the function's start address.
+	// The value is 0 if the address is unknown.
+	prologueEndAddrCache map[uint64]uint64
 
 	breakpointTypes map[uint64]breakpointType
 	breakpoints     Breakpoints
 
 	tracingPoints tracingPoints
 	traceLevel    int
+	// maxPrintDepth is the max stack depth of the functions printed. 0 means no limit.
+	maxPrintDepth int
 	parseLevel    int
+	printCaller   bool
+	// printAddresses is true if the entry pc and the return address are printed. Useful to correlate with the disassembler.
+	printAddresses bool
+	// printGoRoutineStatus is true if the status or wait reason of the go routine is printed at the function entry.
+	printGoRoutineStatus bool
+	// printThreadID is true if the id of the OS thread which hit the breakpoint follows the go routine id.
+	printThreadID bool
+	// printArgumentTypes is true if the type name follows each argument's name, such as `n int = 42`.
+	printArgumentTypes bool
+	// printDeferChain is true if the pending deferred functions of the go routine are printed at the function entry.
+	printDeferChain bool
+	// skipPrologue is true if the input arguments are read after the function prologue.
+	skipPrologue bool
+	// readResultsAtReturnInst is true if the results are read at the return instruction of the function.
+	readResultsAtReturnInst bool
+	// timestampFormat is the layout of the timestamp printed at the beginning of each line. Not printed if empty.
+	timestampFormat string
+	// traceSyscalls is true if the system calls made by the traced go routines are printed.
+	traceSyscalls bool
+	// syscallFuncAddrs is the start addresses of the syscall functions. nil if not resolved yet.
+	syscallFuncAddrs []uint64
+	// traceAllocations is true if the heap allocations made by the traced go routines are printed.
+	traceAllocations bool
+	// mallocFuncAddr is the start address of runtime.mallocgc. 0 if not resolved yet.
+	mallocFuncAddr uint64
+	// deferReturnFuncAddr is the start address of runtime.deferreturn. 0 if not resolved yet.
+	deferReturnFuncAddr uint64
+	// maxDuration is the max time the main loop traces the tracee. 0 means no limit.
+	maxDuration time.Duration
+	// mergeRecursiveCalls is true if the consecutive recursive calls are merged into the outermost call's lines.
+	mergeRecursiveCalls bool
+	// breakOnFirstHit is true if the main loop pauses when the start trace point is hit first time.
+	breakOnFirstHit bool
+	// breakThreadID is the thread which hit the start trace point and so the main loop pauses at. 0 if no pause is pending.
+	breakThreadID int
+	// breakHit is true if the main loop paused already.
+	breakHit bool
+	// tracingPaused is true if the tracing is paused by PauseTracing. Updated only by the main loop.
+	tracingPaused bool
+	// sampler decides which hits of the start trace points are traced. See SetSampling.
+	sampler sampler
+	// reportedSamplingInterval is the sampling interval printed last time. 0 if not printed yet.
+	reportedSamplingInterval int
 
 	// Use the buffered channels to handle the requests to the controller asyncronously.
 	// It's because the tracee process must be trapped to handle these requests, but the process may not
 	// be trapped when the requests are sent.
 	interruptCh            chan bool
-	pendingStartTracePoint chan uint64
+	pendingStartTracePoint chan startTracePoint
 	pendingEndTracePoint   chan uint64
+	clearAllTracePointsCh  chan bool
+	pendingArgsRequest     chan chan currentArgsResult
+	pendingCallerRequest   chan chan callerResult
+	pendingRegsRequest     chan chan registersResult
+	pendingMemoryRequest   chan memoryRequest
+	pendingDeferRequest    chan chan deferChainResult
+	pendingParamRequest    chan paramRequest
+	resumeCh               chan bool
+	// pauseTracingCh receives true to pause the tracing and false to resume it.
+	pauseTracingCh chan bool
+	// mainLoopDoneCh is closed when the main loop ends, so that the requests waiting for the result give up.
+	mainLoopDoneCh chan struct{}
+	// requestTimeout is the max time the requests like CurrentArguments wait for the result. 0 means no limit.
+	requestTimeout time.Duration
+	// lastTrappedThreadID is the thread which hit the breakpoint most recently. 0 if no thread trapped yet.
+	lastTrappedThreadID int
+	// trappedGoRoutines holds the go routine info of the threads trapped in the last trap event, at the time they hit the breakpoint.
+	// CurrentPC is the breakpoint address. At the prologue end, the info is rewound to the function entry.
+	// The key is the thread id.
+	trappedGoRoutines map[int]tracee.GoRoutineInfo
 	// The traced data is written to this writer.
 	outputWriter io.Writer
+	// flushInterval is the number of the lines written before the output writer is flushed. 0 disables the flush.
+	flushInterval int
+	// unflushedLines is the number of the lines written since the last flush.
+	unflushedLines int
+	// drainTimeout is the max time to wait for the output writer to write the queued data when the main loop ends.
+	// 0 means no limit.
+	drainTimeout time.Duration
+	outputFormat OutputFormat
+	// collapsedStacks aggregates the traced calls if the output format is OutputFormatCollapsed.
+	collapsedStacks collapsedStacks
+	// spanExporter converts the traced calls into the spans if the output format is OutputFormatSpans.
+	spanExporter  *SpanExporter
+	spansEndpoint string
+	// onEnter and onReturn are called with the enter and return events. Not called if nil.
+	onEnter, onReturn func(Event)
+	// lastCallID is the id of the last traced call. The id starts from 1.
+	lastCallID uint64
+	// lineBuffer is reused to format each line of the traced data.
+	lineBuffer bytes.Buffer
+
+	stateMtx sync.Mutex // protects state
+	state    State
+}
+
+type startTracePoint struct {
+	addr uint64
+	// hitLimit is the number of times the trace point is hit before removed. 0 means no limit.
+	hitLimit int
+	// caller is the function the trace point's function must be called from. No filter if empty.
+	caller string
+}
+
+type currentArgsResult struct {
+	args []Argument
+	err  error
+}
+
+type callerResult struct {
+	pc       uint64
+	funcName string
+	err      error
+}
+
+type registersResult struct {
+	regs debugapi.Registers
+	err  error
+}
+
+type memoryRequest struct {
+	addr     uint64
+	size     int
+	resultCh chan memoryResult
+}
+
+type memoryResult struct {
+	data []byte
+	err  error
+}
+
+type deferChainResult struct {
+	funcNames []string
+	err       error
+}
+
+type paramRequest struct {
+	name     string
+	resultCh chan paramResult
+}
+
+type paramResult struct {
+	value string
+	err   error
 }
 
 type goRoutineStatus struct {
 	// This list include only the functions which hit the breakpoint before and so is not complete.
 	callingFunctions []callingFunction
+	// pendingInput is the function input which will be printed at the end of the function prologue.
+	pendingInput *pendingFunctionInput
+	// depthMarkerPrinted is true if the marker is printed because the stack depth exceeds the max print depth.
+	depthMarkerPrinted bool
+}
+
+type pendingFunctionInput struct {
+	function      *tracee.Function
+	callID        uint64
+	usedStackSize uint64
+	depth         int
+	deferred      bool
 }
 
 func (status goRoutineStatus) usedStackSize() uint64 {
@@ -74,21 +285,54 @@ func (status goRoutineStatus) lastFunctionAddr() uint64 {
 
 type callingFunction struct {
 	*tracee.Function
+	// callID identifies the call among all the go routines. The entry and return events of the call have the same id.
+	callID                 uint64
 	returnAddress          uint64
 	usedStackSize          uint64
 	setCallInstBreakpoints bool
+	// returnInstBreakpoints is the addresses of the function's return instructions the breakpoints are set at.
+	returnInstBreakpoints []uint64
+	// resultFrame is the stack frame read at the return instruction. nil if not read.
+	resultFrame *tracee.StackFrame
+	// deferred is true if the function is called as the deferred function.
+	deferred bool
+	// merged is true if the function is the recursive call merged into the caller's lines.
+	merged bool
+	// mergedCalls is the number of the recursive calls merged into this function's lines.
+	mergedCalls int
+	// enteredWhilePaused is true if the function is called while the tracing is paused. Its return is not printed
+	// even if the tracing is resumed, because its entry is not printed.
+	enteredWhilePaused bool
 }
 
 // NewController returns the new controller.
 func NewController() *Controller {
 	return &Controller{
 		outputWriter:           os.Stdout,
+		flushInterval:          1,
+		drainTimeout:           defaultDrainTimeout,
+		outputFormat:           OutputFormatText,
 		statusStore:            make(map[int64]goRoutineStatus),
 		breakpointTypes:        make(map[uint64]breakpointType),
 		callInstAddrCache:      make(map[uint64][]uint64),
+		returnInstAddrCache:    make(map[uint64][]uint64),
+		prologueEndAddrCache:   make(map[uint64]uint64),
+		trappedGoRoutines:      make(map[int]tracee.GoRoutineInfo),
+		skipPrologue:           true,
 		interruptCh:            make(chan bool, chanBufferSize),
-		pendingStartTracePoint: make(chan uint64, chanBufferSize),
+		pendingStartTracePoint: make(chan startTracePoint, chanBufferSize),
 		pendingEndTracePoint:   make(chan uint64, chanBufferSize),
+		clearAllTracePointsCh:  make(chan bool, chanBufferSize),
+		pendingArgsRequest:     make(chan chan currentArgsResult, chanBufferSize),
+		pendingCallerRequest:   make(chan chan callerResult, chanBufferSize),
+		pendingRegsRequest:     make(chan chan registersResult, chanBufferSize),
+		pendingMemoryRequest:   make(chan memoryRequest, chanBufferSize),
+		pendingDeferRequest:    make(chan chan deferChainResult, chanBufferSize),
+		pendingParamRequest:    make(chan paramRequest, chanBufferSize),
+		resumeCh:               make(chan bool, chanBufferSize),
+		pauseTracingCh:         make(chan bool, chanBufferSize),
+		mainLoopDoneCh:         make(chan struct{}),
+		requestTimeout:         defaultRequestTimeout,
 	}
 }
 
@@ -100,6 +344,9 @@ func (c *Controller) LaunchTracee(name string, arg []string, attrs Attributes) e
 	var err error
 	c.process, err = tracee.LaunchProcess(name, arg, tracee.Attributes(attrs))
 	c.breakpoints = NewBreakpoints(c.process.SetBreakpoint, c.process.ClearBreakpoint)
+	if err == nil {
+		c.setState(StateStopped)
+	}
 	return err
 }
 
@@ -108,13 +355,82 @@ func (c *Controller) AttachTracee(pid int, attrs Attributes) error {
 	var err error
 	c.process, err = tracee.AttachProcess(pid, tracee.Attributes(attrs))
 	c.breakpoints = NewBreakpoints(c.process.SetBreakpoint, c.process.ClearBreakpoint)
+	if err == nil {
+		c.setState(StateStopped)
+	}
 	return err
 }
 
+// TraceeArgs returns the command-line arguments of the tracee, including the program name.
+// They are the ones passed to LaunchTracee if launched, or ones read from os.Args when attached.
+func (c *Controller) TraceeArgs() ([]string, error) {
+	if c.process == nil {
+		return nil, errors.New("the tracee is not launched or attached")
+	} else if c.process.Args == nil {
+		return nil, errors.New("the command-line arguments are unknown")
+	}
+	return c.process.Args, nil
+}
+
+// ContinueUntilStartTracePoint lets the tracee continue until any go routine hits one of the start trace points
+// and then returns with the tracee stopped, so that the further configuration, like the end trace points, is applied
+// before the tracing starts. Call MainLoop after that to continue the tracing.
+//
+// It's mainly for the attached tracee. The tracee runs without any trace points until the main loop sets them and
+// so it may pass the point where the tracing should start. Add the start trace point before calling this function
+// so that it's set before the tracee resumes. Because the trace point is the breakpoint at the function entry,
+// the next entry is caught even if the function is already running when attached.
+func (c *Controller) ContinueUntilStartTracePoint() error {
+	for {
+		event, err := c.continueAndWait()
+		if err == ErrInterrupted {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("failed to continue: %v", err)
+		}
+
+		switch event.Type {
+		case debugapi.EventTypeTrapped:
+			if err := c.handleTrappedThreads(event.Data.([]int)); err != nil {
+				return err
+			}
+			if len(c.tracingPoints.goRoutinesInside) > 0 {
+				if c.breakThreadID != 0 {
+					// already stopped at the start trace point and so no need to pause.
+					c.lastTrappedThreadID, c.breakThreadID = c.breakThreadID, 0
+					c.breakHit = true
+				}
+				return nil
+			}
+		case debugapi.EventTypeExited, debugapi.EventTypeCoreDump, debugapi.EventTypeTerminated, debugapi.EventTypeExec:
+			return errors.New("the process exited before hitting the start trace point")
+		default:
+			return fmt.Errorf("unknown event: %v", event.Type)
+		}
+	}
+}
+
 // AddStartTracePoint adds the starting point of the tracing. The go routines which executed one of these addresses start to be traced.
 func (c *Controller) AddStartTracePoint(startAddr uint64) error {
+	return c.AddStartTracePointWithHitLimit(startAddr, 0)
+}
+
+// AddStartTracePointWithHitLimit adds the starting point of the tracing like AddStartTracePoint, but
+// the trace point is removed after the go routines executed the address `hitLimit` times. 0 means no limit.
+func (c *Controller) AddStartTracePointWithHitLimit(startAddr uint64, hitLimit int) error {
+	return c.addStartTracePoint(startTracePoint{addr: startAddr, hitLimit: hitLimit})
+}
+
+// AddStartTracePointWithCaller adds the starting point of the tracing like AddStartTracePoint, but
+// the go routine starts to be traced only if the function which contains the address is called from the `caller` function,
+// such as "main.handler". The caller is the function the return address of the current frame belongs to.
+func (c *Controller) AddStartTracePointWithCaller(startAddr uint64, caller string) error {
+	return c.addStartTracePoint(startTracePoint{addr: startAddr, caller: caller})
+}
+
+func (c *Controller) addStartTracePoint(startPoint startTracePoint) error {
 	select {
-	case c.pendingStartTracePoint <- startAddr:
+	case c.pendingStartTracePoint <- startPoint:
 	default:
 		// maybe buffer full
 		return errors.New("failed to add start trace point")
@@ -122,7 +438,49 @@ func (c *Controller) AddStartTracePoint(startAddr uint64) error {
 	return nil
 }
 
-// AddEndTracePoint adds the ending point of the tracing. The tracing is disabled when any go routine executes any of these addresses.
+// AddStartTracePointByName adds the beginning of the specified function as the starting point of the tracing.
+// For example, specify "main.main" to trace from the program start. Specify "runtime.main" to trace
+// the program startup, including the package initialization before main.main.
+// The assembly function, which has no DWARF info, can be specified as well.
+func (c *Controller) AddStartTracePointByName(funcName string) error {
+	f, err := c.process.FindFunctionByName(funcName)
+	if err != nil {
+		return err
+	}
+	return c.AddStartTracePoint(f.StartAddr)
+}
+
+// AddStartTracePointAtInit adds the beginning of the init functions of the package, such as "main.init.0",
+// as the starting points of the tracing. The init functions run before main.main, so it should be called before
+// the main loop starts, e.g. just after the tracee is launched.
+func (c *Controller) AddStartTracePointAtInit(pkgName string) error {
+	functions, err := c.process.FindInitFunctions(pkgName)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range functions {
+		if err := c.AddStartTracePoint(f.StartAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddStartTracePointAtLine adds the statement at the source location, such as `main.go:42`, as the starting point of
+// the tracing. The file can be the path suffix, like `main.go`. The blank or comment line snaps to the next statement.
+func (c *Controller) AddStartTracePointAtLine(file string, line int) error {
+	addr, err := c.process.LineAddr(file, line)
+	if err != nil {
+		return err
+	}
+	return c.AddStartTracePoint(addr)
+}
+
+// AddEndTracePoint adds the ending point of the tracing. When the go routine executes any of these addresses,
+// it exits the tracing ranges started in the functions which have returned. If the address is the beginning of
+// the function, the ranges started in its caller are exited too. So the end point of the nested range doesn't end
+// the outer range. The tracing of the go routine is disabled when it exits all the ranges.
 func (c *Controller) AddEndTracePoint(endAddr uint64) error {
 	select {
 	case c.pendingEndTracePoint <- endAddr:
@@ -133,6 +491,253 @@ func (c *Controller) AddEndTracePoint(endAddr uint64) error {
 	return nil
 }
 
+// ClearAllTracePoints removes all the start and end trace points. The go routines inside the tracing point stop to be traced.
+// The request is handled before the pending trace points are set.
+func (c *Controller) ClearAllTracePoints() error {
+	select {
+	case c.clearAllTracePointsCh <- true:
+	default:
+		// maybe buffer full
+		return errors.New("failed to clear all trace points")
+	}
+	return nil
+}
+
+// GoVersion returns the go version the tracee is compiled with, which is found in the binary.
+// The Raw field is empty if unknown. It must be called after the tracee is launched or attached.
+func (c *Controller) GoVersion() tracee.GoVersion {
+	return c.process.Binary.GoVersion()
+}
+
+// IsPIE returns true if the tracee is the position independent executable. If so, the addresses found in the binary
+// are relocated by the load bias. It must be called after the tracee is launched or attached.
+func (c *Controller) IsPIE() bool {
+	return c.process.Binary.IsPIE()
+}
+
+// defaultRequestTimeout is the default max time the requests wait for the result.
+const defaultRequestTimeout = 10 * time.Second
+
+// SetRequestTimeout sets the max time the requests like CurrentArguments and ReadMemory wait for the result.
+// The request fails if the tracee is not trapped in time. The default is 10 seconds. 0 means no limit.
+func (c *Controller) SetRequestTimeout(timeout time.Duration) {
+	c.requestTimeout = timeout
+}
+
+// requestTimeoutCh returns the channel which receives the time when the request times out.
+// The nil channel, which never receives, is returned if no limit.
+func (c *Controller) requestTimeoutCh() <-chan time.Time {
+	if c.requestTimeout <= 0 {
+		return nil
+	}
+	return time.After(c.requestTimeout)
+}
+
+func (c *Controller) requestTimeoutError() error {
+	return fmt.Errorf("the request timed out in %v. The tracee may not be trapped", c.requestTimeout)
+}
+
+// Argument is the input argument of the function the go routine is running. See CurrentArguments.
+type Argument struct {
+	Name string
+	// Type is the type name of the argument, such as `int`. Empty if unknown.
+	Type string
+	// Value is in the same representation as the text format, such as `{a: 1}`. It's `-` if the value is not available.
+	Value string
+}
+
+// String returns the argument in the same representation as the text format, such as `a = 1`.
+func (arg Argument) String() string {
+	if arg.Name == "" {
+		return arg.Value
+	}
+	return arg.Name + " = " + arg.Value
+}
+
+// CurrentArguments returns the parsed input arguments of the function the last trapped go routine is running.
+// The request is handled when the tracee is trapped next time and so this function blocks until then,
+// the main loop ends or the request times out (see SetRequestTimeout).
+// The returned list is meaningful only when the go routine is trapped at the beginning of the function,
+// e.g. at the start trace point.
+func (c *Controller) CurrentArguments() ([]Argument, error) {
+	resultCh := make(chan currentArgsResult, 1)
+	select {
+	case c.pendingArgsRequest <- resultCh:
+	default:
+		// maybe buffer full
+		return nil, errors.New("failed to request current arguments")
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.args, result.err
+	case <-c.mainLoopDoneCh:
+		return nil, errors.New("the tracer is not running")
+	case <-c.requestTimeoutCh():
+		return nil, c.requestTimeoutError()
+	}
+}
+
+// CallerPC returns the return address of the function the last trapped go routine is running and
+// the name of the function the address belongs to.
+// Like CurrentArguments, the request is handled when the tracee is trapped next time and
+// the returned value is meaningful only when the go routine is trapped at the beginning of the function.
+func (c *Controller) CallerPC() (uint64, string, error) {
+	resultCh := make(chan callerResult, 1)
+	select {
+	case c.pendingCallerRequest <- resultCh:
+	default:
+		// maybe buffer full
+		return 0, "", errors.New("failed to request caller pc")
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.pc, result.funcName, result.err
+	case <-c.mainLoopDoneCh:
+		return 0, "", errors.New("the tracer is not running")
+	case <-c.requestTimeoutCh():
+		return 0, "", c.requestTimeoutError()
+	}
+}
+
+// CurrentRegisters returns the registers of the thread the last trapped go routine is running on.
+// Like CurrentArguments, the request is handled when the tracee is trapped next time or while the main loop is paused.
+func (c *Controller) CurrentRegisters() (debugapi.Registers, error) {
+	resultCh := make(chan registersResult, 1)
+	select {
+	case c.pendingRegsRequest <- resultCh:
+	default:
+		// maybe buffer full
+		return debugapi.Registers{}, errors.New("failed to request current registers")
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.regs, result.err
+	case <-c.mainLoopDoneCh:
+		return debugapi.Registers{}, errors.New("the tracer is not running")
+	case <-c.requestTimeoutCh():
+		return debugapi.Registers{}, c.requestTimeoutError()
+	}
+}
+
+// ReadMemory reads the `size` bytes of the tracee's memory at the address.
+// Like CurrentArguments, the request is handled when the tracee is trapped next time or while the main loop is paused.
+func (c *Controller) ReadMemory(addr uint64, size int) ([]byte, error) {
+	resultCh := make(chan memoryResult, 1)
+	select {
+	case c.pendingMemoryRequest <- memoryRequest{addr: addr, size: size, resultCh: resultCh}:
+	default:
+		// maybe buffer full
+		return nil, errors.New("failed to request memory")
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.data, result.err
+	case <-c.mainLoopDoneCh:
+		return nil, errors.New("the tracer is not running")
+	case <-c.requestTimeoutCh():
+		return nil, c.requestTimeoutError()
+	}
+}
+
+// ReadParameter returns the parsed value of the parameter which has the given name, such as `i` of `func f(i int)`.
+// Both the input and output parameters are searched. The value is in the same representation as CurrentArguments.
+// Like CurrentArguments, the request is handled when the tracee is trapped next time or while the main loop is paused.
+func (c *Controller) ReadParameter(name string) (string, error) {
+	resultCh := make(chan paramResult, 1)
+	select {
+	case c.pendingParamRequest <- paramRequest{name: name, resultCh: resultCh}:
+	default:
+		// maybe buffer full
+		return "", errors.New("failed to request parameter")
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.value, result.err
+	case <-c.mainLoopDoneCh:
+		return "", errors.New("the tracer is not running")
+	case <-c.requestTimeoutCh():
+		return "", c.requestTimeoutError()
+	}
+}
+
+// DeferChain returns the names of the deferred functions the last trapped go routine has queued but not called yet,
+// from the one called first. The open-coded defers, which the compiler inlines into the function, are not included.
+// Like CurrentArguments, the request is handled when the tracee is trapped next time or while the main loop is paused.
+func (c *Controller) DeferChain() ([]string, error) {
+	resultCh := make(chan deferChainResult, 1)
+	select {
+	case c.pendingDeferRequest <- resultCh:
+	default:
+		// maybe buffer full
+		return nil, errors.New("failed to request defer chain")
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.funcNames, result.err
+	case <-c.mainLoopDoneCh:
+		return nil, errors.New("the tracer is not running")
+	case <-c.requestTimeoutCh():
+		return nil, c.requestTimeoutError()
+	}
+}
+
+// SetBreakOnFirstHitOnly sets whether the main loop pauses when any start trace point is hit first time.
+// While paused, the tracee is kept stopped and the requests like CurrentArguments, CurrentRegisters and ReadMemory
+// are handled, so that the state of the tracee can be inspected. Call Resume to continue the tracing.
+// The later hits are traced as usual. The default is false.
+func (c *Controller) SetBreakOnFirstHitOnly(enable bool) {
+	c.breakOnFirstHit = enable
+}
+
+// Resume resumes the main loop paused by SetBreakOnFirstHitOnly. It returns error if not paused.
+func (c *Controller) Resume() error {
+	if c.State() != StatePaused {
+		return errors.New("not paused")
+	}
+
+	select {
+	case c.resumeCh <- true:
+	default:
+		// maybe buffer full
+		return errors.New("failed to resume")
+	}
+	return nil
+}
+
+// PauseTracing temporarily stops printing the traced data without clearing the trace points.
+// While paused, the go routines which hit the start trace point don't start to be traced, and the go routines already
+// traced are tracked silently so that their depths are kept correct after ResumeTracing. The returns of the
+// functions called while paused are not printed even after ResumeTracing. The tracee keeps running, as the
+// breakpoints are stepped over and continued. The request is handled before the tracee is continued next time.
+//
+// Unlike the pause by SetBreakOnFirstHitOnly, the tracee is not kept stopped.
+func (c *Controller) PauseTracing() error {
+	select {
+	case c.pauseTracingCh <- true:
+	default:
+		// maybe buffer full
+		return errors.New("failed to pause the tracing")
+	}
+	return nil
+}
+
+// ResumeTracing resumes the tracing paused by PauseTracing. It's no-op if not paused.
+func (c *Controller) ResumeTracing() error {
+	select {
+	case c.pauseTracingCh <- false:
+	default:
+		// maybe buffer full
+		return errors.New("failed to resume the tracing")
+	}
+	return nil
+}
+
 // SetTraceLevel set the tracing level, which determines whether to print the traced info of the functions.
 // The traced info is printed if the function is (directly or indirectly) called by the trace point function AND
 // the stack depth is within the `level`.
@@ -141,15 +746,214 @@ func (c *Controller) SetTraceLevel(level int) {
 	c.traceLevel = level
 }
 
+// SetMaxPrintDepth sets the max stack depth of the functions printed. 0 means no limit.
+// Unlike the trace level, the functions deeper than this depth are still traced, but not printed.
+// The marker `...` is printed when the stack depth exceeds it and the printing resumes when the stack unwinds.
+func (c *Controller) SetMaxPrintDepth(depth int) {
+	c.maxPrintDepth = depth
+}
+
+// SetMergeRecursiveCalls sets whether the consecutive recursive calls are merged. If true, the function which is
+// called by the same function is not printed and instead the number of the calls is printed at the outermost call's return,
+// such as `main.dec() (1) (x6)`. The default is false.
+func (c *Controller) SetMergeRecursiveCalls(merge bool) {
+	c.mergeRecursiveCalls = merge
+}
+
 // SetParseLevel sets the parsing level, which determines how deeply the parser parses the value of args.
+// If the level is 0, the args are not read at all and printed as `...`. It's useful when only the call tree is necessary.
 func (c *Controller) SetParseLevel(level int) {
 	c.parseLevel = level
 }
 
+// SetPrintCaller sets whether to print the caller of each traced function.
+func (c *Controller) SetPrintCaller(printCaller bool) {
+	c.printCaller = printCaller
+}
+
+// SetPrintAddresses sets whether to print the entry pc and the return address of each traced function in hex.
+// The default is false.
+func (c *Controller) SetPrintAddresses(printAddresses bool) {
+	c.printAddresses = printAddresses
+}
+
+// SetPrintThreadID sets whether to print the id of the OS thread which executes the go routine, such as `(#01 tid 1234)`.
+// It helps to see how the go routines are multiplexed onto the threads. The default is false.
+func (c *Controller) SetPrintThreadID(printThreadID bool) {
+	c.printThreadID = printThreadID
+}
+
+// SetPrintGoRoutineStatus sets whether to print the status of the go routine at each function entry,
+// such as `[goroutine 7: running]`. The wait reason is printed instead if the go routine is waiting. The default is false.
+func (c *Controller) SetPrintGoRoutineStatus(printGoRoutineStatus bool) {
+	c.printGoRoutineStatus = printGoRoutineStatus
+}
+
+// SetPrintArgumentTypes sets whether to print the type of each argument along with its name, such as `n int = 42`.
+// It helps to tell the parameters of the same type apart. The default is false, which prints `n = 42`.
+func (c *Controller) SetPrintArgumentTypes(printArgumentTypes bool) {
+	c.printArgumentTypes = printArgumentTypes
+}
+
+// SetPrintDeferChain sets whether to print the deferred functions the go routine has queued at each function entry,
+// such as `[defers: main.unlock, main.cleanup]`. It's the diagnostic option and slows down the tracing. The default is false.
+func (c *Controller) SetPrintDeferChain(printDeferChain bool) {
+	c.printDeferChain = printDeferChain
+}
+
+// SetTraceSyscalls sets whether to trace the system calls the traced go routines make, like strace.
+// The syscall is printed with its number and arguments, such as `! (#01) syscall syscall.Syscall(trap = 1, ...)`,
+// even if the syscall function is deeper than the trace level. The default is false.
+func (c *Controller) SetTraceSyscalls(traceSyscalls bool) {
+	c.traceSyscalls = traceSyscalls
+}
+
+// SetSampling sets the adaptive sampling of the start trace points to keep the tracing overhead low on the hot path.
+// At most `maxTracedHits` hits per `period` start the tracing. The other hits are skipped as if the trace point is not set.
+// 1 in N hits is traced and N is adjusted based on the hit rate of the last period. The effective sampling ratio is printed
+// whenever N changes, such as `# sampling 1 in 4 hits`. 0 disables the sampling, which is the default.
+func (c *Controller) SetSampling(maxTracedHits int, period time.Duration) {
+	c.sampler = sampler{maxTracedHits: maxTracedHits, period: period, now: time.Now}
+}
+
+// SetTraceAllocations sets whether to trace the heap allocations the traced go routines make.
+// The allocation is printed with its size and type along with the innermost traced function, such as
+// `|! (#01) alloc 16 bytes main.T in main.f`. The breakpoint at runtime.mallocgc traps every allocation
+// of the tracee and so slows down the tracee a lot. The default is false.
+func (c *Controller) SetTraceAllocations(traceAllocations bool) {
+	c.traceAllocations = traceAllocations
+}
+
+// SetSkipPrologue sets the option to read the input arguments after the function prologue.
+// The arguments may not be in their final locations at the function entry. Enabled by default.
+// The arguments are read at the function entry if the end of the prologue is unknown. If the function returns before
+// the end of the prologue, the input is printed just before the output and the input argument values are `-`.
+func (c *Controller) SetSkipPrologue(skip bool) {
+	c.skipPrologue = skip
+}
+
+// SetReadResultsAtReturnInst sets the option to read the results at the return instruction of the function,
+// where the results are in their final locations and the function's stack frame is not reused yet.
+// Otherwise, the results are read at the return address. The go compiler doesn't mark the epilogue in the line table,
+// so the return instruction is used rather than the epilogue beginning. The default is false.
+func (c *Controller) SetReadResultsAtReturnInst(enabled bool) {
+	c.readResultsAtReturnInst = enabled
+}
+
+// SetTimestampFormat sets the layout of the wall-clock timestamp printed at the beginning of each traced line.
+// See the time package for the layout. The timestamp is not printed if the layout is empty, which is the default.
+func (c *Controller) SetTimestampFormat(layout string) {
+	c.timestampFormat = layout
+}
+
+// SetFlattenEmbeddedFields sets whether the fields of the embedded struct are printed as the fields of the embedding struct.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetFlattenEmbeddedFields(flatten bool) {
+	c.process.SetFlattenEmbeddedFields(flatten)
+}
+
+// SetPrintInterfaceMethods sets whether to print the concrete methods which satisfy the interface.
+// The methods are appended to the interface value, like `{Write: os.(*File).Write}`.
+// It adds the memory reads and function lookups per interface value. The default is false.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetPrintInterfaceMethods(printMethods bool) {
+	c.process.SetParseInterfaceMethods(printMethods)
+}
+
+// SetPrintConstantNames sets whether to print the name of the package-level constant along with the integer value
+// if the constant has the same type and value. Untyped constants have the default type, such as int. The default is false.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetPrintConstantNames(printNames bool) {
+	c.process.SetParseConstantNames(printNames)
+}
+
+// SetInvalidPointerThreshold sets the address below which the pointer is printed as invalid rather than dereferenced.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetInvalidPointerThreshold(threshold uint64) {
+	c.process.SetInvalidPointerThreshold(threshold)
+}
+
+// SetMaxPointerDepth sets the max number of the pointer indirections followed when the args are parsed, such as 3 for `***T`.
+// The pointer beyond the limit is printed as the address. Unlike the parse level, the struct nesting doesn't count.
+// 0 means no limit, which is the default. It must be called after the tracee is launched or attached.
+func (c *Controller) SetMaxPointerDepth(depth int) {
+	c.process.SetMaxPointerDepth(depth)
+}
+
+// SetUnsafePointerHint declares the type the unsafe.Pointer field or parameter points to, so that the pointed value is printed
+// rather than the address. For example, SetUnsafePointerHint("main.X", "data", "main.Foo") prints the `data` field of the
+// main.X struct as `*main.Foo`. The owner is the function name if the name is the parameter.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetUnsafePointerHint(owner, name, typeName string) error {
+	return c.process.SetUnsafePointerHint(owner, name, typeName)
+}
+
+// SetMaxStringLen sets the max number of the bytes printed for the string arg. The longer string is truncated,
+// such as `"abc"...`, and only the printed part is read from the tracee. 0 means no limit, which is the default,
+// though the string longer than 1 MiB is truncated anyway. It must be called after the tracee is launched or attached.
+func (c *Controller) SetMaxStringLen(maxLen int) {
+	c.process.SetMaxStringLen(maxLen)
+}
+
+// SetMapLenOnly sets whether to print only the number of the entries of the map arg, such as `map[string]int(len 3)`.
+// It reads just the map header and so is much cheaper than reading the entries of the large map. The default is false.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetMapLenOnly(lenOnly bool) {
+	c.process.SetMapLenOnly(lenOnly)
+}
+
+// SetMaxFieldsToPrint sets the max number of the fields printed for the struct arg and the entries for the map arg,
+// so that the giant struct, such as the runtime's one, doesn't flood the output. The rest are abbreviated, such as `{a: 1, ...}`.
+// The default is 32 and 0 means no limit. It must be called after the tracee is launched or attached.
+func (c *Controller) SetMaxFieldsToPrint(maxFields int) {
+	c.process.SetMaxFieldsToPrint(maxFields)
+}
+
+// SetByteArrayFormat sets how the byte array arg, such as the hash or UUID of `[16]byte`, is printed.
+// The default is tracee.ByteArrayFormatDecimal, the list of the integers like the other arrays.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetByteArrayFormat(format tracee.ByteArrayFormat) {
+	c.process.SetByteArrayFormat(format)
+}
+
+// SetMaxLinkedNodes sets the max number of the nodes printed when the arg is the pointer to the linked list or tree.
+// The list is printed as the sequence, such as `[{val: 1} -> {val: 2}]`, and the tree is printed with the nested nodes.
+// Unlike the parse level, following the link fields doesn't decrement the depth. 0 disables the traversal, which is the default.
+// It must be called after the tracee is launched or attached.
+func (c *Controller) SetMaxLinkedNodes(maxNodes int) {
+	c.process.SetMaxLinkedNodes(maxNodes)
+}
+
+// SetLinkFields sets the names of the fields followed by the traversal. See SetMaxLinkedNodes.
+// The default is `next`, `left` and `right`. It must be called after the tracee is launched or attached.
+func (c *Controller) SetLinkFields(names []string) {
+	c.process.SetLinkFields(names)
+}
+
+// SetMaxDuration sets the max time the main loop traces the tracee. The main loop is interrupted
+// when the duration elapses. 0 means no limit, which is the default.
+func (c *Controller) SetMaxDuration(d time.Duration) {
+	c.maxDuration = d
+}
+
 // MainLoop repeatedly lets the tracee continue and then wait an event. It returns ErrInterrupted error if
-// the trace ends due to the interrupt.
+// the trace ends due to the interrupt, including the one caused by the max duration.
 func (c *Controller) MainLoop() error {
-	defer c.process.Detach() // the connection status is unknown at this point
+	defer c.detach()
+	defer c.drainOutput()
+	defer c.writeCollapsedStacks()
+	defer c.exportSpans()
+	// Closed after the pending requests are rejected, so that the requests sent after that don't wait forever.
+	defer close(c.mainLoopDoneCh)
+	defer c.rejectPendingArgsRequests()
+	defer c.rejectPendingCallerRequests()
+	defer c.rejectPendingInspectRequests()
+
+	if c.maxDuration > 0 {
+		// As with Interrupt, the main loop stops when the tracee is trapped next time and the breakpoints are cleared on detach.
+		timer := time.AfterFunc(c.maxDuration, c.Interrupt)
+		defer timer.Stop()
+	}
 
 	event, err := c.continueAndWait()
 	if err == ErrInterrupted {
@@ -166,6 +970,8 @@ func (c *Controller) MainLoop() error {
 			return errors.New("the process exited due to core dump")
 		case debugapi.EventTypeTerminated:
 			return fmt.Errorf("the process exited due to signal %d", event.Data.(int))
+		case debugapi.EventTypeExec:
+			return ErrExecuted
 		case debugapi.EventTypeTrapped:
 			trappedThreadIDs := event.Data.([]int)
 			event, err = c.handleTrapEvent(trappedThreadIDs)
@@ -190,15 +996,61 @@ func (c *Controller) continueAndWait() (debugapi.Event, error) {
 		if err := c.setPendingTracePoints(); err != nil {
 			return debugapi.Event{}, err
 		}
+		c.handlePauseTracingRequests()
+		c.handlePendingArgsRequests()
+		c.handlePendingCallerRequests()
+		c.handlePendingInspectRequests()
+
+		c.setState(StateRunning)
+		event, err := c.process.ContinueAndWait()
+		if debugapi.IsExitEvent(event.Type) {
+			c.setState(StateExited)
+		} else {
+			c.setState(StateStopped)
+		}
+		return event, err
+	}
+}
 
-		return c.process.ContinueAndWait()
+func (c *Controller) detach() {
+	c.process.Detach() // the connection status is unknown at this point
+	if c.State() != StateExited {
+		c.setState(StateDetached)
 	}
 }
 
+// State returns the current run state of the tracee. It can be called while the main loop is running.
+func (c *Controller) State() State {
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+	return c.state
+}
+
+func (c *Controller) setState(state State) {
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+	c.state = state
+}
+
 func (c *Controller) setPendingTracePoints() error {
+	if err := c.handleClearAllTracePoints(); err != nil {
+		return err
+	}
+
+	if err := c.setSyscallBreakpoints(); err != nil {
+		return err
+	}
+
+	if err := c.setMallocBreakpoint(); err != nil {
+		return err
+	}
+
 	for {
 		select {
-		case startAddr := <-c.pendingStartTracePoint:
+		case startPoint := <-c.pendingStartTracePoint:
+			startAddr := startPoint.addr
+			c.tracingPoints.SetHitLimit(startAddr, startPoint.hitLimit)
+			c.tracingPoints.SetCallerFilter(startAddr, startPoint.caller)
 			if c.tracingPoints.IsStartAddress(startAddr) {
 				continue // set already
 			}
@@ -224,20 +1076,375 @@ func (c *Controller) setPendingTracePoints() error {
 	}
 }
 
-func (c *Controller) handleTrapEvent(trappedThreadIDs []int) (debugapi.Event, error) {
-	for i := 0; i < len(trappedThreadIDs); i++ {
-		threadID := trappedThreadIDs[i]
-		if err := c.handleTrapEventOfThread(threadID); err != nil {
-			return debugapi.Event{}, fmt.Errorf("failed to handle trap event (thread id: %d): %v", threadID, err)
+func (c *Controller) handleClearAllTracePoints() error {
+	for {
+		select {
+		case <-c.clearAllTracePointsCh:
+			if err := c.clearAllTracePoints(); err != nil {
+				return err
+			}
+		default:
+			return nil // no data
+		}
+	}
+}
+
+func (c *Controller) clearAllTracePoints() error {
+	for _, goRoutineID := range append([]int64(nil), c.tracingPoints.goRoutinesInside...) {
+		if err := c.breakpoints.ClearAllByGoRoutineID(goRoutineID); err != nil {
+			return err
+		}
+		delete(c.statusStore, goRoutineID)
+		c.tracingPoints.ExitAll(goRoutineID)
+	}
+
+	for _, addr := range append(c.tracingPoints.startAddressList, c.tracingPoints.endAddressList...) {
+		if err := c.breakpoints.Clear(addr); err != nil {
+			return err
+		}
+	}
+	c.tracingPoints.startAddressList = nil
+	c.tracingPoints.endAddressList = nil
+	c.tracingPoints.remainingHits = nil
+	c.tracingPoints.callerFilters = nil
+	return nil
+}
+
+// setSyscallBreakpoints sets the breakpoints at the beginning of the syscall functions if the syscall tracing is enabled.
+// The breakpoints are set again if cleared, for example, when the go routine exits the tracing range.
+func (c *Controller) setSyscallBreakpoints() error {
+	if !c.traceSyscalls {
+		return nil
+	}
+
+	if c.syscallFuncAddrs == nil {
+		c.syscallFuncAddrs = []uint64{}
+		for _, funcName := range syscallFuncNames {
+			f, err := c.process.FindFunctionByName(funcName)
+			if err != nil {
+				log.Debugf("failed to find %s: %v", funcName, err)
+				continue
+			}
+			c.syscallFuncAddrs = append(c.syscallFuncAddrs, f.StartAddr)
+		}
+	}
+
+	for _, addr := range c.syscallFuncAddrs {
+		if c.breakpoints.Exist(addr) {
+			continue
+		}
+		if err := c.breakpoints.Set(addr); err != nil {
+			return err
+		}
+		c.breakpointTypes[addr] = breakpointTypeSyscall
+	}
+	return nil
+}
+
+// setMallocBreakpoint sets the breakpoint at the beginning of runtime.mallocgc if the allocation tracing is enabled.
+// The breakpoint is set again if cleared, like the syscall breakpoints.
+func (c *Controller) setMallocBreakpoint() error {
+	if !c.traceAllocations {
+		return nil
+	}
+
+	if c.mallocFuncAddr == 0 {
+		addr, err := c.process.RuntimeFunctionAddr(tracee.MallocFuncName)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %v", tracee.MallocFuncName, err)
+		}
+		c.mallocFuncAddr = addr
+	}
+
+	if c.breakpoints.Exist(c.mallocFuncAddr) {
+		return nil
+	}
+	if err := c.breakpoints.Set(c.mallocFuncAddr); err != nil {
+		return err
+	}
+	c.breakpointTypes[c.mallocFuncAddr] = breakpointTypeMalloc
+	return nil
+}
+
+func (c *Controller) handlePauseTracingRequests() {
+	for {
+		select {
+		case paused := <-c.pauseTracingCh:
+			if paused != c.tracingPaused {
+				log.Debugf("tracing paused: %v", paused)
+			}
+			c.tracingPaused = paused
+		default:
+			return // no data
+		}
+	}
+}
+
+func (c *Controller) handlePendingArgsRequests() {
+	for {
+		select {
+		case resultCh := <-c.pendingArgsRequest:
+			args, err := c.currentArguments()
+			resultCh <- currentArgsResult{args: args, err: err}
+		default:
+			return // no data
+		}
+	}
+}
+
+func (c *Controller) rejectPendingArgsRequests() {
+	for {
+		select {
+		case resultCh := <-c.pendingArgsRequest:
+			resultCh <- currentArgsResult{err: errors.New("the tracer is not running")}
+		default:
+			return // no data
+		}
+	}
+}
+
+func (c *Controller) currentArguments() ([]Argument, error) {
+	stackFrame, err := c.lastTrappedStackFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	if !stackFrame.Function.FrameBaseIsCFA {
+		return nil, fmt.Errorf("the parameter values of %s are not available", stackFrame.Function.Name)
+	}
+
+	var args []Argument
+	for _, arg := range stackFrame.InputArguments {
+		currArg := Argument{Name: arg.Name}
+		if arg.Typ != nil {
+			currArg.Type = arg.Typ.String()
+		}
+		arg.Name = "" // to get only the value
+		currArg.Value = arg.ParseValue(c.parseLevel)
+		args = append(args, currArg)
+	}
+	return args, nil
+}
+
+func (c *Controller) handlePendingCallerRequests() {
+	for {
+		select {
+		case resultCh := <-c.pendingCallerRequest:
+			pc, funcName, err := c.callerPC()
+			resultCh <- callerResult{pc: pc, funcName: funcName, err: err}
+		default:
+			return // no data
+		}
+	}
+}
+
+// handlePendingInspectRequests handles the requests of the registers, memory, defer chain and parameter.
+func (c *Controller) handlePendingInspectRequests() {
+	for {
+		select {
+		case resultCh := <-c.pendingRegsRequest:
+			resultCh <- c.currentRegisters()
+		case req := <-c.pendingMemoryRequest:
+			req.resultCh <- c.readMemory(req.addr, req.size)
+		case resultCh := <-c.pendingDeferRequest:
+			resultCh <- c.deferChain()
+		case req := <-c.pendingParamRequest:
+			req.resultCh <- c.readParameter(req.name)
+		default:
+			return // no data
+		}
+	}
+}
+
+func (c *Controller) rejectPendingInspectRequests() {
+	for {
+		select {
+		case resultCh := <-c.pendingRegsRequest:
+			resultCh <- registersResult{err: errors.New("the tracer is not running")}
+		case req := <-c.pendingMemoryRequest:
+			req.resultCh <- memoryResult{err: errors.New("the tracer is not running")}
+		case resultCh := <-c.pendingDeferRequest:
+			resultCh <- deferChainResult{err: errors.New("the tracer is not running")}
+		case req := <-c.pendingParamRequest:
+			req.resultCh <- paramResult{err: errors.New("the tracer is not running")}
+		default:
+			return // no data
+		}
+	}
+}
+
+func (c *Controller) currentRegisters() registersResult {
+	goRoutineInfo, err := c.process.CurrentGoRoutineInfo(c.lastTrappedThreadID)
+	if err != nil {
+		return registersResult{err: err}
+	}
+	return registersResult{regs: goRoutineInfo.Registers}
+}
+
+func (c *Controller) readMemory(addr uint64, size int) memoryResult {
+	data := make([]byte, size)
+	if err := c.process.ReadMemory(addr, data); err != nil {
+		return memoryResult{err: err}
+	}
+	return memoryResult{data: data}
+}
+
+func (c *Controller) readParameter(name string) paramResult {
+	stackFrame, err := c.lastTrappedStackFrame()
+	if err != nil {
+		return paramResult{err: err}
+	}
+
+	if !stackFrame.Function.FrameBaseIsCFA {
+		return paramResult{err: fmt.Errorf("the parameter values of %s are not available", stackFrame.Function.Name)}
+	}
+
+	for _, arg := range append(stackFrame.InputArguments, stackFrame.OutputArguments...) {
+		if arg.Name == name {
+			arg.Name = "" // to get only the value
+			return paramResult{value: arg.ParseValue(c.parseLevel)}
+		}
+	}
+	return paramResult{err: fmt.Errorf("parameter %s not found in %s", name, stackFrame.Function.Name)}
+}
+
+// deferChain returns the defer chain of the go routine running on the last trapped thread. The functions are ordered
+// as they are called, which is the reverse order of the defer statements.
+func (c *Controller) deferChain() deferChainResult {
+	funcs, err := c.process.DeferChain(c.lastTrappedThreadID)
+	if err != nil {
+		return deferChainResult{err: err}
+	}
+
+	var funcNames []string
+	for _, function := range funcs {
+		funcNames = append(funcNames, function.Name)
+	}
+	return deferChainResult{funcNames: funcNames}
+}
+
+// waitResume keeps the tracee stopped and handles the requests until Resume or Interrupt is called.
+func (c *Controller) waitResume() error {
+	c.setState(StatePaused)
+	defer c.setState(StateStopped)
+
+	for {
+		select {
+		case <-c.resumeCh:
+			return nil
+		case <-c.interruptCh:
+			return ErrInterrupted
+		case resultCh := <-c.pendingArgsRequest:
+			args, err := c.currentArguments()
+			resultCh <- currentArgsResult{args: args, err: err}
+		case resultCh := <-c.pendingCallerRequest:
+			pc, funcName, err := c.callerPC()
+			resultCh <- callerResult{pc: pc, funcName: funcName, err: err}
+		case resultCh := <-c.pendingRegsRequest:
+			resultCh <- c.currentRegisters()
+		case req := <-c.pendingMemoryRequest:
+			req.resultCh <- c.readMemory(req.addr, req.size)
+		case resultCh := <-c.pendingDeferRequest:
+			resultCh <- c.deferChain()
+		case req := <-c.pendingParamRequest:
+			req.resultCh <- c.readParameter(req.name)
+		}
+	}
+}
+
+func (c *Controller) rejectPendingCallerRequests() {
+	for {
+		select {
+		case resultCh := <-c.pendingCallerRequest:
+			resultCh <- callerResult{err: errors.New("the tracer is not running")}
+		default:
+			return // no data
+		}
+	}
+}
+
+func (c *Controller) callerPC() (uint64, string, error) {
+	stackFrame, err := c.lastTrappedStackFrame()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return stackFrame.ReturnAddress, c.funcNameAt(stackFrame.ReturnAddress), nil
+}
+
+// funcNameAt returns the name of the function the pc belongs to. Returns the empty string if not found.
+func (c *Controller) funcNameAt(pc uint64) string {
+	f, err := c.process.FindFunction(pc)
+	if err != nil {
+		return ""
+	}
+	return f.Name
+}
+
+// lastTrappedStackFrame returns the stack frame of the last trapped thread. The frame is read as of the function entry,
+// because the stack pointer and the registers passing the arguments are known only there.
+// So it fails if the thread is neither at the function entry nor trapped at the function entry or prologue end,
+// such as when it's trapped at the line in the middle of the function.
+func (c *Controller) lastTrappedStackFrame() (*tracee.StackFrame, error) {
+	if c.lastTrappedThreadID == 0 {
+		return nil, errors.New("no thread trapped yet")
+	}
+
+	goRoutineInfo, err := c.process.CurrentGoRoutineInfo(c.lastTrappedThreadID)
+	if err != nil {
+		return nil, err
+	} else if goRoutineInfo.OnSystemStack {
+		return nil, errors.New("the last trapped thread is running on the system stack")
+	}
+
+	if c.atFunctionEntry(goRoutineInfo.CurrentPC) {
+		return c.currentStackFrame(goRoutineInfo)
+	}
+	// the thread may have stepped over the breakpoint at the function entry.
+	if trapped, ok := c.trappedGoRoutines[c.lastTrappedThreadID]; ok && trapped.ID == goRoutineInfo.ID && c.atFunctionEntry(trapped.CurrentPC) {
+		return c.currentStackFrame(trapped)
+	}
+	return nil, fmt.Errorf("the stack frame at %#x is unknown: the last trapped thread is not at the function entry", goRoutineInfo.CurrentPC)
+}
+
+// atFunctionEntry returns true if the pc is the start address of the function.
+func (c *Controller) atFunctionEntry(pc uint64) bool {
+	f, err := c.process.FindFunction(pc)
+	return err == nil && f.StartAddr == pc
+}
+
+func (c *Controller) handleTrapEvent(trappedThreadIDs []int) (debugapi.Event, error) {
+	if err := c.handleTrappedThreads(trappedThreadIDs); err != nil {
+		return debugapi.Event{}, err
+	}
+
+	if c.breakThreadID != 0 {
+		// the requests while paused are about the thread which hit the start trace point.
+		c.lastTrappedThreadID, c.breakThreadID = c.breakThreadID, 0
+		c.breakHit = true
+		if err := c.waitResume(); err != nil {
+			return debugapi.Event{}, err
 		}
 	}
 
 	return c.continueAndWait()
 }
 
+func (c *Controller) handleTrappedThreads(trappedThreadIDs []int) error {
+	c.trappedGoRoutines = make(map[int]tracee.GoRoutineInfo)
+	for i := 0; i < len(trappedThreadIDs); i++ {
+		threadID := trappedThreadIDs[i]
+		c.lastTrappedThreadID = threadID
+		if err := c.handleTrapEventOfThread(threadID); err != nil {
+			return fmt.Errorf("failed to handle trap event (thread id: %d): %v", threadID, err)
+		}
+	}
+	return nil
+}
+
 func (c *Controller) handleTrapEventOfThread(threadID int) error {
 	goRoutineInfo, err := c.process.CurrentGoRoutineInfo(threadID)
-	if err != nil || goRoutineInfo.ID == 0 {
+	if err != nil || goRoutineInfo.ID == 0 || goRoutineInfo.OnSystemStack {
 		return c.handleTrappedSystemRoutine(threadID)
 	}
 
@@ -245,18 +1452,47 @@ func (c *Controller) handleTrapEventOfThread(threadID int) error {
 	if !c.breakpoints.Hit(breakpointAddr, goRoutineInfo.ID) {
 		return c.handleTrapAtUnrelatedBreakpoint(threadID, breakpointAddr)
 	}
-
-	if !c.tracingPoints.Inside(goRoutineInfo.ID) {
-		if !c.tracingPoints.IsStartAddress(breakpointAddr) {
+	trapped := goRoutineInfo
+	trapped.CurrentPC = breakpointAddr
+	c.trappedGoRoutines[threadID] = trapped
+
+	if c.tracingPoints.Inside(goRoutineInfo.ID) {
+		if c.tracingPoints.IsStartAddress(breakpointAddr) && c.calledFromFilteredCaller(goRoutineInfo, breakpointAddr) {
+			// enters the nested tracing range.
+			c.tracingPoints.Enter(goRoutineInfo.ID, goRoutineInfo.UsedStackSize)
+		}
+	} else {
+		if !c.tracingPoints.IsStartAddress(breakpointAddr) || c.tracingPaused || !c.calledFromFilteredCaller(goRoutineInfo, breakpointAddr) {
+			return c.handleTrapAtUnrelatedBreakpoint(threadID, breakpointAddr)
+		}
+		sampled := c.sampler.Sample()
+		if err := c.printSamplingInterval(); err != nil {
+			return err
+		}
+		if !sampled {
 			return c.handleTrapAtUnrelatedBreakpoint(threadID, breakpointAddr)
 		}
 		if err := c.enterTracepoint(threadID, goRoutineInfo); err != nil {
 			return err
 		}
+		if c.breakOnFirstHit && !c.breakHit && c.breakThreadID == 0 {
+			c.breakThreadID = threadID
+		}
+		if c.tracingPoints.Hit(breakpointAddr) {
+			if err := c.removeStartTracePoint(breakpointAddr); err != nil {
+				return err
+			}
+			if _, ok := c.breakpointTypes[breakpointAddr]; !ok && !c.tracingPoints.IsEndAddress(breakpointAddr) {
+				return c.handleTrapAtUnrelatedBreakpoint(threadID, breakpointAddr)
+			}
+		}
 	}
 
 	if c.tracingPoints.IsEndAddress(breakpointAddr) {
-		return c.exitTracepoint(threadID, goRoutineInfo.ID, goRoutineInfo.CurrentPC-1)
+		if _, err := c.exitTracepoint(goRoutineInfo, breakpointAddr); err != nil {
+			return err
+		}
+		return c.handleTrapAtUnrelatedBreakpoint(threadID, breakpointAddr)
 	} else if c.tracingPoints.IsStartAddress(breakpointAddr) {
 		// the tracing point may be used as the break point as well. If not, return here.
 		if _, ok := c.breakpointTypes[breakpointAddr]; !ok {
@@ -271,11 +1507,37 @@ func (c *Controller) handleTrapEventOfThread(threadID int) error {
 		return c.handleTrapAtDeferredFuncCall(threadID, goRoutineInfo)
 	case breakpointTypeReturn:
 		return c.handleTrapAfterFunctionReturn(threadID, goRoutineInfo)
+	case breakpointTypePrologueEnd:
+		return c.handleTrapAtPrologueEnd(threadID, goRoutineInfo)
+	case breakpointTypeSyscall:
+		return c.handleTrapAtSyscall(threadID, goRoutineInfo)
+	case breakpointTypeMalloc:
+		return c.handleTrapAtMalloc(threadID, goRoutineInfo)
+	case breakpointTypeDeferReturn:
+		return c.handleTrapAtDeferReturn(threadID, goRoutineInfo)
+	case breakpointTypeReturnInst:
+		return c.handleTrapAtReturnInst(threadID, goRoutineInfo)
 	default:
 		return fmt.Errorf("unknown breakpoint: %#x", breakpointAddr)
 	}
 }
 
+// calledFromFilteredCaller returns true if the go routine trapped at the start address is called from
+// the caller set by AddStartTracePointWithCaller. Always true if no caller is set.
+func (c *Controller) calledFromFilteredCaller(goRoutineInfo tracee.GoRoutineInfo, startAddr uint64) bool {
+	caller := c.tracingPoints.CallerFilter(startAddr)
+	if caller == "" {
+		return true
+	}
+
+	stackFrame, err := c.currentStackFrame(goRoutineInfo)
+	if err != nil {
+		log.Debugf("failed to get the stack frame to find the caller: %v", err)
+		return false
+	}
+	return c.funcNameAt(stackFrame.ReturnAddress) == caller
+}
+
 func (c *Controller) enterTracepoint(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
 	goRoutineID := goRoutineInfo.ID
 
@@ -288,23 +1550,37 @@ func (c *Controller) enterTracepoint(threadID int, goRoutineInfo tracee.GoRoutin
 			return err
 		}
 
-		c.tracingPoints.Enter(goRoutineID)
+		c.tracingPoints.Enter(goRoutineID, goRoutineInfo.UsedStackSize)
 	}
 
 	// not single step here, because tracing point may be used as breakpoint as well.
 	return nil
 }
 
-func (c *Controller) exitTracepoint(threadID int, goRoutineID int64, breakpointAddr uint64) error {
-	if c.tracingPoints.Inside(goRoutineID) {
-		if err := c.breakpoints.ClearAllByGoRoutineID(goRoutineID); err != nil {
-			return err
-		}
+// removeStartTracePoint removes the start trace point. The go routines which are inside the tracing point are still traced.
+func (c *Controller) removeStartTracePoint(startAddr uint64) error {
+	c.tracingPoints.RemoveStartAddress(startAddr)
+	if _, ok := c.breakpointTypes[startAddr]; ok || c.tracingPoints.IsEndAddress(startAddr) {
+		return nil // the breakpoint is still used
+	}
+	return c.breakpoints.Clear(startAddr)
+}
 
-		c.tracingPoints.Exit(goRoutineID)
+// exitTracepoint exits the tracing ranges the end point closes (see tracingPoints.Exit).
+// It returns true if the go routine exits the outermost range and so is not traced anymore.
+func (c *Controller) exitTracepoint(goRoutineInfo tracee.GoRoutineInfo, endAddr uint64) (bool, error) {
+	goRoutineID := goRoutineInfo.ID
+	if !c.tracingPoints.Inside(goRoutineID) {
+		return false, nil
 	}
 
-	return c.handleTrapAtUnrelatedBreakpoint(threadID, breakpointAddr)
+	function, err := c.process.FindFunction(endAddr)
+	atFunctionEntry := err == nil && function.StartAddr == endAddr
+	// the tracing continues until the go routine exits the outermost tracing range.
+	if !c.tracingPoints.Exit(goRoutineID, goRoutineInfo.UsedStackSize, atFunctionEntry) {
+		return false, nil
+	}
+	return true, c.breakpoints.ClearAllByGoRoutineID(goRoutineID)
 }
 
 func (c *Controller) setCallInstBreakpoints(goRoutineID int64, pc uint64) error {
@@ -354,6 +1630,62 @@ func (c *Controller) setDeferredFuncBreakpoints(goRoutineInfo tracee.GoRoutineIn
 	return nil
 }
 
+func (c *Controller) handleTrapAtSyscall(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
+	breakpointAddr := goRoutineInfo.CurrentPC - 1
+	stackFrame, err := c.currentStackFrame(goRoutineInfo)
+	if err != nil {
+		return err
+	}
+
+	// On go 1.19 or later, syscall.Syscall calls syscall.RawSyscall6 and so on. Print only the outermost call.
+	if c.calledFromSyscallFunc(stackFrame.ReturnAddress) {
+		return c.process.SingleStep(threadID, breakpointAddr)
+	}
+
+	depth := len(c.statusStore[goRoutineInfo.ID].callingFunctions) + 1
+	if c.maxPrintDepth <= 0 || depth <= c.maxPrintDepth {
+		if err := c.printSyscall(goRoutineInfo.ID, stackFrame, depth); err != nil {
+			return err
+		}
+	}
+
+	return c.process.SingleStep(threadID, breakpointAddr)
+}
+
+// calledFromSyscallFunc returns true if the return address is inside the syscall function.
+func (c *Controller) calledFromSyscallFunc(returnAddr uint64) bool {
+	caller, err := c.process.FindFunction(returnAddr)
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range c.syscallFuncAddrs {
+		if addr == caller.StartAddr {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) handleTrapAtMalloc(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
+	breakpointAddr := goRoutineInfo.CurrentPC - 1
+	callingFunctions := c.statusStore[goRoutineInfo.ID].callingFunctions
+	depth := len(callingFunctions) + 1
+	if len(callingFunctions) > 0 && (c.maxPrintDepth <= 0 || depth <= c.maxPrintDepth) {
+		alloc, err := c.process.Allocation(goRoutineInfo)
+		if err != nil {
+			return err
+		}
+
+		caller := callingFunctions[len(callingFunctions)-1].Function
+		if err := c.printAllocation(goRoutineInfo.ID, caller, depth, alloc); err != nil {
+			return err
+		}
+	}
+
+	return c.process.SingleStep(threadID, breakpointAddr)
+}
+
 func (c *Controller) handleTrappedSystemRoutine(threadID int) error {
 	threadInfo, err := c.process.CurrentThreadInfo(threadID)
 	if err != nil {
@@ -388,17 +1720,22 @@ func (c *Controller) handleTrapBeforeFunctionCall(threadID int, goRoutineInfo tr
 	}
 
 	if c.tracingPoints.IsEndAddress(goRoutineInfo.CurrentPC) {
-		return c.exitTracepoint(threadID, goRoutineInfo.ID, goRoutineInfo.CurrentPC)
+		if exited, err := c.exitTracepoint(goRoutineInfo, goRoutineInfo.CurrentPC); err != nil {
+			return err
+		} else if exited {
+			return c.handleTrapAtUnrelatedBreakpoint(threadID, goRoutineInfo.CurrentPC)
+		}
 	}
 
-	return c.handleTrapAtFunctionCall(threadID, goRoutineInfo.CurrentPC, goRoutineInfo)
+	return c.handleTrapAtFunctionCall(threadID, goRoutineInfo.CurrentPC, goRoutineInfo, false)
 }
 
 // handleTrapAtFunctionCall handles the trapped event at the function call.
 // It needs `breakpointAddr` though it's usually same as the function's start address.
 // It is because some function, such as runtime.duffzero, directly jumps to the middle of the function and
 // the breakpoint address is not explicit in that case.
-func (c *Controller) handleTrapAtFunctionCall(threadID int, breakpointAddr uint64, goRoutineInfo tracee.GoRoutineInfo) error {
+// `deferred` should be true if the function is called as the deferred function.
+func (c *Controller) handleTrapAtFunctionCall(threadID int, breakpointAddr uint64, goRoutineInfo tracee.GoRoutineInfo, deferred bool) error {
 	status, _ := c.statusStore[goRoutineInfo.ID]
 	stackFrame, err := c.currentStackFrame(goRoutineInfo)
 	if err != nil {
@@ -418,11 +1755,24 @@ func (c *Controller) handleTrapAtFunctionCall(threadID int, breakpointAddr uint6
 		currStackDepth -= c.countSkippedFuncs(status.callingFunctions, goRoutineInfo.PanicHandler.UsedStackSizeAtDefer)
 	}
 
+	// The C function runs on the system stack and so the call instructions inside are not traced.
+	cgoCall := stackFrame.Function.Name == tracee.CgoCallFuncName
+
+	merged := c.mergeRecursiveCalls && isRecursiveCall(remainingFuncs, stackFrame.Function)
+	if merged {
+		countMergedCall(remainingFuncs)
+	}
+
+	c.lastCallID++
 	callingFunc := callingFunction{
 		Function:               stackFrame.Function,
+		callID:                 c.lastCallID,
 		returnAddress:          stackFrame.ReturnAddress,
 		usedStackSize:          goRoutineInfo.UsedStackSize,
-		setCallInstBreakpoints: currStackDepth < c.traceLevel,
+		setCallInstBreakpoints: currStackDepth < c.traceLevel && !cgoCall,
+		deferred:               deferred,
+		merged:                 merged,
+		enteredWhilePaused:     c.tracingPaused,
 	}
 	remainingFuncs, err = c.appendFunction(remainingFuncs, callingFunc, goRoutineInfo.ID)
 	if err != nil {
@@ -433,21 +1783,100 @@ func (c *Controller) handleTrapAtFunctionCall(threadID int, breakpointAddr uint6
 		return err
 	}
 
-	if currStackDepth <= c.traceLevel && c.printableFunc(stackFrame.Function) {
-		if err := c.printFunctionInput(goRoutineInfo.ID, stackFrame, currStackDepth); err != nil {
+	// the function called before the prologue end (e.g. runtime.morestack) should not discard the pending input.
+	pendingInput := status.pendingInput
+	depthMarkerPrinted := status.depthMarkerPrinted
+	if cgoCall && currStackDepth <= c.traceLevel && !c.exceedsMaxPrintDepth(goRoutineInfo.ID, currStackDepth, &depthMarkerPrinted) {
+		if err := c.printCgoCall(goRoutineInfo.ID, stackFrame, currStackDepth, c.cgoCallee(goRoutineInfo)); err != nil {
+			return err
+		}
+	} else if !merged && !c.tracingPaused && currStackDepth <= c.traceLevel && c.printableFunc(stackFrame.Function) && !c.exceedsMaxPrintDepth(goRoutineInfo.ID, currStackDepth, &depthMarkerPrinted) {
+		prologueEndAddr := c.findPrologueEndAddr(stackFrame.Function)
+		if prologueEndAddr != 0 {
+			if err := c.breakpoints.SetConditional(prologueEndAddr, goRoutineInfo.ID); err != nil {
+				return err
+			}
+			c.breakpointTypes[prologueEndAddr] = breakpointTypePrologueEnd
+			pendingInput = &pendingFunctionInput{function: stackFrame.Function, callID: callingFunc.callID, usedStackSize: goRoutineInfo.UsedStackSize, depth: currStackDepth, deferred: deferred}
+		} else if err := c.printFunctionInput(goRoutineInfo.ID, callingFunc.callID, stackFrame, currStackDepth, deferred, goRoutineInfo.PanicValue); err != nil {
 			return err
 		}
+
+		if c.readResultsAtReturnInst {
+			addrs, err := c.setReturnInstBreakpoints(goRoutineInfo.ID, stackFrame.Function)
+			if err != nil {
+				return err
+			}
+			remainingFuncs[len(remainingFuncs)-1].returnInstBreakpoints = addrs
+		}
 	}
 
 	if err := c.process.SingleStep(threadID, breakpointAddr); err != nil {
 		return err
 	}
 
-	c.statusStore[goRoutineInfo.ID] = goRoutineStatus{callingFunctions: remainingFuncs}
+	c.statusStore[goRoutineInfo.ID] = goRoutineStatus{callingFunctions: remainingFuncs, pendingInput: pendingInput, depthMarkerPrinted: depthMarkerPrinted}
 	return nil
 }
 
-func (c *Controller) countSkippedFuncs(callingFuncs []callingFunction, usedStackSize uint64) int {
+// findPrologueEndAddr returns the address to which the breakpoint is set to read the input arguments.
+// It returns 0 if the arguments should be read at the function entry.
+func (c *Controller) findPrologueEndAddr(f *tracee.Function) uint64 {
+	if !c.skipPrologue {
+		return 0
+	}
+
+	addr, ok := c.prologueEndAddrCache[f.StartAddr]
+	if !ok {
+		var err error
+		addr, err = c.process.PrologueEndAddr(f)
+		if err != nil {
+			log.Debugf("failed to find the prologue end: %v", err)
+			addr = 0
+		}
+		c.prologueEndAddrCache[f.StartAddr] = addr
+	}
+
+	if addr == f.StartAddr {
+		return 0
+	}
+	if typ, ok := c.breakpointTypes[addr]; ok && typ != breakpointTypePrologueEnd {
+		return 0 // the address is used for another purpose
+	}
+	return addr
+}
+
+func (c *Controller) handleTrapAtPrologueEnd(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
+	breakpointAddr := goRoutineInfo.CurrentPC - 1
+
+	status, _ := c.statusStore[goRoutineInfo.ID]
+	if input := status.pendingInput; input != nil {
+		// The stack may be copied after the function entry (e.g. runtime.morestack), but the used stack size at that time
+		// is not changed. So calculate the stack address at the function entry from it.
+		// The prologue doesn't change the registers passing the arguments, so the current ones can be used.
+		stackAddr := goRoutineInfo.CurrentStackAddr + (goRoutineInfo.UsedStackSize - input.usedStackSize)
+		stackFrame, err := c.process.StackFrameWithRegisters(stackAddr, input.function.StartAddr, goRoutineInfo.Registers)
+		if err != nil {
+			return err
+		}
+		entry := goRoutineInfo
+		entry.CurrentPC, entry.CurrentStackAddr = input.function.StartAddr, stackAddr
+		c.trappedGoRoutines[threadID] = entry
+		if err := c.printFunctionInput(goRoutineInfo.ID, input.callID, stackFrame, input.depth, input.deferred, goRoutineInfo.PanicValue); err != nil {
+			return err
+		}
+
+		status.pendingInput = nil
+		c.statusStore[goRoutineInfo.ID] = status
+	}
+
+	if err := c.process.SingleStep(threadID, breakpointAddr); err != nil {
+		return err
+	}
+	return c.breakpoints.ClearConditional(breakpointAddr, goRoutineInfo.ID)
+}
+
+func (c *Controller) countSkippedFuncs(callingFuncs []callingFunction, usedStackSize uint64) int {
 	for i := len(callingFuncs) - 1; i >= 0; i-- {
 		if callingFuncs[i].usedStackSize < usedStackSize {
 			return len(callingFuncs) - 1 - i
@@ -472,18 +1901,73 @@ func (c *Controller) unwindFunctions(callingFuncs []callingFunction, goRoutineIn
 			}
 		}
 
-		unwindFunc := callingFuncs[i]
-		if err := c.breakpoints.ClearConditional(unwindFunc.returnAddress, goRoutineInfo.ID); err != nil {
+		if err := c.clearFunctionBreakpoints(callingFuncs[i], goRoutineInfo.ID); err != nil {
 			return nil, nil, err
 		}
+	}
+	return nil, callingFuncs, nil
+}
 
-		if unwindFunc.setCallInstBreakpoints {
-			if err := c.clearCallInstBreakpoints(goRoutineInfo.ID, unwindFunc.StartAddr); err != nil {
-				return nil, nil, err
+// clearFunctionBreakpoints clears the breakpoints set when the function is called.
+func (c *Controller) clearFunctionBreakpoints(unwindFunc callingFunction, goRoutineID int64) error {
+	if err := c.breakpoints.ClearConditional(unwindFunc.returnAddress, goRoutineID); err != nil {
+		return err
+	}
+
+	for _, addr := range unwindFunc.returnInstBreakpoints {
+		if err := c.breakpoints.ClearConditional(addr, goRoutineID); err != nil {
+			return err
+		}
+	}
+
+	if unwindFunc.setCallInstBreakpoints {
+		return c.clearCallInstBreakpoints(goRoutineID, unwindFunc.StartAddr)
+	}
+	return nil
+}
+
+// setReturnInstBreakpoints sets the breakpoints at the return instructions of the function for the go routine.
+// It returns the addresses the breakpoints are set at. The address used for another purpose, such as the return
+// address of the call just before, is skipped.
+func (c *Controller) setReturnInstBreakpoints(goRoutineID int64, f *tracee.Function) ([]uint64, error) {
+	addrs, err := c.findReturnInstAddresses(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var setAddrs []uint64
+	for _, addr := range addrs {
+		if typ, ok := c.breakpointTypes[addr]; ok && typ != breakpointTypeReturnInst {
+			continue
+		}
+		if err := c.breakpoints.SetConditional(addr, goRoutineID); err != nil {
+			return nil, err
+		}
+		c.breakpointTypes[addr] = breakpointTypeReturnInst
+		setAddrs = append(setAddrs, addr)
+	}
+	return setAddrs, nil
+}
+
+// handleTrapAtReturnInst reads the results of the function which is about to return. At the return instruction,
+// the stack pointer is same as the one at the function entry, so the stack frame is read in the same way.
+func (c *Controller) handleTrapAtReturnInst(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
+	breakpointAddr := goRoutineInfo.CurrentPC - 1
+
+	status, _ := c.statusStore[goRoutineInfo.ID]
+	if n := len(status.callingFunctions); n > 0 {
+		// the untracked recursive call may hit the breakpoint too. The used stack size tells which call returns.
+		if lastFunc := &status.callingFunctions[n-1]; lastFunc.usedStackSize == goRoutineInfo.UsedStackSize {
+			stackFrame, err := c.process.StackFrameWithRegisters(goRoutineInfo.CurrentStackAddr, lastFunc.StartAddr, goRoutineInfo.Registers)
+			if err != nil {
+				return err
 			}
+			lastFunc.resultFrame = stackFrame
+			c.statusStore[goRoutineInfo.ID] = status
 		}
 	}
-	return nil, callingFuncs, nil
+
+	return c.process.SingleStep(threadID, breakpointAddr)
 }
 
 func (c *Controller) appendFunction(callingFuncs []callingFunction, newFunc callingFunction, goRoutineID int64) ([]callingFunction, error) {
@@ -506,13 +1990,88 @@ func (c *Controller) appendFunction(callingFuncs []callingFunction, newFunc call
 }
 
 func (c *Controller) handleTrapAtDeferredFuncCall(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
-	if err := c.handleTrapAtFunctionCall(threadID, goRoutineInfo.CurrentPC-1, goRoutineInfo); err != nil {
+	if goRoutineInfo.Panicking {
+		// the deferred function may recover and then the functions the panic passed through never return.
+		if err := c.setDeferReturnBreakpoint(goRoutineInfo.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := c.handleTrapAtFunctionCall(threadID, goRoutineInfo.CurrentPC-1, goRoutineInfo, true); err != nil {
 		return err
 	}
 
 	return c.breakpoints.ClearConditional(goRoutineInfo.CurrentPC-1, goRoutineInfo.ID)
 }
 
+// setDeferReturnBreakpoint sets the breakpoint at the beginning of runtime.deferreturn for the panicking go routine,
+// so that the functions unwound by the panic are popped when the go routine recovers.
+func (c *Controller) setDeferReturnBreakpoint(goRoutineID int64) error {
+	if c.deferReturnFuncAddr == 0 {
+		addr, err := c.process.RuntimeFunctionAddr(deferReturnFuncName)
+		if err != nil {
+			// the unwound functions are popped when the next function is called or returns.
+			log.Debugf("failed to find %s: %v", deferReturnFuncName, err)
+			return nil
+		}
+		c.deferReturnFuncAddr = addr
+	}
+
+	if c.breakpoints.Hit(c.deferReturnFuncAddr, goRoutineID) {
+		return nil // set already
+	}
+	if err := c.breakpoints.SetConditional(c.deferReturnFuncAddr, goRoutineID); err != nil {
+		return err
+	}
+	c.breakpointTypes[c.deferReturnFuncAddr] = breakpointTypeDeferReturn
+	return nil
+}
+
+func (c *Controller) handleTrapAtDeferReturn(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
+	breakpointAddr := goRoutineInfo.CurrentPC - 1
+	if err := c.unwindPanickedFunctions(goRoutineInfo.ID, goRoutineInfo.UsedStackSize); err != nil {
+		return err
+	}
+
+	if err := c.process.SingleStep(threadID, breakpointAddr); err != nil {
+		return err
+	}
+
+	if goRoutineInfo.Panicking {
+		return nil // the deferred function may call runtime.deferreturn before the recovery.
+	}
+	return c.breakpoints.ClearConditional(breakpointAddr, goRoutineInfo.ID)
+}
+
+// unwindPanickedFunctions pops the functions which are exited via the panic and so never hit the return address.
+// It must be called at the beginning of runtime.deferreturn. The functions called after the one which calls
+// runtime.deferreturn used more stack than the current one.
+//
+// No return line nor OnReturn event is emitted for the popped functions, so their entry lines have no matching
+// return lines. The functions returned after the recovery are printed at their actual depth.
+func (c *Controller) unwindPanickedFunctions(goRoutineID int64, usedStackSize uint64) error {
+	status, _ := c.statusStore[goRoutineID]
+	callingFuncs := status.callingFunctions
+	i := len(callingFuncs)
+	for i > 0 && callingFuncs[i-1].usedStackSize >= usedStackSize {
+		i--
+	}
+
+	for _, unwindFunc := range callingFuncs[i:] {
+		log.Debugf("%s is exited via the panic (#%d)", unwindFunc.Name, goRoutineID)
+		if err := c.clearFunctionBreakpoints(unwindFunc, goRoutineID); err != nil {
+			return err
+		}
+	}
+
+	status.callingFunctions = callingFuncs[0:i]
+	if status.pendingInput != nil && status.pendingInput.usedStackSize >= usedStackSize {
+		status.pendingInput = nil
+	}
+	c.statusStore[goRoutineID] = status
+	return nil
+}
+
 func (c *Controller) handleTrapAfterFunctionReturn(threadID int, goRoutineInfo tracee.GoRoutineInfo) error {
 	status, _ := c.statusStore[goRoutineInfo.ID]
 
@@ -520,19 +2079,45 @@ func (c *Controller) handleTrapAfterFunctionReturn(threadID int, goRoutineInfo t
 	if err != nil {
 		return err
 	}
-	returnedFunc := unwindedFuncs[0].Function
+	returnedFunc, callID := unwindedFuncs[0].Function, unwindedFuncs[0].callID
+	deferred := unwindedFuncs[0].deferred
+	merged, mergedCalls := unwindedFuncs[0].merged, unwindedFuncs[0].mergedCalls
+	enteredWhilePaused := unwindedFuncs[0].enteredWhilePaused
 
 	currStackDepth := len(remainingFuncs) + 1 // include returnedFunc for now
 	if goRoutineInfo.Panicking && goRoutineInfo.PanicHandler != nil {
 		currStackDepth -= c.countSkippedFuncs(remainingFuncs, goRoutineInfo.PanicHandler.UsedStackSizeAtDefer)
 	}
 
-	if currStackDepth <= c.traceLevel && c.printableFunc(returnedFunc) {
-		prevStackFrame, err := c.prevStackFrame(goRoutineInfo, returnedFunc.StartAddr)
-		if err != nil {
+	// the function may return before its prologue end, and then the input is printed just before the output.
+	pendingInput, printPendingInput := status.pendingInput, false
+	if pendingInput != nil && pendingInput.usedStackSize >= unwindedFuncs[0].usedStackSize {
+		if err := c.breakpoints.ClearConditional(c.findPrologueEndAddr(pendingInput.function), goRoutineInfo.ID); err != nil {
 			return err
 		}
-		if err := c.printFunctionOutput(goRoutineInfo.ID, prevStackFrame, currStackDepth); err != nil {
+		printPendingInput = pendingInput.callID == callID
+		pendingInput = nil
+	}
+
+	depthMarkerPrinted := status.depthMarkerPrinted
+	if !merged && !enteredWhilePaused && currStackDepth <= c.traceLevel && c.printableFunc(returnedFunc) && !c.exceedsMaxPrintDepth(goRoutineInfo.ID, currStackDepth, &depthMarkerPrinted) {
+		prevStackFrame := unwindedFuncs[0].resultFrame
+		if prevStackFrame == nil {
+			var err error
+			prevStackFrame, err = c.prevStackFrame(goRoutineInfo, returnedFunc.StartAddr)
+			if err != nil {
+				return err
+			}
+		}
+		if printPendingInput {
+			// the registers hold the results now, so the input arguments are unknown.
+			entryStackFrame := *prevStackFrame
+			entryStackFrame.InputArguments = unknownArguments(prevStackFrame.InputArguments)
+			if err := c.printFunctionInput(goRoutineInfo.ID, callID, &entryStackFrame, currStackDepth, deferred, goRoutineInfo.PanicValue); err != nil {
+				return err
+			}
+		}
+		if err := c.printFunctionOutput(goRoutineInfo.ID, callID, prevStackFrame, currStackDepth, deferred, mergedCalls); err != nil {
 			return err
 		}
 	}
@@ -541,18 +2126,43 @@ func (c *Controller) handleTrapAfterFunctionReturn(threadID int, goRoutineInfo t
 		return err
 	}
 
-	c.statusStore[goRoutineInfo.ID] = goRoutineStatus{callingFunctions: remainingFuncs}
+	c.statusStore[goRoutineInfo.ID] = goRoutineStatus{callingFunctions: remainingFuncs, pendingInput: pendingInput, depthMarkerPrinted: depthMarkerPrinted}
 	return nil
 }
 
+// unknownArguments returns the arguments which have the same names and types, but whose values are unknown.
+func unknownArguments(args []tracee.Argument) []tracee.Argument {
+	unknownArgs := make([]tracee.Argument, 0, len(args))
+	for _, arg := range args {
+		unknownArgs = append(unknownArgs, tracee.Argument{Name: arg.Name, Typ: arg.Typ})
+	}
+	return unknownArgs
+}
+
+// isRecursiveCall returns true if the function is called by the same function, which is the last one of the calling functions.
+func isRecursiveCall(callingFuncs []callingFunction, f *tracee.Function) bool {
+	return len(callingFuncs) > 0 && callingFuncs[len(callingFuncs)-1].StartAddr == f.StartAddr
+}
+
+// countMergedCall increments the number of the merged calls of the outermost call of the consecutive recursive calls.
+func countMergedCall(callingFuncs []callingFunction) {
+	for i := len(callingFuncs) - 1; i >= 0; i-- {
+		if !callingFuncs[i].merged {
+			callingFuncs[i].mergedCalls++
+			return
+		}
+	}
+}
+
 // It must be called at the beginning of the function due to the StackFrameAt's constraint.
 func (c *Controller) currentStackFrame(goRoutineInfo tracee.GoRoutineInfo) (*tracee.StackFrame, error) {
-	return c.process.StackFrameAt(goRoutineInfo.CurrentStackAddr, goRoutineInfo.CurrentPC)
+	return c.process.StackFrameWithRegisters(goRoutineInfo.CurrentStackAddr, goRoutineInfo.CurrentPC, goRoutineInfo.Registers)
 }
 
 // It must be called at return address due to the StackFrameAt's constraint.
+// The registers hold the results at this point, so the input arguments in the registers are not reliable.
 func (c *Controller) prevStackFrame(goRoutineInfo tracee.GoRoutineInfo, rip uint64) (*tracee.StackFrame, error) {
-	return c.process.StackFrameAt(goRoutineInfo.CurrentStackAddr-8, rip)
+	return c.process.StackFrameWithRegisters(goRoutineInfo.CurrentStackAddr-8, rip, goRoutineInfo.Registers)
 }
 
 func (c *Controller) printableFunc(f *tracee.Function) bool {
@@ -566,27 +2176,498 @@ func (c *Controller) printableFunc(f *tracee.Function) bool {
 	return true
 }
 
-func (c *Controller) printFunctionInput(goRoutineID int64, stackFrame *tracee.StackFrame, depth int) error {
-	var args []string
-	//for _, arg := range stackFrame.InputArguments {
-	//	args = append(args, arg.ParseValue(c.parseLevel))
-	//}
+// exceedsMaxPrintDepth returns true if the function at the `depth` should not be printed due to the max print depth.
+// The marker is printed when the stack depth exceeds the max print depth first. `markerPrinted` is updated accordingly.
+func (c *Controller) exceedsMaxPrintDepth(goRoutineID int64, depth int, markerPrinted *bool) bool {
+	if c.maxPrintDepth <= 0 || depth <= c.maxPrintDepth {
+		*markerPrinted = false
+		return false
+	}
 
-	fmt.Fprintf(c.outputWriter, "%s\\ (#%02d) %s(%s)\n", strings.Repeat("|", depth-1), goRoutineID, stackFrame.Function.Name, strings.Join(args, ", "))
+	if !*markerPrinted {
+		// the marker has no corresponding event in the JSON format.
+		if c.outputFormat != OutputFormatJSON && !c.tracingPaused {
+			buf := c.beginLine(c.maxPrintDepth+1, "...", goRoutineID)
+			buf.Truncate(buf.Len() - 1) // remove the space before the function name, which the marker doesn't have
+			if err := c.endLine(buf); err != nil {
+				log.Debugf("failed to print the marker: %v", err)
+			}
+		}
+		*markerPrinted = true
+	}
+	return true
+}
 
-	return nil
+// printFunctionInput prints the function's entry. `panicValue` is the value the go routine is panicking with, if any.
+// It's printed only if the function is deferred, because then the function can recover the value.
+func (c *Controller) printFunctionInput(goRoutineID int64, callID uint64, stackFrame *tracee.StackFrame, depth int, deferred bool, panicValue *tracee.Argument) error {
+	if c.tracingPaused {
+		return nil
+	}
+	if !deferred {
+		panicValue = nil
+	}
+
+	if c.onEnter != nil || c.outputFormat == OutputFormatJSON || c.outputFormat == OutputFormatSpans {
+		event := c.newEvent(EventKindEnter, goRoutineID, depth, stackFrame.Function)
+		event.CallID = callID
+		if stackFrame.Function.FrameBaseIsCFA {
+			event.Args = c.eventArguments(stackFrame.InputArguments)
+		}
+		event.Deferred = deferred
+		if panicValue != nil && c.parseLevel > 0 {
+			event.PanicValue = panicValue.ParseValue(c.parseLevel)
+		}
+		if c.printCaller {
+			event.Caller = c.funcNameAt(stackFrame.ReturnAddress)
+		}
+		if c.printAddresses {
+			event.PC, event.ReturnAddress = stackFrame.Function.StartAddr, stackFrame.ReturnAddress
+		}
+		if c.printGoRoutineStatus {
+			event.GoRoutineStatus = c.currentGoRoutineStatus()
+		}
+		if c.printDeferChain {
+			event.DeferChain = c.currentDeferChain()
+		}
+		if c.onEnter != nil {
+			c.onEnter(event)
+		}
+		switch c.outputFormat {
+		case OutputFormatJSON:
+			return c.writeEvent(event)
+		case OutputFormatSpans:
+			c.spanExporter.OnEnter(event)
+			return nil
+		}
+	}
+
+	if c.outputFormat == OutputFormatCollapsed {
+		c.collapsedStacks.Enter(goRoutineID, depth, stackFrame.Function.Name)
+		return nil
+	}
+
+	buf := c.beginLine(depth, "\\", goRoutineID)
+	buf.WriteString(stackFrame.Function.Name)
+	buf.WriteByte('(')
+	if stackFrame.Function.FrameBaseIsCFA {
+		c.writeArguments(buf, stackFrame.InputArguments)
+	}
+	buf.WriteByte(')')
+
+	if c.printCaller {
+		buf.WriteString(" (caller: ")
+		buf.WriteString(c.funcNameAt(stackFrame.ReturnAddress))
+		buf.WriteByte(')')
+	}
+	if c.printAddresses {
+		fmt.Fprintf(buf, " [pc: %#x, return: %#x]", stackFrame.Function.StartAddr, stackFrame.ReturnAddress)
+	}
+	if c.printGoRoutineStatus {
+		fmt.Fprintf(buf, " [goroutine %d: %s]", goRoutineID, c.currentGoRoutineStatus())
+	}
+	if c.printDeferChain {
+		if funcNames := c.currentDeferChain(); len(funcNames) > 0 {
+			fmt.Fprintf(buf, " [defers: %s]", strings.Join(funcNames, ", "))
+		}
+	}
+	if panicValue != nil {
+		buf.WriteString(" [panic: ")
+		c.writeArguments(buf, []tracee.Argument{*panicValue})
+		buf.WriteByte(']')
+	}
+	buf.WriteString(deferMark(deferred))
+
+	return c.endLine(buf)
 }
 
-func (c *Controller) printFunctionOutput(goRoutineID int64, stackFrame *tracee.StackFrame, depth int) error {
-	var args []string
-	for _, arg := range stackFrame.OutputArguments {
-		args = append(args, arg.ParseValue(c.parseLevel))
+// currentGoRoutineStatus returns the status of the go routine running on the last trapped thread.
+func (c *Controller) currentGoRoutineStatus() string {
+	status, err := c.process.CurrentGoRoutineStatus(c.lastTrappedThreadID)
+	if err != nil {
+		log.Debugf("failed to read the go routine status: %v", err)
+		return "unknown"
 	}
-	fmt.Fprintf(c.outputWriter, "%s/ (#%02d) %s() (%s)\n", strings.Repeat("|", depth-1), goRoutineID, stackFrame.Function.Name, strings.Join(args, ", "))
+	return status.String()
+}
 
+// currentDeferChain returns the names of the deferred functions the go routine running on the last trapped thread has queued.
+func (c *Controller) currentDeferChain() []string {
+	result := c.deferChain()
+	if result.err != nil {
+		log.Debugf("failed to read the defer chain: %v", result.err)
+		return nil
+	}
+	return result.funcNames
+}
+
+// printFunctionOutput prints the function's return. `mergedCalls` is the number of the recursive calls merged into this call.
+func (c *Controller) printFunctionOutput(goRoutineID int64, callID uint64, stackFrame *tracee.StackFrame, depth int, deferred bool, mergedCalls int) error {
+	if c.tracingPaused {
+		return nil
+	}
+	if c.onReturn != nil || c.outputFormat == OutputFormatJSON || c.outputFormat == OutputFormatSpans {
+		event := c.newEvent(EventKindReturn, goRoutineID, depth, stackFrame.Function)
+		event.CallID = callID
+		if stackFrame.Function.FrameBaseIsCFA {
+			event.Args = c.eventArguments(stackFrame.OutputArguments)
+		}
+		event.Deferred = deferred
+		event.MergedCalls = mergedCalls
+		if c.onReturn != nil {
+			c.onReturn(event)
+		}
+		switch c.outputFormat {
+		case OutputFormatJSON:
+			return c.writeEvent(event)
+		case OutputFormatSpans:
+			c.spanExporter.OnReturn(event)
+			return nil
+		}
+	}
+
+	if c.outputFormat == OutputFormatCollapsed {
+		return nil // the depth of the next call tells the return.
+	}
+
+	buf := c.beginLine(depth, "/", goRoutineID)
+	buf.WriteString(stackFrame.Function.Name)
+	buf.WriteString("() (")
+	if stackFrame.Function.FrameBaseIsCFA {
+		c.writeArguments(buf, stackFrame.OutputArguments)
+	}
+	buf.WriteByte(')')
+	if mergedCalls > 0 {
+		fmt.Fprintf(buf, " (x%d)", mergedCalls+1)
+	}
+	buf.WriteString(deferMark(deferred))
+
+	return c.endLine(buf)
+}
+
+func (c *Controller) printSyscall(goRoutineID int64, stackFrame *tracee.StackFrame, depth int) error {
+	if c.tracingPaused {
+		return nil
+	}
+	if c.outputFormat == OutputFormatJSON {
+		event := c.newEvent(EventKindSyscall, goRoutineID, depth, stackFrame.Function)
+		if stackFrame.Function.FrameBaseIsCFA {
+			event.Args = c.eventArguments(stackFrame.InputArguments)
+		}
+		return c.writeEvent(event)
+	}
+
+	buf := c.beginLine(depth, "!", goRoutineID)
+	buf.WriteString("syscall ")
+	buf.WriteString(stackFrame.Function.Name)
+	buf.WriteByte('(')
+	if stackFrame.Function.FrameBaseIsCFA {
+		c.writeArguments(buf, stackFrame.InputArguments)
+	}
+	buf.WriteByte(')')
+
+	return c.endLine(buf)
+}
+
+// printAllocation prints the allocation the traced function `caller` makes, such as `|! (#01) alloc 16 bytes main.T in main.f`.
+func (c *Controller) printAllocation(goRoutineID int64, caller *tracee.Function, depth int, alloc tracee.Allocation) error {
+	if c.tracingPaused {
+		return nil
+	}
+	if c.outputFormat == OutputFormatJSON {
+		event := c.newEvent(EventKindAlloc, goRoutineID, depth, caller)
+		event.AllocSize = alloc.Size
+		event.AllocType = alloc.TypeName
+		return c.writeEvent(event)
+	}
+
+	buf := c.beginLine(depth, "!", goRoutineID)
+	fmt.Fprintf(buf, "alloc %d bytes ", alloc.Size)
+	if alloc.TypeName != "" {
+		buf.WriteString(alloc.TypeName)
+		buf.WriteByte(' ')
+	}
+	buf.WriteString("in ")
+	buf.WriteString(caller.Name)
+	return c.endLine(buf)
+}
+
+// printSamplingInterval prints the sampling ratio, such as `# sampling 1 in 4 hits`, if it's changed since the last print.
+func (c *Controller) printSamplingInterval() error {
+	interval := c.sampler.Interval()
+	if c.sampler.maxTracedHits <= 0 || interval == c.reportedSamplingInterval {
+		return nil
+	}
+	c.reportedSamplingInterval = interval
+
+	if c.outputFormat == OutputFormatJSON {
+		event := Event{Version: EventSchemaVersion, Kind: EventKindSampling, SamplingInterval: interval}
+		if c.timestampFormat != "" {
+			event.Timestamp = time.Now().Format(c.timestampFormat)
+		}
+		return c.writeEvent(event)
+	}
+
+	buf := &c.lineBuffer
+	buf.Reset()
+	c.writeTimestamp(buf)
+	fmt.Fprintf(buf, "# sampling 1 in %d hits", interval)
+	return c.endLine(buf)
+}
+
+// printCgoCall prints the call to the C function `callee`, such as `|! (#01) cgo C.puts`.
+func (c *Controller) printCgoCall(goRoutineID int64, stackFrame *tracee.StackFrame, depth int, callee string) error {
+	if c.tracingPaused {
+		return nil
+	}
+	if c.outputFormat == OutputFormatJSON {
+		event := c.newEvent(EventKindCgo, goRoutineID, depth, stackFrame.Function)
+		event.Function = callee
+		return c.writeEvent(event)
+	}
+
+	buf := c.beginLine(depth, "!", goRoutineID)
+	buf.WriteString("cgo ")
+	buf.WriteString(callee)
+	return c.endLine(buf)
+}
+
+// cgoCallee returns the name of the C function the go routine trapped at runtime.cgocall is going to call.
+func (c *Controller) cgoCallee(goRoutineInfo tracee.GoRoutineInfo) string {
+	callee, err := c.process.CgoCallee(goRoutineInfo)
+	if err != nil {
+		log.Debugf("failed to find the C function: %v", err)
+		return "unknown"
+	}
+	return callee
+}
+
+// beginLine resets the line buffer and writes the beginning of the line, such as `|\ (#01) `.
+// The line buffer is reused to avoid the allocations per line.
+func (c *Controller) beginLine(depth int, mark string, goRoutineID int64) *bytes.Buffer {
+	buf := &c.lineBuffer
+	buf.Reset()
+	c.writeTimestamp(buf)
+	if c.outputFormat == OutputFormatTree {
+		writeTreeIndent(buf, depth, mark)
+	} else {
+		for i := 1; i < depth; i++ {
+			buf.WriteByte('|')
+		}
+		buf.WriteString(mark)
+	}
+	buf.WriteString(" (#")
+	if goRoutineID >= 0 && goRoutineID < 10 {
+		buf.WriteByte('0')
+	}
+	var scratch [24]byte
+	buf.Write(strconv.AppendInt(scratch[:0], goRoutineID, 10))
+	if c.printThreadID {
+		// the line is always printed while handling the thread which is trapped last.
+		buf.WriteString(" tid ")
+		buf.Write(strconv.AppendInt(scratch[:0], int64(c.lastTrappedThreadID), 10))
+	}
+	buf.WriteString(") ")
+	return buf
+}
+
+// writeTreeIndent writes the connectors of the tree format, such as `│  ├─`. The function entry is drawn as the branch
+// and its return as the end of the branch, because the output is streamed and the last call is unknown at the entry.
+func writeTreeIndent(buf *bytes.Buffer, depth int, mark string) {
+	for i := 1; i < depth; i++ {
+		buf.WriteString("│  ")
+	}
+	switch mark {
+	case "\\":
+		buf.WriteString("├─")
+	case "/":
+		buf.WriteString("└─")
+	default:
+		buf.WriteString(mark)
+	}
+}
+
+func (c *Controller) endLine(buf *bytes.Buffer) error {
+	if c.outputFormat == OutputFormatCollapsed || c.outputFormat == OutputFormatSpans {
+		return nil // only the aggregated stacks or spans are written.
+	}
+	buf.WriteByte('\n')
+	return c.writeOutput(buf.Bytes())
+}
+
+// flusher is the writer which buffers the written data, such as bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// writeDeadliner is the writer whose blocked write can be aborted by the deadline, such as net.Conn and os.File.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// defaultDrainTimeout is the default max time to wait for the output writer to drain.
+const defaultDrainTimeout = 5 * time.Second
+
+// SetOutputWriter sets the writer to which the traced data is written. The default is os.Stdout.
+// If the writer has the Flush method, like bufio.Writer and http.Flusher, it's flushed as specified by SetFlushInterval.
+func (c *Controller) SetOutputWriter(w io.Writer) {
+	c.outputWriter = w
+}
+
+// SetFlushInterval sets the number of the lines (the events in the JSON format) written before the output writer is flushed.
+// The default is 1, which flushes after each line so that the live trace appears promptly. The larger interval trades
+// the latency for the throughput. 0 disables the flush until the main loop ends.
+func (c *Controller) SetFlushInterval(lines int) {
+	c.flushInterval = lines
+}
+
+func (c *Controller) writeOutput(data []byte) error {
+	if _, err := c.outputWriter.Write(data); err != nil {
+		return err
+	}
+
+	c.unflushedLines++
+	if c.flushInterval > 0 && c.unflushedLines >= c.flushInterval {
+		return c.flushOutput()
+	}
+	return nil
+}
+
+func (c *Controller) flushOutput() error {
+	c.unflushedLines = 0
+	switch w := c.outputWriter.(type) {
+	case flusher:
+		return w.Flush()
+	case interface{ Flush() }:
+		w.Flush()
+	}
 	return nil
 }
 
+// SetDrainTimeout sets the max time to wait for the output to drain when the main loop ends, for example, after Interrupt.
+// The output writer is flushed so that the tail of the trace isn't lost. If the writer has the SetWriteDeadline method,
+// like net.Conn, the deadline is set so that the blocked write is aborted after the timeout.
+// The default is 5 seconds. 0 means no limit.
+func (c *Controller) SetDrainTimeout(timeout time.Duration) {
+	c.drainTimeout = timeout
+}
+
+// writeCollapsedStacks writes the aggregated stacks if the output format is OutputFormatCollapsed.
+func (c *Controller) writeCollapsedStacks() {
+	if c.outputFormat != OutputFormatCollapsed {
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.collapsedStacks.WriteTo(&buf); err != nil {
+		log.Debugf("failed to write the collapsed stacks: %v", err)
+		return
+	}
+	if err := c.writeOutput(buf.Bytes()); err != nil {
+		log.Debugf("failed to write the collapsed stacks: %v", err)
+	}
+}
+
+// exportSpans writes the spans, or sends them to the spans endpoint, if the output format is OutputFormatSpans.
+func (c *Controller) exportSpans() {
+	if c.outputFormat != OutputFormatSpans {
+		return
+	}
+
+	if c.spansEndpoint != "" {
+		if err := c.spanExporter.Export(c.spansEndpoint); err != nil {
+			log.Debugf("failed to export the spans: %v", err)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.spanExporter.WriteTo(&buf); err != nil {
+		log.Debugf("failed to write the spans: %v", err)
+		return
+	}
+	if err := c.writeOutput(buf.Bytes()); err != nil {
+		log.Debugf("failed to write the spans: %v", err)
+	}
+}
+
+// drainOutput flushes the output writer and waits for it to write all the buffered data, up to the drain timeout.
+// The flush continues in the background after the timeout unless the writer supports the write deadline.
+func (c *Controller) drainOutput() {
+	deadliner, hasDeadline := c.outputWriter.(writeDeadliner)
+	hasDeadline = hasDeadline && c.drainTimeout > 0
+	if hasDeadline {
+		if err := deadliner.SetWriteDeadline(time.Now().Add(c.drainTimeout)); err != nil {
+			log.Debugf("failed to set the write deadline: %v", err)
+			hasDeadline = false
+		}
+	}
+
+	doneCh := make(chan error, 1) // buffered so that the goroutine can exit after the timeout.
+	go func() {
+		err := c.flushOutput()
+		if hasDeadline {
+			_ = deadliner.SetWriteDeadline(time.Time{})
+		}
+		doneCh <- err
+	}()
+
+	var timeoutCh <-chan time.Time
+	if c.drainTimeout > 0 {
+		timer := time.NewTimer(c.drainTimeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case err := <-doneCh:
+		if err != nil {
+			log.Debugf("failed to drain the output: %v", err)
+		}
+	case <-timeoutCh:
+		log.Debugf("failed to drain the output in %v. The tail of the trace may be lost", c.drainTimeout)
+	}
+}
+
+func (c *Controller) writeArguments(buf *bytes.Buffer, args []tracee.Argument) {
+	if c.parseLevel == 0 {
+		// skip reading the args, which is costly when the traced function is called frequently.
+		if len(args) > 0 {
+			buf.WriteString("...")
+		}
+		return
+	}
+
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if c.printArgumentTypes {
+			arg.WriteTypedValue(buf, c.parseLevel)
+		} else {
+			arg.WriteValue(buf, c.parseLevel)
+		}
+	}
+}
+
+// deferMark returns the mark appended to the line of the deferred function.
+func deferMark(deferred bool) string {
+	if deferred {
+		return " [defer]"
+	}
+	return ""
+}
+
+// writeTimestamp writes the current time followed by the space. Writes nothing if the timestamp is disabled.
+func (c *Controller) writeTimestamp(buf *bytes.Buffer) {
+	if c.timestampFormat == "" {
+		return
+	}
+	var scratch [64]byte
+	buf.Write(time.Now().AppendFormat(scratch[:0], c.timestampFormat))
+	buf.WriteByte(' ')
+}
+
 func (c *Controller) findCallInstAddresses(f *tracee.Function) ([]uint64, error) {
 	// this cache is not only efficient, but required because there are no call insts if breakpoints are set.
 	if cache, ok := c.callInstAddrCache[f.StartAddr]; ok {
@@ -611,6 +2692,51 @@ func (c *Controller) findCallInstAddresses(f *tracee.Function) ([]uint64, error)
 	return addresses, nil
 }
 
+func (c *Controller) findReturnInstAddresses(f *tracee.Function) ([]uint64, error) {
+	if cache, ok := c.returnInstAddrCache[f.StartAddr]; ok {
+		return cache, nil
+	}
+
+	insts, err := c.process.ReadInstructions(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var pos int
+	var addresses []uint64
+	for _, inst := range insts {
+		if inst.Op == x86asm.RET {
+			addresses = append(addresses, f.StartAddr+uint64(pos))
+		}
+		pos += inst.Len
+	}
+
+	c.returnInstAddrCache[f.StartAddr] = addresses
+	return addresses, nil
+}
+
+// Disassemble returns the string representation of at most `count` instructions from the specified address.
+// The instruction at which the breakpoint is set is marked.
+// It reads the tracee's memory directly and so must not be called while the main loop is running.
+func (c *Controller) Disassemble(addr uint64, count int) ([]string, error) {
+	insts, err := c.process.ReadInstructionsAt(addr, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	pc := addr
+	for _, inst := range insts {
+		line := fmt.Sprintf("%#x: %s", pc, x86asm.GoSyntax(inst, pc, nil))
+		if c.breakpoints.Exist(pc) {
+			line += " (breakpoint)"
+		}
+		lines = append(lines, line)
+		pc += uint64(inst.Len)
+	}
+	return lines, nil
+}
+
 // Interrupt interrupts the main loop.
 func (c *Controller) Interrupt() {
 	c.interruptCh <- true
@@ -2,14 +2,22 @@ package tracer
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"reflect"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/nkbai/tgo/testutils"
+	"github.com/nkbai/tgo/tracee"
 )
 
 var helloworldAttrs = Attributes{
@@ -47,6 +55,47 @@ func TestAttachProcess(t *testing.T) {
 	cmd.Process.Wait()
 }
 
+func TestContinueUntilStartTracePoint(t *testing.T) {
+	cmd := exec.Command(testutils.ProgramInfloop)
+	_ = cmd.Start()
+	defer func() {
+		cmd.Process.Kill()
+		// Not cmd.Process.Wait, because it hangs if the threads which were running on detach are still traced.
+		var status syscall.WaitStatus
+		for {
+			if wpid, err := syscall.Wait4(-1, &status, 0, nil); err != nil || wpid == cmd.Process.Pid {
+				return
+			}
+		}
+	}()
+
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	if err := controller.AttachTracee(cmd.Process.Pid, infloopAttrs); err != nil {
+		t.Fatalf("failed to attch to the process: %v", err)
+	}
+	// main.main is running when attached, so trace the function it calls repeatedly.
+	if err := controller.AddStartTracePointByName("time.Sleep"); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	err := controller.ContinueUntilStartTracePoint()
+	if err != nil {
+		t.Errorf("failed to continue: %v", err)
+	}
+	if len(controller.tracingPoints.goRoutinesInside) == 0 {
+		t.Errorf("no go routines inside the tracing point")
+	}
+	if state := controller.State(); state != StateStopped {
+		t.Errorf("wrong state: %v", state)
+	}
+
+	controller.Interrupt()
+	if err := controller.MainLoop(); err != ErrInterrupted {
+		t.Errorf("not interrupted: %v", err)
+	}
+}
+
 var startStopAttrs = Attributes{
 	ProgramPath:         testutils.ProgramStartStop,
 	FirstModuleDataAddr: testutils.StartStopAddrFirstModuleData,
@@ -75,6 +124,24 @@ func TestAddStartTracePoint(t *testing.T) {
 	}
 }
 
+func TestAddStartTracePointByName(t *testing.T) {
+	controller := NewController()
+	err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+
+	if err := controller.AddStartTracePointByName("main.main"); err != nil {
+		t.Errorf("failed to set tracing point: %v", err)
+	}
+	if err := controller.setPendingTracePoints(); err != nil {
+		t.Errorf("failed to set pending trace points: %v", err)
+	}
+	if !controller.breakpoints.Exist(testutils.HelloworldAddrMain) {
+		t.Errorf("breakpoint is not set at main.main")
+	}
+}
+
 func TestAddEndTracePoint(t *testing.T) {
 	controller := NewController()
 	err := controller.LaunchTracee(testutils.ProgramStartStop, nil, startStopAttrs)
@@ -92,12 +159,811 @@ func TestAddEndTracePoint(t *testing.T) {
 		t.Errorf("breakpoint is not set at main.tracedFunc")
 	}
 
-	if err := controller.AddEndTracePoint(testutils.StartStopAddrTracedFunc); err != nil {
-		t.Errorf("failed to set tracing point: %v", err)
+	if err := controller.AddEndTracePoint(testutils.StartStopAddrTracedFunc); err != nil {
+		t.Errorf("failed to set tracing point: %v", err)
+	}
+}
+
+func TestClearAllTracePoints(t *testing.T) {
+	controller := NewController()
+	controller.breakpoints = NewBreakpoints(func(uint64) error { return nil }, func(uint64) error { return nil })
+
+	if err := controller.AddStartTracePoint(0x100); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	if err := controller.AddEndTracePoint(0x200); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	if err := controller.setPendingTracePoints(); err != nil {
+		t.Fatalf("failed to set pending trace points: %v", err)
+	}
+
+	if err := controller.ClearAllTracePoints(); err != nil {
+		t.Fatalf("failed to clear trace points: %v", err)
+	}
+	if err := controller.setPendingTracePoints(); err != nil {
+		t.Fatalf("failed to set pending trace points: %v", err)
+	}
+
+	if controller.breakpoints.Exist(0x100) || controller.breakpoints.Exist(0x200) {
+		t.Errorf("breakpoint is not cleared")
+	}
+	if controller.tracingPoints.IsStartAddress(0x100) || controller.tracingPoints.IsEndAddress(0x200) {
+		t.Errorf("trace point is not cleared")
+	}
+}
+
+func TestFindPrologueEndAddr(t *testing.T) {
+	controller := NewController()
+	f := &tracee.Function{Name: "main.f", StartAddr: 0x100}
+	controller.prologueEndAddrCache[f.StartAddr] = 0x110
+
+	if addr := controller.findPrologueEndAddr(f); addr != 0x110 {
+		t.Errorf("wrong address: %#x", addr)
+	}
+
+	controller.breakpointTypes[0x110] = breakpointTypeCall
+	if addr := controller.findPrologueEndAddr(f); addr != 0 {
+		t.Errorf("the address used by another breakpoint is returned: %#x", addr)
+	}
+
+	delete(controller.breakpointTypes, 0x110)
+	controller.SetSkipPrologue(false)
+	if addr := controller.findPrologueEndAddr(f); addr != 0 {
+		t.Errorf("the address is returned though the option is disabled: %#x", addr)
+	}
+}
+
+func TestCurrentArguments_NoThreadTrapped(t *testing.T) {
+	controller := NewController()
+	resultCh := make(chan currentArgsResult, 1)
+	controller.pendingArgsRequest <- resultCh
+
+	controller.handlePendingArgsRequests()
+	if result := <-resultCh; result.err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestCallerPC_NoThreadTrapped(t *testing.T) {
+	controller := NewController()
+	resultCh := make(chan callerResult, 1)
+	controller.pendingCallerRequest <- resultCh
+
+	controller.handlePendingCallerRequests()
+	if result := <-resultCh; result.err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestCurrentArguments_MainLoopEnded(t *testing.T) {
+	controller := NewController()
+	close(controller.mainLoopDoneCh)
+
+	if _, err := controller.CurrentArguments(); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestCurrentArguments_Timeout(t *testing.T) {
+	controller := NewController()
+	controller.SetRequestTimeout(10 * time.Millisecond)
+
+	if _, err := controller.CurrentArguments(); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestCurrentRegistersAndReadMemory_MainLoopEnded(t *testing.T) {
+	controller := NewController()
+	close(controller.mainLoopDoneCh)
+
+	if _, err := controller.CurrentRegisters(); err == nil {
+		t.Errorf("error should be returned")
+	}
+	if _, err := controller.ReadMemory(0x1000, 8); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestDeferChain_Timeout(t *testing.T) {
+	controller := NewController()
+	controller.SetRequestTimeout(10 * time.Millisecond)
+
+	if _, err := controller.DeferChain(); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestReadParameter_MainLoopEnded(t *testing.T) {
+	controller := NewController()
+	close(controller.mainLoopDoneCh)
+
+	if _, err := controller.ReadParameter("i"); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestCallerPC_Timeout(t *testing.T) {
+	controller := NewController()
+	controller.SetRequestTimeout(10 * time.Millisecond)
+
+	if _, _, err := controller.CallerPC(); err == nil {
+		t.Errorf("error should be returned")
+	}
+}
+
+func TestPrintFunctionInput_Addresses(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f", StartAddr: 0x1000}, ReturnAddress: 0x2000}
+	for i, testdata := range []struct {
+		printAddresses bool
+		expected       string
+	}{
+		{printAddresses: false, expected: "\\ (#01) main.f()\n"},
+		{printAddresses: true, expected: "\\ (#01) main.f() [pc: 0x1000, return: 0x2000]\n"},
+	} {
+		controller := NewController()
+		buff := &bytes.Buffer{}
+		controller.outputWriter = buff
+		controller.SetPrintAddresses(testdata.printAddresses)
+
+		if err := controller.printFunctionInput(1, 0, stackFrame, 1, false, nil); err != nil {
+			t.Fatalf("[%d] failed to print: %v", i, err)
+		}
+		if buff.String() != testdata.expected {
+			t.Errorf("[%d] unexpected output: %s", i, buff.String())
+		}
+	}
+}
+
+func TestPrintFunctionInput_ParseLevelZero(t *testing.T) {
+	// the arg panics if its value is parsed.
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f", FrameBaseIsCFA: true}, InputArguments: []tracee.Argument{{Name: "a"}}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetParseLevel(0)
+
+	if err := controller.printFunctionInput(1, 0, stackFrame, 1, false, nil); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "\\ (#01) main.f(...)\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintFunctionOutput_ParseLevelZero(t *testing.T) {
+	// the arg panics if its value is parsed.
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f", FrameBaseIsCFA: true}, OutputArguments: []tracee.Argument{{Name: "a"}}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetParseLevel(0)
+
+	if err := controller.printFunctionOutput(1, 0, stackFrame, 1, false, 0); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "/ (#01) main.f() (...)\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintFunctionOutput_MergedCalls(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.dec", FrameBaseIsCFA: true}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+
+	if err := controller.printFunctionOutput(1, 0, stackFrame, 1, false, 5); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "/ (#01) main.dec() () (x6)\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestCountMergedCall(t *testing.T) {
+	f := &tracee.Function{Name: "main.dec", StartAddr: 0x1000}
+	callingFuncs := []callingFunction{{Function: &tracee.Function{Name: "main.main"}}, {Function: f}}
+	if !isRecursiveCall(callingFuncs, f) {
+		t.Fatalf("not recursive call")
+	}
+	countMergedCall(callingFuncs)
+	callingFuncs = append(callingFuncs, callingFunction{Function: f, merged: true})
+	countMergedCall(callingFuncs)
+
+	if callingFuncs[1].mergedCalls != 2 || callingFuncs[0].mergedCalls != 0 {
+		t.Errorf("wrong merged calls: %d, %d", callingFuncs[0].mergedCalls, callingFuncs[1].mergedCalls)
+	}
+	if isRecursiveCall(callingFuncs[0:1], f) {
+		t.Errorf("wrong recursive call")
+	}
+}
+
+func TestPrintSyscall(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "syscall.Syscall"}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+
+	if err := controller.printSyscall(1, stackFrame, 2); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "|! (#01) syscall syscall.Syscall()\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintCgoCall(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "runtime.cgocall"}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+
+	if err := controller.printCgoCall(1, stackFrame, 2, "C.puts"); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "|! (#01) cgo C.puts\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintThreadID(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "syscall.Syscall"}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetPrintThreadID(true)
+	controller.lastTrappedThreadID = 1234
+
+	if err := controller.printSyscall(1, stackFrame, 2); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "|! (#01 tid 1234) syscall syscall.Syscall()\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintAllocation(t *testing.T) {
+	caller := &tracee.Function{Name: "main.f"}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+
+	if err := controller.printAllocation(1, caller, 2, tracee.Allocation{Size: 16, TypeName: "main.T"}); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if err := controller.printAllocation(1, caller, 2, tracee.Allocation{Size: 8}); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	expected := "|! (#01) alloc 16 bytes main.T in main.f\n|! (#01) alloc 8 bytes in main.f\n"
+	if buff.String() != expected {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintSamplingInterval(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetSampling(2, time.Second)
+
+	controller.sampler.interval = 4
+	for i := 0; i < 2; i++ {
+		if err := controller.printSamplingInterval(); err != nil {
+			t.Fatalf("failed to print: %v", err)
+		}
+	}
+	if buff.String() != "# sampling 1 in 4 hits\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPauseTracing(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f"}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+
+	if err := controller.PauseTracing(); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+	controller.handlePauseTracingRequests()
+	if err := controller.printFunctionInput(1, 0, stackFrame, 1, false, nil); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.Len() != 0 {
+		t.Errorf("printed while paused: %s", buff.String())
+	}
+
+	if err := controller.ResumeTracing(); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	controller.handlePauseTracingRequests()
+	if err := controller.printFunctionOutput(1, 0, stackFrame, 1, false, 0); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if buff.String() != "/ (#01) main.f() ()\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+type flushCountingWriter struct {
+	bytes.Buffer
+	numFlushes int
+}
+
+func (w *flushCountingWriter) Flush() error {
+	w.numFlushes++
+	return nil
+}
+
+func TestSetFlushInterval(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "syscall.Syscall"}}
+	for i, testdata := range []struct {
+		flushInterval      int
+		expectedNumFlushes int
+	}{
+		{flushInterval: 1, expectedNumFlushes: 3},
+		{flushInterval: 2, expectedNumFlushes: 1},
+		{flushInterval: 0, expectedNumFlushes: 0},
+	} {
+		controller := NewController()
+		writer := &flushCountingWriter{}
+		controller.SetOutputWriter(writer)
+		controller.SetFlushInterval(testdata.flushInterval)
+
+		for j := 0; j < 3; j++ {
+			if err := controller.printSyscall(1, stackFrame, 2); err != nil {
+				t.Fatalf("failed to print: %v", err)
+			}
+		}
+		if writer.numFlushes != testdata.expectedNumFlushes {
+			t.Errorf("[%d] wrong number of flushes: %d", i, writer.numFlushes)
+		}
+
+		controller.drainOutput()
+		if writer.numFlushes != testdata.expectedNumFlushes+1 {
+			t.Errorf("[%d] not flushed on exit: %d", i, writer.numFlushes)
+		}
+	}
+}
+
+// blockingFlushWriter is the writer whose flush blocks until the write deadline passes.
+type blockingFlushWriter struct {
+	bytes.Buffer
+	deadlineCh chan struct{}
+	flushedCh  chan struct{}
+}
+
+func (w *blockingFlushWriter) Flush() error {
+	defer close(w.flushedCh)
+	<-w.deadlineCh
+	return errors.New("write deadline exceeded")
+}
+
+func (w *blockingFlushWriter) SetWriteDeadline(t time.Time) error {
+	if !t.IsZero() {
+		time.AfterFunc(time.Until(t), func() { close(w.deadlineCh) })
+	}
+	return nil
+}
+
+func TestDrainOutput(t *testing.T) {
+	controller := NewController()
+	writer := &blockingFlushWriter{deadlineCh: make(chan struct{}), flushedCh: make(chan struct{})}
+	controller.SetOutputWriter(writer)
+	controller.SetDrainTimeout(10 * time.Millisecond)
+
+	controller.drainOutput() // should return without the flush
+
+	select {
+	case <-writer.flushedCh:
+	case <-time.After(time.Second):
+		t.Errorf("the flush is still blocked after the deadline")
+	}
+}
+
+func TestUnwindPanickedFunctions(t *testing.T) {
+	controller := NewController()
+	setBreakpoints := make(map[uint64]bool)
+	controller.breakpoints = NewBreakpoints(
+		func(addr uint64) error { setBreakpoints[addr] = true; return nil },
+		func(addr uint64) error { delete(setBreakpoints, addr); return nil })
+
+	// main.f recovers from the panic main.h raised through main.g.
+	var callingFuncs []callingFunction
+	for i, name := range []string{"main.f", "main.g", "main.h"} {
+		callingFunc := callingFunction{Function: &tracee.Function{Name: name}, returnAddress: uint64(0x100 * (i + 1)), usedStackSize: uint64(0x10 * (i + 1))}
+		if err := controller.breakpoints.SetConditional(callingFunc.returnAddress, 1); err != nil {
+			t.Fatalf("failed to set breakpoint: %v", err)
+		}
+		callingFuncs = append(callingFuncs, callingFunc)
+	}
+	controller.statusStore[1] = goRoutineStatus{callingFunctions: callingFuncs}
+
+	// runtime.deferreturn is called by main.f and so uses the same stack as main.g at its entry.
+	if err := controller.unwindPanickedFunctions(1, 0x20); err != nil {
+		t.Fatalf("failed to unwind: %v", err)
+	}
+
+	remainingFuncs := controller.statusStore[1].callingFunctions
+	if len(remainingFuncs) != 1 || remainingFuncs[0].Name != "main.f" {
+		t.Errorf("wrong remaining functions: %v", remainingFuncs)
+	}
+	if !setBreakpoints[0x100] || setBreakpoints[0x200] || setBreakpoints[0x300] {
+		t.Errorf("wrong breakpoints: %v", setBreakpoints)
+	}
+}
+
+func TestMainLoop_Cgo(t *testing.T) {
+	if testutils.ProgramCgo == "" {
+		t.Skip("the cgo program is not built")
+	}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	attrs := Attributes{
+		ProgramPath:         testutils.ProgramCgo,
+		FirstModuleDataAddr: testutils.CgoAddrFirstModuleData,
+		CompiledGoVersion:   runtime.Version(),
+	}
+	if err := controller.LaunchTracee(testutils.ProgramCgo, nil, attrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.CgoAddrCallC); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetTraceLevel(2)
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	// the C function is called via main._Cfunc_hello and then runtime.cgocall.
+	output := buff.String()
+	if !strings.Contains(output, "|! (#01) cgo C.hello\n") {
+		t.Errorf("the cgo call is not printed\n%s", output)
+	}
+	if !strings.Contains(output, "\\ (#01) main._Cfunc_hello(") || !strings.Contains(output, "/ (#01) main._Cfunc_hello(") {
+		t.Errorf("the function calling the C function is not traced\n%s", output)
+	}
+}
+
+func TestSetSyscallBreakpoints_Disabled(t *testing.T) {
+	controller := NewController()
+	// the process is not necessary because the syscall tracing is disabled.
+	if err := controller.setSyscallBreakpoints(); err != nil {
+		t.Fatalf("failed to set breakpoints: %v", err)
+	}
+	if controller.syscallFuncAddrs != nil {
+		t.Errorf("syscall functions are resolved: %v", controller.syscallFuncAddrs)
+	}
+}
+
+func TestExceedsMaxPrintDepth(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetMaxPrintDepth(2)
+
+	var markerPrinted bool
+	for i, testdata := range []struct {
+		depth          int
+		expected       bool
+		expectedOutput string
+	}{
+		{depth: 1, expected: false},
+		{depth: 2, expected: false},
+		{depth: 3, expected: true, expectedOutput: "||... (#01)\n"},
+		{depth: 4, expected: true},
+		{depth: 2, expected: false},
+		{depth: 3, expected: true, expectedOutput: "||... (#01)\n"},
+	} {
+		buff.Reset()
+		if actual := controller.exceedsMaxPrintDepth(1, testdata.depth, &markerPrinted); actual != testdata.expected {
+			t.Errorf("[%d] wrong result: %v", i, actual)
+		}
+		if buff.String() != testdata.expectedOutput {
+			t.Errorf("[%d] unexpected output: %q", i, buff.String())
+		}
+	}
+}
+
+func TestPrintFunctionOutput_Timestamp(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f", FrameBaseIsCFA: true}}
+	for i, testdata := range []struct {
+		layout       string
+		expectPrefix bool
+	}{
+		{layout: "", expectPrefix: false},
+		{layout: RFC3339Micro, expectPrefix: true},
+	} {
+		controller := NewController()
+		buff := &bytes.Buffer{}
+		controller.outputWriter = buff
+		controller.SetTimestampFormat(testdata.layout)
+
+		if err := controller.printFunctionOutput(1, 0, stackFrame, 1, false, 0); err != nil {
+			t.Fatalf("[%d] failed to print: %v", i, err)
+		}
+
+		output := buff.String()
+		if !testdata.expectPrefix {
+			if !strings.HasPrefix(output, "/") {
+				t.Errorf("[%d] unexpected output: %s", i, output)
+			}
+			continue
+		}
+		fields := strings.SplitN(output, " ", 2)
+		if _, err := time.Parse(testdata.layout, fields[0]); err != nil {
+			t.Errorf("[%d] invalid timestamp: %s", i, output)
+		}
+	}
+}
+
+func TestMainLoop_TraceSyscalls(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	controller.SetTraceSyscalls(true)
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	output := buff.String()
+	if strings.Count(output, "syscall syscall.") == 0 {
+		t.Errorf("no syscall: %s", output)
+	}
+	if strings.Contains(output, "syscall syscall.RawSyscall6") {
+		t.Errorf("the syscall is printed twice: %s", output)
+	}
+}
+
+func TestMainLoop_MainMain(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	output := buff.String()
+	if strings.Count(output, "main.main") != 0 {
+		t.Errorf("unexpected output: %s", output)
+	}
+	if strings.Count(output, "main.noParameter") != 2 {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
+func TestMainLoop_CallID(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = &bytes.Buffer{}
+	controller.SetTraceLevel(1)
+	var enterIDs, returnIDs []uint64
+	controller.SetOnEnter(func(event Event) { enterIDs = append(enterIDs, event.CallID) })
+	controller.SetOnReturn(func(event Event) { returnIDs = append(returnIDs, event.CallID) })
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	// the functions at the trace level 1 are called one by one.
+	if len(enterIDs) == 0 || len(enterIDs) != len(returnIDs) {
+		t.Fatalf("unmatched events: %v, %v", enterIDs, returnIDs)
+	}
+	for i := range enterIDs {
+		if enterIDs[i] == 0 || enterIDs[i] != returnIDs[i] || (i > 0 && enterIDs[i] == enterIDs[i-1]) {
+			t.Errorf("wrong call ids: %v, %v", enterIDs, returnIDs)
+		}
+	}
+}
+
+func TestMainLoop_ReadResultsAtReturnInst(t *testing.T) {
+	twoReturnsRegexp := regexp.MustCompile(`\n/ \(#01\) main\.twoReturns\(\) \(~r0 = \d+, ~r1 = \d+\)\n`)
+	for _, enabled := range []bool{false, true} {
+		controller := NewController()
+		buff := &bytes.Buffer{}
+		controller.outputWriter = buff
+		controller.SetTraceLevel(1)
+		controller.SetParseLevel(1)
+		controller.SetReadResultsAtReturnInst(enabled)
+		if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+			t.Fatalf("failed to launch process: %v", err)
+		}
+		if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+			t.Fatalf("failed to set tracing point: %v", err)
+		}
+
+		if err := controller.MainLoop(); err != nil {
+			t.Errorf("failed to run main loop: %v", err)
+		}
+
+		output := buff.String()
+		if !strings.Contains(output, "\n/ (#01) main.oneParameter() (~r0 = []{1, 2})\n") {
+			t.Errorf("[%v] wrong results of main.oneParameter\n%s", enabled, output)
+		}
+		if !twoReturnsRegexp.MatchString(output) {
+			t.Errorf("[%v] wrong results of main.twoReturns\n%s", enabled, output)
+		}
+	}
+}
+
+func TestMainLoop_ReturnBeforePrologueEnd(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	controller.SetParseLevel(1)
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	// the last call is the one to runtime.morestack, which is not executed unless the stack grows.
+	function, err := controller.process.FindFunction(testutils.HelloworldAddrOneParameter)
+	if err != nil {
+		t.Fatalf("failed to find function: %v", err)
+	}
+	addrs, err := controller.findCallInstAddresses(function)
+	if err != nil || len(addrs) == 0 {
+		t.Fatalf("failed to find call insts: %v", err)
+	}
+	controller.prologueEndAddrCache[function.StartAddr] = addrs[len(addrs)-1]
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	output := buff.String()
+	if !strings.Contains(output, "\\ (#01) main.oneParameter(s = -)\n/ (#01) main.oneParameter() (") {
+		t.Errorf("the input is not printed before the output\n%s", output)
+	}
+}
+
+func TestMainLoop_Collapsed(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	controller.SetOutputFormat(OutputFormatCollapsed)
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	output := buff.String()
+	if !strings.Contains(output, "main.noParameter 1\n") || !strings.Contains(output, "main.twoReturns 1\n") {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
+func TestMainLoop_Spans(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	controller.SetParseLevel(1)
+	controller.SetOutputFormat(OutputFormatSpans)
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	var req otlpTraceRequest
+	if err := json.Unmarshal(buff.Bytes(), &req); err != nil {
+		t.Fatalf("failed to unmarshal: %v: %s", err, buff.String())
+	}
+	var span *otlpSpan
+	for i, s := range req.ResourceSpans[0].ScopeSpans[0].Spans {
+		if s.Name == "main.oneParameter" {
+			span = &req.ResourceSpans[0].ScopeSpans[0].Spans[i]
+		}
+	}
+	if span == nil {
+		t.Fatalf("unexpected spans: %s", buff.String())
+	}
+	attrs := span.Attributes
+	if len(attrs) != 3 || attrs[1].Key != "arg.s" || attrs[2].Key != "result.~r0" || *attrs[2].Value.StringValue != "[]{1, 2}" {
+		t.Errorf("wrong attributes: %s", buff.String())
+	}
+	start, _ := strconv.ParseInt(span.StartTimeUnixNano, 10, 64)
+	end, _ := strconv.ParseInt(span.EndTimeUnixNano, 10, 64)
+	if start == 0 || end < start {
+		t.Errorf("wrong times: %d, %d", start, end)
+	}
+}
+
+func TestMainLoop_CallerFilter(t *testing.T) {
+	for i, testdata := range []struct {
+		caller   string
+		expected int
+	}{
+		{caller: "main.main", expected: 2},
+		{caller: "main.oneParameter", expected: 0},
+	} {
+		controller := NewController()
+		buff := &bytes.Buffer{}
+		controller.outputWriter = buff
+		controller.SetTraceLevel(1)
+		if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+			t.Fatalf("failed to launch process: %v", err)
+		}
+		if err := controller.AddStartTracePointWithCaller(testutils.HelloworldAddrNoParameter, testdata.caller); err != nil {
+			t.Fatalf("failed to set tracing point: %v", err)
+		}
+
+		if err := controller.MainLoop(); err != nil {
+			t.Errorf("failed to run main loop: %v", err)
+		}
+
+		output := buff.String()
+		if strings.Count(output, "\n") != testdata.expected {
+			t.Errorf("[%d] unexpected output: %s", i, output)
+		}
+	}
+}
+
+func TestMainLoop_NoDWARFBinary(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	if err := controller.LaunchTracee(testutils.ProgramHelloworldNoDwarf, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	output := buff.String()
+	if strings.Count(output, "main.main") != 0 {
+		t.Errorf("unexpected output: %s", output)
 	}
 }
 
-func TestMainLoop_MainMain(t *testing.T) {
+func TestMainLoop_MainNoParameter(t *testing.T) {
 	controller := NewController()
 	buff := &bytes.Buffer{}
 	controller.outputWriter = buff
@@ -105,7 +971,10 @@ func TestMainLoop_MainMain(t *testing.T) {
 	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
 		t.Fatalf("failed to launch process: %v", err)
 	}
-	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrNoParameter); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	if err := controller.AddEndTracePoint(testutils.HelloworldAddrOneParameter); err != nil {
 		t.Fatalf("failed to set tracing point: %v", err)
 	}
 
@@ -114,48 +983,92 @@ func TestMainLoop_MainMain(t *testing.T) {
 	}
 
 	output := buff.String()
-	if strings.Count(output, "main.main") != 0 {
+	if strings.Count(output, "fmt.Println") != 2 && strings.Count(output, "fmt.Fprintln") != 2 {
 		t.Errorf("unexpected output: %s", output)
 	}
-	if strings.Count(output, "main.noParameter") != 2 {
+	if strings.Count(output, "main.noParameter") != 0 {
+		t.Errorf("unexpected output: %s", output)
+	}
+	if strings.Count(output, "main.oneParameter") != 0 {
 		t.Errorf("unexpected output: %s", output)
 	}
 }
 
-func TestMainLoop_NoDWARFBinary(t *testing.T) {
+func TestMainLoop_NestedRanges(t *testing.T) {
 	controller := NewController()
 	buff := &bytes.Buffer{}
 	controller.outputWriter = buff
 	controller.SetTraceLevel(1)
-	if err := controller.LaunchTracee(testutils.ProgramHelloworldNoDwarf, nil, helloworldAttrs); err != nil {
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
 		t.Fatalf("failed to launch process: %v", err)
 	}
-	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
-		t.Fatalf("failed to set tracing point: %v", err)
+	// the outer range is main.main and the inner range starts at main.oneParameter.
+	for _, addr := range []uint64{testutils.HelloworldAddrMain, testutils.HelloworldAddrOneParameter} {
+		if err := controller.AddStartTracePoint(addr); err != nil {
+			t.Fatalf("failed to set tracing point: %v", err)
+		}
+	}
+	// both end points are called from main.main after the inner range's function returns.
+	for _, addr := range []uint64{testutils.HelloworldAddrOneParameterAndVariable, testutils.HelloworldAddrTwoParameters} {
+		if err := controller.AddEndTracePoint(addr); err != nil {
+			t.Fatalf("failed to set tracing point: %v", err)
+		}
 	}
 
 	if err := controller.MainLoop(); err != nil {
 		t.Errorf("failed to run main loop: %v", err)
 	}
 
+	// the end points leave the inner range, but not the outer range.
 	output := buff.String()
-	if strings.Count(output, "main.main") != 0 {
-		t.Errorf("unexpected output: %s", output)
+	for _, funcName := range []string{"main.oneParameter", "main.twoParameters", "main.twoReturns"} {
+		if !strings.Contains(output, funcName) {
+			t.Errorf("%s is not traced: %s", funcName, output)
+		}
 	}
 }
 
-func TestMainLoop_MainNoParameter(t *testing.T) {
+var typePrintAttrs = Attributes{
+	ProgramPath:         testutils.ProgramTypePrint,
+	FirstModuleDataAddr: testutils.TypePrintAddrFirstModuleData,
+	CompiledGoVersion:   runtime.Version(),
+}
+
+func TestMainLoop_MixedResults(t *testing.T) {
 	controller := NewController()
 	buff := &bytes.Buffer{}
 	controller.outputWriter = buff
 	controller.SetTraceLevel(1)
-	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+	controller.SetParseLevel(1)
+	if err := controller.LaunchTracee(testutils.ProgramTypePrint, nil, typePrintAttrs); err != nil {
 		t.Fatalf("failed to launch process: %v", err)
 	}
-	if err := controller.AddStartTracePoint(testutils.HelloworldAddrNoParameter); err != nil {
+	if err := controller.AddStartTracePoint(testutils.TypePrintAddrPrintMixedResults); err != nil {
 		t.Fatalf("failed to set tracing point: %v", err)
 	}
-	if err := controller.AddEndTracePoint(testutils.HelloworldAddrOneParameter); err != nil {
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	// the integers, the floats and the padded struct are read from the different sets of registers.
+	expected := "main.mixedResults() (~r0 = 1, ~r1 = 0.5, ~r2 = {b: true, c: -1}, ~r3 = (2+3i), ~r4 = true)"
+	if !strings.Contains(buff.String(), expected) {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestMainLoop_GenericFunction(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetTraceLevel(1)
+	controller.SetParseLevel(1)
+	controller.SetPrintArgumentTypes(true)
+	if err := controller.LaunchTracee(testutils.ProgramTypePrint, nil, typePrintAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.TypePrintAddrCallGeneric); err != nil {
 		t.Fatalf("failed to set tracing point: %v", err)
 	}
 
@@ -163,14 +1076,9 @@ func TestMainLoop_MainNoParameter(t *testing.T) {
 		t.Errorf("failed to run main loop: %v", err)
 	}
 
+	// the shapes, like go.shape.string, are resolved to the actual type arguments.
 	output := buff.String()
-	if strings.Count(output, "fmt.Println") != 2 && strings.Count(output, "fmt.Fprintln") != 2 {
-		t.Errorf("unexpected output: %s", output)
-	}
-	if strings.Count(output, "main.noParameter") != 0 {
-		t.Errorf("unexpected output: %s", output)
-	}
-	if strings.Count(output, "main.oneParameter") != 0 {
+	if !strings.Contains(output, "main.printGeneric[string,int](v main.Pair[string,int] = ") || strings.Contains(output, "go.shape.") {
 		t.Errorf("unexpected output: %s", output)
 	}
 }
@@ -182,8 +1090,9 @@ var goRoutinesAttrs = Attributes{
 }
 
 func TestMainLoop_GoRoutines(t *testing.T) {
-	// Because this test case have many threads run the same function, one thread may pass through the breakpoint
-	// while another thread is single-stepping.
+	// The darwin client holds the other threads stopped while one thread single-steps over the breakpoint, but
+	// the linux client stops only the trapped threads and the others keep running. Then they may pass through
+	// the breakpoint, whose original instruction is restored during the step, or crash the tracee.
 	os.Setenv("GOMAXPROCS", "1")
 	defer os.Unsetenv("GOMAXPROCS")
 
@@ -217,6 +1126,29 @@ var recursiveAttrs = Attributes{
 	CompiledGoVersion:   runtime.Version(),
 }
 
+func TestMainLoop_Recursive_Merged(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	if err := controller.LaunchTracee(testutils.ProgramRecursive, nil, recursiveAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.RecursiveAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetTraceLevel(3)
+	controller.SetMergeRecursiveCalls(true)
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	output := buff.String()
+	if strings.Count(output, "main.dec") != 2 || !strings.Contains(output, "(x3)") {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
 func TestMainLoop_Recursive(t *testing.T) {
 	controller := NewController()
 	buff := &bytes.Buffer{}
@@ -265,6 +1197,84 @@ func TestMainLoop_Panic(t *testing.T) {
 	if strings.Count(output, "main.catch") != 2 {
 		t.Errorf("wrong number of main.catch: %d\n%s", strings.Count(output, "main.catch"), output)
 	}
+	if strings.Count(output, "[defer]") == 0 {
+		t.Errorf("deferred function is not marked\n%s", output)
+	}
+	if !strings.Contains(output, `main.catch() [panic: "2"] [defer]`) {
+		t.Errorf("panic value is not printed\n%s", output)
+	}
+}
+
+func TestMainLoop_PanicWithMultipleDefers(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	if err := controller.LaunchTracee(testutils.ProgramPanic, nil, panicAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.PanicAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetTraceLevel(4)
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	// the panic in main.throw runs main.through deferred by g(1) and g(0), and then main.catch deferred by f.
+	var deferredFuncs []string
+	output := buff.String()
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimLeft(line, "|")
+		if !strings.HasPrefix(line, "\\ ") || !strings.HasSuffix(line, " [defer]") {
+			continue
+		}
+		name := strings.TrimPrefix(line, "\\ (#01) ")
+		deferredFuncs = append(deferredFuncs, name[:strings.Index(name, "(")])
+	}
+	expected := []string{"main.through", "main.through", "main.catch"}
+	if !reflect.DeepEqual(deferredFuncs, expected) {
+		t.Errorf("wrong deferred functions: %v\n%s", deferredFuncs, output)
+	}
+}
+
+func TestMainLoop_PanicDepthAfterRecover(t *testing.T) {
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	if err := controller.LaunchTracee(testutils.ProgramPanic, nil, panicAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.PanicAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetTraceLevel(2)
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+
+	// main.g and main.throw are exited via the panic, so main.f, which recovers, and the functions called
+	// after it returns are at the depth 1.
+	output := buff.String()
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	returnIndex := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "/ (#01) main.f()") {
+			returnIndex = i
+		}
+	}
+	if returnIndex == -1 {
+		t.Fatalf("main.f does not return at the depth 1\n%s", output)
+	}
+	if returnIndex+1 >= len(lines) || !strings.HasPrefix(lines[returnIndex+1], "\\ (#01) fmt.Fprintln(") {
+		t.Errorf("the call after the recovery is not at the depth 1\n%s", output)
+	}
+	for _, line := range lines[returnIndex+1:] {
+		if strings.HasPrefix(line, "||") {
+			t.Errorf("the call after the recovery is too deep: %s\n%s", line, output)
+		}
+	}
 }
 
 var specialFuncsAttrs = Attributes{
@@ -315,4 +1325,269 @@ func TestInterrupt(t *testing.T) {
 	if err := <-done; err != ErrInterrupted {
 		t.Errorf("not interrupted: %v", err)
 	}
+	if state := controller.State(); state != StateDetached {
+		t.Errorf("wrong state: %v", state)
+	}
+}
+
+func TestMainLoop_PauseTracing(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	controller.SetTraceLevel(2)
+	if err := controller.LaunchTracee(testutils.ProgramInfloop, nil, infloopAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.InfloopAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+
+	// time.Sleep(1s) is called repeatedly. Pause at the first call and resume in the middle of the second call.
+	paused := false
+	enteredCalls := make(map[uint64]bool)
+	var returnedCalls []uint64
+	controller.SetOnEnter(func(event Event) {
+		if !paused && event.Function == "time.Sleep" {
+			paused = true
+			if err := controller.PauseTracing(); err != nil {
+				t.Errorf("failed to pause: %v", err)
+			}
+			time.AfterFunc(1500*time.Millisecond, func() { _ = controller.ResumeTracing() })
+		}
+		enteredCalls[event.CallID] = true
+	})
+	controller.SetOnReturn(func(event Event) {
+		returnedCalls = append(returnedCalls, event.CallID)
+	})
+
+	done := make(chan error)
+	go func(ch chan error) {
+		ch <- controller.MainLoop()
+	}(done)
+
+	time.Sleep(3500 * time.Millisecond)
+	controller.Interrupt()
+	if err := <-done; err != ErrInterrupted {
+		t.Errorf("not interrupted: %v", err)
+	}
+
+	if len(returnedCalls) == 0 {
+		t.Errorf("no return is printed after resumed")
+	}
+	for _, callID := range returnedCalls {
+		if !enteredCalls[callID] {
+			t.Errorf("the return of the call %d, which is called while paused, is printed", callID)
+		}
+	}
+}
+
+func TestBreakOnFirstHitOnly(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetBreakOnFirstHitOnly(true)
+
+	errCh := make(chan error)
+	go func() { errCh <- controller.MainLoop() }()
+
+	for i := 0; controller.State() != StatePaused; i++ {
+		if i == 100 {
+			t.Fatalf("not paused: %v", controller.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	regs, err := controller.CurrentRegisters()
+	if err != nil {
+		t.Errorf("failed to get registers: %v", err)
+	} else if regs.Rip <= testutils.HelloworldAddrMain {
+		t.Errorf("wrong pc: %#x", regs.Rip)
+	}
+	if data, err := controller.ReadMemory(regs.Rsp, 8); err != nil || len(data) != 8 {
+		t.Errorf("failed to read memory: %v", err)
+	}
+
+	if err := controller.Resume(); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+	if err := controller.Resume(); err == nil {
+		t.Errorf("error should be returned if not paused")
+	}
+}
+
+func TestReadParameter(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrOneParameterAndVariable); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetBreakOnFirstHitOnly(true)
+	controller.SetParseLevel(1)
+
+	errCh := make(chan error)
+	go func() { errCh <- controller.MainLoop() }()
+
+	for i := 0; controller.State() != StatePaused; i++ {
+		if i == 100 {
+			t.Fatalf("not paused: %v", controller.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if value, err := controller.ReadParameter("i"); err != nil {
+		t.Errorf("failed to read parameter: %v", err)
+	} else if value != "1" {
+		t.Errorf("wrong value: %s", value)
+	}
+	if _, err := controller.ReadParameter("notexist"); err == nil {
+		t.Errorf("error should be returned if the parameter doesn't exist")
+	}
+
+	if err := controller.Resume(); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+}
+
+func TestCurrentArguments(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.HelloworldAddrOneParameterAndVariable); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetBreakOnFirstHitOnly(true)
+	controller.SetParseLevel(1)
+
+	errCh := make(chan error)
+	go func() { errCh <- controller.MainLoop() }()
+
+	for i := 0; controller.State() != StatePaused; i++ {
+		if i == 100 {
+			t.Fatalf("not paused: %v", controller.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	args, err := controller.CurrentArguments()
+	if err != nil {
+		t.Errorf("failed to get the arguments: %v", err)
+	} else if len(args) != 1 || args[0].Name != "i" || args[0].Type != "int" || args[0].Value == "" {
+		t.Errorf("wrong arguments: %#v", args)
+	}
+
+	if err := controller.Resume(); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+}
+
+func TestArgument_String(t *testing.T) {
+	for i, testdata := range []struct {
+		arg      Argument
+		expected string
+	}{
+		{arg: Argument{Name: "a", Type: "int", Value: "1"}, expected: "a = 1"},
+		{arg: Argument{Value: "1"}, expected: "1"},
+	} {
+		if actual := testdata.arg.String(); actual != testdata.expected {
+			t.Errorf("[%d] wrong string: %s", i, actual)
+		}
+	}
+}
+
+func TestReadParameter_MiddleOfFunction(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	// the first fmt.Println of main.oneParameterAndOneVariable.
+	if err := controller.AddStartTracePointAtLine("helloworld.go", 22); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetBreakOnFirstHitOnly(true)
+
+	errCh := make(chan error)
+	go func() { errCh <- controller.MainLoop() }()
+
+	for i := 0; controller.State() != StatePaused; i++ {
+		if i == 100 {
+			t.Fatalf("not paused: %v", controller.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the stack pointer doesn't point to the return address here.
+	if _, err := controller.ReadParameter("i"); err == nil {
+		t.Errorf("error should be returned in the middle of the function")
+	}
+	if _, _, err := controller.CallerPC(); err == nil {
+		t.Errorf("error should be returned in the middle of the function")
+	}
+
+	if err := controller.Resume(); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	err := controller.LaunchTracee(testutils.ProgramInfloop, nil, infloopAttrs)
+	if err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if err := controller.AddStartTracePoint(testutils.InfloopAddrMain); err != nil {
+		t.Fatalf("failed to set tracing point: %v", err)
+	}
+	controller.SetMaxDuration(100 * time.Millisecond)
+
+	if err := controller.MainLoop(); err != ErrInterrupted {
+		t.Errorf("not interrupted: %v", err)
+	}
+	if state := controller.State(); state != StateDetached {
+		t.Errorf("wrong state: %v", state)
+	}
+}
+
+func TestState(t *testing.T) {
+	controller := NewController()
+	controller.outputWriter = ioutil.Discard
+	if state := controller.State(); state != StateDetached {
+		t.Errorf("wrong state before launched: %v", state)
+	}
+
+	if err := controller.LaunchTracee(testutils.ProgramHelloworld, nil, helloworldAttrs); err != nil {
+		t.Fatalf("failed to launch process: %v", err)
+	}
+	if state := controller.State(); state != StateStopped {
+		t.Errorf("wrong state after launched: %v", state)
+	}
+
+	if err := controller.MainLoop(); err != nil {
+		t.Errorf("failed to run main loop: %v", err)
+	}
+	if state := controller.State(); state != StateExited {
+		t.Errorf("wrong state after exited: %v", state)
+	}
 }
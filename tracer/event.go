@@ -0,0 +1,166 @@
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nkbai/tgo/tracee"
+)
+
+// EventSchemaVersion is the version of the Event schema. Increment it whenever the existing fields are changed
+// or removed, typically along with the service version. Adding the new optional field doesn't break the consumers
+// and so doesn't require the increment.
+const EventSchemaVersion = 1
+
+// OutputFormat is the format of the traced data.
+type OutputFormat string
+
+const (
+	// OutputFormatText is the human-readable format, such as `|\ (#01) main.f()`. It's the default.
+	OutputFormatText OutputFormat = "text"
+	// OutputFormatJSON is the format which writes one Event per line as the JSON object.
+	OutputFormatJSON OutputFormat = "json"
+	// OutputFormatTree is the human-readable format which draws the call tree like tree(1), such as `│  ├─ (#01) main.f()`.
+	OutputFormatTree OutputFormat = "tree"
+	// OutputFormatCollapsed is the collapsed stacks of the traced calls, such as `main.main;main.f 3`, which flamegraph.pl
+	// can read. The calls are aggregated and written when the main loop ends, not while tracing.
+	OutputFormatCollapsed OutputFormat = "collapsed"
+	// OutputFormatSpans is the OpenTelemetry spans of the traced calls in the OTLP/JSON encoding. See SpanExporter.
+	// The spans are written, or sent to the endpoint set by SetSpansEndpoint, when the main loop ends.
+	OutputFormatSpans OutputFormat = "spans"
+)
+
+// The kinds of the event.
+const (
+	EventKindEnter   = "enter"
+	EventKindReturn  = "return"
+	EventKindSyscall = "syscall"
+	// EventKindCgo is the call to the C function. The Function is the C function's name, such as `C.puts`.
+	EventKindCgo = "cgo"
+	// EventKindAlloc is the heap allocation. The Function is the innermost traced function which makes the allocation.
+	EventKindAlloc = "alloc"
+	// EventKindSampling is the change of the sampling ratio. No go routine or function is associated. See SetSampling.
+	EventKindSampling = "sampling"
+)
+
+// Event is the traced event written in the JSON output format. The JSON field names are the part of the schema.
+type Event struct {
+	// Version is the EventSchemaVersion the event conforms to.
+	Version int    `json:"version"`
+	Kind    string `json:"kind"`
+	// Timestamp is formatted in the layout set by SetTimestampFormat. Omitted if the timestamp is disabled.
+	Timestamp   string `json:"timestamp,omitempty"`
+	GoRoutineID int64  `json:"goroutine"`
+	// ThreadID is the OS thread which executes the go routine. Filled in only if SetPrintThreadID is enabled.
+	ThreadID int             `json:"thread_id,omitempty"`
+	Depth    int             `json:"depth"`
+	Function string          `json:"function"`
+	Args     []EventArgument `json:"args,omitempty"`
+	Deferred bool            `json:"deferred,omitempty"`
+	// CallID pairs the enter and return events of the same call. It's unique among all the go routines,
+	// so the nested and recursive calls are distinguished. Only the enter and return events have the id.
+	CallID uint64 `json:"call_id,omitempty"`
+	// PanicValue is the value the go routine is panicking with when the deferred function is called.
+	PanicValue string `json:"panic_value,omitempty"`
+	// MergedCalls is the number of the recursive calls merged into the return event. See SetMergeRecursiveCalls.
+	MergedCalls int `json:"merged_calls,omitempty"`
+	// Caller, the addresses and the go routine status are filled in only if the corresponding options are enabled.
+	Caller          string `json:"caller,omitempty"`
+	PC              uint64 `json:"pc,omitempty"`
+	ReturnAddress   uint64 `json:"return_address,omitempty"`
+	GoRoutineStatus string `json:"goroutine_status,omitempty"`
+	// DeferChain is the deferred functions the go routine has queued, from the one called first. See SetPrintDeferChain.
+	DeferChain []string `json:"defer_chain,omitempty"`
+	// AllocSize and AllocType are the size in bytes and the type name of the allocation. See SetTraceAllocations.
+	AllocSize uint64 `json:"alloc_size,omitempty"`
+	AllocType string `json:"alloc_type,omitempty"`
+	// SamplingInterval is the N of the sampling ratio, 1 in N hits.
+	SamplingInterval int `json:"sampling_interval,omitempty"`
+}
+
+// EventArgument is the argument of the traced function. The Value is in the same representation as the text format.
+type EventArgument struct {
+	Name string `json:"name,omitempty"`
+	// Type is the type name of the argument, such as `int`. Filled in only if SetPrintArgumentTypes is enabled.
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value"`
+}
+
+// ParseOutputFormat returns the output format which has the given name, such as "json".
+// It returns OutputFormatText if the name is empty.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch format := OutputFormat(name); format {
+	case "":
+		return OutputFormatText, nil
+	case OutputFormatText, OutputFormatJSON, OutputFormatTree, OutputFormatCollapsed, OutputFormatSpans:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format: %s", name)
+	}
+}
+
+// SetOutputFormat sets the format of the traced data. The default is OutputFormatText.
+func (c *Controller) SetOutputFormat(format OutputFormat) {
+	c.outputFormat = format
+	if format == OutputFormatSpans && c.spanExporter == nil {
+		c.spanExporter = NewSpanExporter("")
+	}
+}
+
+// SetSpansEndpoint sets the OTLP/HTTP endpoint, such as `http://localhost:4318/v1/traces`, to which the spans are sent
+// in the OutputFormatSpans format. The default is empty, which writes the spans to the output writer instead.
+func (c *Controller) SetSpansEndpoint(endpoint string) {
+	c.spansEndpoint = endpoint
+}
+
+// SetOnEnter sets the function called with the enter event whenever the traced function is entered,
+// regardless of the output format. The function is called in the main loop and so should not block.
+func (c *Controller) SetOnEnter(onEnter func(Event)) {
+	c.onEnter = onEnter
+}
+
+// SetOnReturn sets the function called with the return event whenever the traced function returns,
+// regardless of the output format. The event has the same CallID as the corresponding enter event.
+// The function is called in the main loop and so should not block.
+func (c *Controller) SetOnReturn(onReturn func(Event)) {
+	c.onReturn = onReturn
+}
+
+func (c *Controller) newEvent(kind string, goRoutineID int64, depth int, function *tracee.Function) Event {
+	event := Event{Version: EventSchemaVersion, Kind: kind, GoRoutineID: goRoutineID, Depth: depth, Function: function.Name}
+	if c.timestampFormat != "" {
+		event.Timestamp = time.Now().Format(c.timestampFormat)
+	}
+	if c.printThreadID {
+		event.ThreadID = c.lastTrappedThreadID
+	}
+	return event
+}
+
+func (c *Controller) eventArguments(args []tracee.Argument) []EventArgument {
+	if c.parseLevel == 0 {
+		return nil
+	}
+
+	var eventArgs []EventArgument
+	for _, arg := range args {
+		eventArg := EventArgument{Name: arg.Name}
+		if c.printArgumentTypes && arg.Typ != nil {
+			eventArg.Type = arg.Typ.String()
+		}
+		arg.Name = "" // to get only the value
+		eventArg.Value = arg.ParseValue(c.parseLevel)
+		eventArgs = append(eventArgs, eventArg)
+	}
+	return eventArgs
+}
+
+func (c *Controller) writeEvent(event Event) error {
+	buf := &c.lineBuffer
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(event); err != nil {
+		return err
+	}
+	return c.writeOutput(buf.Bytes())
+}
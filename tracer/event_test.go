@@ -0,0 +1,126 @@
+package tracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/nkbai/tgo/tracee"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	for i, testdata := range []struct {
+		name     string
+		expected OutputFormat
+	}{
+		{name: "", expected: OutputFormatText},
+		{name: "text", expected: OutputFormatText},
+		{name: "json", expected: OutputFormatJSON},
+		{name: "tree", expected: OutputFormatTree},
+		{name: "collapsed", expected: OutputFormatCollapsed},
+		{name: "spans", expected: OutputFormatSpans},
+	} {
+		actual, err := ParseOutputFormat(testdata.name)
+		if err != nil {
+			t.Errorf("[%d] failed to parse: %v", i, err)
+		} else if actual != testdata.expected {
+			t.Errorf("[%d] wrong format: %s", i, actual)
+		}
+	}
+
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Errorf("error not returned")
+	}
+}
+
+func TestPrintFunctionInput_JSON(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f", StartAddr: 0x1000}, ReturnAddress: 0x2000}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetOutputFormat(OutputFormatJSON)
+	controller.SetPrintAddresses(true)
+
+	if err := controller.printFunctionInput(1, 0, stackFrame, 2, true, nil); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	expected := `{"version":1,"kind":"enter","goroutine":1,"depth":2,"function":"main.f","deferred":true,"pc":4096,"return_address":8192}` + "\n"
+	if buff.String() != expected {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestPrintFunctionOutput_JSON(t *testing.T) {
+	// the arg panics if its value is parsed.
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f", FrameBaseIsCFA: true}, OutputArguments: []tracee.Argument{{Name: "a"}}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetOutputFormat(OutputFormatJSON)
+	controller.SetParseLevel(0)
+
+	if err := controller.printFunctionOutput(1, 0, stackFrame, 1, false, 0); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+
+	var event Event
+	if err := json.Unmarshal(buff.Bytes(), &event); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if event.Version != EventSchemaVersion || event.Kind != EventKindReturn || event.Function != "main.f" || event.Args != nil {
+		t.Errorf("unexpected event: %#v", event)
+	}
+}
+
+func TestPrintFunction_Tree(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f"}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	controller.SetOutputFormat(OutputFormatTree)
+
+	if err := controller.printFunctionInput(1, 0, stackFrame, 1, false, nil); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if err := controller.printFunctionInput(1, 0, stackFrame, 3, false, nil); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if err := controller.printFunctionOutput(1, 0, stackFrame, 3, false, 0); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	expected := "├─ (#01) main.f()\n│  │  ├─ (#01) main.f()\n│  │  └─ (#01) main.f() ()\n"
+	if buff.String() != expected {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
+
+func TestSetOnEnterOnReturn(t *testing.T) {
+	stackFrame := &tracee.StackFrame{Function: &tracee.Function{Name: "main.f"}}
+	controller := NewController()
+	buff := &bytes.Buffer{}
+	controller.outputWriter = buff
+	var events []Event
+	controller.SetOnEnter(func(event Event) { events = append(events, event) })
+	controller.SetOnReturn(func(event Event) { events = append(events, event) })
+
+	if err := controller.printFunctionInput(1, 3, stackFrame, 1, false, nil); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+	if err := controller.printFunctionOutput(1, 3, stackFrame, 1, false, 0); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("wrong number of events: %d", len(events))
+	}
+	if events[0].Kind != EventKindEnter || events[0].CallID != 3 || events[0].Function != "main.f" {
+		t.Errorf("unexpected enter event: %#v", events[0])
+	}
+	if events[1].Kind != EventKindReturn || events[1].CallID != 3 || events[1].Function != "main.f" {
+		t.Errorf("unexpected return event: %#v", events[1])
+	}
+	// the text output is not affected.
+	if buff.String() != "\\ (#01) main.f()\n/ (#01) main.f() ()\n" {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
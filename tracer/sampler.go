@@ -0,0 +1,63 @@
+package tracer
+
+import "time"
+
+// sampler decides which hits of the start trace points are traced. 1 in `interval` hits is traced and the interval is
+// adjusted at the end of each period based on the hit rate, so that the traced hits per period don't exceed the target.
+type sampler struct {
+	// maxTracedHits is the max number of the traced hits per period. 0 means all the hits are traced.
+	maxTracedHits int
+	period        time.Duration
+	interval      int
+	// skippedHits is the number of the hits skipped since the last traced hit.
+	skippedHits int
+	periodStart time.Time
+	// periodHits and periodTracedHits are the number of all the hits and the traced hits in the current period.
+	periodHits       int
+	periodTracedHits int
+	// now returns the current time. Replaced in the tests.
+	now func() time.Time
+}
+
+// Sample returns true if the hit should be traced.
+func (s *sampler) Sample() bool {
+	if s.maxTracedHits <= 0 {
+		return true
+	}
+
+	now := s.now()
+	if s.periodStart.IsZero() {
+		s.periodStart = now
+		s.interval = 1
+	} else if now.Sub(s.periodStart) >= s.period {
+		s.adjust()
+		s.periodStart = now
+	}
+
+	s.periodHits++
+	if s.skippedHits+1 < s.interval || s.periodTracedHits >= s.maxTracedHits {
+		s.skippedHits++
+		return false
+	}
+	s.skippedHits = 0
+	s.periodTracedHits++
+	return true
+}
+
+// adjust updates the interval so that the hits at the last period's rate are traced up to the max.
+func (s *sampler) adjust() {
+	s.interval = (s.periodHits + s.maxTracedHits - 1) / s.maxTracedHits
+	if s.interval < 1 {
+		s.interval = 1
+	}
+	s.periodHits = 0
+	s.periodTracedHits = 0
+}
+
+// Interval returns the current sampling interval, that is, 1 in the interval hits is traced.
+func (s *sampler) Interval() int {
+	if s.interval < 1 {
+		return 1
+	}
+	return s.interval
+}
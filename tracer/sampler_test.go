@@ -0,0 +1,54 @@
+package tracer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampler_Disabled(t *testing.T) {
+	s := sampler{}
+	for i := 0; i < 10; i++ {
+		if !s.Sample() {
+			t.Fatalf("[%d] hit is skipped though the sampling is disabled", i)
+		}
+	}
+}
+
+func TestSampler_AdjustInterval(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := sampler{maxTracedHits: 2, period: time.Second, now: func() time.Time { return now }}
+
+	// the first period traces up to the max.
+	var traced int
+	for i := 0; i < 8; i++ {
+		if s.Sample() {
+			traced++
+		}
+	}
+	if traced != 2 {
+		t.Errorf("wrong number of traced hits: %d", traced)
+	}
+
+	// the next period traces 1 in 4 hits, based on the last period's 8 hits.
+	now = now.Add(time.Second)
+	traced = 0
+	for i := 0; i < 8; i++ {
+		if s.Sample() {
+			traced++
+		}
+	}
+	if s.Interval() != 4 || traced != 2 {
+		t.Errorf("wrong sampling: interval %d, traced %d", s.Interval(), traced)
+	}
+
+	// the interval goes back as the hit rate drops.
+	now = now.Add(time.Second)
+	s.Sample()
+	if s.Interval() != 4 {
+		t.Errorf("wrong interval: %d", s.Interval())
+	}
+	now = now.Add(time.Second)
+	if !s.Sample() || s.Interval() != 1 {
+		t.Errorf("wrong interval: %d", s.Interval())
+	}
+}
@@ -0,0 +1,234 @@
+package tracer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// spanKindInternal is the OTLP span kind of the traced calls, which are neither the remote calls nor the messages.
+const spanKindInternal = 1
+
+// defaultSpanServiceName is the service.name resource attribute used if the service name is empty.
+const defaultSpanServiceName = "tgo"
+
+// SpanExporter converts the traced calls into the OpenTelemetry spans and exports them in the OTLP/JSON encoding.
+// The span is named after the function and its attributes are the go routine id, the arguments (`arg.<name>`)
+// and the results (`result.<name>`). The calls in the same go routine are nested by the depth and the outermost call
+// starts the new trace.
+//
+// Pass its OnEnter and OnReturn methods to Controller.SetOnEnter and Controller.SetOnReturn, or use OutputFormatSpans.
+// The methods are not safe for the concurrent use, which is fine with the callbacks called in the main loop.
+type SpanExporter struct {
+	serviceName string
+	// openSpans is the spans each go routine has entered but not returned, from the outermost one.
+	openSpans map[int64][]*span
+	spans     []*span
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+type span struct {
+	traceID, spanID, parentSpanID string
+	callID                        uint64
+	name                          string
+	start, end                    time.Time
+	attributes                    []spanAttribute
+}
+
+type spanAttribute struct {
+	Key   string             `json:"key"`
+	Value spanAttributeValue `json:"value"`
+}
+
+// spanAttributeValue is the AnyValue of OTLP. The int value is the string as the protobuf JSON mapping encodes int64.
+type spanAttributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    string  `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+// NewSpanExporter returns the new exporter. The serviceName is the service.name resource attribute.
+// "tgo" is used if it's empty.
+func NewSpanExporter(serviceName string) *SpanExporter {
+	if serviceName == "" {
+		serviceName = defaultSpanServiceName
+	}
+	return &SpanExporter{serviceName: serviceName, openSpans: make(map[int64][]*span), now: time.Now}
+}
+
+// OnEnter starts the span of the call. The calls deeper than or at the same depth in the go routine have ended,
+// for example, due to the panic, and so their spans end here.
+func (e *SpanExporter) OnEnter(event Event) {
+	now := e.now()
+	stack := e.openSpans[event.GoRoutineID]
+	for len(stack) > 0 && len(stack) >= event.Depth {
+		stack[len(stack)-1].end = now
+		stack = stack[:len(stack)-1]
+	}
+
+	s := &span{spanID: randomHexID(8), callID: event.CallID, name: event.Function, start: now}
+	if len(stack) > 0 {
+		parent := stack[len(stack)-1]
+		s.traceID, s.parentSpanID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomHexID(16)
+	}
+	s.attributes = append(s.attributes, spanAttribute{Key: "goroutine.id", Value: intAttributeValue(event.GoRoutineID)})
+	if event.Deferred {
+		s.attributes = append(s.attributes, spanAttribute{Key: "deferred", Value: boolAttributeValue(true)})
+	}
+	s.attributes = appendArgumentAttributes(s.attributes, "arg.", event.Args)
+
+	e.openSpans[event.GoRoutineID] = append(stack, s)
+	e.spans = append(e.spans, s)
+}
+
+// OnReturn ends the span which has the same CallID as the event. The spans inside it, whose returns are not traced,
+// end at the same time. The return is ignored if the call's entry is not traced.
+func (e *SpanExporter) OnReturn(event Event) {
+	stack := e.openSpans[event.GoRoutineID]
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].callID != event.CallID {
+			continue
+		}
+
+		now := e.now()
+		for _, s := range stack[i:] {
+			s.end = now
+		}
+		stack[i].attributes = appendArgumentAttributes(stack[i].attributes, "result.", event.Args)
+		e.openSpans[event.GoRoutineID] = stack[:i]
+		return
+	}
+}
+
+func appendArgumentAttributes(attrs []spanAttribute, prefix string, args []EventArgument) []spanAttribute {
+	for i, arg := range args {
+		name := arg.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		attrs = append(attrs, spanAttribute{Key: prefix + name, Value: stringAttributeValue(arg.Value)})
+	}
+	return attrs
+}
+
+func stringAttributeValue(value string) spanAttributeValue {
+	return spanAttributeValue{StringValue: &value}
+}
+
+func intAttributeValue(value int64) spanAttributeValue {
+	return spanAttributeValue{IntValue: strconv.FormatInt(value, 10)}
+}
+
+func boolAttributeValue(value bool) spanAttributeValue {
+	return spanAttributeValue{BoolValue: &value}
+}
+
+func randomHexID(size int) string {
+	id := make([]byte, size)
+	if _, err := rand.Read(id); err != nil {
+		// the id is only required to be unique in practice, and all zeros is invalid in OTLP.
+		binary.BigEndian.PutUint64(id[len(id)-8:], uint64(time.Now().UnixNano()))
+	}
+	return hex.EncodeToString(id)
+}
+
+// The types below are the subset of the OTLP ExportTraceServiceRequest in the JSON encoding.
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []spanAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []spanAttribute `json:"attributes,omitempty"`
+}
+
+// request returns the export request of all the spans. The spans not ended yet end now.
+func (e *SpanExporter) request() otlpTraceRequest {
+	now := e.now()
+	spans := make([]otlpSpan, 0, len(e.spans))
+	for _, s := range e.spans {
+		end := s.end
+		if end.IsZero() {
+			end = now
+		}
+		spans = append(spans, otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentSpanID,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+			Attributes:        s.attributes,
+		})
+	}
+
+	resource := otlpResource{Attributes: []spanAttribute{{Key: "service.name", Value: stringAttributeValue(e.serviceName)}}}
+	scopeSpans := otlpScopeSpans{Scope: otlpScope{Name: "tgo"}, Spans: spans}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{Resource: resource, ScopeSpans: []otlpScopeSpans{scopeSpans}}}}
+}
+
+// WriteTo writes all the spans as one OTLP/JSON ExportTraceServiceRequest in one line, which the OpenTelemetry
+// collector's file receiver and otlpjsonfile can read.
+func (e *SpanExporter) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(e.request()); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// Export sends all the spans to the OTLP/HTTP endpoint, such as `http://localhost:4318/v1/traces`, in the JSON encoding.
+func (e *SpanExporter) Export(endpoint string) error {
+	var buf bytes.Buffer
+	if _, err := e.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	resp, err := http.Post(endpoint, "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to export the spans: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package tracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestSpanExporter() *SpanExporter {
+	exporter := NewSpanExporter("")
+	var tick int64
+	exporter.now = func() time.Time {
+		tick++
+		return time.Unix(0, tick)
+	}
+	return exporter
+}
+
+func TestSpanExporter(t *testing.T) {
+	exporter := newTestSpanExporter()
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 1, Function: "main.main", CallID: 1})
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 2, Function: "main.f", CallID: 2, Args: []EventArgument{{Name: "a", Value: "1"}}})
+	exporter.OnReturn(Event{GoRoutineID: 1, Depth: 2, Function: "main.f", CallID: 2, Args: []EventArgument{{Name: "~r0", Value: "2"}}})
+	exporter.OnEnter(Event{GoRoutineID: 2, Depth: 1, Function: "main.g", CallID: 3})
+
+	req := exporter.request()
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request: %#v", req)
+	}
+	if attr := req.ResourceSpans[0].Resource.Attributes[0]; attr.Key != "service.name" || *attr.Value.StringValue != "tgo" {
+		t.Errorf("wrong resource attribute: %#v", attr)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("wrong number of spans: %d", len(spans))
+	}
+
+	main, f, g := spans[0], spans[1], spans[2]
+	if main.Name != "main.main" || main.ParentSpanID != "" || len(main.TraceID) != 32 || len(main.SpanID) != 16 {
+		t.Errorf("wrong root span: %#v", main)
+	}
+	if main.EndTimeUnixNano != "5" {
+		t.Errorf("span not ended at the export: %s", main.EndTimeUnixNano)
+	}
+	if f.TraceID != main.TraceID || f.ParentSpanID != main.SpanID {
+		t.Errorf("wrong parent: %#v", f)
+	}
+	if f.StartTimeUnixNano != "2" || f.EndTimeUnixNano != "3" {
+		t.Errorf("wrong times: %s, %s", f.StartTimeUnixNano, f.EndTimeUnixNano)
+	}
+	if len(f.Attributes) != 3 || f.Attributes[0].Key != "goroutine.id" || f.Attributes[0].Value.IntValue != "1" ||
+		f.Attributes[1].Key != "arg.a" || *f.Attributes[1].Value.StringValue != "1" ||
+		f.Attributes[2].Key != "result.~r0" || *f.Attributes[2].Value.StringValue != "2" {
+		t.Errorf("wrong attributes: %#v", f.Attributes)
+	}
+	if g.TraceID == main.TraceID || g.ParentSpanID != "" {
+		t.Errorf("the other go routine's span is in the same trace: %#v", g)
+	}
+}
+
+func TestSpanExporter_UnwoundCalls(t *testing.T) {
+	exporter := newTestSpanExporter()
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 1, Function: "main.main", CallID: 1})
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 2, Function: "main.f", CallID: 2})
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 3, Function: "main.g", CallID: 3})
+	// main.f and main.g returned without the return events, for example, due to the panic.
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 2, Function: "main.h", CallID: 4})
+	exporter.OnReturn(Event{GoRoutineID: 1, Depth: 1, Function: "main.main", CallID: 1})
+	exporter.OnReturn(Event{GoRoutineID: 1, Depth: 1, Function: "main.unknown", CallID: 5})
+
+	spans := exporter.request().ResourceSpans[0].ScopeSpans[0].Spans
+	if spans[1].EndTimeUnixNano != "4" || spans[2].EndTimeUnixNano != "4" {
+		t.Errorf("wrong end times: %s, %s", spans[1].EndTimeUnixNano, spans[2].EndTimeUnixNano)
+	}
+	if spans[3].ParentSpanID != spans[0].SpanID {
+		t.Errorf("wrong parent: %#v", spans[3])
+	}
+	if spans[0].EndTimeUnixNano != "5" || spans[3].EndTimeUnixNano != "5" {
+		t.Errorf("wrong end times: %s, %s", spans[0].EndTimeUnixNano, spans[3].EndTimeUnixNano)
+	}
+}
+
+func TestSpanExporter_Export(t *testing.T) {
+	var received otlpTraceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	exporter := newTestSpanExporter()
+	exporter.OnEnter(Event{GoRoutineID: 1, Depth: 1, Function: "main.main", CallID: 1})
+	if err := exporter.Export(server.URL + "/v1/traces"); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if len(received.ResourceSpans) != 1 || received.ResourceSpans[0].ScopeSpans[0].Spans[0].Name != "main.main" {
+		t.Errorf("unexpected request: %#v", received)
+	}
+
+	if err := exporter.Export(server.URL + "/unknown"); err == nil {
+		t.Errorf("error not returned")
+	}
+}
+
+func TestSpanExporter_WriteTo(t *testing.T) {
+	exporter := newTestSpanExporter()
+	buff := &bytes.Buffer{}
+	if _, err := exporter.WriteTo(buff); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	expected := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"tgo"}}]},"scopeSpans":[{"scope":{"name":"tgo"},"spans":[]}]}]}` + "\n"
+	if buff.String() != expected {
+		t.Errorf("unexpected output: %s", buff.String())
+	}
+}
@@ -6,6 +6,72 @@ type tracingPoints struct {
 	startAddressList []uint64
 	endAddressList   []uint64
 	goRoutinesInside []int64
+	// rangeStartDepths is the used stack sizes at which each go routine entered the tracing ranges.
+	// The ranges may overlap or nest. See Exit for which end point closes the range.
+	rangeStartDepths map[int64][]uint64
+	// remainingHits is the number of times the start address can be hit. No limit if the address is not in the map.
+	remainingHits map[uint64]int
+	// callerFilters is the name of the function which must call the start address's function. No filter if the address is not in the map.
+	callerFilters map[uint64]string
+}
+
+// SetHitLimit sets the number of times the start address can be hit. 0 means no limit.
+func (p *tracingPoints) SetHitLimit(startAddr uint64, limit int) {
+	if limit <= 0 {
+		delete(p.remainingHits, startAddr)
+		return
+	}
+
+	if p.remainingHits == nil {
+		p.remainingHits = make(map[uint64]int)
+	}
+	p.remainingHits[startAddr] = limit
+}
+
+// Hit decrements the remaining hits of the start address. It returns true if the hit limit is reached.
+func (p *tracingPoints) Hit(startAddr uint64) bool {
+	remainingHits, ok := p.remainingHits[startAddr]
+	if !ok {
+		return false
+	}
+
+	remainingHits--
+	if remainingHits > 0 {
+		p.remainingHits[startAddr] = remainingHits
+		return false
+	}
+	delete(p.remainingHits, startAddr)
+	return true
+}
+
+// SetCallerFilter sets the caller function the go routine must be called from to start the tracing at the start address.
+// The empty name means no filter.
+func (p *tracingPoints) SetCallerFilter(startAddr uint64, caller string) {
+	if caller == "" {
+		delete(p.callerFilters, startAddr)
+		return
+	}
+
+	if p.callerFilters == nil {
+		p.callerFilters = make(map[uint64]string)
+	}
+	p.callerFilters[startAddr] = caller
+}
+
+// CallerFilter returns the caller function set by SetCallerFilter. Returns the empty string if no filter.
+func (p *tracingPoints) CallerFilter(startAddr uint64) string {
+	return p.callerFilters[startAddr]
+}
+
+// RemoveStartAddress removes the start address from the list.
+func (p *tracingPoints) RemoveStartAddress(startAddr uint64) {
+	for i, addr := range p.startAddressList {
+		if addr == startAddr {
+			p.startAddressList = append(p.startAddressList[0:i], p.startAddressList[i+1:]...)
+			delete(p.callerFilters, startAddr)
+			return
+		}
+	}
 }
 
 // IsStartAddress returns true if the addr is same as the start address.
@@ -29,8 +95,14 @@ func (p *tracingPoints) IsEndAddress(addr uint64) bool {
 }
 
 // Enter updates the list of the go routines which are inside the tracing point.
-// It does nothing if the go routine has already entered.
-func (p *tracingPoints) Enter(goRoutineID int64) {
+// If the go routine has already entered, it enters the nested tracing range.
+// `usedStackSize` is the used stack size of the go routine at the start point.
+func (p *tracingPoints) Enter(goRoutineID int64, usedStackSize uint64) {
+	if p.rangeStartDepths == nil {
+		p.rangeStartDepths = make(map[int64][]uint64)
+	}
+	p.rangeStartDepths[goRoutineID] = append(p.rangeStartDepths[goRoutineID], usedStackSize)
+
 	for _, existingGoRoutine := range p.goRoutinesInside {
 		if existingGoRoutine == goRoutineID {
 			return
@@ -42,9 +114,40 @@ func (p *tracingPoints) Enter(goRoutineID int64) {
 	return
 }
 
-// Exit clears the inside go routines list.
-func (p *tracingPoints) Exit(goRoutineID int64) {
+// Exit exits the tracing ranges which the end point hit at `usedStackSize` closes. It's the ranges started
+// in the deeper frames, that is, the functions which have returned. The ranges started in the same frame
+// are not closed, so the end point of the nested range doesn't close the outer range.
+// If the end point is the beginning of the function, such as tracer.Stop, the ranges started in its caller's frame
+// are closed too. The used stack size there includes the return address the call pushed.
+// It returns true if the go routine exits the outermost range and so is removed from the inside go routines list.
+func (p *tracingPoints) Exit(goRoutineID int64, usedStackSize uint64, atFunctionEntry bool) bool {
+	const returnAddressSize = 8
+	closes := func(startDepth uint64) bool {
+		if atFunctionEntry {
+			return startDepth+returnAddressSize >= usedStackSize
+		}
+		return startDepth > usedStackSize
+	}
+
+	var remaining []uint64
+	for _, startDepth := range p.rangeStartDepths[goRoutineID] {
+		if !closes(startDepth) {
+			remaining = append(remaining, startDepth)
+		}
+	}
+	if len(remaining) > 0 {
+		p.rangeStartDepths[goRoutineID] = remaining
+		return false
+	}
+
+	p.ExitAll(goRoutineID)
+	return true
+}
+
+// ExitAll exits all the tracing ranges the go routine is inside.
+func (p *tracingPoints) ExitAll(goRoutineID int64) {
 	log.Debugf("End tracing of go routine #%d", goRoutineID)
+	delete(p.rangeStartDepths, goRoutineID)
 	for i, existingGoRoutine := range p.goRoutinesInside {
 		if existingGoRoutine == goRoutineID {
 			p.goRoutinesInside = append(p.goRoutinesInside[0:i], p.goRoutinesInside[i+1:]...)
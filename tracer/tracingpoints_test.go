@@ -5,13 +5,121 @@ import "testing"
 func TestTracingPoints_EnterAndExit(t *testing.T) {
 	points := tracingPoints{}
 	var id int64 = 1
-	points.Enter(id)
+	points.Enter(id, 0x100)
 	if !points.Inside(id) {
 		t.Errorf("go routine id %d is not traced", id)
 	}
 
-	points.Exit(1)
+	points.Exit(1, 0x80, false)
 	if points.Inside(id) {
 		t.Errorf("go routine id %d is still traced", id)
 	}
 }
+
+func TestTracingPoints_Hit(t *testing.T) {
+	points := tracingPoints{}
+	if points.Hit(0x100) {
+		t.Errorf("limit is reached though no limit is set")
+	}
+
+	points.SetHitLimit(0x100, 2)
+	if points.Hit(0x100) {
+		t.Errorf("limit is reached at the first hit")
+	}
+	if !points.Hit(0x100) {
+		t.Errorf("limit is not reached at the second hit")
+	}
+}
+
+func TestTracingPoints_CallerFilter(t *testing.T) {
+	points := tracingPoints{startAddressList: []uint64{0x100}}
+	points.SetCallerFilter(0x100, "main.handler")
+	if points.CallerFilter(0x100) != "main.handler" {
+		t.Errorf("unexpected caller filter: %s", points.CallerFilter(0x100))
+	}
+
+	points.RemoveStartAddress(0x100)
+	if points.CallerFilter(0x100) != "" {
+		t.Errorf("caller filter is not removed: %s", points.CallerFilter(0x100))
+	}
+}
+
+func TestTracingPoints_NestedRanges(t *testing.T) {
+	points := tracingPoints{}
+	var id int64 = 1
+	points.Enter(id, 0x100) // outer range
+	points.Enter(id, 0x200) // inner range in the function the outer range's function calls
+
+	// the end point of the inner range, hit after the inner range's function returns.
+	if points.Exit(id, 0x100, false) {
+		t.Errorf("exited the outermost range at the end of the inner range")
+	}
+	if !points.Inside(id) {
+		t.Errorf("go routine id %d is not traced after the inner range ends", id)
+	}
+	// the end point hit twice, like the one of the inner range called in the loop, doesn't close the outer range.
+	if points.Exit(id, 0x100, false) {
+		t.Errorf("exited the outermost range at the end point of the inner range")
+	}
+
+	if !points.Exit(id, 0x80, false) {
+		t.Errorf("not exited the outermost range")
+	}
+	if points.Inside(id) {
+		t.Errorf("go routine id %d is still traced", id)
+	}
+}
+
+func TestTracingPoints_OverlappedRanges(t *testing.T) {
+	points := tracingPoints{}
+	var id, otherID int64 = 1, 2
+	points.Enter(id, 0x100)      // range A starts
+	points.Enter(otherID, 0x100) // the other go routine is not affected
+	points.Enter(id, 0x100)      // range B starts in the same frame before range A ends
+
+	points.Exit(id, 0x200, false) // the end point in the deeper frame closes no range
+	if !points.Inside(id) {
+		t.Errorf("go routine id %d is not traced though no range is ended", id)
+	}
+
+	points.Exit(id, 0x80, false) // the function which started range A and B returns
+	if points.Inside(id) {
+		t.Errorf("go routine id %d is still traced", id)
+	}
+	if !points.Inside(otherID) {
+		t.Errorf("go routine id %d is not traced", otherID)
+	}
+}
+
+func TestTracingPoints_ExitAtFunctionEntry(t *testing.T) {
+	points := tracingPoints{}
+	var id int64 = 1
+	points.Enter(id, 0x100)
+	points.Enter(id, 0x200)
+
+	// like tracer.Stop, the function called in the inner range's frame.
+	if points.Exit(id, 0x208, true) {
+		t.Errorf("exited the outermost range at the function called in the inner range")
+	}
+	// the function called in the outer range's frame.
+	if !points.Exit(id, 0x108, true) {
+		t.Errorf("not exited the outermost range")
+	}
+}
+
+func TestTracingPoints_ExitAll(t *testing.T) {
+	points := tracingPoints{}
+	var id int64 = 1
+	points.Enter(id, 0x100)
+	points.Enter(id, 0x200)
+
+	points.ExitAll(id)
+	if points.Inside(id) {
+		t.Errorf("go routine id %d is still traced", id)
+	}
+
+	points.Enter(id, 0x200)
+	if !points.Exit(id, 0x100, false) {
+		t.Errorf("the ranges are not reset")
+	}
+}